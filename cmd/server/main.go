@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 
+	"github.com/mylxsw/n8n-parallels/internal/auth"
 	"github.com/mylxsw/n8n-parallels/internal/config"
 	"github.com/mylxsw/n8n-parallels/internal/handler"
 	"github.com/mylxsw/n8n-parallels/internal/logger"
 	"github.com/mylxsw/n8n-parallels/internal/service"
+	"github.com/mylxsw/n8n-parallels/internal/tracing"
 )
 
 func main() {
@@ -28,33 +34,170 @@ func main() {
 	}
 
 	// Initialize logger
-	log := logger.New(cfg.Logger)
+	log, leveler, err := logger.NewLeveled(cfg.Logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 	
 	log.Info("Starting N8n Parallels Server",
 		"version", "1.0.0",
 		"port", cfg.Server.Port,
 		"host", cfg.Server.Host,
 		"log_level", cfg.Logger.Level,
-		"log_format", cfg.Logger.Format)
+		"log_format", cfg.Logger.Format,
+		"log_output", cfg.Logger.Output)
+
+	// Export spans of executions if an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Tracing.Endpoint != "" {
+		log.Info("Tracing enabled",
+			"endpoint", cfg.Tracing.Endpoint,
+			"service_name", cfg.Tracing.ServiceName,
+			"sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	var redisClient *redis.Client
+	if cfg.Execution.ConcurrencyGroupBackend == "redis" || cfg.Execution.QueueBackend == "redis" || cfg.Execution.ReplicaURL != "" {
+		redisClient, err = newRedisClient(cfg.Redis.URL)
+		if err != nil {
+			log.Error("Failed to connect to redis", "error", err)
+			os.Exit(1)
+		}
+		defer redisClient.Close()
+	}
+
+	// Initialize concurrency groups
+	groups := service.NewLocalGroupSemaphore(cfg.Execution.ConcurrencyGroupLimit, cfg.Execution.ConcurrencyGroupLimits)
+	if cfg.Execution.ConcurrencyGroupBackend == "redis" {
+		groups = service.NewRedisGroupSemaphore(redisClient, cfg.Redis.KeyPrefix,
+			cfg.Execution.ConcurrencyGroupLimit, cfg.Execution.ConcurrencyGroupLimits,
+			time.Duration(cfg.Execution.ConcurrencyGroupLeaseTTL)*time.Second, log)
+	}
+
+	// Asynchronous executions are queued in redis if configured, so they survive restarts
+	var queue service.ExecutionQueue
+	if cfg.Execution.QueueBackend == "redis" {
+		queue = service.NewRedisExecutionQueue(redisClient, cfg.Redis.KeyPrefix,
+			time.Duration(cfg.Execution.QueueLeaseTTL)*time.Second, time.Duration(cfg.Execution.QueueTTL)*time.Second, log)
+	}
 
 	// Initialize services
-	webhookService := service.NewWebhookService(log)
+	store := service.NewMemoryExecutionStore(time.Duration(cfg.Execution.AsyncResultTTL) * time.Second)
+	if cfg.Execution.ExecutionStore == "sqlite" {
+		store, err = service.NewSQLiteExecutionStore(cfg.Execution.ExecutionStorePath,
+			time.Duration(cfg.Execution.ExecutionStoreRetention)*24*time.Hour,
+			int64(cfg.Execution.ExecutionStoreMaxSize)<<20,
+			time.Duration(cfg.Execution.ExecutionStoreCleanupInterval)*time.Second,
+			cfg.Execution.ExecutionArchiveDir, time.Duration(cfg.Execution.ExecutionArchiveAfter)*24*time.Hour, log)
+		if err != nil {
+			log.Error("Failed to open execution store", "error", err)
+			os.Exit(1)
+		}
+	}
+	webhookService := service.NewWebhookService(cfg.Execution, groups, store, queue, log)
+	// Replicas forward reads of executions recorded by another one, claims outlast the records
+	if cfg.Execution.ReplicaURL != "" {
+		ownerTTL := time.Duration(cfg.Execution.AsyncResultTTL) * time.Second
+		if cfg.Execution.ExecutionStore == "sqlite" {
+			// 0 keeps the claims as long as the records, forever
+			ownerTTL = time.Duration(cfg.Execution.ExecutionStoreRetention) * 24 * time.Hour
+		}
+		webhookService.SetExecutionOwners(service.NewRedisExecutionOwners(redisClient, cfg.Redis.KeyPrefix, cfg.Execution.ReplicaURL, ownerTTL))
+		log.Info("Forwarding reads of executions recorded by other replicas", "replica_url", cfg.Execution.ReplicaURL)
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	if queue != nil {
+		go func() {
+			defer close(workersDone)
+			webhookService.RunWorkers(workersCtx, cfg.Execution.QueueWorkers)
+		}()
+	} else {
+		close(workersDone)
+	}
+	// Callbacks which were pending when the server stopped are delivered again, until shutdown
+	go webhookService.ResumeCallbacks(workersCtx)
 	
 	// Initialize handlers
-	parallelHandler := handler.NewParallelHandler(webhookService, log)
+	parallelHandler := handler.NewParallelHandler(webhookService, cfg.Execution, log)
+	adminHandler := handler.NewAdminHandler(leveler, log)
 
 	// Setup routes
 	router := mux.NewRouter()
 	
 	// API routes
 	apiRouter := router.PathPrefix("/v1").Subrouter()
+	if cfg.Auth.Enabled() {
+		apiRouter.Use(parallelHandler.JWTMiddleware(auth.NewJWTVerifier(cfg.Auth)))
+		log.Info("JWT authentication enabled",
+			"hs256", cfg.Auth.JWTSecret != "",
+			"jwks_url", cfg.Auth.JWTJWKSURL)
+	}
+	// Callers are limited before signatures are checked, so floods don't get their bodies read
+	if cfg.Execution.RateLimitRequests > 0 {
+		apiRouter.Use(parallelHandler.RateLimitMiddleware)
+		log.Info("Request rate limit enabled",
+			"requests_per_minute", cfg.Execution.RateLimitRequests)
+	}
+	if cfg.Auth.SigningSecret != "" {
+		apiRouter.Use(parallelHandler.SignatureMiddleware(cfg.Auth))
+		log.Info("Request signature verification enabled",
+			"tolerance_seconds", cfg.Auth.SigningTolerance)
+	}
+	if cfg.Execution.ReplicaURL != "" {
+		apiRouter.Use(parallelHandler.ReplicaMiddleware)
+	}
 	apiRouter.HandleFunc("/parallels/execute", parallelHandler.Execute).Methods("POST")
+	apiRouter.HandleFunc("/parallels/bulk", parallelHandler.Bulk).Methods("POST")
+	apiRouter.HandleFunc("/parallels/ws", parallelHandler.ExecuteWebSocket).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions", parallelHandler.ListExecutions).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions/search", parallelHandler.SearchExecutions).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions/{id}", parallelHandler.GetExecution).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions/{id}", parallelHandler.CancelExecution).Methods("DELETE")
+	apiRouter.HandleFunc("/parallels/executions/{id}/stream", parallelHandler.StreamExecution).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions/{id}/results", parallelHandler.ExecutionResults).Methods("GET")
+	apiRouter.HandleFunc("/parallels/executions/{id}/restore", parallelHandler.RestoreExecution).Methods("POST")
+	apiRouter.HandleFunc("/parallels/jobs", parallelHandler.ListJobs).Methods("GET")
+	apiRouter.HandleFunc("/parallels/jobs/{id}", parallelHandler.GetJob).Methods("GET")
+	apiRouter.HandleFunc("/parallels/jobs/{id}/log", parallelHandler.JobLog).Methods("GET")
+	apiRouter.HandleFunc("/parallels/jobs/{id}/pause", parallelHandler.PauseJob).Methods("POST")
+	apiRouter.HandleFunc("/parallels/jobs/{id}/resume", parallelHandler.ResumeJob).Methods("POST")
+	apiRouter.HandleFunc("/parallels/jobs/{id}/continue", parallelHandler.ContinueJob).Methods("POST")
+	apiRouter.HandleFunc("/targets/check", parallelHandler.CheckTarget).Methods("GET")
+
+	// Admin endpoints change the server itself, they need the admin token on top of API credentials
+	if !handler.RegisterAdminRoutes(apiRouter, cfg.Auth.AdminToken, adminHandler, parallelHandler) {
+		log.Info("Admin endpoints disabled, ADMIN_TOKEN is not set")
+	}
 	
 	// Health check endpoint
 	router.HandleFunc("/health", parallelHandler.Health).Methods("GET")
+
+	// Public key of signed results, outside of /v1 so consumers verify without credentials
+	router.HandleFunc("/.well-known/jwks.json", parallelHandler.SigningKeys).Methods("GET")
+	if signer := webhookService.ResultSigner(); signer != nil {
+		log.Info("Result signing enabled", "key_id", signer.KeyID())
+	}
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/health", http.StatusFound)
 	}).Methods("GET")
+	allowPreflights(router)
+
+	// Resolve client addresses behind trusted proxies, validated above
+	trustedProxies, _ := cfg.Server.TrustedProxyPrefixes()
+	router.Use(handler.ClientIPMiddleware(trustedProxies))
+
+	// Identify every request in the logs, the response and optionally the webhook calls
+	router.Use(handler.RequestIDMiddleware)
+
+	// Continue the trace of the caller, e.g. an n8n workflow, with a span per API request
+	router.Use(handler.TracingMiddleware)
 
 	// Add logging middleware
 	router.Use(parallelHandler.LoggingMiddleware)
@@ -62,6 +205,9 @@ func main() {
 	// Add CORS middleware for cross-origin requests
 	router.Use(corsMiddleware)
 
+	// Add configured response headers, e.g. for gateways routing on them
+	router.Use(responseHeadersMiddleware(cfg.Server.ResponseHeaders, cfg.Server.EchoRequestHeaders))
+
 	// Setup HTTP server
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
@@ -70,10 +216,44 @@ func main() {
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 	}
 
+	// TLS is terminated by the server itself if a certificate is configured, renewed
+	// certificates are picked up without a restart
+	certCtx, stopCertWatch := context.WithCancel(context.Background())
+	defer stopCertWatch()
+	if cfg.Server.TLSEnabled() {
+		certs, err := newCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, log)
+		if err != nil {
+			log.Error("Failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		server.TLSConfig = &tls.Config{
+			GetCertificate: certs.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+		go certs.watch(certCtx)
+		log.Info("TLS enabled", "cert_file", cfg.Server.TLSCertFile, "not_after", certs.notAfter())
+	}
+
+	// Profiling handlers listen on a port of their own, so they are never exposed with the API
+	var pprofServer *http.Server
+	if cfg.Server.PprofPort != 0 {
+		pprofServer = newPprofServer(fmt.Sprintf("%s:%d", cfg.Server.PprofHost, cfg.Server.PprofPort))
+		go func() {
+			log.Info("pprof server starting", "addr", pprofServer.Addr)
+			if err := pprofServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("pprof server failed", "error", err)
+			}
+		}()
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Info("HTTP server starting", "addr", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Info("HTTP server starting", "addr", server.Addr, "tls", server.TLSConfig != nil)
+		serve := server.ListenAndServe
+		if server.TLSConfig != nil {
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			log.Error("HTTP server failed to start", "error", err)
 			os.Exit(1)
 		}
@@ -93,27 +273,111 @@ func main() {
 	defer cancel()
 
 	// Attempt to gracefully shutdown the server
+	stopWorkers()
+	if pprofServer != nil {
+		pprofServer.Close()
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		log.Error("Server forced to shutdown", "error", err)
 		os.Exit(1)
 	}
 
+	// Queued executions cut short are handed out again once their lease expired
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		log.Warn("Shutdown timeout reached with queued executions still running")
+	}
+
+	// Spans still buffered are exported before exiting
+	if err := shutdownTracing(ctx); err != nil {
+		log.Warn("Failed to flush pending spans", "error", err)
+	}
+
 	log.Info("Server shutdown complete")
 }
 
+// newRedisClient connects to redis and verifies the connection
+func newRedisClient(url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	return client, nil
+}
+
+// newPprofServer serves the net/http/pprof handlers, e.g. /debug/pprof/goroutine?debug=2
+func newPprofServer(addr string) *http.Server {
+	routes := http.NewServeMux()
+	routes.HandleFunc("/debug/pprof/", pprof.Index)
+	routes.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	routes.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	routes.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	routes.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// CPU profiles and traces run for the requested seconds, there is no write timeout
+	return &http.Server{
+		Addr:              addr,
+		Handler:           routes,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
 // corsMiddleware adds CORS headers to responses
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join([]string{
+			"Content-Type", "Authorization", "If-None-Match", service.HeaderRequestID,
+			handler.HeaderSignature, handler.HeaderSignatureTimestamp, handler.HeaderSignatureNonce,
+		}, ", "))
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 
 		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
+}
+
+// allowPreflights routes OPTIONS requests of every path, mux would answer them with 405 before
+// any middleware ran otherwise. The router's middlewares, corsMiddleware among them, answer them;
+// those of subrouters, e.g. authentication, don't run since browsers send preflights without
+// credentials. It must be registered after all other routes.
+func allowPreflights(router *mux.Router) {
+	router.Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// responseHeadersMiddleware adds static headers and echoes selected request headers to responses
+func responseHeadersMiddleware(headers map[string]string, echo []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			for _, name := range echo {
+				if values := r.Header.Values(name); len(values) > 0 {
+					w.Header()[http.CanonicalHeaderKey(name)] = values
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mylxsw/n8n-parallels/internal/handler"
+)
+
+func TestCORSPreflightAllowsSignatureHeaders(t *testing.T) {
+	router := mux.NewRouter()
+	apiRouter := router.PathPrefix("/v1").Subrouter()
+	apiRouter.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "missing signature", http.StatusUnauthorized)
+		})
+	})
+	apiRouter.HandleFunc("/parallels/execute", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+	allowPreflights(router)
+	router.Use(corsMiddleware)
+
+	requested := []string{handler.HeaderSignature, handler.HeaderSignatureTimestamp, handler.HeaderSignatureNonce}
+	req := httptest.NewRequest(http.MethodOptions, "/v1/parallels/execute", nil)
+	req.Header.Set("Origin", "https://n8n.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", strings.ToLower(strings.Join(requested, ",")))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	allowed := map[string]bool{}
+	for _, name := range strings.Split(rec.Header().Get("Access-Control-Allow-Headers"), ",") {
+		allowed[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	for _, name := range requested {
+		if !allowed[http.CanonicalHeaderKey(name)] {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", rec.Header().Get("Access-Control-Allow-Headers"), name)
+		}
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
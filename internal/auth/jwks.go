@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Caching of JWKS documents
+const (
+	jwksCacheTTL      = time.Hour        // keys are fetched again after this time
+	jwksRefreshMinGap = time.Minute      // unknown key ids trigger a refresh at most this often
+	jwksFetchTimeout  = 10 * time.Second // of a single fetch
+	jwksMaxSize       = 1 << 20          // largest accepted document
+	jwksMinKeyBits    = 2048             // smaller RSA keys are ignored
+)
+
+// jwks caches the RSA keys of a JWKS document by key id. Keys are refreshed once the cache
+// expired or a token refers to an unknown key, e.g. right after the issuer rotated its keys.
+// Concurrent lookups share a single fetch, which doesn't block lookups of cached keys.
+type jwks struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+	fetch  singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// newJWKS creates the cache of the JWKS document at url, it is fetched on first use
+func newJWKS(url string) *jwks {
+	return &jwks{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		now:    time.Now,
+	}
+}
+
+// lookup returns the key with the given id, or all keys for tokens without a key id
+func (j *jwks) lookup(ctx context.Context, kid string) ([]*rsa.PublicKey, error) {
+	j.mu.Lock()
+	keys, fetchedAt := j.keys, j.fetchedAt
+	j.mu.Unlock()
+
+	age := j.now().Sub(fetchedAt)
+	_, known := keys[kid]
+	if age > jwksCacheTTL || (kid != "" && !known && age > jwksRefreshMinGap) {
+		// The fetch is shared, it must not fail for everyone once the first caller gives up
+		result := j.fetch.DoChan("", func() (interface{}, error) {
+			return j.refresh(context.WithoutCancel(ctx), fetchedAt)
+		})
+		select {
+		case r := <-result:
+			if r.Err != nil {
+				return nil, r.Err
+			}
+			keys = r.Val.(map[string]*rsa.PublicKey)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if kid != "" {
+		if key, ok := keys[kid]; ok {
+			return []*rsa.PublicKey{key}, nil
+		}
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+	}
+	result := make([]*rsa.PublicKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// refresh fetches the keys unless another lookup did since they were fetched at seen. A failed
+// refresh keeps the previous keys, the issuer may be down for a moment.
+func (j *jwks) refresh(ctx context.Context, seen time.Time) (map[string]*rsa.PublicKey, error) {
+	j.mu.Lock()
+	if j.fetchedAt.After(seen) {
+		defer j.mu.Unlock()
+		return j.keys, nil
+	}
+	j.mu.Unlock()
+
+	keys, err := j.download(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetchedAt = j.now()
+	if err != nil {
+		if j.keys == nil {
+			return nil, err
+		}
+		return j.keys, nil
+	}
+	j.keys = keys
+	return keys, nil
+}
+
+// download fetches the JWKS document and parses its RSA keys
+func (j *jwks) download(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var document struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, jwksMaxSize)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range document.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		modulus := new(big.Int).SetBytes(n)
+		if modulus.BitLen() < jwksMinKeyBits {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: modulus,
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
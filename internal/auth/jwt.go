@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config represents the authentication of API requests
+type Config struct {
+	JWTSecret       string `json:"jwt_secret"`        // shared secret of HS256 tokens
+	JWTJWKSURL      string `json:"jwt_jwks_url"`      // JWKS document with the keys of RS256 tokens
+	JWTIssuer       string `json:"jwt_issuer"`        // required iss claim, empty accepts any issuer
+	JWTAudience     string `json:"jwt_audience"`      // required aud claim, empty accepts any audience
+	JWTSubjectClaim string `json:"jwt_subject_claim"` // claim identifying the caller, "sub" by default
+
+	SigningSecret    string `json:"signing_secret"`    // shared secret request bodies must be signed with, empty disables it
+	SigningTolerance int    `json:"signing_tolerance"` // seconds a signature timestamp may differ from the server time
+
+	AdminToken string `json:"admin_token"` // token of the /v1/admin endpoints, empty disables them
+}
+
+// Enabled reports whether API requests must carry a valid JWT
+func (c Config) Enabled() bool {
+	return c.JWTSecret != "" || c.JWTJWKSURL != ""
+}
+
+// DefaultSubjectClaim is the claim identifying the caller if none is configured
+const DefaultSubjectClaim = "sub"
+
+// jwtLeeway is the clock skew tolerated when checking exp and nbf
+const jwtLeeway = time.Minute
+
+// ErrInvalidToken is returned for tokens which are malformed, expired or not signed by a trusted key
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTVerifier verifies the bearer tokens of API requests
+type JWTVerifier struct {
+	config Config
+	keys   *jwks // nil without a JWKS URL
+	now    func() time.Time
+}
+
+// NewJWTVerifier creates a verifier accepting HS256 tokens signed with the secret and RS256
+// tokens signed with a key of the JWKS document, whichever are configured
+func NewJWTVerifier(config Config) *JWTVerifier {
+	if config.JWTSubjectClaim == "" {
+		config.JWTSubjectClaim = DefaultSubjectClaim
+	}
+	verifier := &JWTVerifier{config: config, now: time.Now}
+	if config.JWTJWKSURL != "" {
+		verifier.keys = newJWKS(config.JWTJWKSURL)
+	}
+	return verifier
+}
+
+// Verify checks the signature and claims of a token and returns its subject
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	// The algorithm must match the configured keys, so an RSA public key is never used as a
+	// HMAC secret and unsigned tokens are never accepted
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && v.config.JWTSecret != "":
+		mac := hmac.New(sha256.New, []byte(v.config.JWTSecret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return "", fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	case header.Alg == "RS256" && v.keys != nil:
+		keys, err := v.keys.lookup(ctx, header.Kid)
+		if err != nil {
+			return "", err
+		}
+		if !verifyRS256(keys, signed, signature) {
+			return "", fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+	default:
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.checkClaims(claims, v.now()); err != nil {
+		return "", err
+	}
+
+	subject, _ := claims[v.config.JWTSubjectClaim].(string)
+	if subject == "" {
+		return "", fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.config.JWTSubjectClaim)
+	}
+	return subject, nil
+}
+
+// checkClaims validates the registered claims of a token
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.config.JWTIssuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.JWTIssuer {
+			return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+		}
+	}
+	if v.config.JWTAudience != "" && !hasAudience(claims["aud"], v.config.JWTAudience) {
+		return fmt.Errorf("%w: token not issued for %s", ErrInvalidToken, v.config.JWTAudience)
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings, contains audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyRS256 checks an RS256 signature against the candidate keys
+func verifyRS256(keys []*rsa.PublicKey, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+	for _, key := range keys {
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context carrying the authenticated caller
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Subject returns the authenticated caller carried by ctx, empty if the request wasn't authenticated
+func Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "0123456789abcdef0123456789abcdef"
+
+// testNow is the fake time of the verifiers under test
+var testNow = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// jsonSegment encodes a token segment
+func jsonSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signHS256 creates an HS256 token with the claims
+func signHS256(t *testing.T, claims map[string]interface{}) string {
+	signed := jsonSegment(t, map[string]string{"alg": "HS256"}) + "." + jsonSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signRS256 creates an RS256 token with the claims
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := jsonSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + jsonSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwksDocument serves the public keys by key id
+func jwksDocument(keys map[string]*rsa.PrivateKey) []byte {
+	var document struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		document.Keys = append(document.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, _ := json.Marshal(document)
+	return data
+}
+
+func TestVerifyRequiresExpiry(t *testing.T) {
+	verifier := NewJWTVerifier(Config{JWTSecret: testJWTSecret})
+	verifier.now = func() time.Time { return testNow }
+
+	if _, err := verifier.Verify(context.Background(), signHS256(t, map[string]interface{}{"sub": "alice"})); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token without exp: %v", err)
+	}
+	token := signHS256(t, map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Hour).Unix()})
+	if subject, err := verifier.Verify(context.Background(), token); err != nil || subject != "alice" {
+		t.Fatalf("token with exp: %q, %v", subject, err)
+	}
+}
+
+func TestJWKSIgnoresShortRSAKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strong, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwksDocument(map[string]*rsa.PrivateKey{"weak": weak, "strong": strong}))
+	}))
+	defer server.Close()
+
+	verifier := NewJWTVerifier(Config{JWTJWKSURL: server.URL})
+	verifier.now = func() time.Time { return testNow }
+	claims := map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Hour).Unix()}
+
+	if _, err := verifier.Verify(context.Background(), signRS256(t, weak, "weak", claims)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token signed with a 1024 bit key: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signRS256(t, strong, "strong", claims)); err != nil {
+		t.Fatalf("token signed with a 2048 bit key: %v", err)
+	}
+}
+
+func TestJWKSFetchIsSharedAndDoesNotBlockCachedKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(jwksDocument(map[string]*rsa.PrivateKey{"known": key}))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	now := testNow
+	keys := newJWKS(server.URL)
+	keys.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	ctx := context.Background()
+	if _, err := keys.lookup(ctx, "known"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown key ids refresh the keys, all of them wait for the same fetch
+	mu.Lock()
+	now = now.Add(2 * jwksRefreshMinGap)
+	mu.Unlock()
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys.lookup(ctx, "rotated")
+		}()
+	}
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := keys.lookup(ctx, "known"); err != nil {
+		t.Fatalf("cached key during a fetch: %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("%d fetches, want 2", n)
+	}
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// ResultSigner signs response bodies with the server key as detached JWS (RFC 7515 appendix F),
+// so consumers of exported results can verify they came from this service unchanged. Its
+// public key is published as a JWKS document.
+type ResultSigner struct {
+	key   crypto.Signer
+	alg   string
+	keyID string
+	jwk   map[string]string
+}
+
+// NewResultSigner creates a signer for an ECDSA P-256 (ES256), Ed25519 (EdDSA) or RSA (RS256)
+// key. Without a key id, the JWK thumbprint of the key (RFC 7638) is used.
+func NewResultSigner(key crypto.Signer, keyID string) (*ResultSigner, error) {
+	signer := &ResultSigner{key: key}
+	switch public := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported ECDSA curve %s, only P-256 is supported", public.Curve.Params().Name)
+		}
+		signer.alg = "ES256"
+		signer.jwk = map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   encodeSegment(public.X.FillBytes(make([]byte, 32))),
+			"y":   encodeSegment(public.Y.FillBytes(make([]byte, 32))),
+		}
+	case ed25519.PublicKey:
+		signer.alg = "EdDSA"
+		signer.jwk = map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   encodeSegment(public),
+		}
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		signer.alg = "RS256"
+		signer.jwk = map[string]string{
+			"kty": "RSA",
+			"n":   encodeSegment(public.N.Bytes()),
+			"e":   encodeSegment(big.NewInt(int64(public.E)).Bytes()),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+
+	signer.keyID = keyID
+	if signer.keyID == "" {
+		// The members required for the key type in lexical order, as the thumbprint requires;
+		// encoding/json sorts the keys of maps
+		thumbprint, err := json.Marshal(signer.jwk)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(thumbprint)
+		signer.keyID = encodeSegment(sum[:])
+	}
+	return signer, nil
+}
+
+// Sign returns the detached JWS of payload in compact serialization, "<header>..<signature>".
+// The payload is verified by inserting its base64url encoding between the dots.
+func (s *ResultSigner) Sign(payload []byte) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	protected := encodeSegment(header)
+	signed := []byte(protected + "." + encodeSegment(payload))
+
+	var signature []byte
+	switch key := s.key.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		r, sv, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return "", fmt.Errorf("sign result: %w", err)
+		}
+		// JWS uses the fixed-size concatenation of r and s instead of ASN.1
+		signature = append(r.FillBytes(make([]byte, 32)), sv.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, signed)
+	default:
+		digest := sha256.Sum256(signed)
+		if signature, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+			return "", fmt.Errorf("sign result: %w", err)
+		}
+	}
+	return protected + ".." + encodeSegment(signature), nil
+}
+
+// KeyID returns the kid of the signatures
+func (s *ResultSigner) KeyID() string {
+	return s.keyID
+}
+
+// JWKS returns the JWKS document with the public key of the signer
+func (s *ResultSigner) JWKS() ([]byte, error) {
+	jwk := map[string]string{"use": "sig", "alg": s.alg, "kid": s.keyID}
+	for name, value := range s.jwk {
+		jwk[name] = value
+	}
+	return json.Marshal(map[string]interface{}{"keys": []map[string]string{jwk}})
+}
+
+// encodeSegment encodes a part of a JWS
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
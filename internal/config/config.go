@@ -1,18 +1,32 @@
 package config
 
 import (
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 
+	"github.com/mylxsw/n8n-parallels/internal/auth"
 	"github.com/mylxsw/n8n-parallels/internal/logger"
+	"github.com/mylxsw/n8n-parallels/internal/tracing"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server ServerConfig       `json:"server"`
-	Logger logger.Config      `json:"logger"`
+	Server    ServerConfig    `json:"server"`
+	Logger    logger.Config   `json:"logger"`
+	Execution ExecutionConfig `json:"execution"`
+	Redis     RedisConfig     `json:"redis"`
+	Tracing   tracing.Config  `json:"tracing"`
+	Auth      auth.Config     `json:"auth"`
 }
 
 // ServerConfig represents the HTTP server configuration
@@ -22,6 +36,121 @@ type ServerConfig struct {
 	ReadTimeout     int    `json:"read_timeout"`     // seconds
 	WriteTimeout    int    `json:"write_timeout"`    // seconds
 	ShutdownTimeout int    `json:"shutdown_timeout"` // seconds
+
+	ResponseHeaders    map[string]string `json:"response_headers"`     // added to every API response
+	EchoRequestHeaders []string          `json:"echo_request_headers"` // request headers copied to the API response
+	TrustedProxies     []string          `json:"trusted_proxies"`      // IPs or CIDRs whose forwarding headers are trusted
+
+	PprofPort int    `json:"pprof_port"` // port of the net/http/pprof handlers, 0 disables them
+	PprofHost string `json:"pprof_host"` // host the pprof handlers listen on, loopback by default
+
+	TLSCertFile string `json:"tls_cert_file"` // PEM certificate chain served over HTTPS, empty serves plain HTTP
+	TLSKeyFile  string `json:"tls_key_file"`  // PEM private key of the certificate
+}
+
+// TLSEnabled reports whether the server terminates TLS itself
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != ""
+}
+
+// ExecutionConfig represents the webhook execution configuration
+type ExecutionConfig struct {
+	ConcurrencyGroupBackend     string         `json:"concurrency_group_backend"`      // "local" or "redis"
+	ConcurrencyGroupLimit       int            `json:"concurrency_group_limit"`        // executions per group running at once
+	ConcurrencyGroupLimits      map[string]int `json:"concurrency_group_limits"`       // per-group overrides
+	ConcurrencyGroupWeights     map[string]int `json:"concurrency_group_weights"`      // shares of the server-wide slots while saturated, default 1
+	ConcurrencyGroupWaitTimeout int            `json:"concurrency_group_wait_timeout"` // seconds
+	ConcurrencyGroupLeaseTTL    int            `json:"concurrency_group_lease_ttl"`    // seconds, redis backend only
+	AsyncResultTTL              int            `json:"async_result_ttl"`               // seconds results of async executions are kept
+	CallbackMaxRetries          int            `json:"callback_max_retries"`           // retries of failed completion callbacks
+	CallbackSigningSecret       string         `json:"callback_signing_secret"`        // HMAC secret of callbacks without their own callback_secret
+	CanaryTTL                   int            `json:"canary_ttl"`                     // seconds a canary execution awaits confirmation
+	PauseTTL                    int            `json:"pause_ttl"`                      // seconds an execution may stay paused before it is canceled
+	GoogleCredentialsFile       string         `json:"google_credentials_file"`        // service account key for google_id_token auth
+	GoogleIDTokenAudiences      []string       `json:"google_id_token_audiences"`      // audiences other than the target origin tokens may be minted for
+	MaxURLLength                int            `json:"max_url_length"`                 // longest accepted target URL
+	MaxHeaderValueLength        int            `json:"max_header_value_length"`        // longest accepted outbound header value
+	DialTimeout                 int            `json:"dial_timeout"`                   // seconds
+	DialFallbackDelay           int            `json:"dial_fallback_delay"`            // milliseconds before racing the other address family, negative disables it
+	DialPrefer                  string         `json:"dial_prefer"`                    // "dual", "ipv4" or "ipv6"
+	OutboundBandwidthLimit      int            `json:"outbound_bandwidth_limit"`       // bytes per second of all request bodies, 0 is unlimited
+	PayloadSpoolThreshold       int64          `json:"payload_spool_threshold"`        // bytes of payloads kept in memory before spooling to disk, 0 never spools
+	PayloadSpoolDir             string         `json:"payload_spool_dir"`              // directory of spool files, default the system temp dir
+	AllowInsecureTLS            bool           `json:"allow_insecure_tls"`             // allow executions to skip TLS verification
+	DefaultMaxConcurrency       int            `json:"default_max_concurrency"`        // webhook calls of an execution running at once
+	MaxConcurrencyLimit         int            `json:"max_concurrency_limit"`          // cap of max_concurrency, 0 is uncapped
+	MaxTotalConcurrency         int            `json:"max_total_concurrency"`          // webhook calls in flight server-wide, 0 is unlimited
+	TotalConcurrencyWaitTimeout int            `json:"total_concurrency_wait_timeout"` // seconds an execution waits for admission
+	DNSServers                  []string       `json:"dns_servers"`                    // "ip" or "ip:port", the host resolver is used if empty
+	DNSSearchDomains            []string       `json:"dns_search_domains"`             // domains tried for single-label host names
+	ConsulAddr                  string         `json:"consul_addr"`                    // consul agent queried for consul:// targets
+	ConsulToken                 string         `json:"consul_token"`                   // ACL token of consul queries
+
+	CircuitBreakerThreshold      int `json:"circuit_breaker_threshold"`        // consecutive failures opening the circuit of a host, 0 disables
+	CircuitBreakerResetInterval  int `json:"circuit_breaker_reset_interval"`   // seconds until an open circuit lets probes through
+	CircuitBreakerHalfOpenProbes int `json:"circuit_breaker_half_open_probes"` // probe calls allowed at once while half-open
+
+	QueueBackend  string `json:"queue_backend"`   // "none" or "redis", async executions run right away without a queue
+	QueueWorkers  int    `json:"queue_workers"`   // queued executions running at once per replica
+	QueueLeaseTTL int    `json:"queue_lease_ttl"` // seconds until executions of a dead worker are handed out again
+	QueueTTL      int    `json:"queue_ttl"`       // seconds a queued execution is kept before it is dropped unrun
+
+	ReplicaURL string `json:"replica_url"` // URL other replicas reach this one at, reads of executions it recorded are forwarded to it
+
+	StorageEncryptionKey string `json:"storage_encryption_key"` // key of the secrets kept outside of the process, e.g. queued requests and callback credentials
+
+	FastPathMaxItems int `json:"fast_path_max_items"` // batches up to this size bypass the queue and are recorded in the background, 0 disables
+
+	BlockPrivateTargets   bool     `json:"block_private_targets"`   // reject webhook targets in loopback, private and link-local ranges
+	AllowedTargetNetworks []string `json:"allowed_target_networks"` // IPs or CIDRs allowed although private targets are blocked
+
+	AllowedTargetHosts []string `json:"allowed_target_hosts"` // globs or /regexes/ target hosts must match, empty allows all
+	DeniedTargetHosts  []string `json:"denied_target_hosts"`  // globs or /regexes/ of target hosts which are rejected
+
+	RateLimitRequests int `json:"rate_limit_requests"` // API requests per minute of a caller, 0 is unlimited
+	RateLimitPayloads int `json:"rate_limit_payloads"` // payloads per minute a caller may submit, 0 is unlimited
+
+	OutboundProxyURL string `json:"outbound_proxy_url"` // http, https or socks5 proxy of webhook calls, empty connects directly
+
+	AllowedProxyURLs []string `json:"allowed_proxy_urls"` // proxies executions may choose with transport.proxy_url, empty allows none
+
+	CACertFile string `json:"ca_cert_file"` // PEM bundle of CAs trusted by outbound requests in addition to the system roots
+	CACert     string `json:"ca_cert"`      // PEM encoded CAs trusted in addition to the system roots
+
+	ClientCertFile  string   `json:"client_cert_file"`  // PEM certificate chain presented to webhook targets requiring mutual TLS
+	ClientKeyFile   string   `json:"client_key_file"`   // PEM private key of the client certificate
+	ClientCertHosts []string `json:"client_cert_hosts"` // globs or /regexes/ of the target hosts the client certificate is presented to
+
+	MaxExecutionDuration int `json:"max_execution_duration"` // seconds a run of an execution may take before it is stopped, 0 is unlimited
+
+	DedupWindow int `json:"dedup_window"` // seconds an item sent to a target is skipped when sent again by another execution, 0 disables it
+
+	MaxResponseSize int `json:"max_response_size"` // bytes of a webhook response body kept per task, larger ones are truncated, 0 is unlimited
+
+	ResultSigningKeyFile string `json:"result_signing_key_file"` // PEM private key execution results are signed with, empty disables signing
+	ResultSigningKeyID   string `json:"result_signing_key_id"`   // kid of the signatures, default the JWK thumbprint of the key
+
+	ExecutionStore                string `json:"execution_store"`                  // "memory" or "sqlite", sqlite records every execution
+	ExecutionStorePath            string `json:"execution_store_path"`             // database file of the sqlite store
+	ExecutionStorePayloads        bool   `json:"execution_store_payloads"`         // keep the sent payloads in execution records
+	ExecutionStoreRetention       int    `json:"execution_store_retention"`        // days executions are kept by the sqlite store, 0 keeps them forever
+	ExecutionStoreMaxSize         int    `json:"execution_store_max_size"`         // megabytes of the sqlite store before the oldest executions are purged, 0 is unlimited
+	ExecutionStoreCleanupInterval int    `json:"execution_store_cleanup_interval"` // seconds between runs of the sqlite store janitor
+
+	ExecutionArchiveDir   string `json:"execution_archive_dir"`   // directory old executions of the sqlite store are moved to, empty disables archival
+	ExecutionArchiveAfter int    `json:"execution_archive_after"` // days after which finished executions are archived
+
+	PayloadQueryDriver  string            `json:"payload_query_driver"`   // "postgres" or "mysql"
+	PayloadQueryDSN     string            `json:"payload_query_dsn"`      // database payload queries run against, empty disables them
+	PayloadQueries      map[string]string `json:"payload_queries"`        // read-only SQL queries by name, every row becomes a payload
+	PayloadQueryMaxRows int               `json:"payload_query_max_rows"` // rows a query may return, more reject the request
+	PayloadQueryTimeout int               `json:"payload_query_timeout"`  // seconds
+}
+
+// RedisConfig represents the Redis connection configuration
+type RedisConfig struct {
+	URL       string `json:"url"`
+	KeyPrefix string `json:"key_prefix"`
 }
 
 // Load loads configuration from environment variables with defaults
@@ -33,10 +162,136 @@ func Load() *Config {
 			ReadTimeout:     getEnvAsInt("READ_TIMEOUT", 30),
 			WriteTimeout:    getEnvAsInt("WRITE_TIMEOUT", 30),
 			ShutdownTimeout: getEnvAsInt("SHUTDOWN_TIMEOUT", 30),
+
+			ResponseHeaders:    getEnvAsStringMap("RESPONSE_HEADERS"),
+			EchoRequestHeaders: getEnvAsList("ECHO_REQUEST_HEADERS"),
+			TrustedProxies:     getEnvAsList("TRUSTED_PROXIES"),
+
+			PprofPort: getEnvAsInt("PPROF_PORT", 0),
+			PprofHost: getEnv("PPROF_HOST", "127.0.0.1"),
+
+			TLSCertFile: getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:  getEnv("TLS_KEY_FILE", ""),
 		},
 		Logger: logger.Config{
-			Level:  logger.LogLevel(getEnv("LOG_LEVEL", "info")),
-			Format: getEnv("LOG_FORMAT", "text"), // "text" or "json"
+			Level:      logger.LogLevel(getEnv("LOG_LEVEL", "info")),
+			Format:     getEnv("LOG_FORMAT", "text"), // "text" or "json"
+			Output:     getEnv("LOG_OUTPUT", logger.OutputStdout),
+			SyslogAddr: getEnv("LOG_SYSLOG_ADDR", ""),
+			Tag:        getEnv("LOG_TAG", logger.DefaultTag),
+		},
+		Execution: ExecutionConfig{
+			ConcurrencyGroupBackend:     getEnv("CONCURRENCY_GROUP_BACKEND", "local"),
+			ConcurrencyGroupLimit:       getEnvAsInt("CONCURRENCY_GROUP_LIMIT", 1),
+			ConcurrencyGroupLimits:      getEnvAsIntMap("CONCURRENCY_GROUP_LIMITS"),
+			ConcurrencyGroupWeights:     getEnvAsIntMap("CONCURRENCY_GROUP_WEIGHTS"),
+			ConcurrencyGroupWaitTimeout: getEnvAsInt("CONCURRENCY_GROUP_WAIT_TIMEOUT", 60),
+			ConcurrencyGroupLeaseTTL:    getEnvAsInt("CONCURRENCY_GROUP_LEASE_TTL", 30),
+			AsyncResultTTL:              getEnvAsInt("ASYNC_RESULT_TTL", 3600),
+			CallbackMaxRetries:          getEnvAsInt("CALLBACK_MAX_RETRIES", 5),
+			CallbackSigningSecret:       getEnv("CALLBACK_SIGNING_SECRET", ""),
+			CanaryTTL:                   getEnvAsInt("CANARY_TTL", 3600),
+			PauseTTL:                    getEnvAsInt("PAUSE_TTL", 3600),
+			GoogleCredentialsFile:       getEnv("GOOGLE_APPLICATION_CREDENTIALS", ""),
+			GoogleIDTokenAudiences:      getEnvAsList("GOOGLE_ID_TOKEN_AUDIENCES"),
+			MaxURLLength:                getEnvAsInt("MAX_URL_LENGTH", 8192),
+			MaxHeaderValueLength:        getEnvAsInt("MAX_HEADER_VALUE_LENGTH", 8192),
+			DialTimeout:                 getEnvAsInt("DIAL_TIMEOUT", 30),
+			DialFallbackDelay:           getEnvAsInt("DIAL_FALLBACK_DELAY", 300),
+			DialPrefer:                  getEnv("DIAL_PREFER", "dual"),
+			OutboundBandwidthLimit:      getEnvAsInt("OUTBOUND_BANDWIDTH_LIMIT", 0),
+			PayloadSpoolThreshold:       int64(getEnvAsInt("PAYLOAD_SPOOL_THRESHOLD", 64<<20)),
+			PayloadSpoolDir:             getEnv("PAYLOAD_SPOOL_DIR", ""),
+			AllowInsecureTLS:            getEnvAsBool("ALLOW_INSECURE_TLS", false),
+			DefaultMaxConcurrency:       getEnvAsInt("DEFAULT_MAX_CONCURRENCY", 50),
+			MaxConcurrencyLimit:         getEnvAsInt("MAX_CONCURRENCY_LIMIT", 1000),
+			MaxTotalConcurrency:         getEnvAsInt("MAX_TOTAL_CONCURRENCY", 0),
+			TotalConcurrencyWaitTimeout: getEnvAsInt("TOTAL_CONCURRENCY_WAIT_TIMEOUT", 30),
+			DNSServers:                  getEnvAsList("DNS_SERVERS"),
+			DNSSearchDomains:            getEnvAsList("DNS_SEARCH_DOMAINS"),
+			ConsulAddr:                  getEnv("CONSUL_HTTP_ADDR", "http://127.0.0.1:8500"),
+			ConsulToken:                 getEnv("CONSUL_HTTP_TOKEN", ""),
+
+			CircuitBreakerThreshold:      getEnvAsInt("CIRCUIT_BREAKER_THRESHOLD", 0),
+			CircuitBreakerResetInterval:  getEnvAsInt("CIRCUIT_BREAKER_RESET_INTERVAL", 30),
+			CircuitBreakerHalfOpenProbes: getEnvAsInt("CIRCUIT_BREAKER_HALF_OPEN_PROBES", 1),
+
+			QueueBackend:  getEnv("QUEUE_BACKEND", "none"),
+			QueueWorkers:  getEnvAsInt("QUEUE_WORKERS", 4),
+			QueueLeaseTTL: getEnvAsInt("QUEUE_LEASE_TTL", 30),
+			QueueTTL:      getEnvAsInt("QUEUE_TTL", 86400),
+
+			ReplicaURL: getEnv("REPLICA_URL", ""),
+
+			StorageEncryptionKey: getEnv("STORAGE_ENCRYPTION_KEY", ""),
+
+			FastPathMaxItems: getEnvAsInt("FAST_PATH_MAX_ITEMS", 10),
+
+			BlockPrivateTargets:   getEnvAsBool("BLOCK_PRIVATE_TARGETS", true),
+			AllowedTargetNetworks: getEnvAsList("ALLOWED_TARGET_NETWORKS"),
+
+			AllowedTargetHosts: getEnvAsList("ALLOWED_TARGET_HOSTS"),
+			DeniedTargetHosts:  getEnvAsList("DENIED_TARGET_HOSTS"),
+
+			RateLimitRequests: getEnvAsInt("RATE_LIMIT_REQUESTS", 0),
+			RateLimitPayloads: getEnvAsInt("RATE_LIMIT_PAYLOADS", 0),
+
+			OutboundProxyURL: getEnv("OUTBOUND_PROXY_URL", ""),
+
+			AllowedProxyURLs: getEnvAsList("ALLOWED_PROXY_URLS"),
+
+			CACertFile: getEnv("CA_CERT_FILE", ""),
+			CACert:     getEnv("CA_CERT", ""),
+
+			ClientCertFile:  getEnv("CLIENT_CERT_FILE", ""),
+			ClientKeyFile:   getEnv("CLIENT_KEY_FILE", ""),
+			ClientCertHosts: getEnvAsList("CLIENT_CERT_HOSTS"),
+
+			MaxExecutionDuration: getEnvAsInt("MAX_EXECUTION_DURATION", 0),
+
+			DedupWindow: getEnvAsInt("DEDUP_WINDOW", 0),
+
+			MaxResponseSize: getEnvAsInt("MAX_RESPONSE_SIZE", 10<<20),
+
+			ResultSigningKeyFile: getEnv("RESULT_SIGNING_KEY_FILE", ""),
+			ResultSigningKeyID:   getEnv("RESULT_SIGNING_KEY_ID", ""),
+
+			ExecutionStore:                getEnv("EXECUTION_STORE", "memory"),
+			ExecutionStorePath:            getEnv("EXECUTION_STORE_PATH", "n8n-parallels.db"),
+			ExecutionStorePayloads:        getEnvAsBool("EXECUTION_STORE_PAYLOADS", false),
+			ExecutionStoreRetention:       getEnvAsInt("EXECUTION_STORE_RETENTION", 30),
+			ExecutionStoreMaxSize:         getEnvAsInt("EXECUTION_STORE_MAX_SIZE", 0),
+			ExecutionStoreCleanupInterval: getEnvAsInt("EXECUTION_STORE_CLEANUP_INTERVAL", 3600),
+
+			ExecutionArchiveDir:   getEnv("EXECUTION_ARCHIVE_DIR", ""),
+			ExecutionArchiveAfter: getEnvAsInt("EXECUTION_ARCHIVE_AFTER", 7),
+
+			PayloadQueryDriver:  getEnv("PAYLOAD_QUERY_DRIVER", "postgres"),
+			PayloadQueryDSN:     getEnv("PAYLOAD_QUERY_DSN", ""),
+			PayloadQueries:      getEnvAsStringMap("PAYLOAD_QUERIES"),
+			PayloadQueryMaxRows: getEnvAsInt("PAYLOAD_QUERY_MAX_ROWS", 100000),
+			PayloadQueryTimeout: getEnvAsInt("PAYLOAD_QUERY_TIMEOUT", 60),
+		},
+		Redis: RedisConfig{
+			URL:       getEnv("REDIS_URL", ""),
+			KeyPrefix: getEnv("REDIS_KEY_PREFIX", "n8n-parallels"),
+		},
+		Tracing: tracing.Config{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", tracing.DefaultServiceName),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+		},
+		Auth: auth.Config{
+			JWTSecret:       getEnv("JWT_SECRET", ""),
+			JWTJWKSURL:      getEnv("JWT_JWKS_URL", ""),
+			JWTIssuer:       getEnv("JWT_ISSUER", ""),
+			JWTAudience:     getEnv("JWT_AUDIENCE", ""),
+			JWTSubjectClaim: getEnv("JWT_SUBJECT_CLAIM", auth.DefaultSubjectClaim),
+
+			SigningSecret:    getEnv("REQUEST_SIGNING_SECRET", ""),
+			SigningTolerance: getEnvAsInt("REQUEST_SIGNING_TOLERANCE", 300),
+
+			AdminToken: getEnv("ADMIN_TOKEN", ""),
 		},
 	}
 
@@ -77,12 +332,155 @@ func LoadFromFile(filename string) (*Config, error) {
 	return &config, nil
 }
 
+// TrustedProxyPrefixes parses the trusted proxies, single IPs are treated as host prefixes
+func (c ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	return parsePrefixes(c.TrustedProxies, "trusted proxy")
+}
+
+// AllowedTargetPrefixes parses the private networks webhook targets may be in although
+// private targets are blocked, single IPs are treated as host prefixes
+func (c ExecutionConfig) AllowedTargetPrefixes() ([]netip.Prefix, error) {
+	return parsePrefixes(c.AllowedTargetNetworks, "allowed target network")
+}
+
+// ClientCertHostPatterns compiles the host patterns of the targets the client certificate is
+// presented to
+func (c ExecutionConfig) ClientCertHostPatterns() ([]*regexp.Regexp, error) {
+	return compileHostPatterns(c.ClientCertHosts)
+}
+
+// TargetHostPatterns compiles the host patterns of allowed and denied targets
+func (c ExecutionConfig) TargetHostPatterns() (allowed, denied []*regexp.Regexp, err error) {
+	if allowed, err = compileHostPatterns(c.AllowedTargetHosts); err != nil {
+		return nil, nil, err
+	}
+	if denied, err = compileHostPatterns(c.DeniedTargetHosts); err != nil {
+		return nil, nil, err
+	}
+	return allowed, denied, nil
+}
+
+// RootCAs returns the system roots extended by the configured CAs, nil if none are configured
+func (c ExecutionConfig) RootCAs() (*x509.CertPool, error) {
+	if c.CACertFile == "" && c.CACert == "" {
+		return nil, nil
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if c.CACertFile != "" {
+		bundle, err := os.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca_cert_file: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("ca_cert_file %s contains no valid PEM certificate", c.CACertFile)
+		}
+	}
+	if c.CACert != "" && !roots.AppendCertsFromPEM([]byte(c.CACert)) {
+		return nil, fmt.Errorf("ca_cert contains no valid PEM certificate")
+	}
+	return roots, nil
+}
+
+// ResultSigner returns the signer of execution results, nil if no signing key is configured.
+// The key is a PKCS#8, SEC 1 (EC) or PKCS#1 (RSA) PEM block.
+func (c ExecutionConfig) ResultSigner() (*auth.ResultSigner, error) {
+	if c.ResultSigningKeyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(c.ResultSigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read result_signing_key_file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("result_signing_key_file %s contains no PEM block", c.ResultSigningKeyFile)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse result_signing_key_file: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("result_signing_key_file contains an unsupported key type %T", key)
+	}
+	resultSigner, err := auth.NewResultSigner(signer, c.ResultSigningKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("result_signing_key_file: %w", err)
+	}
+	return resultSigner, nil
+}
+
+// compileHostPatterns compiles host patterns to case-insensitive regular expressions matching
+// whole host names. Patterns enclosed in slashes are regular expressions, others are globs
+// where * matches any characters, dots included, and ? a single one.
+func compileHostPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := ""
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = "^(?:" + pattern[1:len(pattern)-1] + ")$"
+		} else {
+			expr = regexp.QuoteMeta(pattern)
+			expr = strings.ReplaceAll(expr, `\*`, ".*")
+			expr = strings.ReplaceAll(expr, `\?`, ".")
+			expr = "^" + expr + "$"
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target host pattern: %s: %v", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// parsePrefixes parses a list of IPs and CIDRs
+func parsePrefixes(values []string, what string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s, must be an IP address or CIDR", what, value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid port: %d, must be between 1 and 65535", c.Server.Port)
 	}
 
+	if c.Server.PprofPort < 0 || c.Server.PprofPort > 65535 {
+		return fmt.Errorf("invalid pprof port: %d, must be between 1 and 65535, or 0 to disable", c.Server.PprofPort)
+	}
+	if c.Server.PprofPort != 0 && c.Server.PprofPort == c.Server.Port {
+		return fmt.Errorf("pprof port must differ from the server port")
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+
 	if c.Server.ReadTimeout <= 0 {
 		return fmt.Errorf("read_timeout must be greater than 0")
 	}
@@ -95,6 +493,266 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("shutdown_timeout must be greater than 0")
 	}
 
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		return err
+	}
+
+	if c.Execution.ConcurrencyGroupLimit <= 0 {
+		return fmt.Errorf("concurrency_group_limit must be greater than 0")
+	}
+
+	for group, limit := range c.Execution.ConcurrencyGroupLimits {
+		if limit <= 0 {
+			return fmt.Errorf("invalid limit for concurrency group %s: %d, must be greater than 0", group, limit)
+		}
+	}
+
+	for group, weight := range c.Execution.ConcurrencyGroupWeights {
+		if weight <= 0 {
+			return fmt.Errorf("invalid weight for concurrency group %s: %d, must be greater than 0", group, weight)
+		}
+	}
+
+	if c.Execution.ConcurrencyGroupWaitTimeout <= 0 {
+		return fmt.Errorf("concurrency_group_wait_timeout must be greater than 0")
+	}
+
+	if c.Execution.AsyncResultTTL <= 0 {
+		return fmt.Errorf("async_result_ttl must be greater than 0")
+	}
+
+	if c.Execution.CallbackMaxRetries < 0 {
+		return fmt.Errorf("callback_max_retries must not be negative")
+	}
+	if c.Execution.CallbackSigningSecret != "" && len(c.Execution.CallbackSigningSecret) < 32 {
+		return fmt.Errorf("callback_signing_secret must be at least 32 bytes long")
+	}
+
+	if c.Execution.CanaryTTL <= 0 {
+		return fmt.Errorf("canary_ttl must be greater than 0")
+	}
+	if c.Execution.PauseTTL <= 0 {
+		return fmt.Errorf("pause_ttl must be greater than 0")
+	}
+
+	if c.Execution.DefaultMaxConcurrency <= 0 {
+		return fmt.Errorf("default_max_concurrency must be greater than 0")
+	}
+
+	if c.Execution.MaxConcurrencyLimit < 0 {
+		return fmt.Errorf("max_concurrency_limit must not be negative")
+	}
+
+	if c.Execution.MaxTotalConcurrency < 0 {
+		return fmt.Errorf("max_total_concurrency must not be negative")
+	}
+
+	if c.Execution.TotalConcurrencyWaitTimeout < 0 {
+		return fmt.Errorf("total_concurrency_wait_timeout must not be negative")
+	}
+
+	if c.Execution.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("circuit_breaker_threshold must not be negative")
+	}
+
+	if c.Execution.CircuitBreakerResetInterval <= 0 {
+		return fmt.Errorf("circuit_breaker_reset_interval must be greater than 0")
+	}
+
+	if c.Execution.CircuitBreakerHalfOpenProbes <= 0 {
+		return fmt.Errorf("circuit_breaker_half_open_probes must be greater than 0")
+	}
+
+	if c.Execution.MaxURLLength <= 0 {
+		return fmt.Errorf("max_url_length must be greater than 0")
+	}
+
+	if c.Execution.MaxHeaderValueLength <= 0 {
+		return fmt.Errorf("max_header_value_length must be greater than 0")
+	}
+
+	if c.Execution.DialTimeout <= 0 {
+		return fmt.Errorf("dial_timeout must be greater than 0")
+	}
+
+	if c.Execution.OutboundBandwidthLimit < 0 {
+		return fmt.Errorf("outbound_bandwidth_limit must not be negative")
+	}
+
+	if c.Execution.MaxResponseSize < 0 {
+		return fmt.Errorf("max_response_size must not be negative")
+	}
+
+	if _, err := c.Execution.AllowedTargetPrefixes(); err != nil {
+		return err
+	}
+
+	if _, _, err := c.Execution.TargetHostPatterns(); err != nil {
+		return err
+	}
+
+	if c.Execution.OutboundProxyURL != "" {
+		if err := validateProxyURL("outbound_proxy_url", c.Execution.OutboundProxyURL); err != nil {
+			return err
+		}
+	}
+	for _, proxy := range c.Execution.AllowedProxyURLs {
+		if err := validateProxyURL("allowed_proxy_urls", proxy); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.Execution.RootCAs(); err != nil {
+		return err
+	}
+	if _, err := c.Execution.ResultSigner(); err != nil {
+		return err
+	}
+
+	if c.Execution.RateLimitRequests < 0 {
+		return fmt.Errorf("rate_limit_requests must not be negative")
+	}
+
+	if c.Execution.RateLimitPayloads < 0 {
+		return fmt.Errorf("rate_limit_payloads must not be negative")
+	}
+
+	if (c.Execution.ClientCertFile == "") != (c.Execution.ClientKeyFile == "") {
+		return fmt.Errorf("client_cert_file and client_key_file must be set together")
+	}
+
+	if c.Execution.ClientCertFile != "" && len(c.Execution.ClientCertHosts) == 0 {
+		return fmt.Errorf("client_cert_hosts is required with client_cert_file")
+	}
+	if _, err := c.Execution.ClientCertHostPatterns(); err != nil {
+		return err
+	}
+
+	if c.Execution.MaxExecutionDuration < 0 {
+		return fmt.Errorf("max_execution_duration must not be negative")
+	}
+
+	if c.Execution.DedupWindow < 0 {
+		return fmt.Errorf("dedup_window must not be negative")
+	}
+
+	if c.Execution.PayloadSpoolThreshold < 0 {
+		return fmt.Errorf("payload_spool_threshold must not be negative")
+	}
+
+	for _, server := range c.Execution.DNSServers {
+		host := server
+		if h, _, err := net.SplitHostPort(server); err == nil {
+			host = h
+		}
+		if _, err := netip.ParseAddr(host); err != nil {
+			return fmt.Errorf("invalid dns server: %s, must be an IP address with optional port", server)
+		}
+	}
+
+	switch c.Execution.DialPrefer {
+	case "dual", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("invalid dial preference: %s, must be 'dual', 'ipv4' or 'ipv6'", c.Execution.DialPrefer)
+	}
+
+	switch c.Execution.ConcurrencyGroupBackend {
+	case "local":
+	case "redis":
+		if c.Redis.URL == "" {
+			return fmt.Errorf("redis url is required when concurrency_group_backend is 'redis'")
+		}
+		if c.Execution.ConcurrencyGroupLeaseTTL <= 0 {
+			return fmt.Errorf("concurrency_group_lease_ttl must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("invalid concurrency group backend: %s, must be 'local' or 'redis'", c.Execution.ConcurrencyGroupBackend)
+	}
+
+	switch c.Execution.QueueBackend {
+	case "none":
+	case "redis":
+		if c.Redis.URL == "" {
+			return fmt.Errorf("redis url is required when queue_backend is 'redis'")
+		}
+		if c.Execution.QueueWorkers <= 0 {
+			return fmt.Errorf("queue_workers must be greater than 0")
+		}
+		if c.Execution.QueueLeaseTTL <= 0 {
+			return fmt.Errorf("queue_lease_ttl must be greater than 0")
+		}
+		if c.Execution.QueueTTL <= 0 {
+			return fmt.Errorf("queue_ttl must be greater than 0")
+		}
+		// Queued requests carry the credentials of their webhooks and callbacks
+		if c.Execution.StorageEncryptionKey == "" {
+			return fmt.Errorf("storage_encryption_key is required when queue_backend is 'redis'")
+		}
+	default:
+		return fmt.Errorf("invalid queue backend: %s, must be 'none' or 'redis'", c.Execution.QueueBackend)
+	}
+
+	if c.Execution.ReplicaURL != "" {
+		if c.Redis.URL == "" {
+			return fmt.Errorf("redis url is required with replica_url")
+		}
+		if u, err := url.Parse(c.Execution.ReplicaURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("replica_url must be an absolute http or https URL")
+		}
+	}
+
+	if c.Execution.StorageEncryptionKey != "" && len(c.Execution.StorageEncryptionKey) < 32 {
+		return fmt.Errorf("storage_encryption_key must be at least 32 bytes long")
+	}
+
+	if c.Execution.FastPathMaxItems < 0 {
+		return fmt.Errorf("fast_path_max_items must not be negative")
+	}
+
+	switch c.Execution.ExecutionStore {
+	case "memory":
+	case "sqlite":
+		if c.Execution.ExecutionStorePath == "" {
+			return fmt.Errorf("execution_store_path is required when execution_store is 'sqlite'")
+		}
+		if c.Execution.ExecutionStoreRetention < 0 {
+			return fmt.Errorf("execution_store_retention must not be negative")
+		}
+		if c.Execution.ExecutionStoreMaxSize < 0 {
+			return fmt.Errorf("execution_store_max_size must not be negative")
+		}
+		if c.Execution.ExecutionStoreCleanupInterval <= 0 {
+			return fmt.Errorf("execution_store_cleanup_interval must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("invalid execution store: %s, must be 'memory' or 'sqlite'", c.Execution.ExecutionStore)
+	}
+	if c.Execution.ExecutionArchiveDir != "" {
+		if c.Execution.ExecutionStore != "sqlite" {
+			return fmt.Errorf("execution_archive_dir requires execution_store 'sqlite'")
+		}
+		if c.Execution.ExecutionArchiveAfter <= 0 {
+			return fmt.Errorf("execution_archive_after must be greater than 0")
+		}
+		if c.Execution.ExecutionStoreRetention > 0 && c.Execution.ExecutionArchiveAfter >= c.Execution.ExecutionStoreRetention {
+			return fmt.Errorf("execution_archive_after must be shorter than execution_store_retention, or executions are purged before they are archived")
+		}
+	}
+
+	if c.Execution.PayloadQueryDSN != "" {
+		if c.Execution.PayloadQueryDriver != "postgres" && c.Execution.PayloadQueryDriver != "mysql" {
+			return fmt.Errorf("invalid payload query driver: %s, must be 'postgres' or 'mysql'", c.Execution.PayloadQueryDriver)
+		}
+		if c.Execution.PayloadQueryMaxRows <= 0 {
+			return fmt.Errorf("payload_query_max_rows must be greater than 0")
+		}
+		if c.Execution.PayloadQueryTimeout <= 0 {
+			return fmt.Errorf("payload_query_timeout must be greater than 0")
+		}
+	} else if len(c.Execution.PayloadQueries) > 0 {
+		return fmt.Errorf("payload_queries require payload_query_dsn")
+	}
+
 	validLevels := map[logger.LogLevel]bool{
 		logger.LevelDebug: true,
 		logger.LevelInfo:  true,
@@ -110,6 +768,46 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid log format: %s, must be 'text' or 'json'", c.Logger.Format)
 	}
 
+	switch c.Logger.Output {
+	case logger.OutputStdout, logger.OutputJournald:
+	case logger.OutputSyslog:
+		if _, _, err := logger.ParseSyslogAddr(c.Logger.SyslogAddr); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid log output: %s, must be 'stdout', 'syslog' or 'journald'", c.Logger.Output)
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid tracing endpoint: %s, must be an http or https URL", c.Tracing.Endpoint)
+		}
+	}
+	if c.Auth.JWTJWKSURL != "" {
+		if u, err := url.Parse(c.Auth.JWTJWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid jwt_jwks_url: %s, must be an http or https URL", c.Auth.JWTJWKSURL)
+		}
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		return fmt.Errorf("jwt_secret must be at least 32 bytes long")
+	}
+
+	if c.Auth.SigningSecret != "" {
+		if len(c.Auth.SigningSecret) < 32 {
+			return fmt.Errorf("request_signing_secret must be at least 32 bytes long")
+		}
+		if c.Auth.SigningTolerance <= 0 {
+			return fmt.Errorf("request_signing_tolerance must be greater than 0")
+		}
+	}
+	if c.Auth.AdminToken != "" && len(c.Auth.AdminToken) < 32 {
+		return fmt.Errorf("admin_token must be at least 32 bytes long")
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+	}
+
 	return nil
 }
 
@@ -128,4 +826,76 @@ func getEnvAsInt(name string, defaultValue int) int {
 		return value
 	}
 	return defaultValue
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(name string, defaultValue float64) float64 {
+	valueStr := getEnv(name, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsBool gets an environment variable as a boolean or returns a default value
+func getEnvAsBool(name string, defaultValue bool) bool {
+	valueStr := getEnv(name, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsIntMap parses an environment variable of the form "key1=1,key2=2"
+func getEnvAsIntMap(name string) map[string]int {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(getEnv(name, ""), ",") {
+		key, valueStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if value, err := strconv.Atoi(strings.TrimSpace(valueStr)); err == nil {
+			result[strings.TrimSpace(key)] = value
+		}
+	}
+	return result
+}
+
+// getEnvAsStringMap parses an environment variable of the form "key1=value1;key2=value2".
+// Pairs are separated by semicolons as header values may contain commas.
+func getEnvAsStringMap(name string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(getEnv(name, ""), ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// validateProxyURL checks the URL of a forward proxy
+func validateProxyURL(name, raw string) error {
+	proxyURL, err := url.Parse(raw)
+	if err != nil || proxyURL.Host == "" {
+		return fmt.Errorf("%s must be an absolute URL", name)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("%s must use http, https, socks5 or socks5h, got %q", name, proxyURL.Scheme)
+	}
+	return nil
+}
+
+// getEnvAsList parses a comma separated environment variable
+func getEnvAsList(name string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnv(name, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
\ No newline at end of file
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateQueueEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		backend string
+		wantErr string
+	}{
+		{"memory without key", "", "none", ""},
+		{"redis without key", "", "redis", "storage_encryption_key is required"},
+		{"short key", "too short", "redis", "at least 32 bytes"},
+		{"redis with key", "0123456789abcdef0123456789abcdef", "redis", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Load()
+			cfg.Redis.URL = "redis://localhost:6379/0"
+			cfg.Execution.QueueBackend = tt.backend
+			cfg.Execution.StorageEncryptionKey = tt.key
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAdminToken(t *testing.T) {
+	cfg := Load()
+	cfg.Auth.AdminToken = "too short"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "admin_token must be at least 32 bytes") {
+		t.Fatalf("Validate() = %v, want a short admin_token rejected", err)
+	}
+
+	cfg.Auth.AdminToken = "0123456789abcdef0123456789abcdef"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+}
+
+func TestValidatePauseTTL(t *testing.T) {
+	cfg := Load()
+	if cfg.Execution.PauseTTL != 3600 {
+		t.Fatalf("default pause_ttl %d, want 3600", cfg.Execution.PauseTTL)
+	}
+	cfg.Execution.PauseTTL = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "pause_ttl must be greater than 0") {
+		t.Fatalf("Validate() = %v, want pause_ttl rejected", err)
+	}
+}
+
+func TestValidateClientCertHosts(t *testing.T) {
+	cfg := Load()
+	cfg.Execution.ClientCertFile = "/etc/n8n-parallels/client.pem"
+	cfg.Execution.ClientKeyFile = "/etc/n8n-parallels/client-key.pem"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "client_cert_hosts is required") {
+		t.Fatalf("Validate() = %v, want client_cert_hosts required", err)
+	}
+	cfg.Execution.ClientCertHosts = []string{"/n8n-[/"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid target host pattern") {
+		t.Fatalf("Validate() = %v, want the pattern rejected", err)
+	}
+	cfg.Execution.ClientCertHosts = []string{"*.n8n.internal"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+}
+
+func TestValidateReplicaURL(t *testing.T) {
+	cfg := Load()
+	cfg.Execution.ReplicaURL = "http://replica-a:8080"
+	cfg.Redis.URL = ""
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "redis url is required") {
+		t.Fatalf("Validate() = %v, want redis url required", err)
+	}
+	cfg.Redis.URL = "redis://localhost:6379/0"
+	for _, replicaURL := range []string{"replica-a:8080", "/replica", "ftp://replica-a"} {
+		cfg.Execution.ReplicaURL = replicaURL
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "replica_url must be") {
+			t.Fatalf("Validate() of %q = %v, want it rejected", replicaURL, err)
+		}
+	}
+	cfg.Execution.ReplicaURL = "https://replica-a.internal:8443"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/logger"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Lifetime of runtime log level changes
+const (
+	defaultLogLevelTTL = 15 * 60 // seconds
+	maxLogLevelTTL     = 24 * 60 * 60
+)
+
+// AdminHandler handles operational endpoints of the server itself
+type AdminHandler struct {
+	leveler *logger.Leveler
+	logger  *slog.Logger
+}
+
+// NewAdminHandler creates a new admin handler instance
+func NewAdminHandler(leveler *logger.Leveler, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		leveler: leveler,
+		logger:  logger,
+	}
+}
+
+// headerAdminToken carries the ADMIN_TOKEN of requests to the admin endpoints. It is separate from
+// the Authorization header, which carries the JWT of API callers.
+const headerAdminToken = "X-Admin-Token"
+
+// TokenMiddleware rejects requests without the admin token with 401, so callers of the API can't
+// change the server itself
+func (ah *AdminHandler) TokenMiddleware(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(headerAdminToken)), []byte(token)) != 1 {
+				ah.logger.Warn("Rejected admin request without a valid token",
+					"method", r.Method,
+					"path", r.URL.Path)
+				ah.sendError(w, http.StatusUnauthorized, "unauthorized", "a valid "+headerAdminToken+" header is required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RegisterAdminRoutes adds the /admin endpoints to the API router, guarded by the admin token.
+// Without a token they aren't registered and false is returned.
+func RegisterAdminRoutes(router *mux.Router, token string, ah *AdminHandler, ph *ParallelHandler) bool {
+	if token == "" {
+		return false
+	}
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(ah.TokenMiddleware(token))
+	adminRouter.HandleFunc("/execution-store", ph.ExecutionStoreStats).Methods("GET")
+	adminRouter.HandleFunc("/log-level", ah.GetLogLevel).Methods("GET")
+	adminRouter.HandleFunc("/log-level", ah.SetLogLevel).Methods("PUT")
+	adminRouter.HandleFunc("/log-level", ah.ResetLogLevel).Methods("DELETE")
+	return true
+}
+
+// logLevelRequest changes the log level for a while
+type logLevelRequest struct {
+	Level      logger.LogLevel `json:"level"`
+	TTLSeconds int             `json:"ttl_seconds"` // default 15 minutes
+}
+
+// GetLogLevel handles GET /v1/admin/log-level
+func (ah *AdminHandler) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	ah.sendLogLevel(w)
+}
+
+// SetLogLevel handles PUT /v1/admin/log-level, changing the log level without a restart.
+// The configured level is restored once the TTL passed or on DELETE.
+func (ah *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var request logLevelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&request); err != nil {
+		ah.sendError(w, http.StatusBadRequest, "invalid request body", "failed to parse JSON payload")
+		return
+	}
+
+	if request.TTLSeconds == 0 {
+		request.TTLSeconds = defaultLogLevelTTL
+	}
+	if request.TTLSeconds < 0 || request.TTLSeconds > maxLogLevelTTL {
+		ah.sendError(w, http.StatusBadRequest, "validation failed", "ttl_seconds must be between 1 and 86400")
+		return
+	}
+
+	if err := ah.leveler.Set(request.Level, time.Duration(request.TTLSeconds)*time.Second); err != nil {
+		ah.sendError(w, http.StatusBadRequest, "validation failed", err.Error())
+		return
+	}
+
+	ah.logger.Warn("Log level changed at runtime", "level", request.Level, "ttl_seconds", request.TTLSeconds)
+	ah.sendLogLevel(w)
+}
+
+// ResetLogLevel handles DELETE /v1/admin/log-level, restoring the configured log level
+func (ah *AdminHandler) ResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	ah.leveler.Reset()
+	ah.logger.Warn("Log level reset to the configured level")
+	ah.sendLogLevel(w)
+}
+
+// sendLogLevel sends the current log level
+func (ah *AdminHandler) sendLogLevel(w http.ResponseWriter) {
+	current, configured, revertAt := ah.leveler.Level()
+	response := map[string]interface{}{
+		"level":            current,
+		"configured_level": configured,
+	}
+	if !revertAt.IsZero() {
+		response["revert_at"] = revertAt.UTC().Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ah.logger.Error("Failed to encode response", "error", err)
+	}
+}
+
+// sendError sends a JSON error response
+func (ah *AdminHandler) sendError(w http.ResponseWriter, statusCode int, error string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{Error: error, Message: message}); err != nil {
+		ah.logger.Error("Failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/logger"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+func TestAdminTokenMiddleware(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+	_, leveler, err := logger.NewLeveled(logger.Config{Level: logger.LevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ah := NewAdminHandler(leveler, testLogger)
+	handler := ah.TokenMiddleware(token)(http.HandlerFunc(ah.SetLogLevel))
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		level  logger.LogLevel
+	}{
+		{"without token", "", http.StatusUnauthorized, logger.LevelInfo},
+		{"wrong token", strings.Repeat("x", len(token)), http.StatusUnauthorized, logger.LevelInfo},
+		{"admin token", token, http.StatusOK, logger.LevelDebug},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/v1/admin/log-level", strings.NewReader(`{"level":"debug"}`))
+			if tt.token != "" {
+				r.Header.Set(headerAdminToken, tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if current, _, _ := leveler.Level(); current != tt.level {
+				t.Fatalf("log level %s, want %s", current, tt.level)
+			}
+		})
+	}
+}
+
+func TestRegisterAdminRoutes(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+	cfg := config.Load().Execution
+	ws := service.NewWebhookService(cfg, service.NewLocalGroupSemaphore(0, nil), service.NewMemoryExecutionStore(time.Hour), nil, testLogger)
+	ph := NewParallelHandler(ws, cfg, testLogger)
+	_, leveler, err := logger.NewLeveled(logger.Config{Level: logger.LevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ah := NewAdminHandler(leveler, testLogger)
+
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+		status     int
+	}{
+		{"disabled", "", token, http.StatusNotFound},
+		{"without token", token, "", http.StatusUnauthorized},
+		{"admin token", token, token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			RegisterAdminRoutes(router.PathPrefix("/v1").Subrouter(), tt.configured, ah, ph)
+
+			for _, path := range []string{"/v1/admin/execution-store", "/v1/admin/log-level"} {
+				r := httptest.NewRequest(http.MethodGet, path, nil)
+				if tt.sent != "" {
+					r.Header.Set(headerAdminToken, tt.sent)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				if w.Code != tt.status {
+					t.Errorf("GET %s: status %d, want %d", path, w.Code, tt.status)
+				}
+			}
+		})
+	}
+}
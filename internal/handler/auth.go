@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+)
+
+// JWTMiddleware rejects API requests without a valid bearer token with 401. The subject of the
+// token is passed on in the request context, it is logged with the request and its executions.
+func (ph *ParallelHandler) JWTMiddleware(verifier *auth.JWTVerifier) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				w.Header().Set("Content-Type", "application/json")
+				ph.sendErrorResponse(w, r, http.StatusUnauthorized, "unauthorized", "a bearer token is required")
+				return
+			}
+
+			subject, err := verifier.Verify(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				if !errors.Is(err, auth.ErrInvalidToken) {
+					// The keys couldn't be fetched, the token may well be valid
+					ph.loggerFor(r).Error("Failed to verify token", "error", err)
+					ph.sendErrorResponse(w, r, http.StatusServiceUnavailable, "authentication unavailable", "failed to load the token signing keys")
+					return
+				}
+				ph.loggerFor(r).Warn("Rejected request with invalid token", "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				ph.sendErrorResponse(w, r, http.StatusUnauthorized, "unauthorized", err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithSubject(r.Context(), subject)))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// maxBulkLines is the number of lines a bulk submission may have
+const maxBulkLines = 1000
+
+// Bulk handles the /v1/parallels/bulk endpoint. The body is NDJSON with an execution request per
+// line, each is started asynchronously like with mode=async. Lines are independent: rejected ones
+// are reported next to the ids of the started executions, in line order.
+func (ph *ParallelHandler) Bulk(w http.ResponseWriter, r *http.Request) {
+	reader := bufio.NewReader(r.Body)
+	response := models.BulkResponse{Executions: []models.BulkLineResult{}}
+	reject := func(line int, errResponse *models.ErrorResponse) {
+		response.Rejected++
+		response.Executions = append(response.Executions, models.BulkLineResult{Line: line, ErrorResponse: errResponse})
+	}
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			ph.loggerFor(r).Error("Failed to read bulk submission", "line", line, "error", err)
+			reject(line, &models.ErrorResponse{Error: "invalid request body", Message: localize(requestLocale(r), "failed to read request body")})
+			break
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if len(response.Executions) == maxBulkLines {
+				reject(line, &models.ErrorResponse{
+					Error:   "too many executions",
+					Message: localize(requestLocale(r), "at most %d lines can be submitted at once, this and the following lines were skipped", maxBulkLines),
+				})
+				break
+			}
+			result := ph.submitBulkLine(r, line, data)
+			if result.ErrorResponse != nil {
+				response.Rejected++
+			} else {
+				response.Accepted++
+			}
+			response.Executions = append(response.Executions, result)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	ph.loggerFor(r).Info("Received bulk submission",
+		"accepted", response.Accepted,
+		"rejected", response.Rejected)
+
+	statusCode := http.StatusAccepted
+	if response.Accepted == 0 {
+		statusCode = http.StatusBadRequest
+	}
+	ph.sendJSONResponse(w, statusCode, response)
+}
+
+// submitBulkLine validates the execution request of a line and starts it
+func (ph *ParallelHandler) submitBulkLine(r *http.Request, line int, data []byte) models.BulkLineResult {
+	request, err := ph.decodeExecuteRequest(bytes.NewReader(data))
+	if err != nil {
+		ph.loggerFor(r).Error("Failed to decode bulk execution request", "line", line, "error", err)
+		return models.BulkLineResult{Line: line, ErrorResponse: &models.ErrorResponse{
+			Error:   "invalid request body",
+			Message: localize(requestLocale(r), "failed to parse JSON payload"),
+		}}
+	}
+	if _, errResponse := ph.checkExecuteRequest(r, request); errResponse != nil {
+		return models.BulkLineResult{Line: line, ErrorResponse: errResponse}
+	}
+	if wait, ok := ph.allowPayloads(r, request.Payloads.Len()); !ok {
+		request.ClosePayloads()
+		return models.BulkLineResult{Line: line, ErrorResponse: &models.ErrorResponse{
+			Error:   "rate limit exceeded",
+			Message: localize(requestLocale(r), "more than %d payloads per minute, retry after %d seconds", ph.config.RateLimitPayloads, retryAfterSeconds(wait)),
+		}}
+	}
+
+	payloads := request.Payloads.Len()
+	id, err := ph.webhookService.ExecuteAsync(r.Context(), request)
+	if err != nil {
+		_, message := executionError(err)
+		return models.BulkLineResult{Line: line, ErrorResponse: &models.ErrorResponse{Error: message, Message: err.Error()}}
+	}
+
+	ph.loggerFor(r).Info("Started bulk execution",
+		"line", line,
+		"execution_id", id,
+		"payloads_count", payloads)
+	statusURL := "/v1/parallels/executions/" + id
+	return models.BulkLineResult{Line: line, ExecutionID: id, Status: service.StateRunning, StatusURL: statusURL}
+}
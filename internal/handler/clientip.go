@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type clientIPKey struct{}
+
+// ClientIPMiddleware resolves the real client address of requests passing through trusted
+// proxies from their X-Forwarded-For or X-Real-IP headers. Forwarding headers of untrusted
+// peers are ignored, so clients can't spoof their address.
+func ClientIPMiddleware(trustedProxies []netip.Prefix) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedProxies)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		})
+	}
+}
+
+// clientIP returns the client address resolved by ClientIPMiddleware. Without the middleware it
+// is the address of the peer without its port, forwarding headers are never read.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r, nil)
+}
+
+// resolveClientIP walks X-Forwarded-For from the right, skipping trusted proxies,
+// the first untrusted address is the client
+func resolveClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(remote, trustedProxies) {
+		return host
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	client := ""
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !isTrusted(addr, trustedProxies) {
+			return client
+		}
+	}
+	if client != "" {
+		return client
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   string
+		realIP         string
+		trustedProxies []netip.Prefix
+		want           string
+	}{
+		{"no trusted proxies ignores X-Forwarded-For", "198.51.100.4:5123", "203.0.113.7", "", nil, "198.51.100.4"},
+		{"no trusted proxies ignores X-Real-IP", "198.51.100.4:5123", "", "203.0.113.7", nil, "198.51.100.4"},
+		{"untrusted peer", "198.51.100.4:5123", "203.0.113.7", "203.0.113.8", trusted, "198.51.100.4"},
+		{"trusted proxy", "10.0.0.2:5123", "203.0.113.7", "", trusted, "203.0.113.7"},
+		{"spoofed entries left of the client", "10.0.0.2:5123", "192.0.2.1, 203.0.113.7, 10.0.0.3", "", trusted, "203.0.113.7"},
+		{"X-Real-IP of a trusted proxy", "10.0.0.2:5123", "", "203.0.113.7", trusted, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/parallels/jobs", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := resolveClientIP(r, tt.trustedProxies); got != tt.want {
+				t.Fatalf("resolveClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitIgnoresForwardingHeadersOfUntrustedPeers(t *testing.T) {
+	cfg := config.Load().Execution
+	cfg.RateLimitRequests = 1
+	ph := NewParallelHandler(nil, cfg, testLogger)
+	limited := ph.RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name    string
+		peer    string
+		handler http.Handler
+	}{
+		{"with ClientIPMiddleware", "198.51.100.4", ClientIPMiddleware(nil)(limited)},
+		{"without ClientIPMiddleware", "198.51.100.5", limited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every request comes over a new connection and claims another address
+			var codes []int
+			for i, forwardedFor := range []string{"203.0.113.7", "203.0.113.8"} {
+				r := httptest.NewRequest(http.MethodGet, "/v1/parallels/jobs", nil)
+				r.RemoteAddr = fmt.Sprintf("%s:%d", tt.peer, 5123+i)
+				r.Header.Set("X-Forwarded-For", forwardedFor)
+				w := httptest.NewRecorder()
+				tt.handler.ServeHTTP(w, r)
+				codes = append(codes, w.Code)
+			}
+			if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+				t.Fatalf("status codes %v, want the second request limited", codes)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// decodeExecuteRequest decodes an execution request without buffering the whole body, so
+// that large payload arrays can be spooled to disk while they are read
+func (ph *ParallelHandler) decodeExecuteRequest(body io.Reader) (*models.ParallelExecuteRequest, error) {
+	dec := json.NewDecoder(body)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("request body must be a JSON object")
+	}
+
+	var payloads models.Payloads
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			payloads.Close()
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		if key == "payloads" {
+			payloads.Close() // duplicate key, the last one wins
+			payloads, err = models.DecodePayloads(dec, ph.config.PayloadSpoolThreshold, ph.config.PayloadSpoolDir)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			payloads.Close()
+			return nil, err
+		}
+		fields[key] = value
+	}
+	if _, err := dec.Token(); err != nil {
+		payloads.Close()
+		return nil, err
+	}
+
+	// Decode the remaining fields as usual
+	data, err := json.Marshal(fields)
+	if err != nil {
+		payloads.Close()
+		return nil, err
+	}
+	var request models.ParallelExecuteRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		payloads.Close()
+		return nil, err
+	}
+	request.Payloads = payloads
+
+	return &request, nil
+}
@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// GetExecution handles the /v1/parallels/executions/{id} endpoint, returning the state of a
+// recorded execution and its results once finished
+func (ph *ParallelHandler) GetExecution(w http.ResponseWriter, r *http.Request) {
+	record, err := ph.webhookService.GetExecution(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, service.ErrExecutionNotFound) {
+			ph.sendErrorResponse(w, r, http.StatusNotFound, "execution not found", err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrExecutionArchived) {
+			ph.sendErrorResponse(w, r, http.StatusGone, "execution archived", err.Error())
+			return
+		}
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+
+	ph.sendCacheableJSONResponse(w, r, record)
+}
+
+// RestoreExecution handles POST /v1/parallels/executions/{id}/restore, moving an archived
+// execution back into the execution store and returning its record
+func (ph *ParallelHandler) RestoreExecution(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, err := ph.webhookService.RestoreExecution(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRequest):
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "archive disabled", err.Error())
+		case errors.Is(err, service.ErrExecutionNotFound):
+			ph.sendErrorResponse(w, r, http.StatusNotFound, "execution not found", err.Error())
+		case errors.Is(err, service.ErrJobStateConflict):
+			ph.sendErrorResponse(w, r, http.StatusConflict, "execution not archived", err.Error())
+		default:
+			ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		}
+		return
+	}
+
+	ph.loggerFor(r).Info("Restored archived execution", "execution_id", record.ExecutionID)
+	ph.sendJSONResponse(w, http.StatusOK, record)
+}
+
+// ExecutionResults handles the /v1/parallels/executions/{id}/results endpoint, returning the results
+// of a finished execution as often as needed while it is retained. ?only=failed or ?only=succeeded
+// and ?filter=status_code>=500 filter the results, ?fields=index,error projects them to the listed
+// fields.
+func (ph *ParallelHandler) ExecutionResults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var fields []string
+	if value := r.URL.Query().Get("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if !resultFields[field] {
+				ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid fields", localize(requestLocale(r), "unknown result field %q", field))
+				return
+			}
+			fields = append(fields, field)
+		}
+	}
+
+	record, err := ph.webhookService.ExecutionResults(r.Context(), mux.Vars(r)["id"], r.URL.Query().Get("only"), r.URL.Query().Get("filter"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRequest):
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid query", err.Error())
+		case errors.Is(err, service.ErrExecutionNotFound):
+			ph.sendErrorResponse(w, r, http.StatusNotFound, "execution not found", err.Error())
+		case errors.Is(err, service.ErrExecutionArchived):
+			ph.sendErrorResponse(w, r, http.StatusGone, "execution archived", err.Error())
+		case errors.Is(err, service.ErrJobStateConflict):
+			ph.sendErrorResponse(w, r, http.StatusConflict, "execution not finished", err.Error())
+		default:
+			ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		}
+		return
+	}
+
+	results, err := projectResults(record.Results, fields)
+	if err != nil {
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+	ph.sendCacheableJSONResponse(w, r, map[string]interface{}{
+		"execution_id": record.ExecutionID,
+		"status":       record.Status,
+		"count":        len(record.Results),
+		"results":      results,
+	})
+}
+
+// resultFields are the fields results can be projected to
+var resultFields = map[string]bool{
+	"index": true, "success": true, "response": true, "truncated": true, "status_code": true, "response_headers": true,
+	"error": true, "error_code": true,
+	"duration_ms": true, "sha256": true, "timings": true, "attempts": true, "attempt_durations_ms": true,
+	"compensated": true, "compensation_error": true, "payload_bytes": true,
+	"skipped": true, "duplicate_of": true, "seq": true,
+}
+
+// projectResults reduces results to the given JSON fields, all fields are kept if there are none.
+// The index is always kept so projected results can be matched with their payloads.
+func projectResults(results []models.WebhookResult, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return results, nil
+	}
+
+	projected := make([]map[string]json.RawMessage, 0, len(results))
+	for _, result := range results {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &all); err != nil {
+			return nil, err
+		}
+
+		item := map[string]json.RawMessage{"index": all["index"]}
+		for _, field := range fields {
+			// Fields omitted because they are empty stay omitted
+			if value, ok := all[field]; ok {
+				item[field] = value
+			}
+		}
+		projected = append(projected, item)
+	}
+	return projected, nil
+}
+
+// CancelExecution handles DELETE /v1/parallels/executions/{id}, canceling the remaining tasks of a
+// running execution and returning its partial results
+func (ph *ParallelHandler) CancelExecution(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, err := ph.webhookService.CancelExecution(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExecutionNotFound):
+			ph.sendErrorResponse(w, r, http.StatusNotFound, "execution not found", err.Error())
+		case errors.Is(err, service.ErrJobStateConflict):
+			ph.sendErrorResponse(w, r, http.StatusConflict, "invalid execution state", err.Error())
+		default:
+			ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		}
+		return
+	}
+
+	ph.loggerFor(r).Info("Canceled execution",
+		"execution_id", response.ExecutionID,
+		"total_requests", response.Summary.TotalRequests,
+		"canceled_requests", response.Summary.CanceledRequests)
+	ph.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// Number of executions returned by a search or a page of the history
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// SearchExecutions handles the /v1/parallels/executions/search endpoint, finding the stored
+// executions with error messages containing all terms of the q parameter
+func (ph *ParallelHandler) SearchExecutions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid query", "q must not be empty")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxSearchLimit {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid limit", "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	matches, err := ph.webhookService.SearchExecutions(r.Context(), query, limit)
+	if err != nil {
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+
+	ph.sendJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"executions": matches,
+	})
+}
+
+// ListExecutions handles the /v1/parallels/executions endpoint, browsing the stored executions
+// newest first. They can be filtered by status, mode, concurrency_group, webhook_url and the
+// from/to range of their creation time; pages are continued with the cursor parameter.
+func (ph *ParallelHandler) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	filter := models.ExecutionFilter{
+		Status:           query.Get("status"),
+		Mode:             query.Get("mode"),
+		ConcurrencyGroup: query.Get("concurrency_group"),
+		WebhookURL:       query.Get("webhook_url"),
+		Limit:            defaultSearchLimit,
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxSearchLimit {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid limit", "limit must be between 1 and 500")
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	// Stored timestamps are RFC 3339 in UTC, the bounds are compared in the same format
+	for _, bound := range []struct {
+		name  string
+		value *string
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid "+bound.name,
+				bound.name+" must be an RFC 3339 timestamp, e.g. 2024-01-15T10:30:00Z")
+			return
+		}
+		*bound.value = t.UTC().Format(time.RFC3339)
+	}
+
+	page, err := ph.webhookService.ListExecutions(r.Context(), filter, query.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRequest) {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid query", err.Error())
+			return
+		}
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+
+	for i := range page.Executions {
+		self := "/v1/parallels/executions/" + url.PathEscape(page.Executions[i].ExecutionID)
+		page.Executions[i].Links = models.ExecutionLinks{Self: self, Results: self + "/results", Stream: self + "/stream"}
+	}
+	ph.sendJSONResponse(w, http.StatusOK, page)
+}
+
+// ExecutionStoreStats handles the /v1/admin/execution-store endpoint, describing the stored
+// executions and the rows purged by the retention policy
+func (ph *ParallelHandler) ExecutionStoreStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	stats, err := ph.webhookService.ExecutionStoreStats(r.Context())
+	if err != nil {
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+		return
+	}
+	ph.sendJSONResponse(w, http.StatusOK, stats)
+}
+
+// StreamExecution handles the /v1/parallels/executions/{id}/stream endpoint, sending the results
+// of an asynchronous execution as Server-Sent Events the moment they complete: a "result" event
+// per result and a final "summary" event with the execution record without results.
+func (ph *ParallelHandler) StreamExecution(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", "streaming is not supported")
+		return
+	}
+
+	// The stream lasts as long as the execution, the server write timeout doesn't apply
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		ph.loggerFor(r).Warn("Failed to clear write deadline of the stream", "error", err)
+	}
+
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // don't let nginx buffer the events
+		w.WriteHeader(http.StatusOK)
+	}
+	emit := func(event string, data interface{}) error {
+		start()
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	err := ph.webhookService.StreamExecution(r.Context(), mux.Vars(r)["id"],
+		func(result models.WebhookResult) error { return emit("result", result) },
+		func(record *models.ExecutionRecord) error { return emit("summary", record) },
+	)
+	if err == nil || started {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, service.ErrExecutionNotFound) {
+		ph.sendErrorResponse(w, r, http.StatusNotFound, "execution not found", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrExecutionArchived) {
+		ph.sendErrorResponse(w, r, http.StatusGone, "execution archived", err.Error())
+		return
+	}
+	ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+func TestExecutionResultsProjectsDuplicateFields(t *testing.T) {
+	cfg := config.Load().Execution
+	store := service.NewMemoryExecutionStore(0)
+	ws := service.NewWebhookService(cfg, service.NewLocalGroupSemaphore(0, nil), store, nil, testLogger)
+	ph := NewParallelHandler(ws, cfg, testLogger)
+
+	if err := store.Save(context.Background(), &models.ExecutionRecord{
+		ExecutionID: "exec-1",
+		Status:      service.StateCompleted,
+		FinishedAt:  "2026-01-02T03:04:05Z",
+		Results: []models.WebhookResult{
+			{Index: 0, Success: true, Duration: 10},
+			{Index: 1, Skipped: true, DuplicateOf: &models.DuplicateRef{ExecutionID: "exec-0", Index: 4}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/parallels/executions/exec-1/results?fields=skipped,duplicate_of", nil)
+	r = mux.SetURLVars(r, map[string]string{"id": "exec-1"})
+	w := httptest.NewRecorder()
+	ph.ExecutionResults(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Results []map[string]json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Results) != 2 || len(body.Results[0]) != 1 {
+		t.Fatalf("results %s, want the first one reduced to its index", w.Body.String())
+	}
+	duplicate := body.Results[1]
+	if string(duplicate["skipped"]) != "true" || string(duplicate["duplicate_of"]) != `{"execution_id":"exec-0","index":4}` || len(duplicate) != 3 {
+		t.Fatalf("duplicate projected to %s", w.Body.String())
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// testLogger discards everything
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestHandler creates a handler without a service and with the default configuration, its
+// clock is a fake starting at start
+func newTestHandler(start time.Time) (*ParallelHandler, *fakeClock) {
+	ph := NewParallelHandler(nil, config.Load().Execution, testLogger)
+	clock := &fakeClock{now: start}
+	ph.clock = clock
+	return ph, clock
+}
+
+// fakeClock only moves when advanced, timers fire once their time was passed
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	c     chan time.Time
+	f     func()
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) service.Timer {
+	return c.add(d, nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) service.Timer {
+	return c.add(d, f)
+}
+
+func (c *fakeClock) add(d time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and fires the timers due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	now := c.now
+	c.mu.Unlock()
+
+	for _, t := range due {
+		if t.f != nil {
+			go t.f()
+		} else {
+			t.c <- now
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// ListJobs handles the /v1/parallels/jobs endpoint, listing all running executions
+func (ph *ParallelHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	ph.sendCacheableJSONResponse(w, r, map[string]interface{}{
+		"jobs": ph.webhookService.ListJobs(),
+	})
+}
+
+// GetJob handles the /v1/parallels/jobs/{id} endpoint
+func (ph *ParallelHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ph.webhookService.GetJob(mux.Vars(r)["id"])
+	if err != nil {
+		ph.sendJobError(w, r, err)
+		return
+	}
+
+	ph.sendCacheableJSONResponse(w, r, job)
+}
+
+// JobLog handles the /v1/parallels/jobs/{id}/log endpoint, returning the event log of a running
+// or recorded execution
+func (ph *ParallelHandler) JobLog(w http.ResponseWriter, r *http.Request) {
+	log, err := ph.webhookService.JobLog(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		ph.sendJobError(w, r, err)
+		return
+	}
+
+	ph.sendCacheableJSONResponse(w, r, log)
+}
+
+// PauseJob handles the /v1/parallels/jobs/{id}/pause endpoint.
+// No new tasks are dispatched until the job is resumed, in-flight tasks finish normally. Jobs
+// which aren't resumed within PAUSE_TTL are canceled.
+func (ph *ParallelHandler) PauseJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ph.webhookService.PauseJob(mux.Vars(r)["id"])
+	if err != nil {
+		ph.sendJobError(w, r, err)
+		return
+	}
+
+	ph.sendJSONResponse(w, http.StatusOK, job)
+}
+
+// ResumeJob handles the /v1/parallels/jobs/{id}/resume endpoint
+func (ph *ParallelHandler) ResumeJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ph.webhookService.ResumeJob(mux.Vars(r)["id"])
+	if err != nil {
+		ph.sendJobError(w, r, err)
+		return
+	}
+
+	ph.sendJSONResponse(w, http.StatusOK, job)
+}
+
+// ContinueJob handles the /v1/parallels/jobs/{id}/continue endpoint, executing the remaining
+// payloads of a canary execution and returning their results
+func (ph *ParallelHandler) ContinueJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response, err := ph.webhookService.ContinueJob(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) || errors.Is(err, service.ErrJobStateConflict) {
+			ph.sendJobError(w, r, err)
+			return
+		}
+		ph.sendExecutionError(w, r, err)
+		return
+	}
+
+	ph.sendExecutionResponse(w, r, response)
+}
+
+// sendJobError maps job errors of the service to error responses
+func (ph *ParallelHandler) sendJobError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		ph.sendErrorResponse(w, r, http.StatusNotFound, "job not found", err.Error())
+	case errors.Is(err, service.ErrJobStateConflict):
+		ph.sendErrorResponse(w, r, http.StatusConflict, "invalid job state", err.Error())
+	case errors.Is(err, service.ErrExecutionArchived):
+		ph.sendErrorResponse(w, r, http.StatusGone, "execution archived", err.Error())
+	default:
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", err.Error())
+	}
+}
+
+// sendCacheableJSONResponse sends a JSON response with an ETag of its body. Pollers sending a
+// matching If-None-Match header get 304 Not Modified without a body.
+func (ph *ParallelHandler) sendCacheableJSONResponse(w http.ResponseWriter, r *http.Request, response interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(response); err != nil {
+		ph.loggerFor(r).Error("Failed to encode response", "error", err)
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", "failed to encode response")
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	ph.setResultSignature(w, r, body.Bytes())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body.Bytes()); err != nil {
+		ph.loggerFor(r).Error("Failed to write response", "error", err)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
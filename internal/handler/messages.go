@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is the language messages are written in, used if the caller accepts no other
+// language of the catalog
+const defaultLocale = "en"
+
+// messageCatalog translates the messages of error responses, by language and the English
+// message or format. Messages without a translation, e.g. errors of the service, stay English.
+var messageCatalog = map[string]map[string]string{
+	"zh": {
+		// Fixed messages
+		"only GET method is supported":                               "仅支持 GET 方法",
+		"only POST method is supported":                              "仅支持 POST 方法",
+		"mode must be 'sync' or 'async'":                             "mode 必须为 'sync' 或 'async'",
+		"failed to parse JSON payload":                               "无法解析 JSON 请求体",
+		"failed to read request body":                                "无法读取请求体",
+		"failed to encode response":                                  "响应编码失败",
+		"streaming is not supported":                                 "不支持流式传输",
+		"limit must be between 1 and 500":                            "limit 必须介于 1 到 500 之间",
+		"q must not be empty":                                        "q 不能为空",
+		"url must not be empty":                                      "url 不能为空",
+		"timeout must be between 1 and 60 seconds":                   "timeout 必须介于 1 到 60 秒之间",
+		"a bearer token is required":                                 "需要提供 Bearer 令牌",
+		"failed to load the token signing keys":                      "无法加载令牌签名密钥",
+		"the signature must be hex encoded":                          "签名必须为十六进制编码",
+		"the timestamp must be in unix seconds":                      "时间戳必须为 Unix 秒",
+		"the timestamp is outside of the tolerance":                  "时间戳超出允许的偏差范围",
+		"the signature doesn't match the request":                    "签名与请求不匹配",
+		"the nonce was already used":                                 "nonce 已被使用",
+		"the replica keeping the execution can't be reached":         "无法连接保存该执行的副本",
+		"payloads array cannot be empty":                             "payloads 数组不能为空",
+		"tasks can't be used together with webhook_url and payloads": "tasks 不能与 webhook_url 和 payloads 同时使用",
+		"payload_query can't be combined with payloads or tasks":     "payload_query 不能与 payloads 或 tasks 同时使用",
+		"payload_query can't be used in follow-ups":                  "payload_query 不能用于后续执行",
+
+		// Formats
+		"the %s, %s and %s headers are required":                                               "必须提供 %s、%s 和 %s 请求头",
+		"the nonce must have %d to %d characters without dots or spaces":                       "nonce 必须为 %d 到 %d 个字符，且不含点或空格",
+		"more than %d requests per minute":                                                     "每分钟请求数超过 %d",
+		"more than %d payloads per minute":                                                     "每分钟载荷数超过 %d",
+		"more than %d payloads per minute, retry after %d seconds":                             "每分钟载荷数超过 %d，请在 %d 秒后重试",
+		"at most %d lines can be submitted at once, this and the following lines were skipped": "一次最多提交 %d 行，本行及之后的行已跳过",
+		"unknown result field %q":                                                              "未知的结果字段 %q",
+		"payload of task %d must be a JSON object":                                             "第 %d 个任务的 payload 必须是 JSON 对象",
+		"failed to run payload query %q":                                                       "无法执行载荷查询 %q",
+		"failed to connect to the database of payload query %q":                                "无法连接载荷查询 %q 的数据库",
+
+		// Validation rules
+		"%s is required":         "%s 为必填项",
+		"%s must be a valid URL": "%s 必须是有效的 URL",
+		"%s must be one of: %s":  "%s 必须是以下值之一：%s",
+		"%s must be at least %s": "%s 不能小于 %s",
+		"%s must be at most %s":  "%s 不能大于 %s",
+		"%s failed the %s rule":  "%s 未通过 %s 校验",
+	},
+}
+
+// requestLocale picks the language of the catalog the caller prefers most by its
+// Accept-Language header, e.g. "zh" for "zh-CN,zh;q=0.9,en;q=0.8"
+func requestLocale(r *http.Request) string {
+	locale, best := defaultLocale, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := messageCatalog[language]; (ok || language == defaultLocale) && quality > best {
+			locale, best = language, quality
+		}
+	}
+	return locale
+}
+
+// localize translates a message or format to locale and formats it with args
+func localize(locale, format string, args ...interface{}) string {
+	if translated, ok := messageCatalog[locale][format]; ok {
+		format = translated
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -1,14 +1,20 @@
 package handler
 
 import (
-	"context"
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 
+	"github.com/mylxsw/n8n-parallels/internal/config"
 	"github.com/mylxsw/n8n-parallels/internal/models"
 	"github.com/mylxsw/n8n-parallels/internal/service"
 )
@@ -16,16 +22,26 @@ import (
 // ParallelHandler handles parallel execution requests
 type ParallelHandler struct {
 	webhookService *service.WebhookService
+	config         config.ExecutionConfig
 	validator      *validator.Validate
 	logger         *slog.Logger
+
+	requestLimiter *rateLimiter // API requests per caller, nil is unlimited
+	payloadLimiter *rateLimiter // submitted payloads per caller, nil is unlimited
+
+	clock service.Clock // of request signatures, replaced in tests
 }
 
 // NewParallelHandler creates a new parallel handler instance
-func NewParallelHandler(webhookService *service.WebhookService, logger *slog.Logger) *ParallelHandler {
+func NewParallelHandler(webhookService *service.WebhookService, cfg config.ExecutionConfig, logger *slog.Logger) *ParallelHandler {
 	return &ParallelHandler{
 		webhookService: webhookService,
-		validator:      validator.New(),
+		config:         cfg,
+		validator:      newValidator(),
 		logger:         logger,
+		requestLimiter: newRateLimiter(cfg.RateLimitRequests),
+		payloadLimiter: newRateLimiter(cfg.RateLimitPayloads),
+		clock:          service.SystemClock,
 	}
 }
 
@@ -36,81 +52,315 @@ func (ph *ParallelHandler) Execute(w http.ResponseWriter, r *http.Request) {
 
 	// Validate HTTP method
 	if r.Method != http.MethodPost {
-		ph.sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed", "only POST method is supported")
+		ph.sendErrorResponse(w, r, http.StatusMethodNotAllowed, "method not allowed", "only POST method is supported")
 		return
 	}
 
-	// Parse request body
-	var request models.ParallelExecuteRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		ph.logger.Error("Failed to decode request body", "error", err)
-		ph.sendErrorResponse(w, http.StatusBadRequest, "invalid request body", "failed to parse JSON payload")
+	// Asynchronous executions return right away, their results are fetched later
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "sync" && mode != "async" {
+		ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid mode", "mode must be 'sync' or 'async'")
 		return
 	}
 
-	// Set default timeout if not provided
-	if request.Timeout == 0 {
-		request.Timeout = 60 // Default 60 seconds
+	// Parse request body, large payload arrays are spooled to disk
+	request, err := ph.decodeExecuteRequest(r.Body)
+	if err != nil {
+		ph.loggerFor(r).Error("Failed to decode request body", "error", err)
+		ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid request body", "failed to parse JSON payload")
+		return
 	}
 
 	// Validate request
-	if err := ph.validator.Struct(&request); err != nil {
-		ph.logger.Error("Request validation failed", "error", err)
-		ph.sendErrorResponse(w, http.StatusBadRequest, "validation failed", err.Error())
+	if statusCode, errResponse := ph.checkExecuteRequest(r, request); errResponse != nil {
+		ph.sendJSONResponse(w, statusCode, errResponse)
 		return
 	}
-
-	// Additional validation for payloads
-	if len(request.Payloads) == 0 {
-		ph.sendErrorResponse(w, http.StatusBadRequest, "validation failed", "payloads array cannot be empty")
+	if wait, ok := ph.allowPayloads(r, request.Payloads.Len()); !ok {
+		request.ClosePayloads()
+		ph.sendRateLimited(w, r, wait, localize(requestLocale(r), "more than %d payloads per minute", ph.config.RateLimitPayloads))
 		return
 	}
 
 	// Log the incoming request
-	ph.logger.Info("Received parallel execution request",
+	ph.loggerFor(r).Info("Received parallel execution request",
 		"webhook_url", request.WebhookURL,
-		"payloads_count", len(request.Payloads),
+		"payloads_count", request.Payloads.Len(),
+		"payloads_spooled", request.Payloads.Spooled(),
 		"timeout", request.Timeout,
-		"has_auth", request.AuthHeader != "",
-		"remote_addr", r.RemoteAddr,
+		"has_auth", request.AuthHeader != "" || request.Auth != nil,
+		"concurrency_group", request.ConcurrencyGroup,
+		"async", mode == "async",
+		"remote_addr", clientIP(r),
 		"user_agent", r.Header.Get("User-Agent"))
 
-	// Create context for the request with a slightly longer timeout to allow cleanup
-	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(request.Timeout+5)*time.Second)
-	defer cancel()
+	if mode == "async" {
+		id, err := ph.webhookService.ExecuteAsync(r.Context(), request)
+		if err != nil {
+			ph.sendExecutionError(w, r, err)
+			return
+		}
+
+		statusURL := "/v1/parallels/executions/" + id
+		w.Header().Set("Location", statusURL)
+		ph.sendJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+			"execution_id": id,
+			"status":       service.StateRunning,
+			"status_url":   statusURL,
+		})
+		return
+	}
+
+	// Results are written as they complete if the client accepts NDJSON
+	if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		ph.executeStreaming(w, r, request)
+		return
+	}
 
 	// Execute parallel webhooks
-	response := ph.webhookService.ExecuteParallel(ctx, &request)
+	response, err := ph.webhookService.ExecuteParallel(r.Context(), request)
+	if err != nil {
+		ph.sendExecutionError(w, r, err)
+		return
+	}
+
+	ph.sendExecutionResponse(w, r, response)
+}
+
+// ndjsonContentType is the media type of newline-delimited JSON responses
+const ndjsonContentType = "application/x-ndjson"
+
+// executeStreaming runs an execution writing every result as a line of JSON the moment it
+// completes, followed by a line with the summary. Errors before the first result are sent as
+// regular error responses.
+func (ph *ParallelHandler) executeStreaming(w http.ResponseWriter, r *http.Request, request *models.ParallelExecuteRequest) {
+	// The response lasts as long as the execution, the server write timeout doesn't apply
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		ph.loggerFor(r).Warn("Failed to clear write deadline of the stream", "error", err)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.Header().Set("X-Accel-Buffering", "no") // don't let nginx buffer the lines
+			w.WriteHeader(http.StatusOK)
+		}
+	}
 
+	response, err := ph.webhookService.ExecuteStreaming(r.Context(), request, func(result models.StreamedResult) {
+		start()
+		lines := []interface{}{result}
+		switch {
+		case request.Output == models.OutputN8NItems:
+			lines[0] = models.N8NItem{JSON: result, PairedItem: models.N8NPairedItem{Item: result.Index}}
+		case request.Output == models.OutputMerged && result.Success:
+			// Every element of the response is a line of its own, failures are sent as results
+			lines = lines[:0]
+			for _, item := range mergedItems(result.WebhookResult) {
+				lines = append(lines, annotateStream(item, result))
+			}
+		}
+		for _, line := range lines {
+			if err := encoder.Encode(line); err != nil {
+				ph.loggerFor(r).Debug("Failed to write streamed result", "index", result.Index, "error", err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		if !started {
+			ph.sendExecutionError(w, r, err)
+			return
+		}
+		ph.loggerFor(r).Error("Streamed execution failed", "error", err)
+		return
+	}
+
+	start()
+	if err := encoder.Encode(streamSummary(response)); err != nil {
+		ph.loggerFor(r).Error("Failed to write execution summary", "error", err)
+		return
+	}
+
+	ph.loggerFor(r).Info("Completed streamed parallel execution request",
+		"execution_id", response.ExecutionID,
+		"total_requests", response.Summary.TotalRequests,
+		"successful_requests", response.Summary.SuccessfulRequests,
+		"failed_requests", response.Summary.FailedRequests,
+		"duration_ms", response.Summary.TotalDuration)
+}
+
+// streamSummary is the final message of a streamed execution, the response without its results
+func streamSummary(response *models.ParallelExecuteResponse) map[string]interface{} {
+	final := map[string]interface{}{
+		"execution_id":      response.ExecutionID,
+		"summary":           response.Summary,
+		"effective_options": response.Options,
+	}
+	if response.Status != "" {
+		final["status"] = response.Status
+		final["pending_requests"] = response.PendingRequests
+	}
+	return final
+}
+
+// sendExecutionResponse sends the results of an execution
+func (ph *ParallelHandler) sendExecutionResponse(w http.ResponseWriter, r *http.Request, response *models.ParallelExecuteResponse) {
 	// Set appropriate status code based on results
 	statusCode := http.StatusOK
 	if response.Summary.SuccessfulRequests == 0 {
 		statusCode = http.StatusMultiStatus // 207 when all requests failed but the operation itself succeeded
 	}
 
-	// Send response
+	// n8n splits a top-level array into items, the execution is described by headers instead
+	var body interface{} = response
+	if response.Options.Output == models.OutputN8NItems {
+		w.Header().Set("X-Execution-ID", response.ExecutionID)
+		if response.Status != "" {
+			w.Header().Set("X-Execution-Status", response.Status)
+		}
+		items := make([]models.N8NItem, len(response.Results))
+		for i, result := range response.Results {
+			items[i] = n8nItem(result)
+		}
+		body = items
+	}
+
+	// The response bodies are concatenated, only failures are reported as results. The response
+	// is copied as the one of a canary execution is kept for its continuation.
+	if response.Options.Output == models.OutputMerged {
+		merged := *response
+		merged.Merged = []json.RawMessage{}
+		merged.Results = []models.WebhookResult{}
+		for _, result := range response.Results {
+			if result.Success {
+				merged.Merged = append(merged.Merged, mergedItems(result)...)
+			} else {
+				merged.Results = append(merged.Results, result)
+			}
+		}
+		body = &merged
+	}
+
+	// Send response, encoded first so the exact bytes are signed
+	var encoded bytes.Buffer
+	if err := json.NewEncoder(&encoded).Encode(body); err != nil {
+		ph.loggerFor(r).Error("Failed to encode response", "error", err)
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", "failed to encode response")
+		return
+	}
+	ph.setResultSignature(w, r, encoded.Bytes())
 	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		ph.logger.Error("Failed to encode response", "error", err)
-		// At this point, headers are already sent, so we can't change the status code
+	if _, err := w.Write(encoded.Bytes()); err != nil {
+		ph.loggerFor(r).Error("Failed to write response", "error", err)
 		return
 	}
 
-	ph.logger.Info("Completed parallel execution request",
+	ph.loggerFor(r).Info("Completed parallel execution request",
+		"execution_id", response.ExecutionID,
 		"total_requests", response.Summary.TotalRequests,
 		"successful_requests", response.Summary.SuccessfulRequests,
 		"failed_requests", response.Summary.FailedRequests,
 		"timeout_requests", response.Summary.TimeoutRequests,
+		"pending_requests", response.PendingRequests,
 		"duration_ms", response.Summary.TotalDuration,
 		"status_code", statusCode)
 }
 
+// n8nItem wraps a result as an n8n item paired with the input item of its payload
+func n8nItem(result models.WebhookResult) models.N8NItem {
+	return models.N8NItem{JSON: result, PairedItem: models.N8NPairedItem{Item: result.Index}}
+}
+
+// mergedIndexKey is the member added to merged response elements, the index of their payload
+const mergedIndexKey = "_index"
+
+// mergedItems flattens the response of a result into elements annotated with the index of its
+// payload: the elements of an array, or the response itself. Objects get an _index member,
+// other values are wrapped as {"_index": ..., "value": ...}.
+func mergedItems(result models.WebhookResult) []json.RawMessage {
+	if len(result.Response) == 0 {
+		return nil
+	}
+	elements := []json.RawMessage{result.Response}
+	if trimmed := bytes.TrimSpace(result.Response); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			elements = []json.RawMessage{result.Response}
+		}
+	}
+
+	items := make([]json.RawMessage, len(elements))
+	for i, element := range elements {
+		items[i] = annotateIndex(element, result.Index)
+	}
+	return items
+}
+
+// annotateIndex adds the payload index to a response element. The member is appended to
+// objects, so it wins over an _index member the target sent.
+func annotateIndex(element json.RawMessage, index int) json.RawMessage {
+	return annotate(element, fmt.Sprintf("%q:%d", mergedIndexKey, index))
+}
+
+// annotateStream adds the completion order and the execution ID of a streamed result to the
+// elements of its response, next to their _index
+func annotateStream(element json.RawMessage, result models.StreamedResult) json.RawMessage {
+	executionID, _ := json.Marshal(result.ExecutionID)
+	return annotate(element, fmt.Sprintf(`"_seq":%d,"_execution_id":%s`, result.Seq, executionID))
+}
+
+// annotate appends members to an object
+func annotate(element json.RawMessage, annotation string) json.RawMessage {
+	element = bytes.TrimSpace(element)
+	if len(element) < 2 || element[0] != '{' {
+		return json.RawMessage(fmt.Sprintf("{%s,\"value\":%s}", annotation, element))
+	}
+
+	members := bytes.TrimSpace(element[1 : len(element)-1])
+	if len(members) == 0 {
+		return json.RawMessage("{" + annotation + "}")
+	}
+	annotated := make([]byte, 0, len(members)+len(annotation)+3)
+	annotated = append(annotated, '{')
+	annotated = append(annotated, members...)
+	annotated = append(annotated, ',')
+	annotated = append(annotated, annotation...)
+	return append(annotated, '}')
+}
+
+// sendExecutionError maps execution errors of the service to error responses
+func (ph *ParallelHandler) sendExecutionError(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, error := executionError(err)
+	ph.sendErrorResponse(w, r, statusCode, error, err.Error())
+}
+
+// executionError returns the status code and error of an execution error of the service
+func executionError(err error) (int, string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRequest):
+		return http.StatusBadRequest, "validation failed"
+	case errors.Is(err, service.ErrConcurrencyGroupBusy):
+		return http.StatusConflict, "concurrency group busy"
+	case errors.Is(err, service.ErrServerBusy):
+		return http.StatusTooManyRequests, "server busy"
+	default:
+		return http.StatusInternalServerError, "execution failed"
+	}
+}
+
 // Health handles the health check endpoint
 func (ph *ParallelHandler) Health(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
 	if r.Method != http.MethodGet {
-		ph.sendErrorResponse(w, http.StatusMethodNotAllowed, "method not allowed", "only GET method is supported")
+		ph.sendErrorResponse(w, r, http.StatusMethodNotAllowed, "method not allowed", "only GET method is supported")
 		return
 	}
 
@@ -125,13 +375,24 @@ func (ph *ParallelHandler) Health(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// sendErrorResponse sends a JSON error response
-func (ph *ParallelHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, error string, message string) {
+// sendJSONResponse sends a JSON response
+func (ph *ParallelHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ph.logger.Error("Failed to encode response", "error", err)
+	}
+}
+
+// sendErrorResponse sends a JSON error response. The message is translated to the language
+// of the caller if the catalog has it, error stays as it is for clients matching on it.
+func (ph *ParallelHandler) sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, error string, message string) {
 	w.WriteHeader(statusCode)
 	
 	errorResponse := models.ErrorResponse{
 		Error:   error,
-		Message: message,
+		Message: localize(requestLocale(r), message),
 	}
 	
 	if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
@@ -151,12 +412,12 @@ func (ph *ParallelHandler) LoggingMiddleware(next http.Handler) http.Handler {
 		
 		duration := time.Since(start)
 		
-		ph.logger.Info("HTTP request completed",
+		ph.loggerFor(r).Info("HTTP request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status_code", wrapped.statusCode,
 			"duration_ms", duration.Milliseconds(),
-			"remote_addr", r.RemoteAddr,
+			"remote_addr", clientIP(r),
 			"user_agent", r.Header.Get("User-Agent"))
 	})
 }
@@ -170,4 +431,22 @@ type responseWriter struct {
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
-}
\ No newline at end of file
+}
+
+// Flush implements http.Flusher, so streamed responses aren't held back by the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the wrapped writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack implements http.Hijacker, so connections can be upgraded to WebSocket
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.statusCode = http.StatusSwitchingProtocols
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
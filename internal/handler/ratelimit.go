@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+)
+
+// rateLimitSweepInterval is how often the buckets of idle callers are dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitMiddleware limits the API requests of every caller to RATE_LIMIT_REQUESTS per minute.
+// Callers are identified by their JWT subject, by their address without authentication. Rejected
+// requests get 429 with Retry-After, so one workflow stuck in a loop can't take down the server.
+func (ph *ParallelHandler) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait, ok := ph.requestLimiter.take(rateLimitKey(r), 1); !ok {
+			ph.loggerFor(r).Warn("Rejected request over the rate limit", "limit", "requests", "retry_after", wait)
+			ph.sendRateLimited(w, r, wait, localize(requestLocale(r), "more than %d requests per minute", ph.config.RateLimitRequests))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowPayloads takes the payloads of an execution request from the RATE_LIMIT_PAYLOADS budget of
+// the caller, it returns how long to wait if they exceed it
+func (ph *ParallelHandler) allowPayloads(r *http.Request, payloads int) (time.Duration, bool) {
+	wait, ok := ph.payloadLimiter.take(rateLimitKey(r), payloads)
+	if !ok {
+		ph.loggerFor(r).Warn("Rejected request over the rate limit", "limit", "payloads", "payloads_count", payloads, "retry_after", wait)
+	}
+	return wait, ok
+}
+
+// sendRateLimited sends a 429 response asking the caller to retry after wait
+func (ph *ParallelHandler) sendRateLimited(w http.ResponseWriter, r *http.Request, wait time.Duration, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+	ph.sendErrorResponse(w, r, http.StatusTooManyRequests, "rate limit exceeded", message)
+}
+
+// retryAfterSeconds rounds a wait up to the whole seconds of a Retry-After header
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// rateLimitKey identifies the caller of a request
+func rateLimitKey(r *http.Request) string {
+	if subject := auth.Subject(r.Context()); subject != "" {
+		return "subject:" + subject
+	}
+	return "ip:" + clientIP(r)
+}
+
+// tokenBucket is the budget of one caller
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a token bucket per caller holding a minute worth of tokens, which refill
+// continuously. A nil limiter doesn't limit.
+type rateLimiter struct {
+	perMinute float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a limiter allowing perMinute tokens per caller, nil if perMinute is 0
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		perMinute: float64(perMinute),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take removes n tokens from the bucket of key, or returns how long until they are available.
+// Requests for more tokens than the bucket holds pass once it is full and leave it in debt,
+// so large batches are accepted but delay the following ones.
+func (l *rateLimiter) take(key string, n int) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		for k, bucket := range l.buckets {
+			if l.refill(bucket, now) >= l.perMinute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.perMinute, updated: now}
+		l.buckets[key] = bucket
+	}
+	tokens := l.refill(bucket, now)
+
+	needed := math.Min(float64(n), l.perMinute)
+	if tokens < needed {
+		return time.Duration((needed - tokens) / l.perMinute * float64(time.Minute)), false
+	}
+	bucket.tokens -= float64(n)
+	return 0, true
+}
+
+// refill adds the tokens accrued since the last update of a bucket
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	bucket.tokens = math.Min(l.perMinute, bucket.tokens+now.Sub(bucket.updated).Minutes()*l.perMinute)
+	bucket.updated = now
+	return bucket.tokens
+}
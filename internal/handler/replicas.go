@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gorilla/mux"
+)
+
+// headerForwardedByReplica marks requests forwarded by another replica, they are never
+// forwarded again
+const headerForwardedByReplica = "X-Forwarded-By-Replica"
+
+// ReplicaMiddleware forwards the requests for an execution recorded by another replica to that
+// one, e.g. a poll of an asynchronous execution created a moment ago through another replica.
+// Requests without an execution id and those of unknown executions are served locally.
+func (ph *ParallelHandler) ReplicaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		if id == "" || r.Header.Get(headerForwardedByReplica) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		owner, err := ph.webhookService.ExecutionOwner(r.Context(), id)
+		if err != nil {
+			ph.loggerFor(r).Warn("Failed to look up the replica of an execution, serving it locally", "execution_id", id, "error", err)
+		}
+		target, parseErr := url.Parse(owner)
+		if err != nil || owner == "" || parseErr != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			req.Header.Set(headerForwardedByReplica, ph.config.ReplicaURL)
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			ph.loggerFor(r).Error("Failed to forward request to the replica of the execution", "replica", owner, "error", err)
+			w.Header().Set("Content-Type", "application/json")
+			ph.sendErrorResponse(w, r, http.StatusBadGateway, "replica unavailable", "the replica keeping the execution can't be reached")
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// staticOwners knows the owners of a fixed set of executions
+type staticOwners map[string]string
+
+func (o staticOwners) Claim(ctx context.Context, id string) error { return nil }
+
+func (o staticOwners) Owner(ctx context.Context, id string) (string, error) { return o[id], nil }
+
+func TestReplicaMiddlewareForwardsToTheOwner(t *testing.T) {
+	var forwardedBy string
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedBy = r.Header.Get(headerForwardedByReplica)
+		io.WriteString(w, "owner "+r.URL.Path)
+	}))
+	defer owner.Close()
+
+	cfg := config.Load().Execution
+	cfg.ReplicaURL = "http://replica-b:8080"
+	ws := service.NewWebhookService(cfg, service.NewLocalGroupSemaphore(0, nil), service.NewMemoryExecutionStore(0), nil, testLogger)
+	ws.SetExecutionOwners(staticOwners{"exec-a": owner.URL, "exec-b": cfg.ReplicaURL})
+	ph := NewParallelHandler(ws, cfg, testLogger)
+
+	router := mux.NewRouter()
+	router.Use(ph.ReplicaMiddleware)
+	router.HandleFunc("/v1/parallels/executions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "local")
+	})
+	get := func(id string, header http.Header) string {
+		req := httptest.NewRequest(http.MethodGet, "/v1/parallels/executions/"+id, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := get("exec-a", nil); body != "owner /v1/parallels/executions/exec-a" {
+		t.Fatalf("execution of another replica answered %q", body)
+	}
+	if forwardedBy != cfg.ReplicaURL {
+		t.Fatalf("%s = %q, want %q", headerForwardedByReplica, forwardedBy, cfg.ReplicaURL)
+	}
+	if body := get("exec-b", nil); body != "local" {
+		t.Fatalf("own execution answered %q", body)
+	}
+	if body := get("unknown", nil); body != "local" {
+		t.Fatalf("unknown execution answered %q", body)
+	}
+	// Forwarded requests are never forwarded again
+	if body := get("exec-a", http.Header{headerForwardedByReplica: {"http://replica-c:8080"}}); body != "local" {
+		t.Fatalf("forwarded request answered %q", body)
+	}
+}
+
+func TestReplicaMiddlewareReportsUnreachableOwner(t *testing.T) {
+	owner := httptest.NewServer(http.NotFoundHandler())
+	owner.Close()
+
+	cfg := config.Load().Execution
+	cfg.ReplicaURL = "http://replica-b:8080"
+	ws := service.NewWebhookService(cfg, service.NewLocalGroupSemaphore(0, nil), service.NewMemoryExecutionStore(0), nil, testLogger)
+	ws.SetExecutionOwners(staticOwners{"exec-a": owner.URL})
+	ph := NewParallelHandler(ws, cfg, testLogger)
+
+	router := mux.NewRouter()
+	router.Use(ph.ReplicaMiddleware)
+	router.HandleFunc("/v1/parallels/executions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "local")
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/parallels/executions/exec-a", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusBadGateway, rec.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// maxRequestIDLength bounds the request ids accepted from clients
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every API request an id, the X-Request-ID header of the client if
+// it sent a usable one. The id is returned in the X-Request-ID response header and logged with
+// every line of the request and of the executions it starts.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(service.HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(service.HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(service.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID reports whether a client supplied id can be logged and forwarded as is:
+// printable ASCII without spaces, so it can't forge log lines or headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request id
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// loggerFor returns the logger of a request, carrying its id and the authenticated caller
+func (ph *ParallelHandler) loggerFor(r *http.Request) *slog.Logger {
+	logger := ph.logger
+	if id := service.RequestID(r.Context()); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if subject := auth.Subject(r.Context()); subject != "" {
+		logger = logger.With("subject", subject)
+	}
+	return logger
+}
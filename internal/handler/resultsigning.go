@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// setResultSignature sets the X-Result-Signature header to the detached JWS of a response body
+// if results are signed. A body which can't be signed is sent without a signature, consumers
+// verifying signatures reject it.
+func (ph *ParallelHandler) setResultSignature(w http.ResponseWriter, r *http.Request, body []byte) {
+	signer := ph.webhookService.ResultSigner()
+	if signer == nil {
+		return
+	}
+	signature, err := signer.Sign(body)
+	if err != nil {
+		ph.loggerFor(r).Error("Failed to sign response", "error", err)
+		return
+	}
+	w.Header().Set(service.HeaderResultSignature, signature)
+}
+
+// SigningKeys handles the /.well-known/jwks.json endpoint, publishing the public key results
+// are signed with
+func (ph *ParallelHandler) SigningKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	signer := ph.webhookService.ResultSigner()
+	if signer == nil {
+		ph.sendErrorResponse(w, r, http.StatusNotFound, "not found", "results aren't signed")
+		return
+	}
+	document, err := signer.JWKS()
+	if err != nil {
+		ph.sendErrorResponse(w, r, http.StatusInternalServerError, "internal error", "failed to encode response")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(document); err != nil {
+		ph.loggerFor(r).Error("Failed to write response", "error", err)
+	}
+}
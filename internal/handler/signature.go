@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// Headers of signed API requests
+const (
+	HeaderSignature          = "X-Signature"           // "sha256=" followed by the hex encoded HMAC
+	HeaderSignatureTimestamp = "X-Signature-Timestamp" // unix seconds, signed together with the request
+	HeaderSignatureNonce     = "X-Signature-Nonce"     // unique per request, signed together with the request
+)
+
+// Length limits of signature nonces
+const (
+	minSignatureNonceLength = 16
+	maxSignatureNonceLength = 128
+)
+
+// SignatureMiddleware rejects API requests which aren't signed with the shared secret.
+// The signature is the HMAC-SHA256 of "<timestamp>.<nonce>.<method>.<path and query>.<body>";
+// requests with a timestamp outside of the tolerance or a nonce which was already used are
+// rejected, so captured requests can't be replayed or sent to another endpoint. Bodies are
+// buffered while verifying, large ones in the spool directory.
+func (ph *ParallelHandler) SignatureMiddleware(config auth.Config) mux.MiddlewareFunc {
+	tolerance := time.Duration(config.SigningTolerance) * time.Second
+	clock := ph.clock
+	replays := newReplayCache(2*tolerance, clock)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reject := func(message string) {
+				ph.loggerFor(r).Warn("Rejected request with invalid signature", "reason", message)
+				w.Header().Set("Content-Type", "application/json")
+				ph.sendErrorResponse(w, r, http.StatusUnauthorized, "invalid signature", message)
+			}
+
+			encoded, ok := strings.CutPrefix(r.Header.Get(HeaderSignature), "sha256=")
+			timestamp := r.Header.Get(HeaderSignatureTimestamp)
+			nonce := r.Header.Get(HeaderSignatureNonce)
+			if !ok || timestamp == "" || nonce == "" {
+				reject(localize(requestLocale(r), "the %s, %s and %s headers are required", HeaderSignature, HeaderSignatureTimestamp, HeaderSignatureNonce))
+				return
+			}
+			if len(nonce) < minSignatureNonceLength || len(nonce) > maxSignatureNonceLength || strings.ContainsAny(nonce, ". ") {
+				reject(localize(requestLocale(r), "the nonce must have %d to %d characters without dots or spaces", minSignatureNonceLength, maxSignatureNonceLength))
+				return
+			}
+			signature, err := hex.DecodeString(encoded)
+			if err != nil {
+				reject("the signature must be hex encoded")
+				return
+			}
+			seconds, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				reject("the timestamp must be in unix seconds")
+				return
+			}
+			if age := clock.Now().Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+				reject("the timestamp is outside of the tolerance")
+				return
+			}
+
+			mac := hmac.New(sha256.New, []byte(config.SigningSecret))
+			mac.Write([]byte(timestamp + "." + nonce + "." + r.Method + "." + r.URL.RequestURI() + "."))
+			body, release, err := ph.bufferBody(r.Body, mac)
+			if err != nil {
+				ph.loggerFor(r).Error("Failed to read signed request body", "error", err)
+				w.Header().Set("Content-Type", "application/json")
+				ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid request body", "failed to read request body")
+				return
+			}
+			defer release()
+
+			if !hmac.Equal(signature, mac.Sum(nil)) {
+				reject("the signature doesn't match the request")
+				return
+			}
+			if !replays.add(nonce) {
+				reject("the nonce was already used")
+				return
+			}
+
+			r.Body = body
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bufferBody reads a request body while writing it to the hash, so it can be passed on once
+// verified. Bodies larger than the payload spool threshold are buffered in a temporary file,
+// release removes it.
+func (ph *ParallelHandler) bufferBody(body io.Reader, h hash.Hash) (io.ReadCloser, func(), error) {
+	body = io.TeeReader(body, h)
+	threshold := ph.config.PayloadSpoolThreshold
+	if threshold <= 0 {
+		data, err := io.ReadAll(body)
+		return io.NopCloser(bytes.NewReader(data)), func() {}, err
+	}
+
+	var buffer bytes.Buffer
+	n, err := io.Copy(&buffer, io.LimitReader(body, threshold+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if n <= threshold {
+		return io.NopCloser(&buffer), func() {}, nil
+	}
+
+	file, err := os.CreateTemp(ph.config.PayloadSpoolDir, "n8n-parallels-body-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	release := func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	if _, err := buffer.WriteTo(file); err != nil {
+		release()
+		return nil, nil, err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		release()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return io.NopCloser(file), release, nil
+}
+
+// replayCache remembers the nonces used within their validity, so each is accepted once
+type replayCache struct {
+	ttl   time.Duration
+	clock service.Clock
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // nonce to the time it was used
+	lastSweep time.Time
+}
+
+// newReplayCache creates a cache forgetting nonces after ttl
+func newReplayCache(ttl time.Duration, clock service.Clock) *replayCache {
+	return &replayCache{ttl: ttl, clock: clock, seen: make(map[string]time.Time), lastSweep: clock.Now()}
+}
+
+// add records a nonce, false if it was used before
+func (c *replayCache) add(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for s, used := range c.seen {
+			if now.Sub(used) > c.ttl {
+				delete(c.seen, s)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if used, ok := c.seen[nonce]; ok && now.Sub(used) <= c.ttl {
+		return false
+	}
+	c.seen[nonce] = now
+	return true
+}
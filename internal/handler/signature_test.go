@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+)
+
+const testSigningSecret = "0123456789abcdef0123456789abcdef"
+
+// signedRequest creates a request signed like a client would
+func signedRequest(method, target, body, nonce string, timestamp time.Time) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write([]byte(ts + "." + nonce + "." + method + "." + r.URL.RequestURI() + "." + body))
+	r.Header.Set(HeaderSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	r.Header.Set(HeaderSignatureTimestamp, ts)
+	r.Header.Set(HeaderSignatureNonce, nonce)
+	return r
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ph, clock := newTestHandler(now)
+	var body string
+	handler := ph.SignatureMiddleware(auth.Config{SigningSecret: testSigningSecret, SigningTolerance: 300})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+		}))
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	valid := signedRequest(http.MethodPost, "/v1/parallels/execute?mode=async", `{"a":1}`, "nonce-0000000001", now)
+	if code := serve(valid); code != http.StatusOK {
+		t.Fatalf("valid request: status %d, want 200", code)
+	}
+	if body != `{"a":1}` {
+		t.Fatalf("body passed on = %q", body)
+	}
+
+	replayed := signedRequest(http.MethodPost, "/v1/parallels/execute?mode=async", `{"a":1}`, "nonce-0000000001", now)
+	if code := serve(replayed); code != http.StatusUnauthorized {
+		t.Errorf("replayed nonce: status %d, want 401", code)
+	}
+
+	tampered := []struct {
+		name   string
+		modify func(r *http.Request)
+	}{
+		{"method", func(r *http.Request) { r.Method = http.MethodDelete }},
+		{"path", func(r *http.Request) { r.URL.Path = "/v1/parallels/executions/x" }},
+		{"query", func(r *http.Request) { r.URL.RawQuery = "mode=sync" }},
+		{"body", func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"a":2}`)) }},
+		{"nonce", func(r *http.Request) { r.Header.Set(HeaderSignatureNonce, "nonce-9999999999") }},
+		{"missing nonce", func(r *http.Request) { r.Header.Del(HeaderSignatureNonce) }},
+	}
+	for i, tt := range tampered {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signedRequest(http.MethodPost, "/v1/parallels/execute?mode=async", `{"a":1}`, "nonce-tampered-"+strconv.Itoa(i), now)
+			tt.modify(r)
+			if code := serve(r); code != http.StatusUnauthorized {
+				t.Errorf("status %d, want 401", code)
+			}
+		})
+	}
+
+	short := signedRequest(http.MethodGet, "/v1/parallels/executions", "", "short", now)
+	if code := serve(short); code != http.StatusUnauthorized {
+		t.Errorf("short nonce: status %d, want 401", code)
+	}
+	stale := signedRequest(http.MethodGet, "/v1/parallels/executions", "", "nonce-0000000002", now.Add(-10*time.Minute))
+	if code := serve(stale); code != http.StatusUnauthorized {
+		t.Errorf("stale timestamp: status %d, want 401", code)
+	}
+
+	// Once the timestamp left the tolerance, the nonce may be forgotten
+	clock.Advance(11 * time.Minute)
+	later := signedRequest(http.MethodPost, "/v1/parallels/execute?mode=async", `{"a":1}`, "nonce-0000000001", clock.Now())
+	if code := serve(later); code != http.StatusOK {
+		t.Errorf("nonce after twice the tolerance: status %d, want 200", code)
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// Time a target check may take
+const (
+	defaultTargetCheckTimeout = 10
+	maxTargetCheckTimeout     = 60
+)
+
+// CheckTarget handles the /v1/targets/check endpoint, probing a webhook target for reachability,
+// TLS details, response time and the n8n version serving it
+func (ph *ParallelHandler) CheckTarget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	targetURL := r.URL.Query().Get("url")
+	if targetURL == "" {
+		ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid query", "url must not be empty")
+		return
+	}
+
+	timeout := defaultTargetCheckTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTargetCheckTimeout {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid timeout", "timeout must be between 1 and 60 seconds")
+			return
+		}
+		timeout = parsed
+	}
+
+	check, err := ph.webhookService.CheckTarget(r.Context(), targetURL, time.Duration(timeout)*time.Second)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRequest) {
+			ph.sendErrorResponse(w, r, http.StatusBadRequest, "invalid url", err.Error())
+			return
+		}
+		ph.sendErrorResponse(w, r, http.StatusBadGateway, "target check failed", err.Error())
+		return
+	}
+
+	ph.sendJSONResponse(w, http.StatusOK, check)
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+// newValidator creates a validator reporting fields by their JSON names
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// checkExecuteRequest applies defaults to a decoded execution request and validates it. The
+// payloads of a rejected request are released, the problems are described in the language of
+// the caller together with the status code of the response.
+func (ph *ParallelHandler) checkExecuteRequest(r *http.Request, request *models.ParallelExecuteRequest) (int, *models.ErrorResponse) {
+	applyRequestDefaults(request)
+	locale := requestLocale(r)
+
+	if err := ph.validator.Struct(request); err != nil {
+		request.ClosePayloads()
+		ph.loggerFor(r).Error("Request validation failed", "error", err)
+		if fieldErrors := validationErrors(err, locale); fieldErrors != nil {
+			return http.StatusBadRequest, validationResponse(fieldErrors)
+		}
+		return http.StatusBadRequest, &models.ErrorResponse{Error: "validation failed", Message: err.Error()}
+	}
+
+	if fieldErrors := expandTasks(request, "", locale); fieldErrors != nil {
+		request.ClosePayloads()
+		ph.loggerFor(r).Error("Request validation failed", "error", fieldErrors[0].Message)
+		return http.StatusBadRequest, validationResponse(fieldErrors)
+	}
+
+	if statusCode, errResponse := ph.loadPayloadQuery(r, request, locale); errResponse != nil {
+		request.ClosePayloads()
+		return statusCode, errResponse
+	}
+
+	// Additional validation for payloads
+	if request.Payloads.Len() == 0 {
+		request.ClosePayloads()
+		return http.StatusBadRequest, validationResponse([]models.FieldError{{
+			Field:   "payloads",
+			Rule:    "min",
+			Message: localize(locale, "payloads array cannot be empty"),
+		}})
+	}
+
+	// Invalid payloads reject the whole request unless they are to be skipped
+	if invalid := request.Payloads.Invalid(); len(invalid) > 0 && request.OnInvalidPayload != "skip_invalid" {
+		request.ClosePayloads()
+		ph.loggerFor(r).Error("Request validation failed", "invalid_payloads", len(invalid))
+		return http.StatusBadRequest, validationResponse(payloadErrors(invalid))
+	}
+	return http.StatusOK, nil
+}
+
+// applyRequestDefaults sets the defaults of a request and of its follow-ups
+func applyRequestDefaults(request *models.ParallelExecuteRequest) {
+	if request == nil {
+		return
+	}
+	// Set default timeout if not provided
+	if request.Timeout == 0 {
+		request.Timeout = 60 // Default 60 seconds
+	}
+	applyRequestDefaults(request.OnSuccess)
+	applyRequestDefaults(request.OnFailure)
+}
+
+// expandTasks moves the payloads of the tasks of a request and of its follow-ups to their
+// payloads, so tasks are executed like payloads which have a target of their own
+func expandTasks(request *models.ParallelExecuteRequest, prefix, locale string) []models.FieldError {
+	if request == nil {
+		return nil
+	}
+	if fieldErrors := expandTasks(request.OnSuccess, prefix+"on_success.", locale); fieldErrors != nil {
+		return fieldErrors
+	}
+	if fieldErrors := expandTasks(request.OnFailure, prefix+"on_failure.", locale); fieldErrors != nil {
+		return fieldErrors
+	}
+	if len(request.Tasks) == 0 {
+		return nil
+	}
+
+	if request.WebhookURL != "" || request.Payloads.Len() > 0 {
+		return []models.FieldError{{
+			Field:   prefix + "tasks",
+			Rule:    "excluded_with",
+			Message: localize(locale, "tasks can't be used together with webhook_url and payloads"),
+		}}
+	}
+	items := make([]json.RawMessage, len(request.Tasks))
+	for i := range request.Tasks {
+		payload := bytes.TrimSpace(request.Tasks[i].Payload)
+		if len(payload) == 0 || payload[0] != '{' {
+			index := i
+			return []models.FieldError{{
+				Field:   fmt.Sprintf("%stasks[%d].payload", prefix, i),
+				Rule:    "object",
+				Message: localize(locale, "payload of task %d must be a JSON object", i),
+				Index:   &index,
+			}}
+		}
+		items[i] = payload
+		request.Tasks[i].Payload = nil
+	}
+	request.Payloads = models.NewPayloads(items...)
+	return nil
+}
+
+// loadPayloadQuery replaces the payloads of a request with the rows of its payload query.
+// Follow-ups can't have one, their payloads are known once the request was accepted. Failures of
+// the database aren't the fault of the caller, they are answered with 503 or 502.
+func (ph *ParallelHandler) loadPayloadQuery(r *http.Request, request *models.ParallelExecuteRequest, locale string) (int, *models.ErrorResponse) {
+	if field := followUpPayloadQuery(request, ""); field != "" {
+		return http.StatusBadRequest, validationResponse([]models.FieldError{{
+			Field:   field,
+			Rule:    "excluded",
+			Message: localize(locale, "payload_query can't be used in follow-ups"),
+		}})
+	}
+	if request.PayloadQuery == nil {
+		return http.StatusOK, nil
+	}
+	if request.Payloads.Len() > 0 {
+		return http.StatusBadRequest, validationResponse([]models.FieldError{{
+			Field:   "payload_query",
+			Rule:    "excluded_with",
+			Message: localize(locale, "payload_query can't be combined with payloads or tasks"),
+		}})
+	}
+
+	payloads, err := ph.webhookService.LoadPayloadQuery(r.Context(), request.PayloadQuery)
+	if errors.Is(err, service.ErrInvalidRequest) {
+		return http.StatusBadRequest, validationResponse([]models.FieldError{{
+			Field:   "payload_query",
+			Rule:    "payload_query",
+			Message: err.Error(),
+		}})
+	}
+	if errors.Is(err, service.ErrPayloadDatabaseUnavailable) {
+		ph.loggerFor(r).Error("Payload database unavailable", "payload_query", request.PayloadQuery.Name, "error", err)
+		return http.StatusServiceUnavailable, &models.ErrorResponse{
+			Error:   "payload database unavailable",
+			Message: localize(locale, "failed to connect to the database of payload query %q", request.PayloadQuery.Name),
+		}
+	}
+	if err != nil {
+		ph.loggerFor(r).Error("Payload query failed", "payload_query", request.PayloadQuery.Name, "error", err)
+		return http.StatusBadGateway, &models.ErrorResponse{
+			Error:   "payload query failed",
+			Message: localize(locale, "failed to run payload query %q", request.PayloadQuery.Name),
+		}
+	}
+	request.Payloads = payloads
+	return http.StatusOK, nil
+}
+
+// followUpPayloadQuery returns the field of the first payload query among the follow-ups of a
+// request, empty if there is none. The request itself has an empty prefix.
+func followUpPayloadQuery(request *models.ParallelExecuteRequest, prefix string) string {
+	if request == nil {
+		return ""
+	}
+	if request.PayloadQuery != nil && prefix != "" {
+		return prefix + "payload_query"
+	}
+	if field := followUpPayloadQuery(request.OnSuccess, prefix+"on_success."); field != "" {
+		return field
+	}
+	return followUpPayloadQuery(request.OnFailure, prefix+"on_failure.")
+}
+
+// validationErrors converts validator errors to field errors, nil for other errors
+func validationErrors(err error, locale string) []models.FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+
+	fieldErrors := make([]models.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		// Drop the name of the request struct from the namespace
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fieldErrors = append(fieldErrors, models.FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: validationMessage(locale, field, fe.Tag(), fe.Param()),
+		})
+	}
+	return fieldErrors
+}
+
+// payloadErrors converts the problems of invalid payloads to field errors
+func payloadErrors(invalid []models.PayloadError) []models.FieldError {
+	fieldErrors := make([]models.FieldError, len(invalid))
+	for i, payloadErr := range invalid {
+		index := payloadErr.Index
+		fieldErrors[i] = models.FieldError{
+			Field:   fmt.Sprintf("payloads[%d]", index),
+			Rule:    "object",
+			Message: payloadErr.Error(),
+			Index:   &index,
+		}
+	}
+	return fieldErrors
+}
+
+// validationMessage describes a failed validation rule in the given language
+func validationMessage(locale, field, rule, param string) string {
+	switch rule {
+	case "required", "required_without":
+		return localize(locale, "%s is required", field)
+	case "url":
+		return localize(locale, "%s must be a valid URL", field)
+	case "oneof":
+		return localize(locale, "%s must be one of: %s", field, strings.ReplaceAll(param, " ", ", "))
+	case "min":
+		return localize(locale, "%s must be at least %s", field, param)
+	case "max":
+		return localize(locale, "%s must be at most %s", field, param)
+	default:
+		return localize(locale, "%s failed the %s rule", field, rule)
+	}
+}
+
+// validationResponse is the error response of a request with invalid fields
+func validationResponse(fieldErrors []models.FieldError) *models.ErrorResponse {
+	return &models.ErrorResponse{
+		Error:   "validation failed",
+		Message: fieldErrors[0].Message,
+		Errors:  fieldErrors,
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+	"github.com/mylxsw/n8n-parallels/internal/service"
+)
+
+func TestPayloadQueryStatus(t *testing.T) {
+	cfg := config.Load().Execution
+	cfg.PayloadQueryDSN = "postgres://reader@127.0.0.1:1/shop?connect_timeout=5"
+	cfg.PayloadQueries = map[string]string{"rows": "SELECT 1"}
+	ws := service.NewWebhookService(cfg, service.NewLocalGroupSemaphore(0, nil), service.NewMemoryExecutionStore(0), nil, testLogger)
+	ph := NewParallelHandler(ws, cfg, testLogger)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"unknown", http.StatusBadRequest},
+		{"rows", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			request := &models.ParallelExecuteRequest{
+				WebhookURL:   "https://example.com/hook",
+				PayloadQuery: &models.PayloadQuery{Name: tt.query},
+			}
+			status, errResponse := ph.checkExecuteRequest(httptest.NewRequest(http.MethodPost, "/v1/parallels/execute", nil), request)
+			if errResponse == nil || status != tt.status {
+				t.Fatalf("checkExecuteRequest() = %d, %+v, want %d", status, errResponse, tt.status)
+			}
+		})
+	}
+}
+
+func TestRejectedRequestReleasesFollowUpPayloads(t *testing.T) {
+	dir := t.TempDir()
+	followUp, err := models.DecodePayloads(json.NewDecoder(strings.NewReader(`[{"a":1},{"a":2}]`)), 1, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !followUp.Spooled() {
+		t.Fatal("follow-up payloads weren't spooled")
+	}
+
+	ph, _ := newTestHandler(time.Now())
+	request := &models.ParallelExecuteRequest{
+		WebhookURL: "https://example.com/hook",
+		OnSuccess:  &models.ParallelExecuteRequest{WebhookURL: "https://example.com/next", Payloads: followUp},
+	}
+	status, errResponse := ph.checkExecuteRequest(httptest.NewRequest(http.MethodPost, "/v1/parallels/execute", nil), request)
+	if errResponse == nil || status != http.StatusBadRequest {
+		t.Fatalf("checkExecuteRequest() = %d, %+v, want 400", status, errResponse)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("spool files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Timings of WebSocket connections
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 2 * wsPingInterval
+)
+
+// wsControlLimit bounds the size of control messages sent after the execution request
+const wsControlLimit = 4096
+
+// wsUpgrader upgrades execution connections. Like the CORS headers, any origin is allowed, the API
+// has no cookie based authentication which other sites could abuse.
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsControl is a message sent by the client while an execution is running
+type wsControl struct {
+	Type string `json:"type"` // "cancel"
+}
+
+// wsError is the message sent if an execution can't be started or failed
+type wsError struct {
+	Type string `json:"type"` // "error"
+	models.ErrorResponse
+}
+
+// ExecuteWebSocket handles the /v1/parallels/ws endpoint. The first message of the client is an
+// execution request like the body of /v1/parallels/execute; every result is sent as a "result"
+// message the moment it completes, followed by a "summary" message and the closing of the
+// connection. A {"type":"cancel"} message stops dispatching the remaining tasks and cancels the
+// in-flight ones.
+func (ph *ParallelHandler) ExecuteWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already sent an error response
+		ph.loggerFor(r).Debug("Failed to upgrade WebSocket connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	_, body, err := conn.NextReader()
+	if err != nil {
+		ph.loggerFor(r).Debug("WebSocket closed before an execution request was received", "error", err)
+		return
+	}
+	request, err := ph.decodeExecuteRequest(body)
+	if err != nil {
+		ph.loggerFor(r).Error("Failed to decode request body", "error", err)
+		ph.closeWebSocket(conn, wsError{Type: "error", ErrorResponse: models.ErrorResponse{
+			Error:   "invalid request body",
+			Message: localize(requestLocale(r), "failed to parse JSON payload"),
+		}})
+		return
+	}
+	if _, errResponse := ph.checkExecuteRequest(r, request); errResponse != nil {
+		ph.closeWebSocket(conn, wsError{Type: "error", ErrorResponse: *errResponse})
+		return
+	}
+	if wait, ok := ph.allowPayloads(r, request.Payloads.Len()); !ok {
+		request.ClosePayloads()
+		ph.closeWebSocket(conn, wsError{Type: "error", ErrorResponse: models.ErrorResponse{
+			Error:   "rate limit exceeded",
+			Message: localize(requestLocale(r), "more than %d payloads per minute, retry after %d seconds", ph.config.RateLimitPayloads, retryAfterSeconds(wait)),
+		}})
+		return
+	}
+
+	ph.loggerFor(r).Info("Received parallel execution request",
+		"webhook_url", request.WebhookURL,
+		"payloads_count", request.Payloads.Len(),
+		"payloads_spooled", request.Payloads.Spooled(),
+		"timeout", request.Timeout,
+		"has_auth", request.AuthHeader != "" || request.Auth != nil,
+		"concurrency_group", request.ConcurrencyGroup,
+		"websocket", true,
+		"remote_addr", clientIP(r),
+		"user_agent", r.Header.Get("User-Agent"))
+
+	// The execution is canceled on request of the client or when the connection is lost
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var canceled atomic.Bool
+	go ph.readWebSocketControl(conn, cancel, &canceled, ph.loggerFor(r))
+
+	done := make(chan struct{})
+	defer close(done)
+	go pingWebSocket(conn, done)
+
+	// Results are only sent by the collector of the execution, one at a time
+	broken := false
+	response, err := ph.webhookService.ExecuteStreaming(ctx, request, func(result models.StreamedResult) {
+		if broken {
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(map[string]interface{}{"type": "result", "result": result}); err != nil {
+			ph.loggerFor(r).Warn("Failed to send result, canceling execution", "index", result.Index, "error", err)
+			broken = true
+			cancel()
+		}
+	})
+	if broken {
+		return
+	}
+	if err != nil {
+		_, error := executionError(err)
+		ph.closeWebSocket(conn, wsError{Type: "error", ErrorResponse: models.ErrorResponse{
+			Error:   error,
+			Message: err.Error(),
+		}})
+		return
+	}
+
+	final := streamSummary(response)
+	final["type"] = "summary"
+	if canceled.Load() {
+		final["canceled"] = true
+	}
+	ph.closeWebSocket(conn, final)
+
+	ph.loggerFor(r).Info("Completed WebSocket parallel execution request",
+		"execution_id", response.ExecutionID,
+		"total_requests", response.Summary.TotalRequests,
+		"successful_requests", response.Summary.SuccessfulRequests,
+		"failed_requests", response.Summary.FailedRequests,
+		"canceled", canceled.Load(),
+		"duration_ms", response.Summary.TotalDuration)
+}
+
+// readWebSocketControl handles the messages of the client while an execution is running
+func (ph *ParallelHandler) readWebSocketControl(conn *websocket.Conn, cancel context.CancelFunc, canceled *atomic.Bool, logger *slog.Logger) {
+	conn.SetReadLimit(wsControlLimit)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var message wsControl
+		if err := conn.ReadJSON(&message); err != nil {
+			// Reading fails once the connection is closed, by either side
+			cancel()
+			return
+		}
+
+		switch message.Type {
+		case "cancel":
+			if !canceled.Swap(true) {
+				logger.Info("Execution canceled by WebSocket client")
+			}
+			cancel()
+		default:
+			logger.Debug("Ignored unknown WebSocket message", "type", message.Type)
+		}
+	}
+}
+
+// pingWebSocket keeps the connection alive through proxies while an execution is running
+func pingWebSocket(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// closeWebSocket sends the final message of an execution and closes the connection
+func (ph *ParallelHandler) closeWebSocket(conn *websocket.Conn, message interface{}) {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := conn.WriteJSON(message); err != nil {
+		ph.logger.Debug("Failed to send final WebSocket message", "error", err)
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(wsWriteTimeout))
+}
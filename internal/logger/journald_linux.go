@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+)
+
+// journaldSocket receives entries of the native journal protocol
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newJournaldOutput sends records to the systemd journal using its native protocol
+func newJournaldOutput(tag string) (writeFunc, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+
+	return func(level slog.Level, line []byte) error {
+		var entry bytes.Buffer
+		writeJournalField(&entry, "PRIORITY", []byte(strconv.Itoa(priority(level))))
+		writeJournalField(&entry, "SYSLOG_IDENTIFIER", []byte(tag))
+		writeJournalField(&entry, "MESSAGE", line)
+		_, err := conn.Write(entry.Bytes())
+		return err
+	}, nil
+}
+
+// writeJournalField appends a field to a journal entry, values containing newlines are sent
+// length-prefixed
+func writeJournalField(entry *bytes.Buffer, name string, value []byte) {
+	entry.WriteString(name)
+	if bytes.IndexByte(value, '\n') < 0 {
+		entry.WriteByte('=')
+		entry.Write(value)
+		entry.WriteByte('\n')
+		return
+	}
+	entry.WriteByte('\n')
+	binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.Write(value)
+	entry.WriteByte('\n')
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package logger
+
+import "errors"
+
+// newJournaldOutput is not supported, the journal only exists on Linux
+func newJournaldOutput(tag string) (writeFunc, error) {
+	return nil, errors.New("journald output is only supported on Linux")
+}
@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // LogLevel represents the logging level
@@ -18,38 +22,155 @@ const (
 
 // Config represents logger configuration
 type Config struct {
-	Level  LogLevel `json:"level"`
-	Format string   `json:"format"` // "text" or "json"
+	Level      LogLevel `json:"level"`
+	Format     string   `json:"format"`      // "text" or "json"
+	Output     string   `json:"output"`      // "stdout", "syslog" or "journald"
+	SyslogAddr string   `json:"syslog_addr"` // e.g. "udp://host:514", empty for the local daemon
+	Tag        string   `json:"tag"`         // identifier in syslog and the journal
 }
 
-// New creates a new structured logger
+// New creates a new structured logger, logging to stdout if the configured output can't be opened
 func New(config Config) *slog.Logger {
-	var level slog.Level
-	switch strings.ToLower(string(config.Level)) {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
+	logger, _, err := NewLeveled(config)
+	if err != nil {
+		config.Output = OutputStdout
+		logger, _, _ = NewLeveled(config)
+	}
+	return logger
+}
+
+// NewLeveled creates a new structured logger whose level can be changed at runtime
+func NewLeveled(config Config) (*slog.Logger, *Leveler, error) {
+	level, ok := parseLevel(config.Level)
+	if !ok {
 		level = slog.LevelInfo
 	}
+	leveler := &Leveler{base: level}
+	leveler.level.Set(level)
 
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level: &leveler.level,
+	}
+
+	// Records for syslog and the journal are formatted into a buffer first
+	var out io.Writer = os.Stdout
+	var routed *routedOutput
+	if config.Output != "" && config.Output != OutputStdout {
+		write, err := newOutput(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		routed = &routedOutput{write: write}
+		out = &routed.buf
+		opts.ReplaceAttr = dropTime
 	}
 
 	var handler slog.Handler
 	if config.Format == "json" {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(out, opts)
 	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(out, opts)
+	}
+	if routed != nil {
+		handler = &routedHandler{inner: handler, out: routed}
+	}
+
+	return slog.New(handler), leveler, nil
+}
+
+// parseLevel converts a configured level to a slog level
+func parseLevel(level LogLevel) (slog.Level, bool) {
+	switch strings.ToLower(string(level)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	default:
+		return slog.LevelInfo, false
+	}
+}
+
+// Leveler changes the level of a logger at runtime. Changes revert to the configured
+// level after a while, so a forgotten debug level doesn't flood the logs.
+type Leveler struct {
+	level slog.LevelVar
+	base  slog.Level
+
+	mu       sync.Mutex
+	revert   *time.Timer
+	revertAt time.Time
+}
+
+// Set changes the level until ttl passed
+func (l *Leveler) Set(level LogLevel, ttl time.Duration) error {
+	parsed, ok := parseLevel(level)
+	if !ok {
+		return fmt.Errorf("invalid log level: %s", level)
 	}
 
-	return slog.New(handler)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.revert != nil {
+		l.revert.Stop()
+	}
+	l.level.Set(parsed)
+	l.revertAt = time.Now().Add(ttl)
+
+	var revert *time.Timer
+	revert = time.AfterFunc(ttl, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// A timer replaced by a later change may still fire
+		if l.revert == revert {
+			l.reset()
+		}
+	})
+	l.revert = revert
+	return nil
+}
+
+// Reset restores the configured level
+func (l *Leveler) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reset()
+}
+
+// reset restores the configured level, l.mu must be held
+func (l *Leveler) reset() {
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert = nil
+	}
+	l.level.Set(l.base)
+	l.revertAt = time.Time{}
+}
+
+// Level returns the current level, the configured one and when a changed level reverts
+// (zero if the configured level is active)
+func (l *Leveler) Level() (current, configured LogLevel, revertAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return levelName(l.level.Level()), levelName(l.base), l.revertAt
+}
+
+// levelName converts a slog level to its configured name
+func levelName(level slog.Level) LogLevel {
+	switch {
+	case level <= slog.LevelDebug:
+		return LevelDebug
+	case level <= slog.LevelInfo:
+		return LevelInfo
+	case level <= slog.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
 }
 
 // NewDefault creates a default logger with reasonable defaults
@@ -0,0 +1,133 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+)
+
+// Destinations of log records
+const (
+	OutputStdout   = "stdout"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+)
+
+// DefaultTag identifies the records of the server in syslog and the journal
+const DefaultTag = "n8n-parallels"
+
+// Syslog and journal priorities of the log levels
+const (
+	priorityError   = 3
+	priorityWarning = 4
+	priorityInfo    = 6
+	priorityDebug   = 7
+)
+
+// priority returns the syslog priority of a level
+func priority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return priorityError
+	case level >= slog.LevelWarn:
+		return priorityWarning
+	case level >= slog.LevelInfo:
+		return priorityInfo
+	default:
+		return priorityDebug
+	}
+}
+
+// writeFunc sends a formatted record with the priority of its level
+type writeFunc func(level slog.Level, line []byte) error
+
+// ParseSyslogAddr splits a syslog address like "udp://host:514" into network and address. An
+// empty address is the local syslog daemon.
+func ParseSyslogAddr(addr string) (network, address string, err error) {
+	if addr == "" {
+		return "", "", nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: missing host", addr)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: missing socket path", addr)
+		}
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %q: scheme must be udp, tcp, unix or unixgram", addr)
+	}
+}
+
+// newOutput opens the destination of log records other than stdout
+func newOutput(config Config) (writeFunc, error) {
+	tag := config.Tag
+	if tag == "" {
+		tag = DefaultTag
+	}
+
+	switch config.Output {
+	case OutputSyslog:
+		return newSyslogOutput(config.SyslogAddr, tag)
+	case OutputJournald:
+		return newJournaldOutput(tag)
+	default:
+		return nil, fmt.Errorf("invalid log output: %s", config.Output)
+	}
+}
+
+// routedOutput collects the formatted record of a handler to send it with the priority of its level
+type routedOutput struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	write writeFunc
+}
+
+// routedHandler formats records with a text or JSON handler writing to the buffer of out, which
+// is shared with the handlers derived from it
+type routedHandler struct {
+	inner slog.Handler
+	out   *routedOutput
+}
+
+func (h *routedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *routedHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.inner.Handle(ctx, record); err != nil {
+		return err
+	}
+	return h.out.write(record.Level, bytes.TrimSuffix(h.out.buf.Bytes(), []byte("\n")))
+}
+
+func (h *routedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &routedHandler{inner: h.inner.WithAttrs(attrs), out: h.out}
+}
+
+func (h *routedHandler) WithGroup(name string) slog.Handler {
+	return &routedHandler{inner: h.inner.WithGroup(name), out: h.out}
+}
+
+// dropTime removes the time of records, syslog and the journal add their own timestamp
+func dropTime(groups []string, attr slog.Attr) slog.Attr {
+	if len(groups) == 0 && attr.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return attr
+}
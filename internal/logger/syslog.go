@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"fmt"
+	"log/slog"
+	"log/syslog"
+)
+
+// newSyslogOutput connects to a syslog daemon, the local one if addr is empty
+func newSyslogOutput(addr, tag string) (writeFunc, error) {
+	network, address, err := ParseSyslogAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return func(level slog.Level, line []byte) error {
+		switch priority(level) {
+		case priorityError:
+			return w.Err(string(line))
+		case priorityWarning:
+			return w.Warning(string(line))
+		case priorityInfo:
+			return w.Info(string(line))
+		default:
+			return w.Debug(string(line))
+		}
+	}, nil
+}
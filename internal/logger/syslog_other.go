@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package logger
+
+import "errors"
+
+// newSyslogOutput is not supported, log/syslog isn't available on this platform
+func newSyslogOutput(addr, tag string) (writeFunc, error) {
+	return nil, errors.New("syslog output is not supported on this platform")
+}
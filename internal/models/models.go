@@ -1,60 +1,626 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ParallelExecuteRequest represents the request payload for parallel webhook execution
 type ParallelExecuteRequest struct {
-	WebhookURL string                   `json:"webhook_url" validate:"required,url"`
-	AuthHeader string                   `json:"auth_header"`
-	Payloads   []map[string]interface{} `json:"payloads" validate:"required,min=1"`
-	Timeout    int                      `json:"timeout" validate:"min=1,max=3600"` // 1 second to 1 hour
+	WebhookURL       string            `json:"webhook_url" validate:"required_without=Tasks,omitempty,url"`
+	AuthHeader       string            `json:"auth_header"`
+	Auth             *WebhookAuth      `json:"auth,omitempty"`                             // structured alternative to auth_header
+	Payloads         Payloads          `json:"payloads"`                                   // JSON objects, spooled to disk when large
+	Tasks            []TaskSpec        `json:"tasks,omitempty" validate:"omitempty,dive"`  // alternative to webhook_url and payloads, items with targets of their own
+	PayloadQuery     *PayloadQuery     `json:"payload_query,omitempty"`                    // alternative to payloads, the rows of a query configured on the server
+	Timeout          int               `json:"timeout" validate:"min=1,max=3600"`          // 1 second to 1 hour
+	MaxConcurrency   int               `json:"max_concurrency,omitempty" validate:"min=0"` // webhook calls running at once, 0 uses the server default
+	ConcurrencyGroup string            `json:"concurrency_group,omitempty" validate:"max=128"`
+	DeadlineHeaders  bool              `json:"deadline_headers,omitempty"`    // send X-Deadline and Request-Timeout headers
+	GRPCTimeout      bool              `json:"grpc_timeout_header,omitempty"` // additionally send a grpc-timeout header
+	IncludeChecksums bool              `json:"include_checksums,omitempty"`   // add SHA-256 checksums of response bodies
+	RateSchedule     *RateSchedule     `json:"rate_schedule,omitempty"`       // cap dispatch rate by time of day
+	Canary           *Canary           `json:"canary,omitempty"`              // run a sample first, the rest after confirmation
+	PinResolution    bool              `json:"pin_resolution,omitempty"`      // resolve the target host once and reuse the addresses for every task
+	IncludeTimings   bool              `json:"include_timings,omitempty"`     // add DNS, connect, TLS and TTFB timings to every result
+	ResponseHeaders  []string          `json:"response_headers,omitempty"`    // names of the target response headers added to every result
+	Analyze          bool              `json:"analyze,omitempty"`             // add an analysis of what dominated the request durations to the summary
+	Transport        *TransportOptions `json:"transport,omitempty"`           // isolated transport settings of this execution
+	VerifyItemIndex  bool              `json:"verify_item_index,omitempty"`   // require responses to echo the X-Item-Index header
+	ForwardRequestID bool              `json:"forward_request_id,omitempty"`  // send the X-Request-ID of the API request with every webhook call
+	AllowDuplicates  bool              `json:"allow_duplicates,omitempty"`    // send items recently sent by another execution again, see DEDUP_WINDOW
+
+	MaxResponseBytes  int    `json:"max_response_bytes,omitempty" validate:"min=0"`                         // response bodies kept per task, default and cap MAX_RESPONSE_SIZE
+	OversizedResponse string `json:"oversized_response,omitempty" validate:"omitempty,oneof=truncate drop"` // what happens to larger bodies, default "truncate"
+
+	BodyFormat  string `json:"body_format,omitempty" validate:"omitempty,oneof=json raw form xml multipart"` // encoding of the payloads sent, default "json"
+	ContentType string `json:"content_type,omitempty"`                                                       // Content-Type of the webhook calls, default by body_format
+	XMLRoot     string `json:"xml_root,omitempty"`                                                           // root element of xml bodies, default "root"
+
+	Headers        map[string]string   `json:"headers,omitempty"`         // sent with every webhook call, next to auth_header
+	PayloadHeaders []map[string]string `json:"payload_headers,omitempty"` // indexed like the payloads, override headers per item
+
+	ConcurrencyKey      string `json:"concurrency_key,omitempty" validate:"max=256"`     // dotted path into the payloads, e.g. "item.customer_id"
+	ConcurrencyKeyLimit int    `json:"concurrency_key_limit,omitempty" validate:"min=0"` // requests per key running at once, default 1
+
+	DetachOnDisconnect bool `json:"detach_on_disconnect,omitempty"` // keep running as an async job if the caller of a synchronous execution disconnects
+
+	CallbackURL        string `json:"callback_url,omitempty" validate:"omitempty,url"` // receives the response of an async execution once finished
+	CallbackAuthHeader string `json:"callback_auth_header,omitempty"`                  // Authorization header of the callback
+	CallbackSecret     string `json:"callback_secret,omitempty"`                       // HMAC secret the callback body is signed with, default CALLBACK_SIGNING_SECRET
+	CallbackOn         string `json:"callback_on,omitempty" validate:"omitempty,oneof=all errors_only summary_only"`
+
+	AbortAfterFailures int           `json:"abort_after_failures,omitempty" validate:"min=0"` // stop dispatching after this many failures, 0 never aborts
+	Compensation       *Compensation `json:"compensation,omitempty"`                          // called for every successful item of an aborted execution
+
+	OnSuccess *ParallelExecuteRequest `json:"on_success,omitempty"` // started asynchronously once the execution completed without failures
+	OnFailure *ParallelExecuteRequest `json:"on_failure,omitempty"` // started asynchronously once the execution failed or has failed items
+
+	OnInvalidPayload string `json:"on_invalid_payload,omitempty" validate:"omitempty,oneof=reject_all skip_invalid"` // "reject_all" (default) or "skip_invalid"
+
+	Output string `json:"output,omitempty" validate:"omitempty,oneof=default n8n_items merged"` // shape of the results, "default", "n8n_items" or "merged"
+
+	MaxRetries        int     `json:"max_retries,omitempty" validate:"min=0,max=10"`                  // retries of transient failures per task
+	BackoffInitialMs  int     `json:"backoff_initial_ms,omitempty" validate:"min=0,max=60000"`        // delay before the first retry, default 500
+	BackoffMultiplier float64 `json:"backoff_multiplier,omitempty" validate:"omitempty,min=1,max=10"` // growth of the delay per retry, default 2
+}
+
+// ClosePayloads releases the payloads of a request and of its follow-ups, once it was rejected
+// or won't run
+func (r *ParallelExecuteRequest) ClosePayloads() {
+	if r == nil {
+		return
+	}
+	r.Payloads.Close()
+	r.OnSuccess.ClosePayloads()
+	r.OnFailure.ClosePayloads()
+}
+
+// TaskSpec is an item of an execution sent to a target of its own. Its payload is moved to the
+// payloads of the request when the request is accepted.
+type TaskSpec struct {
+	WebhookURL string          `json:"webhook_url" validate:"required,url"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	AuthHeader string          `json:"auth_header,omitempty"`
+	Auth       *WebhookAuth    `json:"auth,omitempty"` // auth of the task, tasks without are sent without auth
+
+	Headers map[string]string `json:"headers,omitempty"` // override the headers of the request
+}
+
+// PayloadQuery selects a read-only SQL query configured on the server, see PAYLOAD_QUERIES.
+// Every row becomes a payload, an object of the columns by name. It is run when the request
+// is accepted.
+type PayloadQuery struct {
+	Name string        `json:"name" validate:"required,max=128"`
+	Args []interface{} `json:"args,omitempty"` // bound to the placeholders of the query in order, strings, numbers, booleans or null
+}
+
+// WebhookAuth describes how webhook calls are authenticated
+type WebhookAuth struct {
+	Type string `json:"type" validate:"required,oneof=basic bearer api_key google_id_token azure_ad"`
+
+	// basic
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// bearer
+	Token   string       `json:"token,omitempty"`
+	Refresh *AuthRefresh `json:"refresh,omitempty"` // obtain a new token once when the target responds with 401
+
+	// api_key
+	Name  string `json:"name,omitempty"`  // header or query parameter name
+	Value string `json:"value,omitempty"` // api key
+	In    string `json:"in,omitempty"`    // "header" (default) or "query"
+
+	// google_id_token
+	Audience string `json:"audience,omitempty"` // default: scheme and host of the webhook URL
+
+	// azure_ad, client credentials grant
+	TenantID     string `json:"tenant_id,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	Scope        string `json:"scope,omitempty"` // e.g. "api://<app id>/.default"
+}
+
+// AuthRefresh describes how a new bearer token is obtained when the current one expired
+type AuthRefresh struct {
+	Type     string `json:"type" validate:"required,oneof=oauth2 token_endpoint"`
+	TokenURL string `json:"token_url" validate:"required,url"`
+
+	// oauth2, refresh_token grant
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+
+	// token_endpoint, a custom call returning a JSON document with the token
+	Method     string                 `json:"method,omitempty"` // default POST
+	Headers    map[string]string      `json:"headers,omitempty"`
+	Body       map[string]interface{} `json:"body,omitempty"`        // sent as JSON
+	TokenField string                 `json:"token_field,omitempty"` // dotted path of the token, default "access_token"
+}
+
+// TransportOptions override the outbound transport settings of an execution
+type TransportOptions struct {
+	InsecureSkipVerify  bool   `json:"insecure_skip_verify,omitempty"` // only if ALLOW_INSECURE_TLS is enabled
+	CACert              string `json:"ca_cert,omitempty"`              // PEM encoded, trusted in addition to the system roots
+	ServerName          string `json:"tls_server_name,omitempty"`
+	ClientCert          string `json:"client_cert,omitempty"` // PEM encoded certificate chain presented for mutual TLS
+	ClientKey           string `json:"client_key,omitempty"`  // PEM encoded private key of client_cert
+	ProxyURL            string `json:"proxy_url,omitempty" validate:"omitempty,url"`
+	MaxConnsPerHost     int    `json:"max_conns_per_host,omitempty" validate:"min=0"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host,omitempty" validate:"min=0"`
+	DisableKeepAlives   bool   `json:"disable_keep_alives,omitempty"`
+}
+
+// Compensation describes the call rolling back a successfully processed item of an aborted execution
+type Compensation struct {
+	URL        string `json:"url" validate:"required,url"`
+	AuthHeader string `json:"auth_header,omitempty"`
+	// Template is a Go text/template rendering the request body, with .index, .payload and .response
+	// of the item. Without a template the body is {"index": ..., "payload": ..., "response": ...}.
+	Template string `json:"template,omitempty"`
+}
+
+// Canary executes only a sample of the payloads, the rest is executed once confirmed
+type Canary struct {
+	Count  int  `json:"count" validate:"min=1"` // number of payloads executed first
+	Random bool `json:"random,omitempty"`       // pick a random sample instead of the first payloads
+}
+
+// RateSchedule caps the rate tasks are dispatched at, depending on the time of day
+type RateSchedule struct {
+	Timezone   string       `json:"timezone,omitempty"`                     // IANA time zone of the windows, default UTC
+	DefaultRPS float64      `json:"default_rps,omitempty" validate:"min=0"` // rate outside of all windows, 0 means unlimited
+	Windows    []RateWindow `json:"windows,omitempty" validate:"dive"`
+}
+
+// RateWindow is a daily time window with its own dispatch rate
+type RateWindow struct {
+	Start string  `json:"start" validate:"required"` // "HH:MM", inclusive
+	End   string  `json:"end" validate:"required"`   // "HH:MM", exclusive, may be before start to wrap around midnight
+	RPS   float64 `json:"rps" validate:"gt=0"`       // requests per second
 }
 
 // ParallelExecuteResponse represents the response for parallel webhook execution
 type ParallelExecuteResponse struct {
-	Results []WebhookResult `json:"results"`
-	Summary ExecutionSummary `json:"summary"`
+	ExecutionID     string           `json:"execution_id"`
+	Status          string           `json:"status,omitempty"`           // "awaiting_confirmation" for canary executions, "budget_exceeded" if cut short
+	PendingRequests int              `json:"pending_requests,omitempty"` // payloads awaiting confirmation
+	Results         []WebhookResult  `json:"results"`
+	Summary         ExecutionSummary `json:"summary"`
+	Options         EffectiveOptions `json:"effective_options"` // options after defaults and server-side caps
+	Error           string           `json:"error,omitempty"`   // why an async execution failed, only sent to callbacks
+
+	FollowUpExecutionID string `json:"follow_up_execution_id,omitempty"` // execution started by on_success or on_failure
+
+	Merged []json.RawMessage `json:"merged,omitempty"` // successful response bodies flattened, output "merged" only
+}
+
+// EffectiveOptions are the options an execution ran with after defaults and server-side caps were applied
+type EffectiveOptions struct {
+	Timeout               int    `json:"timeout"`
+	MaxConcurrency        int    `json:"max_concurrency"`
+	OnInvalidPayload      string `json:"on_invalid_payload"`
+	ConcurrencyGroupLimit int    `json:"concurrency_group_limit,omitempty"` // executions of the group allowed at once
+	ConcurrencyKeyLimit   int    `json:"concurrency_key_limit,omitempty"`   // requests per concurrency key allowed at once
+	CanaryCount           int    `json:"canary_count,omitempty"`            // capped to the number of payloads
+	PayloadsSpooled       bool   `json:"payloads_spooled,omitempty"`        // payloads exceeded the spool threshold
+	Output                string `json:"output"`
+
+	MaxRetries        int     `json:"max_retries,omitempty"`
+	BackoffInitialMs  int     `json:"backoff_initial_ms,omitempty"`
+	BackoffMultiplier float64 `json:"backoff_multiplier,omitempty"`
+
+	MaxResponseBytes int `json:"max_response_bytes,omitempty"` // response bodies are cut off after this many bytes, 0 is unlimited
+}
+
+// What the callback of an async execution is sent for
+const (
+	CallbackOnAll         = "all"          // every finished execution, with all results
+	CallbackOnErrorsOnly  = "errors_only"  // executions with failures, with the failed results only
+	CallbackOnSummaryOnly = "summary_only" // every finished execution, without results
+)
+
+// What happens to response bodies exceeding max_response_bytes
+const (
+	OversizedTruncate = "truncate" // the first max_response_bytes are kept
+	OversizedDrop     = "drop"     // the body is left out
+)
+
+// Encodings of the payloads sent to the webhook
+const (
+	BodyFormatJSON      = "json"      // the payload object as it is
+	BodyFormatRaw       = "raw"       // the string in the body member of the payload, sent as it is
+	BodyFormatForm      = "form"      // the members of the payload, application/x-www-form-urlencoded
+	BodyFormatXML       = "xml"       // the payload converted to an XML document
+	BodyFormatMultipart = "multipart" // the members of the payload as multipart/form-data, with base64 file parts
+)
+
+// Shapes of the results of a synchronous execution
+const (
+	OutputDefault  = "default"   // the response object with results and summary
+	OutputN8NItems = "n8n_items" // an array of n8n items, see N8NItem
+	OutputMerged   = "merged"    // the response bodies flattened into one array, failures as results
+)
+
+// N8NItem is a result in the shape of the items n8n nodes pass on, linked to the input item of
+// its payload so n8n can pair them
+type N8NItem struct {
+	JSON       interface{}   `json:"json"` // a WebhookResult, or a StreamedResult when streamed
+	PairedItem N8NPairedItem `json:"pairedItem"`
+}
+
+// N8NPairedItem refers to an input item by its position
+type N8NPairedItem struct {
+	Item int `json:"item"`
 }
 
 // WebhookResult represents the result of a single webhook call
 type WebhookResult struct {
-	Index    int             `json:"index"`
-	Success  bool            `json:"success"`
-	Response json.RawMessage `json:"response,omitempty"`
-	Error    string          `json:"error,omitempty"`
-	Duration int64           `json:"duration_ms"` // Duration in milliseconds
+	Index     int             `json:"index"`
+	Success   bool            `json:"success"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"error_code,omitempty"` // machine readable error category, see ErrorCode constants
+	Duration  int64           `json:"duration_ms"`          // Duration in milliseconds
+	Checksum  string          `json:"sha256,omitempty"`     // SHA-256 of the response body, hex encoded
+	Timings   *RequestTimings `json:"timings,omitempty"`    // phases of the request, if requested
+
+	StatusCode      int               `json:"status_code,omitempty"`      // HTTP status of the target response, 0 if none was received
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"` // the response headers named in the request, if sent
+	Truncated       bool              `json:"truncated,omitempty"`        // the response body exceeded max_response_bytes and was cut off or dropped
+
+	Attempts         int     `json:"attempts,omitempty"`             // requests sent, more than 1 if retried
+	AttemptDurations []int64 `json:"attempt_durations_ms,omitempty"` // durations of the single attempts of retried requests
+
+	Compensated       bool   `json:"compensated,omitempty"`        // compensation call succeeded
+	CompensationError string `json:"compensation_error,omitempty"` // compensation call failed
+
+	PayloadBytes int `json:"payload_bytes,omitempty"` // size of a payload rejected as too large
+
+	Skipped     bool          `json:"skipped,omitempty"`      // not sent, neither succeeded nor failed
+	DuplicateOf *DuplicateRef `json:"duplicate_of,omitempty"` // skipped, an identical item was recently sent by another execution
+
+	Seq int `json:"seq,omitempty"` // position of the result in the order the results of the execution completed, from 1
+}
+
+// StreamedResult is a result streamed the moment it completed, attributed to its execution so
+// frames of several streams or of a reconnected stream can be told apart
+type StreamedResult struct {
+	ExecutionID string `json:"execution_id"`
+	WebhookResult
 }
 
+// DuplicateRef identifies the item of an earlier execution an item was skipped in favor of
+type DuplicateRef struct {
+	ExecutionID string `json:"execution_id"`
+	Index       int    `json:"index"`
+}
+
+// RequestTimings breaks down the duration of a webhook request into its phases, in milliseconds.
+// Phases which didn't happen, e.g. DNS and connect on reused connections, are 0.
+type RequestTimings struct {
+	DNS              float64 `json:"dns_ms"`
+	Connect          float64 `json:"connect_ms"`
+	TLS              float64 `json:"tls_ms"`
+	Wait             float64 `json:"wait_ms"`      // request sent until the first response byte, i.e. target processing time
+	TTFB             float64 `json:"ttfb_ms"`      // request start until the first response byte
+	ConnWait         float64 `json:"conn_wait_ms"` // waiting for a free connection, e.g. limited by max_conns_per_host
+	ConnectionReused bool    `json:"connection_reused"`
+}
+
+// Error codes of failed webhook results
+const (
+	ErrorCodeTimeout         = "timeout"
+	ErrorCodeAborted         = "aborted"
+	ErrorCodeInvalid         = "invalid"
+	ErrorCodeIndexMismatch   = "index_mismatch"
+	ErrorCodeCircuitOpen     = "circuit_open"
+	ErrorCodeCanceled        = "canceled"
+	ErrorCodeBudgetExceeded  = "budget_exceeded"
+	ErrorCodePayloadTooLarge = "payload_too_large" // the target rejected the payload with 413
+	ErrorCodeBlocked         = "blocked"           // the target resolved to an internal address
+)
+
 // ExecutionSummary provides summary statistics of the parallel execution
 type ExecutionSummary struct {
-	TotalRequests     int   `json:"total_requests"`
-	SuccessfulRequests int   `json:"successful_requests"`
-	FailedRequests    int   `json:"failed_requests"`
-	TimeoutRequests   int   `json:"timeout_requests"`
-	TotalDuration     int64 `json:"total_duration_ms"` // Total execution time in milliseconds
+	TotalRequests      int    `json:"total_requests"`
+	SuccessfulRequests int    `json:"successful_requests"`
+	FailedRequests     int    `json:"failed_requests"`
+	TimeoutRequests    int    `json:"timeout_requests"`
+	TotalDuration      int64  `json:"total_duration_ms"`        // Total execution time in milliseconds
+	ResultsChecksum    string `json:"results_sha256,omitempty"` // SHA-256 of all response bodies concatenated in index order
+
+	Aborted             bool `json:"aborted,omitempty"` // failure threshold reached, remaining tasks not dispatched
+	AbortedRequests     int  `json:"aborted_requests,omitempty"`
+	Canceled            bool `json:"canceled,omitempty"` // canceled by DELETE /v1/parallels/executions/{id}
+	CanceledRequests    int  `json:"canceled_requests,omitempty"`
+	CompensatedRequests int  `json:"compensated_requests,omitempty"`
+	InvalidRequests     int  `json:"invalid_requests,omitempty"`   // payloads skipped as invalid
+	DuplicateRequests   int  `json:"duplicate_requests,omitempty"` // payloads skipped as recently sent by another execution, neither successful nor failed
+
+	BudgetExceeded         bool `json:"budget_exceeded,omitempty"` // stopped after MAX_EXECUTION_DURATION, remaining tasks not dispatched
+	BudgetExceededRequests int  `json:"budget_exceeded_requests,omitempty"`
+
+	PayloadTooLargeRequests  int `json:"payload_too_large_requests,omitempty"`  // payloads rejected by the target with 413
+	SuggestedMaxPayloadBytes int `json:"suggested_max_payload_bytes,omitempty"` // largest payload the target accepted, set if some were too large
+
+	TruncatedResponses int `json:"truncated_responses,omitempty"` // response bodies cut off or dropped for exceeding max_response_bytes
+
+	Latency *LatencyStats `json:"latency,omitempty"` // distribution of the durations of dispatched requests
+
+	Analysis *ExecutionAnalysis `json:"analysis,omitempty"` // what dominated the request durations, if requested
+}
+
+// ExecutionAnalysis breaks down where the dispatched requests of an execution spent their time and
+// suggests settings which would make them faster
+type ExecutionAnalysis struct {
+	AnalyzedRequests int      `json:"analyzed_requests"` // requests which got a response
+	NewConnections   int      `json:"new_connections"`   // requests which opened a connection
+	ConnectionReuse  float64  `json:"connection_reuse"`  // share of requests reusing a connection, 0 to 1
+	AvgConnWait      float64  `json:"avg_conn_wait_ms"`  // waiting for a free connection to the target
+	AvgDNS           float64  `json:"avg_dns_ms"`        // per request, including reused connections
+	AvgConnect       float64  `json:"avg_connect_ms"`    // per request, including reused connections
+	AvgTLS           float64  `json:"avg_tls_ms"`        // per request, including reused connections
+	AvgWait          float64  `json:"avg_wait_ms"`       // target processing time
+	Bottleneck       string   `json:"bottleneck"`        // "connection_limit", "dns", "connect", "tls" or "target"
+	Suggestions      []string `json:"suggestions,omitempty"`
+}
+
+// LatencyStats summarizes the distribution of request durations, in milliseconds
+type LatencyStats struct {
+	Min     int64           `json:"min_ms"`
+	P50     int64           `json:"p50_ms"`
+	P90     int64           `json:"p90_ms"`
+	P95     int64           `json:"p95_ms"`
+	P99     int64           `json:"p99_ms"`
+	Max     int64           `json:"max_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the requests with a duration up to LE and above the previous bucket
+type LatencyBucket struct {
+	LE       *int64           `json:"le_ms,omitempty"` // upper bound, omitted for the last bucket
+	Count    int              `json:"count"`
+	Exemplar *LatencyExemplar `json:"exemplar,omitempty"` // the slowest traced request of the bucket, if tracing is enabled
+}
+
+// LatencyExemplar links a latency bucket to the trace of one of its requests, like the exemplars
+// of Prometheus histograms
+type LatencyExemplar struct {
+	Index    int    `json:"index"`
+	Duration int64  `json:"duration_ms"`
+	TraceID  string `json:"trace_id"`
+	SpanID   string `json:"span_id"` // of the webhook task span
+}
+
+// JobStatus represents the state of a running execution
+type JobStatus struct {
+	ID                 string `json:"id"`
+	State              string `json:"state"` // "running", "paused" or "awaiting_confirmation"
+	WebhookURL         string `json:"webhook_url"`
+	ConcurrencyGroup   string `json:"concurrency_group,omitempty"`
+	TotalRequests      int    `json:"total_requests"`
+	DispatchedRequests int    `json:"dispatched_requests"`
+	CompletedRequests  int    `json:"completed_requests"`
+	PendingRequests    int    `json:"pending_requests,omitempty"`
+	StartedAt          string `json:"started_at"`
+}
+
+// ExecutionRecord is the state of an execution, with its results once finished. Synchronous
+// executions are only recorded by a persistent execution store.
+type ExecutionRecord struct {
+	ExecutionID       string            `json:"execution_id"`
+	Status            string            `json:"status"`         // "running", "completed" or "failed"
+	Mode              string            `json:"mode,omitempty"` // "sync", "stream" or "async"
+	WebhookURL        string            `json:"webhook_url"`
+	ConcurrencyGroup  string            `json:"concurrency_group,omitempty"`
+	CallbackURL       string            `json:"callback_url,omitempty"`
+	TotalRequests     int               `json:"total_requests"`
+	CompletedRequests int               `json:"completed_requests"`
+	CreatedAt         string            `json:"created_at"`
+	FinishedAt        string            `json:"finished_at,omitempty"`
+	Error             string            `json:"error,omitempty"` // why a failed execution didn't run
+	Results           []WebhookResult   `json:"results,omitempty"`
+	Summary           *ExecutionSummary `json:"summary,omitempty"`
+	Options           *EffectiveOptions `json:"effective_options,omitempty"`
+	Payloads          []json.RawMessage `json:"payloads,omitempty"` // sent payloads, only kept if EXECUTION_STORE_PAYLOADS is enabled
+
+	FollowUpExecutionID string `json:"follow_up_execution_id,omitempty"` // execution started by on_success or on_failure
+
+	Events []JobEvent `json:"-"` // lifecycle of the execution, served by the job log
+}
+
+// JobEvent is an entry of the event log of an execution
+type JobEvent struct {
+	Seq        int    `json:"seq"`
+	Time       string `json:"time"` // RFC 3339 with sub-second precision
+	Type       string `json:"type"`
+	Index      *int   `json:"index,omitempty"`       // payload index of task events
+	Attempt    int    `json:"attempt,omitempty"`     // attempt of task events
+	StatusCode int    `json:"status_code,omitempty"` // response status of task events
+	Message    string `json:"message,omitempty"`     // error of failures, details of other events
+}
+
+// JobLog is the ordered event log of an execution
+type JobLog struct {
+	ExecutionID string     `json:"execution_id"`
+	Events      []JobEvent `json:"events"`
+}
+
+// ExecutionMatch is an execution found by an error search
+type ExecutionMatch struct {
+	ExecutionID     string   `json:"execution_id"`
+	Status          string   `json:"status"`
+	WebhookURL      string   `json:"webhook_url"`
+	CreatedAt       string   `json:"created_at"`
+	FinishedAt      string   `json:"finished_at,omitempty"`
+	MatchingResults int      `json:"matching_results"` // failed results whose error matches
+	Errors          []string `json:"errors"`           // distinct matching error messages, at most a few
+}
+
+// ExecutionFilter selects the executions listed by the history, newest first. Empty fields
+// don't filter.
+type ExecutionFilter struct {
+	Status           string
+	Mode             string
+	ConcurrencyGroup string
+	WebhookURL       string
+	From             string // RFC 3339 in UTC, executions created at or after
+	To               string // RFC 3339 in UTC, executions created before
+	BeforeCreatedAt  string // position of the last execution of the previous page
+	BeforeID         string
+	Limit            int
+}
+
+// ExecutionListItem is an execution in the history, without its results
+type ExecutionListItem struct {
+	ExecutionID       string            `json:"execution_id"`
+	Status            string            `json:"status"`
+	Mode              string            `json:"mode,omitempty"`
+	WebhookURL        string            `json:"webhook_url"`
+	ConcurrencyGroup  string            `json:"concurrency_group,omitempty"`
+	TotalRequests     int               `json:"total_requests"`
+	CompletedRequests int               `json:"completed_requests"`
+	CreatedAt         string            `json:"created_at"`
+	FinishedAt        string            `json:"finished_at,omitempty"`
+	ArchivedAt        string            `json:"archived_at,omitempty"` // results were moved to the archive, restore the execution to read them
+	Error             string            `json:"error,omitempty"`
+	Summary           *ExecutionSummary `json:"summary,omitempty"`
+	Links             ExecutionLinks    `json:"links"`
+}
+
+// ExecutionLinks are the endpoints of an execution
+type ExecutionLinks struct {
+	Self    string `json:"self"`    // the record with all results
+	Results string `json:"results"` // results only, filtered and projected
+	Stream  string `json:"stream"`  // results as Server-Sent Events
+}
+
+// ExecutionPage is a page of the execution history
+type ExecutionPage struct {
+	Executions []ExecutionListItem `json:"executions"`
+	NextCursor string              `json:"next_cursor,omitempty"` // passed as cursor to get the next page, empty on the last one
+}
+
+// ExecutionStoreStats describes the stored executions and what the retention policy purged
+type ExecutionStoreStats struct {
+	Backend          string `json:"backend"` // "memory" or "sqlite"
+	Executions       int    `json:"executions"`
+	SizeBytes        int64  `json:"size_bytes,omitempty"`     // database size in use, sqlite only
+	MaxSizeBytes     int64  `json:"max_size_bytes,omitempty"` // size limit, 0 is unlimited
+	RetentionSeconds int64  `json:"retention_seconds"`        // age of finished executions before they are purged, 0 keeps them
+	PurgedExecutions int64  `json:"purged_executions"`        // since the server started
+	PurgedResults    int64  `json:"purged_results"`
+	PurgedPayloads   int64  `json:"purged_payloads"`
+	LastCleanupAt    string `json:"last_cleanup_at,omitempty"`
+	LastCleanupError string `json:"last_cleanup_error,omitempty"`
+
+	ArchiveAfterSeconds int64 `json:"archive_after_seconds,omitempty"` // age of finished executions before they are archived, 0 if archival is disabled
+	ArchivedExecutions  int64 `json:"archived_executions,omitempty"`   // moved to the archive since the server started
+}
+
+// TargetCheck is the outcome of probing a webhook target
+type TargetCheck struct {
+	URL          string          `json:"url"` // probed URL, an instance of the service for discovery URLs
+	Reachable    bool            `json:"reachable"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	ResponseTime int64           `json:"response_time_ms"`
+	Timings      *RequestTimings `json:"timings,omitempty"`
+	TLS          *TargetTLS      `json:"tls,omitempty"`
+	N8N          *TargetN8N      `json:"n8n,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// TargetTLS describes the TLS connection to a target
+type TargetTLS struct {
+	Version       string   `json:"version"`
+	CipherSuite   string   `json:"cipher_suite"`
+	Subject       string   `json:"subject"`
+	Issuer        string   `json:"issuer"`
+	DNSNames      []string `json:"dns_names,omitempty"`
+	NotAfter      string   `json:"not_after"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// TargetN8N describes the n8n instance serving a target, as far as it is reachable
+type TargetN8N struct {
+	Healthy bool   `json:"healthy"`           // /healthz answered with 200
+	Version string `json:"version,omitempty"` // from the REST API, if it is public
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error   string       `json:"error"`
+	Message string       `json:"message,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"` // validation problems by field
+}
+
+// BulkLineResult is the outcome of a line of a bulk submission, the execution started for it or
+// why it was rejected
+type BulkLineResult struct {
+	Line        int    `json:"line"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	Status      string `json:"status,omitempty"`
+	StatusURL   string `json:"status_url,omitempty"`
+	*ErrorResponse
+}
+
+// BulkResponse is the response of a bulk submission
+type BulkResponse struct {
+	Accepted   int              `json:"accepted"`
+	Rejected   int              `json:"rejected"`
+	Executions []BulkLineResult `json:"executions"`
+}
+
+// FieldError describes a validation problem of a single request field
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. "auth.refresh.token_url" or "payloads[3]"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Index   *int   `json:"index,omitempty"` // payload index of problems with a single payload
 }
 
 // WebhookExecutionTask represents a single webhook execution task
 type WebhookExecutionTask struct {
-	Index       int
-	WebhookURL  string
-	AuthHeader  string
-	Payload     map[string]interface{}
-	TimeoutSec  int
+	Index           int
+	WebhookURL      string
+	TimeoutSec      int
+	DeadlineHeaders bool
+	GRPCTimeout     bool
+	ConcurrencyKey  string // value of the concurrency key of the payload, empty if not limited
 }
 
 // WebhookExecutionResult represents the result of a webhook execution task
 type WebhookExecutionResult struct {
-	Index     int
-	Success   bool
-	Response  json.RawMessage
-	Error     error
-	Duration  int64 // Duration in milliseconds
-	IsTimeout bool
-}
\ No newline at end of file
+	Index      int
+	StatusCode int
+	Success    bool
+	Response   json.RawMessage
+	Error      error
+	Duration   int64 // Duration in milliseconds
+	IsTimeout  bool
+	IsAborted  bool
+	IsInvalid  bool
+	Timings    *RequestTimings
+	Dispatched bool          // the request was sent, as opposed to skipped or aborted
+	Retryable  bool          // the failure is transient, e.g. a connection error or a 503
+	RetryAfter time.Duration // delay requested by the Retry-After header of a 429 or 503
+
+	PayloadBytes int // size of the sent payload
+
+	ResponseHeaders map[string]string // the response headers named in the request
+	Truncated       bool              // the response body exceeded the size limit
+
+	TraceID, SpanID string // of the sampled span of the webhook call, empty if not traced
+
+	IsMismatch    bool // the response didn't echo the X-Item-Index of the request
+	Seq           int  // position in the completion order of the execution, from 1
+	IsCircuitOpen bool // not sent, the circuit of the target host is open
+
+	DuplicateOf *DuplicateRef // not sent, an identical item was recently sent by another execution
+
+	Attempts         int
+	AttemptDurations []int64 // milliseconds, only set if the task was retried
+}
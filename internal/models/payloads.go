@@ -0,0 +1,250 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Payloads are the payloads of an execution. Small payload arrays are kept in memory, large
+// ones are spooled to a temporary file and read back item by item when they are dispatched.
+type Payloads struct {
+	items   []json.RawMessage
+	invalid map[int]string // problems of items which can't be dispatched, by index
+
+	spool   *os.File
+	offsets []int64 // start of every item in the spool file, followed by the end of the last one
+}
+
+// PayloadError reports an invalid item of a payload array
+type PayloadError struct {
+	Index   int
+	Message string
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("payload %d %s", e.Index, e.Message)
+}
+
+// NewPayloads creates in-memory payloads
+func NewPayloads(items ...json.RawMessage) Payloads {
+	return Payloads{items: items}
+}
+
+// Len returns the number of payloads
+func (p *Payloads) Len() int {
+	if p.spool != nil {
+		return len(p.offsets) - 1
+	}
+	return len(p.items)
+}
+
+// Invalid returns the problems of all items which can't be dispatched, in index order
+func (p *Payloads) Invalid() []PayloadError {
+	invalid := make([]PayloadError, 0, len(p.invalid))
+	for index, message := range p.invalid {
+		invalid = append(invalid, PayloadError{Index: index, Message: message})
+	}
+	sort.Slice(invalid, func(i, j int) bool {
+		return invalid[i].Index < invalid[j].Index
+	})
+	return invalid
+}
+
+// InvalidAt returns the problem of the item at index, if it can't be dispatched
+func (p *Payloads) InvalidAt(index int) (string, bool) {
+	message, ok := p.invalid[index]
+	return message, ok
+}
+
+// Spooled reports whether the payloads are kept on disk
+func (p *Payloads) Spooled() bool {
+	return p.spool != nil
+}
+
+// Get returns the payload at index
+func (p *Payloads) Get(index int) (json.RawMessage, error) {
+	if index < 0 || index >= p.Len() {
+		return nil, fmt.Errorf("payload index %d out of range", index)
+	}
+	if p.spool == nil {
+		return p.items[index], nil
+	}
+
+	item := make([]byte, p.offsets[index+1]-p.offsets[index])
+	if _, err := p.spool.ReadAt(item, p.offsets[index]); err != nil {
+		return nil, fmt.Errorf("failed to read spooled payload %d: %w", index, err)
+	}
+	return item, nil
+}
+
+// Close removes the spool file, it is a no-op for in-memory payloads
+func (p *Payloads) Close() error {
+	if p.spool == nil {
+		return nil
+	}
+	name := p.spool.Name()
+	err := p.spool.Close()
+	if removeErr := os.Remove(name); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) && err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// UnmarshalJSON decodes payloads into memory
+func (p *Payloads) UnmarshalJSON(data []byte) error {
+	decoded, err := DecodePayloads(json.NewDecoder(bytes.NewReader(data)), 0, "")
+	if err != nil {
+		return err
+	}
+	*p = decoded
+	return nil
+}
+
+// MarshalJSON encodes the payloads as a JSON array
+func (p Payloads) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < p.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		item, err := p.Get(i)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(item)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// DecodePayloads decodes a JSON array of payload objects from dec, items which aren't
+// objects are recorded as invalid. Once the payloads exceed
+// spoolThreshold bytes they are written to a temporary file in spoolDir instead of being
+// kept in memory, a spoolThreshold of 0 never spools.
+func DecodePayloads(dec *json.Decoder, spoolThreshold int64, spoolDir string) (Payloads, error) {
+	var p Payloads
+
+	tok, err := dec.Token()
+	if err != nil {
+		return p, err
+	}
+	if tok == nil {
+		return p, nil // null
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return p, fmt.Errorf("payloads must be an array")
+	}
+
+	w := NewPayloadWriter(spoolThreshold, spoolDir)
+	for dec.More() {
+		var item json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			w.Abort()
+			return Payloads{}, err
+		}
+		if err := w.Add(item); err != nil {
+			w.Abort()
+			return Payloads{}, err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		w.Abort()
+		return Payloads{}, err
+	}
+	return w.Finish()
+}
+
+// PayloadWriter collects payloads one at a time, spooling them to disk like DecodePayloads.
+// Payloads produced elsewhere than in a request body, e.g. by a query, are built with it.
+type PayloadWriter struct {
+	payloads  Payloads
+	writer    *bufio.Writer
+	size      int64
+	threshold int64
+	dir       string
+}
+
+// NewPayloadWriter creates a writer spooling to spoolDir once the payloads exceed
+// spoolThreshold bytes, a spoolThreshold of 0 never spools
+func NewPayloadWriter(spoolThreshold int64, spoolDir string) *PayloadWriter {
+	return &PayloadWriter{threshold: spoolThreshold, dir: spoolDir}
+}
+
+// Len returns the number of payloads added so far
+func (w *PayloadWriter) Len() int {
+	return w.payloads.Len()
+}
+
+// Add appends a payload, items which aren't objects are recorded as invalid
+func (w *PayloadWriter) Add(item json.RawMessage) error {
+	p := &w.payloads
+	// Invalid items are kept, the request decides whether they are skipped or rejected
+	if trimmed := bytes.TrimSpace(item); len(trimmed) == 0 || trimmed[0] != '{' {
+		if p.invalid == nil {
+			p.invalid = make(map[int]string)
+		}
+		p.invalid[p.Len()] = "must be a JSON object"
+	}
+
+	w.size += int64(len(item))
+	if w.writer == nil && w.threshold > 0 && w.size > w.threshold {
+		writer, err := p.startSpool(w.dir)
+		if err != nil {
+			return err
+		}
+		w.writer = writer
+	}
+
+	if w.writer == nil {
+		p.items = append(p.items, item)
+		return nil
+	}
+	if _, err := w.writer.Write(item); err != nil {
+		return fmt.Errorf("failed to spool payloads: %w", err)
+	}
+	p.offsets = append(p.offsets, p.offsets[len(p.offsets)-1]+int64(len(item)))
+	return nil
+}
+
+// Finish returns the payloads added, the writer must not be used afterwards
+func (w *PayloadWriter) Finish() (Payloads, error) {
+	if w.writer != nil {
+		if err := w.writer.Flush(); err != nil {
+			w.Abort()
+			return Payloads{}, fmt.Errorf("failed to spool payloads: %w", err)
+		}
+	}
+	return w.payloads, nil
+}
+
+// Abort discards the payloads added and removes their spool file
+func (w *PayloadWriter) Abort() {
+	w.payloads.Close()
+}
+
+// startSpool moves the payloads decoded so far to a new spool file
+func (p *Payloads) startSpool(dir string) (*bufio.Writer, error) {
+	file, err := os.CreateTemp(dir, "n8n-parallels-payloads-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payload spool: %w", err)
+	}
+	p.spool = file
+
+	writer := bufio.NewWriter(file)
+	p.offsets = []int64{0}
+	for _, item := range p.items {
+		if _, err := writer.Write(item); err != nil {
+			return nil, fmt.Errorf("failed to spool payloads: %w", err)
+		}
+		p.offsets = append(p.offsets, p.offsets[len(p.offsets)-1]+int64(len(item)))
+	}
+	p.items = nil
+	return writer, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestAbortAfterFailuresAsResultsComeIn(t *testing.T) {
+	payloads := func() models.Payloads {
+		return models.NewPayloads(json.RawMessage(`{"k":"a"}`), json.RawMessage(`{"k":"a"}`), json.RawMessage(`{"k":"a"}`))
+	}
+	tests := []struct {
+		name    string
+		request func(url string) *models.ParallelExecuteRequest
+	}{
+		{"waiting for the concurrency key", func(url string) *models.ParallelExecuteRequest {
+			return &models.ParallelExecuteRequest{
+				WebhookURL:          url,
+				Payloads:            payloads(),
+				Timeout:             30,
+				AbortAfterFailures:  1,
+				ConcurrencyKey:      "item.k",
+				ConcurrencyKeyLimit: 1,
+			}
+		}},
+		{"waiting for the rate schedule", func(url string) *models.ParallelExecuteRequest {
+			return &models.ParallelExecuteRequest{
+				WebhookURL:         url,
+				Payloads:           payloads(),
+				Timeout:            30,
+				AbortAfterFailures: 1,
+				RateSchedule:       &models.RateSchedule{DefaultRPS: 0.001}, // one per 1000s of the fake clock, which stands still
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(http.StatusBadRequest)
+			}))
+			defer target.Close()
+
+			ws := newTestService(t, nil)
+			ws.SetClock(newFakeClock(), SystemRandomness)
+			response, err := ws.ExecuteParallel(context.Background(), tt.request(target.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			summary := response.Summary
+			if calls.Load() != 1 || !summary.Aborted || summary.AbortedRequests != 2 {
+				t.Fatalf("%d calls, summary %+v, want 1 call and 2 aborted requests", calls.Load(), summary)
+			}
+		})
+	}
+}
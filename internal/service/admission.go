@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// taskSlots bounds the webhook calls in flight across all executions of the server, nil is
+// unbounded. While the server is saturated, freed slots are handed to the waiting flows by
+// weighted fair queuing: every flow gets a share of the slots proportional to its weight, so a
+// large batch doesn't starve the small batches submitted next to it.
+type taskSlots struct {
+	mu            sync.Mutex
+	limit         int
+	inUse         int
+	weights       map[string]int
+	defaultWeight int
+
+	waiting map[slotFlow][]*slotWaiter // waiting tasks per flow, in arrival order
+	pass    map[slotFlow]float64       // virtual time of every flow, advanced by 1/weight per slot
+	virtual float64                    // virtual time of the last slot handed out
+	seq     uint64
+	charges int
+}
+
+// slotFlow is what slots are shared fairly between: a concurrency group, or a single execution
+// without one
+type slotFlow struct {
+	group     string
+	execution string
+}
+
+// flowOf returns the flow of an execution
+func flowOf(exec *execution) slotFlow {
+	if exec.concurrencyGroup != "" {
+		return slotFlow{group: exec.concurrencyGroup}
+	}
+	return slotFlow{execution: exec.id}
+}
+
+// slotSweepInterval is the number of slots handed out between removals of the virtual times of
+// flows which fell behind, they start at the current virtual time again anyway
+const slotSweepInterval = 1024
+
+// slotWaiter is a task waiting for a slot
+type slotWaiter struct {
+	ready chan struct{} // closed once the slot was handed over
+	seq   uint64
+}
+
+// newTaskSlots creates the server-wide slots, limit 0 disables the bound. Weights are per
+// concurrency group, other groups and executions without a group have weight 1.
+func newTaskSlots(limit int, weights map[string]int) *taskSlots {
+	if limit <= 0 {
+		return nil
+	}
+	return &taskSlots{
+		limit:         limit,
+		weights:       weights,
+		defaultWeight: 1,
+		waiting:       make(map[slotFlow][]*slotWaiter),
+		pass:          make(map[slotFlow]float64),
+	}
+}
+
+// acquire blocks until a slot is handed to the flow or the context is done
+func (s *taskSlots) acquire(ctx context.Context, flow slotFlow) error {
+	if s == nil {
+		return nil
+	}
+	return s.wait(ctx, flow, nil)
+}
+
+// admit takes a slot for the first task of an execution, waiting at most timeout.
+// It fails with ErrServerBusy if the server stays saturated, timeout 0 doesn't wait at all.
+func (s *taskSlots) admit(ctx context.Context, flow slotFlow, timeout time.Duration) error {
+	if s == nil {
+		return nil
+	}
+	if timeout <= 0 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.free() {
+			return ErrServerBusy
+		}
+		s.grant(flow)
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	return s.wait(ctx, flow, timer.C)
+}
+
+// wait takes a free slot or queues for one, it fails with ErrServerBusy once expire fires
+func (s *taskSlots) wait(ctx context.Context, flow slotFlow, expire <-chan time.Time) error {
+	s.mu.Lock()
+	if s.free() {
+		s.grant(flow)
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.seq++
+	waiter := &slotWaiter{ready: make(chan struct{}), seq: s.seq}
+	if len(s.waiting[flow]) == 0 {
+		s.activate(flow)
+	}
+	s.waiting[flow] = append(s.waiting[flow], waiter)
+	s.mu.Unlock()
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-expire:
+		err = ErrServerBusy
+	case <-ctx.Done():
+		err = context.Cause(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dequeue(flow, waiter) {
+		// The slot was handed over in the meantime, it goes to the next waiter
+		s.handOver()
+	}
+	return err
+}
+
+// release frees a slot taken by acquire or admit, handing it to the next waiting flow if any
+func (s *taskSlots) release() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOver()
+}
+
+// free reports whether a slot can be taken right away, waiting tasks go first
+func (s *taskSlots) free() bool {
+	return s.inUse < s.limit && len(s.waiting) == 0
+}
+
+// grant takes a slot for the flow and charges it
+func (s *taskSlots) grant(flow slotFlow) {
+	s.inUse++
+	s.activate(flow)
+	s.charge(flow)
+}
+
+// handOver passes a slot which is given back to the waiting flow with the lowest virtual time
+func (s *taskSlots) handOver() {
+	var next slotFlow
+	found := false
+	for flow, waiters := range s.waiting {
+		if !found || s.pass[flow] < s.pass[next] ||
+			(s.pass[flow] == s.pass[next] && waiters[0].seq < s.waiting[next][0].seq) {
+			next, found = flow, true
+		}
+	}
+	if !found {
+		s.inUse--
+		if s.inUse == 0 {
+			// Nothing in flight, the shares start over
+			s.pass = make(map[slotFlow]float64)
+			s.virtual = 0
+		}
+		return
+	}
+
+	waiter := s.waiting[next][0]
+	s.dequeue(next, waiter)
+	s.charge(next)
+	close(waiter.ready)
+}
+
+// activate lets a flow which was idle start at the current virtual time, so it can't claim the
+// slots it didn't use while idle
+func (s *taskSlots) activate(flow slotFlow) {
+	if s.pass[flow] < s.virtual {
+		s.pass[flow] = s.virtual
+	}
+}
+
+// charge advances the virtual time of a flow for a slot handed to it
+func (s *taskSlots) charge(flow slotFlow) {
+	weight := s.defaultWeight
+	if w, ok := s.weights[flow.group]; ok && flow.execution == "" {
+		weight = w
+	}
+	s.virtual = max(s.virtual, s.pass[flow])
+	s.pass[flow] += 1 / float64(weight)
+
+	s.charges++
+	if s.charges%slotSweepInterval == 0 {
+		for f, pass := range s.pass {
+			if pass <= s.virtual && len(s.waiting[f]) == 0 {
+				delete(s.pass, f)
+			}
+		}
+	}
+}
+
+// dequeue removes a waiter of a flow, false if it isn't waiting anymore
+func (s *taskSlots) dequeue(flow slotFlow, waiter *slotWaiter) bool {
+	waiters := s.waiting[flow]
+	for i, w := range waiters {
+		if w == waiter {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			if len(waiters) == 0 {
+				delete(s.waiting, flow)
+			} else {
+				s.waiting[flow] = waiters
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// minBottleneckShare is the share of the request time a phase other than the target has to
+// take at least to be reported as the bottleneck
+const minBottleneckShare = 0.2
+
+// analyzeExecution breaks down where the requests of an execution spent their time, using the
+// timings recorded for every request, and suggests settings to speed up the next execution.
+// transport is the one the requests were sent with, nil if unknown. It returns nil if no request
+// got a response.
+func analyzeExecution(request *models.ParallelExecuteRequest, results []models.WebhookExecutionResult, transport *http.Transport, maxConcurrency int) *models.ExecutionAnalysis {
+	analysis := &models.ExecutionAnalysis{}
+	for _, result := range results {
+		if result.Timings == nil {
+			continue
+		}
+		analysis.AnalyzedRequests++
+		if !result.Timings.ConnectionReused {
+			analysis.NewConnections++
+		}
+		analysis.AvgConnWait += result.Timings.ConnWait
+		analysis.AvgDNS += result.Timings.DNS
+		analysis.AvgConnect += result.Timings.Connect
+		analysis.AvgTLS += result.Timings.TLS
+		analysis.AvgWait += result.Timings.Wait
+	}
+	if analysis.AnalyzedRequests == 0 {
+		return nil
+	}
+
+	n := float64(analysis.AnalyzedRequests)
+	analysis.ConnectionReuse = math.Round((1-float64(analysis.NewConnections)/n)*100) / 100
+	analysis.AvgConnWait = roundMillis(analysis.AvgConnWait / n)
+	analysis.AvgDNS = roundMillis(analysis.AvgDNS / n)
+	analysis.AvgConnect = roundMillis(analysis.AvgConnect / n)
+	analysis.AvgTLS = roundMillis(analysis.AvgTLS / n)
+	analysis.AvgWait = roundMillis(analysis.AvgWait / n)
+
+	// The phase taking the longest on average, the target unless another phase takes a
+	// noticeable share of the time
+	total := analysis.AvgConnWait + analysis.AvgDNS + analysis.AvgConnect + analysis.AvgTLS + analysis.AvgWait
+	analysis.Bottleneck = "target"
+	longest := analysis.AvgWait
+	for _, phase := range []struct {
+		name     string
+		duration float64
+	}{
+		{"connection_limit", analysis.AvgConnWait},
+		{"dns", analysis.AvgDNS},
+		{"connect", analysis.AvgConnect},
+		{"tls", analysis.AvgTLS},
+	} {
+		if phase.duration > longest && phase.duration >= minBottleneckShare*total {
+			analysis.Bottleneck, longest = phase.name, phase.duration
+		}
+	}
+
+	analysis.Suggestions = suggestTuning(request, analysis, transport, maxConcurrency)
+	return analysis
+}
+
+// roundMillis rounds an average to the microsecond precision of the timings
+func roundMillis(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
+
+// suggestTuning returns concrete changes of the request options addressing the bottleneck
+func suggestTuning(request *models.ParallelExecuteRequest, analysis *models.ExecutionAnalysis, transport *http.Transport, maxConcurrency int) []string {
+	var suggestions []string
+	switch analysis.Bottleneck {
+	case "connection_limit":
+		if transport != nil && transport.MaxConnsPerHost > 0 && transport.MaxConnsPerHost < maxConcurrency {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"Requests waited %.1f ms on average for a free connection: raise transport.max_conns_per_host from %d to %d (max_concurrency)",
+				analysis.AvgConnWait, transport.MaxConnsPerHost, maxConcurrency))
+		} else {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"Requests waited %.1f ms on average for a free connection although max_conns_per_host doesn't limit them, the target likely limits concurrent streams: lower max_concurrency or spread the load across more target hosts",
+				analysis.AvgConnWait))
+		}
+
+	case "dns":
+		if !request.PinResolution && len(request.Tasks) == 0 {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"Resolving the target took %.1f ms on average: set pin_resolution to resolve it once per execution",
+				analysis.AvgDNS))
+		}
+		suggestions = append(suggestions, "Configure a faster or closer resolver with DNS_SERVERS")
+
+	case "connect", "tls":
+		phase := "Connecting"
+		if analysis.Bottleneck == "tls" {
+			phase = "The TLS handshake"
+		}
+		if transport != nil && transport.DisableKeepAlives {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"%s took a large share of the request time and every request opened a connection: drop transport.disable_keep_alives",
+				phase))
+			break
+		}
+		idle := http.DefaultMaxIdleConnsPerHost
+		if transport != nil && transport.MaxIdleConnsPerHost > 0 {
+			idle = transport.MaxIdleConnsPerHost
+		}
+		if idle < maxConcurrency {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"%s took a large share of the request time and only %.0f%% of the requests reused a connection: raise transport.max_idle_conns_per_host from %d to %d (max_concurrency), so connections are kept for reuse",
+				phase, analysis.ConnectionReuse*100, idle, maxConcurrency))
+		} else {
+			suggestions = append(suggestions, fmt.Sprintf(
+				"%s took a large share of the request time: the target or a proxy in front of it closes connections, enable keep-alive there",
+				phase))
+		}
+
+	case "target":
+		suggestions = append(suggestions, fmt.Sprintf(
+			"The target took %.1f ms on average to respond, the transport isn't the bottleneck: raise max_concurrency above %d if the target has spare capacity",
+			analysis.AvgWait, maxConcurrency))
+	}
+	return suggestions
+}
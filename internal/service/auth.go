@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Supported auth types
+const (
+	AuthTypeBasic  = "basic"
+	AuthTypeBearer = "bearer"
+	AuthTypeAPIKey = "api_key"
+
+	AuthTypeGoogleIDToken = "google_id_token"
+	AuthTypeAzureAD       = "azure_ad"
+)
+
+// credentials authenticate outgoing webhook requests
+type credentials interface {
+	apply(ctx context.Context, req *http.Request) error
+}
+
+// refreshableCredentials can obtain new credentials once the target rejects the current ones
+type refreshableCredentials interface {
+	credentials
+	refresh(ctx context.Context, client *http.Client) error
+}
+
+// newCredentials creates the credentials of a request, nil if the request doesn't use auth
+func (ws *WebhookService) newCredentials(request *models.ParallelExecuteRequest) (credentials, error) {
+	authHeader, auth := request.AuthHeader, request.Auth
+	if auth == nil {
+		if authHeader == "" {
+			return nil, nil
+		}
+		if !validHeaderValue(authHeader) {
+			return nil, fmt.Errorf("%w: auth_header contains invalid characters", ErrInvalidRequest)
+		}
+		return headerCredentials{name: "Authorization", value: authHeader}, nil
+	}
+
+	if authHeader != "" {
+		return nil, fmt.Errorf("%w: auth_header and auth can't be used together", ErrInvalidRequest)
+	}
+
+	if auth.Refresh != nil && auth.Type != AuthTypeBearer {
+		return nil, fmt.Errorf("%w: auth.refresh is only supported for bearer auth", ErrInvalidRequest)
+	}
+
+	switch auth.Type {
+	case AuthTypeBasic:
+		if auth.Username == "" {
+			return nil, fmt.Errorf("%w: auth.username is required for basic auth", ErrInvalidRequest)
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		return headerCredentials{name: "Authorization", value: "Basic " + encoded}, nil
+	case AuthTypeBearer:
+		if auth.Token == "" {
+			return nil, fmt.Errorf("%w: auth.token is required for bearer auth", ErrInvalidRequest)
+		}
+		if auth.Refresh != nil {
+			if auth.Refresh.Type == "oauth2" && auth.Refresh.RefreshToken == "" {
+				return nil, fmt.Errorf("%w: auth.refresh.refresh_token is required for oauth2 refresh", ErrInvalidRequest)
+			}
+			return &refreshingBearerCredentials{token: auth.Token, config: auth.Refresh, clock: ws.clock}, nil
+		}
+		return headerCredentials{name: "Authorization", value: "Bearer " + auth.Token}, nil
+	case AuthTypeAPIKey:
+		if auth.Name == "" || auth.Value == "" {
+			return nil, fmt.Errorf("%w: auth.name and auth.value are required for api_key auth", ErrInvalidRequest)
+		}
+		switch auth.In {
+		case "", "header":
+			if !validHeaderName(auth.Name) || !validHeaderValue(auth.Value) {
+				return nil, fmt.Errorf("%w: auth.name and auth.value must be a valid header", ErrInvalidRequest)
+			}
+			return headerCredentials{name: auth.Name, value: auth.Value}, nil
+		case "query":
+			return queryCredentials{name: auth.Name, value: auth.Value}, nil
+		default:
+			return nil, fmt.Errorf("%w: auth.in must be 'header' or 'query'", ErrInvalidRequest)
+		}
+	case AuthTypeGoogleIDToken:
+		audience, err := ws.googleIDTokenAudience(request.WebhookURL, auth.Audience)
+		if err != nil {
+			return nil, err
+		}
+		return cachedTokenCredentials{
+			cache: ws.tokens,
+			key:   AuthTypeGoogleIDToken + ":" + audience,
+			fetch: ws.googleIDTokenFetcher(audience),
+		}, nil
+	case AuthTypeAzureAD:
+		if auth.TenantID == "" || auth.ClientID == "" || auth.ClientSecret == "" || auth.Scope == "" {
+			return nil, fmt.Errorf("%w: auth.tenant_id, auth.client_id, auth.client_secret and auth.scope are required for azure_ad auth", ErrInvalidRequest)
+		}
+		return cachedTokenCredentials{
+			cache: ws.tokens,
+			key:   azureADCacheKey(auth),
+			fetch: ws.azureADTokenFetcher(auth),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported auth type %q", ErrInvalidRequest, auth.Type)
+	}
+}
+
+// headerCredentials set a static header
+type headerCredentials struct {
+	name  string
+	value string
+}
+
+func (c headerCredentials) apply(ctx context.Context, req *http.Request) error {
+	req.Header.Set(c.name, c.value)
+	return nil
+}
+
+// queryCredentials add a static query parameter
+type queryCredentials struct {
+	name  string
+	value string
+}
+
+func (c queryCredentials) apply(ctx context.Context, req *http.Request) error {
+	query := req.URL.Query()
+	query.Set(c.name, c.value)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// authRefreshRetryInterval is how long a failed token refresh is reported to the items rejected
+// with the expired token before the next one tries again
+const authRefreshRetryInterval = 5 * time.Second
+
+// refreshingBearerCredentials is a bearer token which is refreshed when the target answers 401.
+// A successful refresh happens once per execution, all items rejected with the expired token
+// share its outcome. A failed one is retried after authRefreshRetryInterval.
+type refreshingBearerCredentials struct {
+	config *models.AuthRefresh
+	clock  Clock
+
+	mu         sync.Mutex
+	token      string
+	refreshed  bool
+	refreshErr error
+	failedAt   time.Time
+}
+
+func (c *refreshingBearerCredentials) apply(ctx context.Context, req *http.Request) error {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (c *refreshingBearerCredentials) refresh(ctx context.Context, client *http.Client) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshed {
+		return nil
+	}
+	if c.refreshErr != nil && c.clock.Now().Sub(c.failedAt) < authRefreshRetryInterval {
+		return c.refreshErr
+	}
+
+	token, err := c.requestToken(ctx, client)
+	if err != nil {
+		err = fmt.Errorf("failed to refresh auth token: %w", err)
+		// The item giving up on the refresh says nothing about the token endpoint
+		if ctx.Err() == nil {
+			c.refreshErr, c.failedAt = err, c.clock.Now()
+		}
+		return err
+	}
+	c.token, c.refreshed, c.refreshErr = token, true, nil
+	return nil
+}
+
+// requestToken obtains a new access token from the configured endpoint
+func (c *refreshingBearerCredentials) requestToken(ctx context.Context, client *http.Client) (string, error) {
+	if c.config.Type == "oauth2" {
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", c.config.RefreshToken)
+		for key, value := range map[string]string{
+			"client_id":     c.config.ClientID,
+			"client_secret": c.config.ClientSecret,
+			"scope":         c.config.Scope,
+		} {
+			if value != "" {
+				form.Set(key, value)
+			}
+		}
+
+		token, err := requestOAuth2Token(ctx, client, c.config.TokenURL, form)
+		if err != nil {
+			return "", err
+		}
+		if token.AccessToken == "" {
+			return "", fmt.Errorf("token response has no access_token")
+		}
+		return token.AccessToken, nil
+	}
+
+	method := c.config.Method
+	if method == "" {
+		method = "POST"
+	}
+
+	var body bytes.Buffer
+	if c.config.Body != nil {
+		if err := json.NewEncoder(&body).Encode(c.config.Body); err != nil {
+			return "", fmt.Errorf("failed to marshal token request body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.TokenURL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	if c.config.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range c.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	document, err := requestToken(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	field := c.config.TokenField
+	if field == "" {
+		field = "access_token"
+	}
+	token, ok := lookupField(document, field)
+	if !ok {
+		return "", fmt.Errorf("token response has no %s", field)
+	}
+	return token, nil
+}
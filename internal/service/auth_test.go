@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestFailedTokenRefreshIsRetriedAfterInterval(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fresh"}`))
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	creds := &refreshingBearerCredentials{
+		token:  "expired",
+		config: &models.AuthRefresh{Type: "token_endpoint", TokenURL: server.URL},
+		clock:  clock,
+	}
+	ctx := context.Background()
+
+	if err := creds.refresh(ctx, server.Client()); err == nil {
+		t.Fatal("first refresh succeeded")
+	}
+	// Items rejected right after the failure share it
+	if err := creds.refresh(ctx, server.Client()); err == nil || calls.Load() != 1 {
+		t.Fatalf("refresh within the retry interval: err %v, %d calls", err, calls.Load())
+	}
+
+	clock.Advance(authRefreshRetryInterval)
+	if err := creds.refresh(ctx, server.Client()); err != nil {
+		t.Fatalf("refresh after the retry interval: %v", err)
+	}
+	req := httptest.NewRequest("POST", "http://target", nil)
+	creds.apply(ctx, req)
+	if got := req.Header.Get("Authorization"); got != "Bearer fresh" {
+		t.Fatalf("authorization %q", got)
+	}
+
+	// A successful refresh is done once
+	clock.Advance(time.Hour)
+	if err := creds.refresh(ctx, server.Client()); err != nil || calls.Load() != 2 {
+		t.Fatalf("refresh after success: err %v, %d calls", err, calls.Load())
+	}
+}
+
+func TestCanceledTokenRefreshIsNotShared(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fresh"}`))
+	}))
+	defer server.Close()
+
+	creds := &refreshingBearerCredentials{
+		token:  "expired",
+		config: &models.AuthRefresh{Type: "token_endpoint", TokenURL: server.URL},
+		clock:  newFakeClock(),
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := creds.refresh(canceled, server.Client()); err == nil {
+		t.Fatal("canceled refresh succeeded")
+	}
+	if err := creds.refresh(context.Background(), server.Client()); err != nil {
+		t.Fatalf("refresh after a canceled one: %v", err)
+	}
+}
+
+func TestCachedTokensExpireByTheServiceClock(t *testing.T) {
+	ws := newTestService(t, nil)
+	clock := newFakeClock()
+	ws.SetClock(clock, SystemRandomness)
+
+	fetches := 0
+	fetch := func(ctx context.Context) (string, time.Time, error) {
+		fetches++
+		return "token", ws.clock.Now().Add(time.Hour), nil
+	}
+	get := func() {
+		t.Helper()
+		if _, err := ws.tokens.get(context.Background(), "key", fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get()
+	clock.Advance(time.Hour - 2*tokenExpiryMargin)
+	get()
+	if fetches != 1 {
+		t.Fatalf("fetched %d tokens before the expiry margin, want 1", fetches)
+	}
+	clock.Advance(tokenExpiryMargin)
+	get()
+	if fetches != 2 {
+		t.Fatalf("fetched %d tokens within the expiry margin, want 2", fetches)
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// azureADTokenURL is the client credentials endpoint of a Microsoft Entra tenant
+const azureADTokenURL = "https://login.microsoftonline.com/%s/oauth2/v2.0/token"
+
+// azureADCacheKey identifies the tokens of an Azure AD client. The secret is part of the key
+// so that a request with a wrong secret never receives a token obtained with the right one.
+func azureADCacheKey(auth *models.WebhookAuth) string {
+	secret := sha256.Sum256([]byte(auth.ClientSecret))
+	return AuthTypeAzureAD + ":" + auth.TenantID + ":" + auth.ClientID + ":" + auth.Scope + ":" + hex.EncodeToString(secret[:])
+}
+
+// azureADTokenFetcher obtains access tokens with the client credentials grant
+func (ws *WebhookService) azureADTokenFetcher(auth *models.WebhookAuth) tokenFetcher {
+	tokenURL := fmt.Sprintf(azureADTokenURL, url.PathEscape(auth.TenantID))
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", auth.ClientID)
+	form.Set("client_secret", auth.ClientSecret)
+	form.Set("scope", auth.Scope)
+
+	return func(ctx context.Context) (string, time.Time, error) {
+		token, err := requestOAuth2Token(ctx, ws.client, tokenURL, form)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to obtain azure ad token: %w", err)
+		}
+		if token.AccessToken == "" {
+			return "", time.Time{}, fmt.Errorf("azure ad token response has no access_token")
+		}
+
+		expiresIn := time.Duration(token.ExpiresIn) * time.Second
+		if expiresIn <= 0 {
+			expiresIn = time.Hour
+		}
+		return token.AccessToken, ws.clock.Now().Add(expiresIn), nil
+	}
+}
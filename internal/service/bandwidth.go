@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// bandwidthChunkSize is the largest chunk of a request body written at once when throttling
+const bandwidthChunkSize = 32 << 10
+
+// bandwidthLimiter caps the aggregate outbound bandwidth of all executions.
+// Up to a second worth of bytes may be sent in a burst after idle periods.
+type bandwidthLimiter struct {
+	bytesPerSecond int
+
+	mu   sync.Mutex
+	next time.Time // when the bytes reserved so far have been sent at the configured rate
+}
+
+// newBandwidthLimiter creates a limiter, nil if bytesPerSecond is not positive
+func newBandwidthLimiter(bytesPerSecond int) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until n bytes may be sent
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	cost := time.Duration(n) * time.Second / time.Duration(l.bytesPerSecond)
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now.Add(-time.Second)) {
+		l.next = now.Add(-time.Second)
+	}
+	l.next = l.next.Add(cost)
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader reads a request body at the rate allowed by a bandwidth limiter
+type throttledReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunkSize {
+		p = p[:bandwidthChunkSize]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// newOutboundRequest creates an outbound request with the given body, throttled to the
+// configured outbound bandwidth
+func (ws *WebhookService) newOutboundRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	if ws.bandwidth == nil {
+		return http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	}
+
+	newBody := func() io.ReadCloser {
+		return io.NopCloser(&throttledReader{ctx: ctx, reader: bytes.NewReader(body), limiter: ws.bandwidth})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, newBody())
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return newBody(), nil
+	}
+	return req, nil
+}
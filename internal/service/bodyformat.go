@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// defaultXMLRoot is the root element of xml bodies if the request doesn't set xml_root
+const defaultXMLRoot = "root"
+
+// rawBodyMember is the member of a payload holding the body of raw requests
+const rawBodyMember = "body"
+
+// quoteEscaper escapes the names in Content-Disposition headers like mime/multipart does
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// validateBodyFormat checks the body options of a request. The content type is checked with
+// the other header values in checkRequestLimits.
+func validateBodyFormat(request *models.ParallelExecuteRequest) error {
+	if request.BodyFormat == models.BodyFormatMultipart && request.ContentType != "" {
+		return fmt.Errorf("%w: content_type can't be set with body_format multipart, the boundary is chosen by the server", ErrInvalidRequest)
+	}
+	if request.XMLRoot == "" {
+		return nil
+	}
+	if request.BodyFormat != models.BodyFormatXML {
+		return fmt.Errorf("%w: xml_root requires body_format xml", ErrInvalidRequest)
+	}
+	if !validXMLName(request.XMLRoot) {
+		return fmt.Errorf("%w: xml_root %q isn't a valid XML element name", ErrInvalidRequest, request.XMLRoot)
+	}
+	return nil
+}
+
+// contentTypeOf returns the Content-Type of the webhook calls of a request
+func contentTypeOf(request *models.ParallelExecuteRequest) string {
+	if request.ContentType != "" {
+		return request.ContentType
+	}
+	switch request.BodyFormat {
+	case models.BodyFormatRaw:
+		return "text/plain; charset=utf-8"
+	case models.BodyFormatForm:
+		return "application/x-www-form-urlencoded"
+	case models.BodyFormatXML:
+		return "application/xml; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// encodeBody converts a payload object to the body format of the request and returns it with
+// its Content-Type
+func encodeBody(request *models.ParallelExecuteRequest, payload []byte) ([]byte, string, error) {
+	var body []byte
+	var err error
+	switch request.BodyFormat {
+	case models.BodyFormatRaw:
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			return nil, "", err
+		}
+		var text *string
+		if err := json.Unmarshal(raw[rawBodyMember], &text); err != nil || text == nil {
+			return nil, "", fmt.Errorf("payload needs a string %q member with body_format raw", rawBodyMember)
+		}
+		body = []byte(*text)
+	case models.BodyFormatForm:
+		body, err = encodeForm(payload)
+	case models.BodyFormatXML:
+		root := request.XMLRoot
+		if root == "" {
+			root = defaultXMLRoot
+		}
+		body, err = encodeXML(payload, root)
+	case models.BodyFormatMultipart:
+		return encodeMultipart(payload)
+	default:
+		body = payload
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return body, contentTypeOf(request), nil
+}
+
+// encodeForm encodes the members of a payload as form fields. Arrays become repeated fields,
+// nested objects are sent as their JSON encoding and null as an empty value.
+func encodeForm(payload []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var object map[string]interface{}
+	if err := dec.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	for name, value := range object {
+		if values, ok := value.([]interface{}); ok {
+			for _, element := range values {
+				form.Add(name, formValue(element))
+			}
+			continue
+		}
+		form.Add(name, formValue(value))
+	}
+	return []byte(form.Encode()), nil
+}
+
+// formValue returns the form field value of a JSON value
+func formValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
+
+// filePart is a payload member sent as file of a multipart body
+type filePart struct {
+	Filename    string  `json:"filename"`
+	ContentType string  `json:"content_type"`
+	Data        *string `json:"data"` // base64 encoded content
+}
+
+// encodeMultipart encodes the members of a payload as multipart/form-data parts, keeping their
+// order. Objects with a filename and base64 data are sent as files, arrays become repeated
+// parts and the other values are sent as fields like with encodeForm. The boundary is derived
+// from the payload, so identical items are encoded identically.
+func encodeMultipart(payload []byte) ([]byte, string, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if token, err := dec.Token(); err != nil {
+		return nil, "", err
+	} else if token != json.Delim('{') {
+		return nil, "", fmt.Errorf("payload must be a JSON object")
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	sum := sha256.Sum256(payload)
+	if err := writer.SetBoundary("n8n-parallels-" + hex.EncodeToString(sum[:20])); err != nil {
+		return nil, "", err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, "", err
+		}
+		name, _ := key.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, "", err
+		}
+
+		values := []json.RawMessage{value}
+		if bytes.HasPrefix(bytes.TrimSpace(value), []byte("[")) {
+			values = nil
+			if err := json.Unmarshal(value, &values); err != nil {
+				return nil, "", err
+			}
+		}
+		for _, value := range values {
+			if err := writeMultipartPart(writer, name, value); err != nil {
+				return nil, "", fmt.Errorf("member %q: %w", name, err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// writeMultipartPart writes a single value of a member as file or field
+func writeMultipartPart(writer *multipart.Writer, name string, value json.RawMessage) error {
+	var file filePart
+	if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+		if err := json.Unmarshal(value, &file); err != nil {
+			return err
+		}
+	}
+	if file.Filename == "" || file.Data == nil {
+		dec := json.NewDecoder(bytes.NewReader(value))
+		dec.UseNumber()
+		var field interface{}
+		if err := dec.Decode(&field); err != nil {
+			return err
+		}
+		return writer.WriteField(name, formValue(field))
+	}
+
+	data, err := base64.StdEncoding.DecodeString(*file.Data)
+	if err != nil {
+		return fmt.Errorf("data of file %q isn't valid base64: %w", file.Filename, err)
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(name), quoteEscaper.Replace(file.Filename)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(data)
+	return err
+}
+
+// encodeXML converts a payload to an XML document below root, keeping the order of the
+// members. Members become elements, array elements repeat the element of their member.
+func encodeXML(payload []byte, root string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := writeXMLElement(&buf, dec, root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXMLElement writes the next JSON value of dec as elements named name
+func writeXMLElement(buf *bytes.Buffer, dec *json.Decoder, name string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			for dec.More() {
+				if err := writeXMLElement(buf, dec, name); err != nil {
+					return err
+				}
+			}
+			_, err := dec.Token()
+			return err
+		}
+
+		buf.WriteString("<" + name + ">")
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			member, _ := key.(string)
+			if !validXMLName(member) {
+				return fmt.Errorf("member %q isn't a valid XML element name", member)
+			}
+			if err := writeXMLElement(buf, dec, member); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+	case nil:
+		buf.WriteString("<" + name + "/>")
+	default:
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(fmt.Sprint(token)))
+		buf.WriteString("</" + name + ">")
+	}
+	return nil
+}
+
+// validXMLName reports whether name can be used as an element name. Names with a colon would
+// refer to undeclared namespaces and names starting with "xml" are reserved.
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
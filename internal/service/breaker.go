@@ -0,0 +1,121 @@
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// circuitBreakers track consecutive failures per target host. Once a host reached the threshold,
+// its circuit opens and calls to it fail fast until the reset interval passed; then a limited
+// number of probe calls is let through, closing the circuit again on success.
+type circuitBreakers struct {
+	threshold int
+	reset     time.Duration
+	probes    int
+	clock     Clock
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*circuit // only hosts with recent failures are tracked
+}
+
+// circuit is the state of a single host
+type circuit struct {
+	failures int // consecutive failures while closed
+	open     bool
+	openedAt time.Time
+	probing  int // probe calls in flight while half-open
+}
+
+// newCircuitBreakers creates the circuit breakers, nil if threshold is 0
+func newCircuitBreakers(threshold int, reset time.Duration, probes int, clock Clock, logger *slog.Logger) *circuitBreakers {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreakers{
+		threshold: threshold,
+		reset:     reset,
+		probes:    probes,
+		clock:     clock,
+		logger:    logger,
+		hosts:     make(map[string]*circuit),
+	}
+}
+
+// allow reports whether a call to host may be made and whether it is a probe of a half-open circuit
+func (cb *circuitBreakers) allow(host string) (allowed, probe bool) {
+	if cb == nil {
+		return true, false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[host]
+	if !ok || !c.open {
+		return true, false
+	}
+	if cb.clock.Now().Sub(c.openedAt) < cb.reset || c.probing >= cb.probes {
+		return false, false
+	}
+	c.probing++
+	return true, true
+}
+
+// record reports the outcome of a call allowed by allow
+func (cb *circuitBreakers) record(host string, probe, failed bool) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.hosts[host]
+	if !failed {
+		// Calls started before the circuit opened don't close it, only probes do
+		if ok && (!c.open || probe) {
+			delete(cb.hosts, host)
+			if c.open {
+				cb.logger.Info("Circuit closed", "host", host)
+			}
+		}
+		return
+	}
+
+	if !ok {
+		c = &circuit{}
+		cb.hosts[host] = c
+	}
+	if c.open {
+		if probe {
+			c.probing--
+			c.openedAt = cb.clock.Now()
+			cb.logger.Warn("Circuit probe failed, circuit stays open", "host", host)
+		}
+		return
+	}
+
+	c.failures++
+	if c.failures >= cb.threshold {
+		c.open = true
+		c.openedAt = cb.clock.Now()
+		cb.logger.Warn("Circuit opened",
+			"host", host,
+			"consecutive_failures", c.failures,
+			"reset_seconds", cb.reset.Seconds())
+	}
+}
+
+// release reports a call allowed by allow which tells nothing about the host, e.g. one canceled
+// by its caller before a response was received. A probe frees its slot, the circuit stays as is.
+func (cb *circuitBreakers) release(host string, probe bool) {
+	if cb == nil || !probe {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c, ok := cb.hosts[host]; ok && c.open {
+		c.probing--
+	}
+}
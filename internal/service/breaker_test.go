@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestCanceledProbeLeavesTheCircuitOpen(t *testing.T) {
+	var hang atomic.Bool
+	arrived, unblock := make(chan struct{}, 1), make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			arrived <- struct{}{}
+			<-unblock
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+	defer close(unblock)
+	host := mustHost(t, target.URL)
+
+	clock := newFakeClock()
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.CircuitBreakerThreshold = 1
+		cfg.CircuitBreakerResetInterval = 30
+		cfg.CircuitBreakerHalfOpenProbes = 1
+	})
+	ws.SetClock(clock, SystemRandomness)
+	execute := func(ctx context.Context) {
+		ws.ExecuteParallel(ctx, &models.ParallelExecuteRequest{
+			WebhookURL: target.URL,
+			Payloads:   models.NewPayloads(json.RawMessage(`{}`)),
+			Timeout:    10,
+		})
+	}
+
+	execute(context.Background())
+	if allowed, _ := ws.breakers.allow(host); allowed {
+		t.Fatal("circuit didn't open on a server error")
+	}
+
+	// The probe is canceled by its caller before the target answered
+	clock.Advance(30 * time.Second)
+	hang.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	execute(ctx)
+
+	allowed, probe := ws.breakers.allow(host)
+	if !allowed || !probe {
+		t.Fatalf("allow() = %v, %v after a canceled probe, want another probe of the open circuit", allowed, probe)
+	}
+	ws.breakers.record(host, probe, false)
+	if allowed, probe := ws.breakers.allow(host); !allowed || probe {
+		t.Fatalf("allow() = %v, %v after a successful probe, want the circuit closed", allowed, probe)
+	}
+}
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	clock := newFakeClock()
+	cb := newCircuitBreakers(2, time.Minute, 1, clock, testLogger)
+
+	// Neutral calls neither count as failures nor reset them
+	cb.record("a", false, true)
+	cb.release("a", false)
+	cb.record("a", false, true)
+	if allowed, _ := cb.allow("a"); allowed {
+		t.Fatal("circuit didn't open after two failures")
+	}
+
+	clock.Advance(time.Minute)
+	if _, probe := cb.allow("a"); !probe {
+		t.Fatal("no probe once the reset interval passed")
+	}
+	if allowed, _ := cb.allow("a"); allowed {
+		t.Fatal("more probes than allowed")
+	}
+	cb.release("a", true)
+	if _, probe := cb.allow("a"); !probe {
+		t.Fatal("released probe slot wasn't freed")
+	}
+}
+
+// mustHost returns the host of a URL
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// HeaderResultSignature carries the detached JWS of a body with execution results, see
+// RESULT_SIGNING_KEY_FILE
+const HeaderResultSignature = "X-Result-Signature"
+
+// Headers of callback requests. Receivers deduplicate by the delivery ID, it stays the same
+// across retries and redeliveries after a restart. The signature is the HMAC-SHA256 of
+// "<timestamp>.<delivery id>.<body>", so the delivery ID can't be swapped to replay a body.
+const (
+	headerDeliveryID         = "X-Delivery-ID"
+	headerDeliveryAttempt    = "X-Delivery-Attempt"
+	headerSignature          = "X-Signature"           // "sha256=" followed by the hex encoded HMAC
+	headerSignatureTimestamp = "X-Signature-Timestamp" // unix seconds of the attempt, signed together with the body
+)
+
+// Delivery of completion callbacks
+const (
+	callbackTimeout         = 30 * time.Second
+	callbackBackoffInitial  = time.Second
+	minCallbackSecretLength = 32 // like CALLBACK_SIGNING_SECRET
+)
+
+// sealedCallbackPrefix marks credentials of pending deliveries encrypted with
+// STORAGE_ENCRYPTION_KEY, the rest of the value is the base64 encoded ciphertext
+const sealedCallbackPrefix = "sealed:"
+
+// CallbackDelivery is a callback which wasn't delivered yet
+type CallbackDelivery struct {
+	ID              string
+	ExecutionID     string
+	URL             string
+	AuthHeader      string
+	Secret          string // HMAC secret, empty if the body isn't signed
+	Body            []byte
+	ResultSignature string // detached JWS of the body, see RESULT_SIGNING_KEY_FILE
+	Attempts        int    // requests sent so far
+	LastError       string
+	CreatedAt       time.Time
+}
+
+// CallbackOutbox is implemented by execution stores that keep callbacks until they are
+// delivered, so callbacks pending when the server stopped are delivered after a restart
+type CallbackOutbox interface {
+	// SaveCallback creates or updates a pending delivery
+	SaveCallback(ctx context.Context, delivery *CallbackDelivery) error
+	// DeleteCallback removes a delivery once it succeeded or was given up
+	DeleteCallback(ctx context.Context, id string) error
+	// PendingCallbacks returns the pending deliveries, oldest first
+	PendingCallbacks(ctx context.Context) ([]CallbackDelivery, error)
+}
+
+// notifyCallback sends the callback of a finished asynchronous execution, whether it ran or
+// couldn't be started, if it has a callback URL and callback_on asks for it
+func (ws *WebhookService) notifyCallback(ctx context.Context, exec *execution, response *models.ParallelExecuteResponse, err error) {
+	request := exec.request
+	if request.CallbackURL == "" {
+		return
+	}
+	body := filterCallback(request.CallbackOn, callbackResponse(exec.id, response, err))
+	if body == nil {
+		exec.logger.Debug("Skipped execution callback without failures", "callback_on", request.CallbackOn)
+		return
+	}
+	ws.sendCallback(ctx, exec, body)
+}
+
+// sendCallback posts the response of a finished asynchronous execution to its callback URL.
+// With a store keeping callbacks, the delivery is recorded before the first attempt.
+func (ws *WebhookService) sendCallback(ctx context.Context, exec *execution, response *models.ParallelExecuteResponse) {
+	request := exec.request
+	body, err := json.Marshal(response)
+	if err != nil {
+		exec.logger.Error("Failed to marshal callback body", "error", err)
+		return
+	}
+	var signature string
+	if ws.signer != nil {
+		if signature, err = ws.signer.Sign(body); err != nil {
+			exec.logger.Error("Failed to sign callback body", "error", err)
+			return
+		}
+	}
+
+	delivery := &CallbackDelivery{
+		ID:              newID(),
+		ExecutionID:     response.ExecutionID,
+		URL:             request.CallbackURL,
+		AuthHeader:      request.CallbackAuthHeader,
+		Secret:          request.CallbackSecret,
+		Body:            body,
+		ResultSignature: signature,
+		CreatedAt:       ws.clock.Now(),
+	}
+	if delivery.Secret == "" {
+		delivery.Secret = ws.config.CallbackSigningSecret
+	}
+	if err := ws.recordCallback(ctx, delivery); err != nil {
+		exec.logger.Warn("Failed to record callback delivery, it won't be resumed after a restart", "error", err)
+	}
+	ws.deliverCallback(ctx, delivery, exec.logger)
+}
+
+// errCallbackNotRecorded is returned for deliveries whose credentials can't be kept encrypted
+var errCallbackNotRecorded = errors.New("the callback carries credentials and STORAGE_ENCRYPTION_KEY isn't set")
+
+// recordCallback saves a delivery to the outbox of the store, if it has one. Credentials are
+// encrypted with STORAGE_ENCRYPTION_KEY and never kept in plaintext: without a key, deliveries
+// with their own callback_auth_header or callback_secret aren't recorded. CALLBACK_SIGNING_SECRET
+// isn't stored, it is applied again when the delivery is resumed.
+func (ws *WebhookService) recordCallback(ctx context.Context, delivery *CallbackDelivery) error {
+	outbox, ok := ws.store.(CallbackOutbox)
+	if !ok {
+		return nil
+	}
+	stored := *delivery
+	if stored.Secret == ws.config.CallbackSigningSecret {
+		stored.Secret = ""
+	}
+	if stored.AuthHeader != "" || stored.Secret != "" {
+		if ws.secrets == nil {
+			return errCallbackNotRecorded
+		}
+		stored.AuthHeader = ws.sealCallbackCredential(stored.AuthHeader)
+		stored.Secret = ws.sealCallbackCredential(stored.Secret)
+	}
+	return outbox.SaveCallback(ctx, &stored)
+}
+
+// sealCallbackCredential encrypts a credential of a delivery, empty ones stay empty
+func (ws *WebhookService) sealCallbackCredential(value string) string {
+	if value == "" {
+		return ""
+	}
+	return sealedCallbackPrefix + base64.StdEncoding.EncodeToString(ws.secrets.seal([]byte(value)))
+}
+
+// openCallbackCredential decrypts a credential sealed by sealCallbackCredential. Values without
+// the prefix were recorded in plaintext by an earlier version and are used as they are.
+func (ws *WebhookService) openCallbackCredential(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedCallbackPrefix)
+	if !ok {
+		return value, nil
+	}
+	if ws.secrets == nil {
+		return "", errors.New("the callback credentials are encrypted and STORAGE_ENCRYPTION_KEY isn't set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed callback credential: %w", err)
+	}
+	opened, err := ws.secrets.open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(opened), nil
+}
+
+// restoreCallback reverses recordCallback for a delivery loaded from the outbox
+func (ws *WebhookService) restoreCallback(delivery *CallbackDelivery) error {
+	var err error
+	if delivery.AuthHeader, err = ws.openCallbackCredential(delivery.AuthHeader); err != nil {
+		return err
+	}
+	if delivery.Secret, err = ws.openCallbackCredential(delivery.Secret); err != nil {
+		return err
+	}
+	if delivery.Secret == "" {
+		delivery.Secret = ws.config.CallbackSigningSecret
+	}
+	return nil
+}
+
+// ResumeCallbacks delivers the callbacks the store kept pending, e.g. because the server stopped
+// while they were retried. The retries continue where they stopped.
+func (ws *WebhookService) ResumeCallbacks(ctx context.Context) {
+	outbox, ok := ws.store.(CallbackOutbox)
+	if !ok {
+		return
+	}
+	deliveries, err := outbox.PendingCallbacks(ctx)
+	if err != nil {
+		ws.logger.Error("Failed to load pending callbacks", "error", err)
+		return
+	}
+	if len(deliveries) > 0 {
+		ws.logger.Info("Resuming pending callbacks", "callbacks", len(deliveries))
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		logger := ws.logger.With("execution_id", delivery.ExecutionID)
+		if err := ws.restoreCallback(delivery); err != nil {
+			logger.Error("Failed to resume callback delivery", "delivery_id", delivery.ID, "error", err)
+			if err := outbox.DeleteCallback(ctx, delivery.ID); err != nil {
+				logger.Warn("Failed to remove callback delivery", "delivery_id", delivery.ID, "error", err)
+			}
+			continue
+		}
+		go ws.deliverCallback(ctx, delivery, logger)
+	}
+}
+
+// deliverCallback sends a callback, retrying transient failures with exponential backoff.
+// The delivery stays pending in the store if ctx ends before it succeeded or was given up.
+func (ws *WebhookService) deliverCallback(ctx context.Context, delivery *CallbackDelivery, logger *slog.Logger) {
+	outbox, _ := ws.store.(CallbackOutbox)
+	finish := func() {
+		if outbox != nil {
+			if err := outbox.DeleteCallback(context.WithoutCancel(ctx), delivery.ID); err != nil {
+				logger.Warn("Failed to remove callback delivery", "delivery_id", delivery.ID, "error", err)
+			}
+		}
+	}
+
+	policy := retryPolicy{maxRetries: ws.config.CallbackMaxRetries, initial: callbackBackoffInitial, multiplier: defaultBackoffMultiplier, random: ws.random}
+	for {
+		delivery.Attempts++
+		retryable, err := ws.postCallback(ctx, delivery)
+		if err == nil {
+			logger.Info("Delivered execution callback", "delivery_id", delivery.ID, "attempts", delivery.Attempts)
+			finish()
+			return
+		}
+		if !retryable || delivery.Attempts > policy.maxRetries {
+			logger.Error("Failed to deliver execution callback",
+				"callback_url", delivery.URL,
+				"delivery_id", delivery.ID,
+				"attempts", delivery.Attempts,
+				"error", err)
+			finish()
+			return
+		}
+
+		delivery.LastError = err.Error()
+		if err := ws.recordCallback(ctx, delivery); err != nil && !errors.Is(err, errCallbackNotRecorded) {
+			logger.Warn("Failed to record callback attempt", "delivery_id", delivery.ID, "error", err)
+		}
+		delay := policy.backoff(delivery.Attempts)
+		logger.Warn("Retrying execution callback",
+			"delivery_id", delivery.ID,
+			"attempt", delivery.Attempts,
+			"delay_ms", delay.Milliseconds(),
+			"error", err)
+		if err := ws.sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+}
+
+// postCallback sends a single callback request, it reports whether a failure is worth retrying.
+// A signature of the body is sent in the X-Result-Signature header, the HMAC in X-Signature.
+func (ws *WebhookService) postCallback(ctx context.Context, delivery *CallbackDelivery) (bool, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+	defer cancel()
+
+	req, err := ws.newOutboundRequest(reqCtx, "POST", delivery.URL, delivery.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to create callback request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerExecutionID, delivery.ExecutionID)
+	req.Header.Set(headerDeliveryID, delivery.ID)
+	req.Header.Set(headerDeliveryAttempt, strconv.Itoa(delivery.Attempts))
+	if delivery.AuthHeader != "" {
+		req.Header.Set("Authorization", delivery.AuthHeader)
+	}
+	if delivery.ResultSignature != "" {
+		req.Header.Set(HeaderResultSignature, delivery.ResultSignature)
+	}
+	if delivery.Secret != "" {
+		timestamp := strconv.FormatInt(ws.clock.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(delivery.Secret))
+		mac.Write([]byte(timestamp + "." + delivery.ID + "."))
+		mac.Write(delivery.Body)
+		req.Header.Set(headerSignatureTimestamp, timestamp)
+		req.Header.Set(headerSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	if err := sanitizeOutboundRequest(req); err != nil {
+		return false, err
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("callback request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return retryableStatus(resp.StatusCode), fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return true, nil
+}
+
+// callbackResponse is the body of the callback of a finished execution
+func callbackResponse(executionID string, response *models.ParallelExecuteResponse, err error) *models.ParallelExecuteResponse {
+	if err != nil {
+		return &models.ParallelExecuteResponse{
+			ExecutionID: executionID,
+			Status:      StateFailed,
+			Results:     []models.WebhookResult{},
+			Error:       err.Error(),
+		}
+	}
+	completed := *response
+	completed.Status = StateCompleted
+	if response.Summary.Canceled {
+		completed.Status = StateCanceled
+	} else if response.Summary.BudgetExceeded {
+		completed.Status = StateBudgetExceeded
+	}
+	return &completed
+}
+
+// filterCallback reduces the callback body to what callback_on asks for, nil if no callback is
+// to be sent. Only executions which failed or have failed items are reported with errors_only.
+func filterCallback(on string, response *models.ParallelExecuteResponse) *models.ParallelExecuteResponse {
+	switch on {
+	case models.CallbackOnErrorsOnly:
+		if response.Status == StateCompleted && response.Summary.FailedRequests == 0 {
+			return nil
+		}
+		failed := make([]models.WebhookResult, 0, response.Summary.FailedRequests)
+		for _, result := range response.Results {
+			if !result.Success && !result.Skipped {
+				failed = append(failed, result)
+			}
+		}
+		response.Results = failed
+	case models.CallbackOnSummaryOnly:
+		response.Results = []models.WebhookResult{}
+	}
+	return response
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+const (
+	testCallbackSecret = "callback-secret-0123456789abcdef"
+	testStorageKey     = "storage-key-0123456789abcdef0123"
+)
+
+func TestCallbackSignatureCoversDeliveryID(t *testing.T) {
+	type received struct{ id, timestamp, signature, body string }
+	got := make(chan received, 1)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get(headerDeliveryID), r.Header.Get(headerSignatureTimestamp), r.Header.Get(headerSignature), string(data)}
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, nil)
+	clock := newFakeClock()
+	ws.SetClock(clock, SystemRandomness)
+	ws.deliverCallback(context.Background(), &CallbackDelivery{
+		ID:     "delivery-1",
+		URL:    target.URL,
+		Secret: testCallbackSecret,
+		Body:   []byte(`{"status":"completed"}`),
+	}, testLogger)
+
+	r := <-got
+	if r.id != "delivery-1" || r.timestamp != strconv.FormatInt(clock.Now().Unix(), 10) {
+		t.Fatalf("delivery id %q, timestamp %q", r.id, r.timestamp)
+	}
+	mac := hmac.New(sha256.New, []byte(testCallbackSecret))
+	mac.Write([]byte(r.timestamp + "." + r.id + "." + r.body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.signature != want {
+		t.Fatalf("signature %q, want %q", r.signature, want)
+	}
+}
+
+func TestCallbackSecretLength(t *testing.T) {
+	ws := newTestService(t, nil)
+	err := ws.validateRequest(&models.ParallelExecuteRequest{
+		WebhookURL:     "https://example.com/hook",
+		Payloads:       models.NewPayloads([]byte(`{}`)),
+		CallbackURL:    "https://example.com/callback",
+		CallbackSecret: strings.Repeat("s", 16),
+	})
+	if err == nil || !strings.Contains(err.Error(), "callback_secret must be at least 32 bytes") {
+		t.Fatalf("validateRequest() = %v, want a 16 byte callback_secret rejected", err)
+	}
+}
+
+// newTestOutboxService creates a service recording callbacks in a SQLite store
+func newTestOutboxService(t *testing.T, storageKey string) (*WebhookService, CallbackOutbox) {
+	t.Helper()
+	store, err := NewSQLiteExecutionStore(filepath.Join(t.TempDir(), "executions.db"), 0, 0, time.Hour, "", 0, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.(*sqliteExecutionStore).db.Close() })
+	cfg := config.Load().Execution
+	cfg.CallbackSigningSecret = "default-secret-0123456789abcdef0"
+	cfg.StorageEncryptionKey = storageKey
+	return NewWebhookService(cfg, NewLocalGroupSemaphore(0, nil), store, nil, testLogger), store.(CallbackOutbox)
+}
+
+func TestRecordCallbackKeepsCredentialsEncrypted(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without key", func(t *testing.T) {
+		ws, outbox := newTestOutboxService(t, "")
+		if err := ws.recordCallback(ctx, &CallbackDelivery{ID: "own", URL: "https://example.com", Body: []byte(`{}`), AuthHeader: "Bearer token", CreatedAt: time.Now()}); err != errCallbackNotRecorded {
+			t.Fatalf("recordCallback() with credentials = %v, want errCallbackNotRecorded", err)
+		}
+		if err := ws.recordCallback(ctx, &CallbackDelivery{ID: "default", URL: "https://example.com", Body: []byte(`{}`), Secret: ws.config.CallbackSigningSecret, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("recordCallback() with the default secret = %v", err)
+		}
+
+		pending, err := outbox.PendingCallbacks(ctx)
+		if err != nil || len(pending) != 1 || pending[0].ID != "default" || pending[0].Secret != "" {
+			t.Fatalf("PendingCallbacks() = %+v, %v, want the delivery with the default secret, without it", pending, err)
+		}
+		if err := ws.restoreCallback(&pending[0]); err != nil || pending[0].Secret != ws.config.CallbackSigningSecret {
+			t.Fatalf("restoreCallback() = %v, secret %q, want the default secret", err, pending[0].Secret)
+		}
+	})
+
+	t.Run("with key", func(t *testing.T) {
+		ws, outbox := newTestOutboxService(t, testStorageKey)
+		delivery := &CallbackDelivery{ID: "own", URL: "https://example.com", Body: []byte(`{}`), AuthHeader: "Bearer token", Secret: testCallbackSecret, CreatedAt: time.Now()}
+		if err := ws.recordCallback(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		pending, err := outbox.PendingCallbacks(ctx)
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("PendingCallbacks() = %+v, %v", pending, err)
+		}
+		stored := pending[0]
+		if !strings.HasPrefix(stored.AuthHeader, sealedCallbackPrefix) || !strings.HasPrefix(stored.Secret, sealedCallbackPrefix) ||
+			strings.Contains(stored.AuthHeader, "token") || strings.Contains(stored.Secret, testCallbackSecret) {
+			t.Fatalf("stored credentials %q and %q, want them sealed", stored.AuthHeader, stored.Secret)
+		}
+		if err := ws.restoreCallback(&stored); err != nil || stored.AuthHeader != delivery.AuthHeader || stored.Secret != delivery.Secret {
+			t.Fatalf("restoreCallback() = %v, %+v, want the original credentials", err, stored)
+		}
+	})
+}
+
+func TestCallbackOnAppliesToEveryOutcome(t *testing.T) {
+	bodies := make(chan string, 4)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies <- string(data)
+	}))
+	defer target.Close()
+	ws := newTestService(t, nil)
+	exec := func(callbackOn string) *execution {
+		return newExecution("exec-1", &models.ParallelExecuteRequest{
+			WebhookURL:  "https://example.com/hook",
+			Payloads:    models.NewPayloads([]byte(`{}`)),
+			CallbackURL: target.URL,
+			CallbackOn:  callbackOn,
+		}, ws.clock, testLogger)
+	}
+	succeeded := &models.ParallelExecuteResponse{
+		ExecutionID: "exec-1",
+		Results:     []models.WebhookResult{{Index: 0, Success: true}},
+		Summary:     models.ExecutionSummary{TotalRequests: 1, SuccessfulRequests: 1},
+	}
+
+	ws.notifyCallback(context.Background(), exec(models.CallbackOnErrorsOnly), succeeded, nil)
+	select {
+	case body := <-bodies:
+		t.Fatalf("errors_only callback sent for a successful execution: %s", body)
+	default:
+	}
+
+	ws.notifyCallback(context.Background(), exec(models.CallbackOnSummaryOnly), succeeded, nil)
+	if body := <-bodies; !strings.Contains(body, `"status":"completed"`) || !strings.Contains(body, `"results":[]`) {
+		t.Fatalf("summary_only callback %s", body)
+	}
+
+	// Queued executions which can't be started are reported through the same filter
+	ws.runQueued(context.Background(), "exec-2", []byte(`{"webhook_url":"https://example.com/hook","payloads":[{}],"concurrency_key_limit":2,"callback_url":"`+target.URL+`","callback_on":"errors_only"}`))
+	if body := <-bodies; !strings.Contains(body, `"execution_id":"exec-2"`) || !strings.Contains(body, `"status":"failed"`) {
+		t.Fatalf("callback of a queued execution which couldn't start %s", body)
+	}
+}
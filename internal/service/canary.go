@@ -0,0 +1,28 @@
+package service
+
+import "sort"
+
+// allIndices returns the payload indices 0..n-1
+func allIndices(n int) []int {
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+// sampleIndices splits the payload indices 0..n-1 into a sample of the given size and the rest.
+// The sample is either the first items or, if random is set, a random selection drawn from rng.
+func sampleIndices(n, size int, random bool, rng Randomness) (sample, rest []int) {
+	indices := allIndices(n)
+	if random {
+		rng.Shuffle(n, func(i, j int) {
+			indices[i], indices[j] = indices[j], indices[i]
+		})
+	}
+
+	sample, rest = indices[:size], indices[size:]
+	sort.Ints(sample)
+	sort.Ints(rest)
+	return sample, rest
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestContinueJobRejectedKeepsAwaitingConfirmation(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.ConcurrencyGroupLimit = 1
+	})
+	ws.SetClock(newFakeClock(), SystemRandomness)
+	response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+		WebhookURL:       target.URL,
+		Payloads:         models.NewPayloads(json.RawMessage(`{}`), json.RawMessage(`{}`), json.RawMessage(`{}`)),
+		Timeout:          30,
+		ConcurrencyGroup: "shop",
+		Canary:           &models.Canary{Count: 1},
+	})
+	if err != nil || response.Status != StateAwaitingConfirmation {
+		t.Fatalf("ExecuteParallel() = %+v, %v, want a canary awaiting confirmation", response, err)
+	}
+	exec, _ := ws.executions.get(response.ExecutionID)
+
+	// Another execution holds the only slot of the group, the continuation isn't admitted
+	_, release, err := ws.groups.Acquire(context.Background(), "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ws.ContinueJob(ctx, response.ExecutionID); !errors.Is(err, ErrConcurrencyGroupBusy) {
+		t.Fatalf("ContinueJob() = %v, want ErrConcurrencyGroupBusy", err)
+	}
+	if status := exec.status(); status.State != StateAwaitingConfirmation || status.PendingRequests != 2 {
+		t.Fatalf("status after rejected continuation %+v, want 2 requests awaiting confirmation", status)
+	}
+	release()
+
+	continued, err := ws.ContinueJob(context.Background(), response.ExecutionID)
+	if err != nil || continued.Summary.SuccessfulRequests != 2 {
+		t.Fatalf("ContinueJob() = %+v, %v, want the 2 remaining requests sent", continued, err)
+	}
+	if _, err := ws.ContinueJob(context.Background(), response.ExecutionID); err == nil {
+		t.Fatal("continuing twice succeeded")
+	}
+}
+
+func TestCanaryExpiringWhileClaimed(t *testing.T) {
+	exec := &execution{events: newEventLog(3, SystemClock), pending: []int{1, 2}}
+	if _, ok := exec.claim(); !ok {
+		t.Fatal("claim() failed")
+	}
+	if _, ok := exec.claim(); ok {
+		t.Fatal("claimed twice")
+	}
+	if exec.expire() {
+		t.Fatal("expire() dropped claimed indices")
+	}
+	if rejected, expired := exec.rejectClaim(); !rejected || !expired {
+		t.Fatalf("rejectClaim() = %v, %v, want the rejected continuation to discard the expired canary", rejected, expired)
+	}
+	if _, ok := exec.claim(); ok {
+		t.Fatal("claimed an expired canary")
+	}
+}
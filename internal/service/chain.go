@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// startFollowUp starts the follow-up of a finished execution: on_success if it completed without
+// failed items, on_failure if it failed or has failed items. Canceled executions start neither.
+// Follow-ups run asynchronously like executions submitted with mode=async, the id of the started
+// one is returned, empty if none was started.
+func (ws *WebhookService) startFollowUp(ctx context.Context, exec *execution, response *models.ParallelExecuteResponse, err error) string {
+	request := exec.request
+	if request.OnSuccess == nil && request.OnFailure == nil {
+		return ""
+	}
+
+	on, followUp, skipped := "on_failure", request.OnFailure, request.OnSuccess
+	if err == nil && response.Summary.FailedRequests == 0 && !response.Summary.Aborted {
+		on, followUp, skipped = "on_success", request.OnSuccess, request.OnFailure
+	}
+	if skipped != nil {
+		skipped.ClosePayloads()
+	}
+	if err == nil && response.Summary.Canceled {
+		if followUp != nil {
+			followUp.ClosePayloads()
+		}
+		return ""
+	}
+	if followUp == nil {
+		return ""
+	}
+
+	id, startErr := ws.ExecuteAsync(ctx, followUp)
+	if startErr != nil {
+		exec.logger.Error("Failed to start follow-up execution", "on", on, "error", startErr)
+		return ""
+	}
+	exec.logger.Info("Started follow-up execution", "on", on, "follow_up_execution_id", id)
+	return id
+}
+
+// validateFollowUps checks the follow-ups of a request up front, so a broken chain is rejected
+// before anything runs
+func (ws *WebhookService) validateFollowUps(request *models.ParallelExecuteRequest) error {
+	for on, followUp := range map[string]*models.ParallelExecuteRequest{"on_success": request.OnSuccess, "on_failure": request.OnFailure} {
+		if followUp == nil {
+			continue
+		}
+		if request.Canary != nil {
+			return fmt.Errorf("%w: %s can't be combined with canary", ErrInvalidRequest, on)
+		}
+		if followUp.Canary != nil {
+			return fmt.Errorf("%w: %s: canary executions can't run asynchronously", ErrInvalidRequest, on)
+		}
+		if followUp.Payloads.Len() == 0 {
+			return fmt.Errorf("%w: %s: payloads array cannot be empty", ErrInvalidRequest, on)
+		}
+		if invalid := followUp.Payloads.Invalid(); len(invalid) > 0 && followUp.OnInvalidPayload != "skip_invalid" {
+			return fmt.Errorf("%w: %s: %s", ErrInvalidRequest, on, invalid[0].Error())
+		}
+		if err := ws.validateRequest(followUp); err != nil {
+			return fmt.Errorf("%s: %w", on, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestRejectedChainReleasesFollowUpPayloads(t *testing.T) {
+	ws := newTestService(t, nil)
+	dir := t.TempDir()
+	spooled := func() models.Payloads {
+		payloads, err := models.DecodePayloads(json.NewDecoder(strings.NewReader(`[{"a":1},{"a":2}]`)), 1, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payloads
+	}
+
+	// The empty on_failure breaks the chain, the spooled payloads of on_success are released
+	request := &models.ParallelExecuteRequest{
+		WebhookURL: "https://example.com/hook",
+		Payloads:   spooled(),
+		Timeout:    10,
+		OnSuccess:  &models.ParallelExecuteRequest{WebhookURL: "https://example.com/next", Payloads: spooled(), Timeout: 10},
+		OnFailure:  &models.ParallelExecuteRequest{WebhookURL: "https://example.com/undo", Timeout: 10},
+	}
+	if _, err := ws.ExecuteAsync(context.Background(), request); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("ExecuteAsync() = %v, want ErrInvalidRequest", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("spool files left behind: %d", len(entries))
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// clientCertCheckInterval is how often the files of the client certificate are checked for changes
+const clientCertCheckInterval = 30 * time.Second
+
+// clientCertificate is presented to the webhook targets of CLIENT_CERT_HOSTS requiring mutual
+// TLS. The files are read again once they changed, so a rotated certificate is used without a
+// restart.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+	hosts    []*regexp.Regexp
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newClientCertificate returns nil if no client certificate is configured
+func newClientCertificate(certFile, keyFile string, hosts []*regexp.Regexp) *clientCertificate {
+	if certFile == "" || keyFile == "" {
+		return nil
+	}
+	return &clientCertificate{certFile: certFile, keyFile: keyFile, hosts: hosts}
+}
+
+type targetHostKey struct{}
+
+// withTargetHost returns a context carrying the host a request is sent to. Connections are
+// dialed with the context of a request, their TLS handshake sees the host.
+func withTargetHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, targetHostKey{}, host)
+}
+
+// presentedTo reports whether the certificate may be presented in a handshake with ctx
+func (c *clientCertificate) presentedTo(ctx context.Context) bool {
+	host, _ := ctx.Value(targetHostKey{}).(string)
+	for _, re := range c.hosts {
+		if host != "" && re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// get is the GetClientCertificate hook of the TLS config. Other hosts get an empty certificate,
+// which sends none. A certificate which can't be read again keeps the previous one in use.
+func (c *clientCertificate) get(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if !c.presentedTo(info.Context()) {
+		return &tls.Certificate{}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.cert != nil && now.Sub(c.checked) < clientCertCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = now
+
+	modTime, err := c.filesModTime()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(c.certFile, c.keyFile); err == nil {
+			c.cert, c.modTime = &cert, modTime
+			return c.cert, nil
+		}
+	}
+	if c.cert != nil {
+		return c.cert, nil
+	}
+	return nil, fmt.Errorf("load client certificate: %w", err)
+}
+
+// filesModTime returns the latest modification time of the certificate and key files
+func (c *clientCertificate) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// writeClientCertificate writes a self-signed client certificate and its key to dir
+func writeClientCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "n8n-parallels"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestClientCertificateIsOnlyPresentedToListedHosts(t *testing.T) {
+	var presented atomic.Bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented.Store(len(r.TLS.PeerCertificates) > 0)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	certFile, keyFile := writeClientCertificate(t, t.TempDir())
+
+	for _, tt := range []struct {
+		hosts     []string
+		presented bool
+	}{
+		{[]string{"127.0.0.1"}, true},
+		{[]string{"n8n.example.com"}, false},
+	} {
+		ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+			cfg.CACert = serverCA
+			cfg.ClientCertFile, cfg.ClientKeyFile, cfg.ClientCertHosts = certFile, keyFile, tt.hosts
+		})
+		resp, err := ws.client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("hosts %v: %v", tt.hosts, err)
+		}
+		resp.Body.Close()
+		if presented.Load() != tt.presented {
+			t.Fatalf("hosts %v: certificate presented %v, want %v", tt.hosts, presented.Load(), tt.presented)
+		}
+	}
+}
+
+func TestTransportPoolKeysHoldNoKeyMaterial(t *testing.T) {
+	ws := newTestService(t, nil)
+	dir := t.TempDir()
+	certFile, keyFile := writeClientCertificate(t, dir)
+	cert, _ := os.ReadFile(certFile)
+	key, _ := os.ReadFile(keyFile)
+
+	if _, err := ws.transports.get(&models.TransportOptions{ClientCert: string(cert), ClientKey: string(key)}); err != nil {
+		t.Fatal(err)
+	}
+	for stored := range ws.transports.entries {
+		if strings.Contains(stored, "PRIVATE KEY") || len(stored) != 64 {
+			t.Fatalf("pool key %q", stored)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Clock is the source of time of retries, rate schedules, circuit breakers, the dedup window,
+// the task timeouts and the execution budget, the timestamps of execution records and events and
+// the expiry of canaries, cached tokens and stored executions. Tests replace it to control time
+// instead of waiting for it. Durations reported in results are measured with the wall clock
+// regardless.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a timer sending on its channel once d passed
+	NewTimer(d time.Duration) Timer
+	// AfterFunc calls f in its own goroutine once d passed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending timer of a Clock
+type Timer interface {
+	// C returns the channel receiving the time the timer fired, nil for AfterFunc timers
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it reports whether it was still pending
+	Stop() bool
+}
+
+// Randomness is the source of the retry jitter and of random canary samples
+type Randomness interface {
+	// Int64N returns a number in [0, n), n must be positive
+	Int64N(n int64) int64
+	// Shuffle permutes n elements using swap
+	Shuffle(n int, swap func(i, j int))
+}
+
+// SystemClock is the clock of the operating system
+var SystemClock Clock = systemClock{}
+
+// SystemRandomness is the shared generator of math/rand
+var SystemRandomness Randomness = systemRandomness{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// clockDeadlineKey is the context key of the deadline set by withClockTimeout on other clocks
+// than the system clock
+type clockDeadlineKey struct{}
+
+// withClockTimeout returns a copy of ctx canceled with cause once d passed on clock. On the
+// system clock it is a regular context with a deadline. Other clocks can't give the context a
+// deadline, network I/O would be timed by it, their deadline is only told by clockDeadline.
+func withClockTimeout(ctx context.Context, clock Clock, d time.Duration, cause error) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeoutCause(ctx, d, cause)
+	}
+
+	deadline := clock.Now().Add(d)
+	if parent, ok := clockDeadline(ctx); ok && parent.Before(deadline) {
+		deadline = parent
+	}
+	ctx, cancel := context.WithCancelCause(context.WithValue(ctx, clockDeadlineKey{}, deadline))
+	timer := clock.AfterFunc(d, func() { cancel(cause) })
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// clockDeadline returns the deadline of a context created by withClockTimeout
+func clockDeadline(ctx context.Context) (time.Time, bool) {
+	if deadline, ok := ctx.Value(clockDeadlineKey{}).(time.Time); ok {
+		return deadline, true
+	}
+	return ctx.Deadline()
+}
+
+// timedOut reports whether a context created by withClockTimeout with the cause
+// context.DeadlineExceeded, or one of its parents, ran out of time
+func timedOut(ctx context.Context) bool {
+	return ctx.Err() != nil && errors.Is(context.Cause(ctx), context.DeadlineExceeded)
+}
+
+type systemRandomness struct{}
+
+func (systemRandomness) Int64N(n int64) int64 {
+	return rand.Int64N(n)
+}
+
+func (systemRandomness) Shuffle(n int, swap func(i, j int)) {
+	rand.Shuffle(n, swap)
+}
+
+// SetClock replaces the sources of time and randomness of the service, e.g. with fakes in
+// tests. The clock also expires the executions of the in-process store and times the archive and
+// retention passes of the SQLite store. It must be called before the service executes anything.
+func (ws *WebhookService) SetClock(clock Clock, random Randomness) {
+	ws.clock = clock
+	ws.random = random
+	if ws.breakers != nil {
+		ws.breakers.clock = clock
+	}
+	if ws.dedup != nil {
+		ws.dedup.clock = clock
+	}
+	ws.tokens.clock = clock
+	if store, ok := ws.store.(*memoryExecutionStore); ok {
+		store.mu.Lock()
+		store.clock = clock
+		store.mu.Unlock()
+	}
+	if store, ok := ws.store.(*sqliteExecutionStore); ok {
+		store.clock = clock
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// compensationFuncs are available in compensation templates
+var compensationFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseCompensationTemplate parses the body template of a compensation, nil if there is none
+func parseCompensationTemplate(compensation *models.Compensation) (*template.Template, error) {
+	if compensation.Template == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("compensation").Funcs(compensationFuncs).Option("missingkey=zero").Parse(compensation.Template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid compensation template: %v", ErrInvalidRequest, err)
+	}
+	return tmpl, nil
+}
+
+// compensate calls the compensation target for every successful result of an aborted execution.
+// The calls are bounded like the tasks of the execution: at most maxConcurrency at once, each
+// holding a server-wide slot. It returns the outcome of the compensation call by payload index.
+func (ws *WebhookService) compensate(ctx context.Context, exec *execution, request *models.ParallelExecuteRequest, results []models.WebhookExecutionResult) map[int]error {
+	tmpl, _ := parseCompensationTemplate(request.Compensation) // validated by ExecuteParallel
+
+	// Roll back even if the caller went away in the meantime
+	ctx = context.WithoutCancel(ctx)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	outcomes := make(map[int]error)
+	slots := make(chan struct{}, ws.maxConcurrency(request))
+
+	for _, result := range results {
+		// Duplicates weren't processed by this execution, there is nothing to roll back
+		if !result.Success || result.DuplicateOf != nil {
+			continue
+		}
+
+		slots <- struct{}{}
+		if err := ws.slots.acquire(ctx, flowOf(exec)); err != nil {
+			<-slots
+			outcomes[result.Index] = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(result models.WebhookExecutionResult) {
+			defer wg.Done()
+			defer func() {
+				ws.slots.release()
+				<-slots
+			}()
+			err := ws.executeCompensation(ctx, request, tmpl, result)
+
+			mu.Lock()
+			outcomes[result.Index] = err
+			mu.Unlock()
+		}(result)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range outcomes {
+		if err != nil {
+			failed++
+		}
+	}
+
+	exec.logger.Info("Completed compensation of aborted execution",
+		"compensation_url", request.Compensation.URL,
+		"total_requests", len(outcomes),
+		"failed_requests", failed)
+
+	return outcomes
+}
+
+// executeCompensation sends the compensation call of a single result
+func (ws *WebhookService) executeCompensation(ctx context.Context, request *models.ParallelExecuteRequest, tmpl *template.Template, result models.WebhookExecutionResult) error {
+	var response interface{}
+	if len(result.Response) > 0 {
+		if err := json.Unmarshal(result.Response, &response); err != nil {
+			response = string(result.Response)
+		}
+	}
+
+	var payload interface{}
+	raw, err := request.Payloads.Get(result.Index)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"index":    result.Index,
+		"payload":  payload,
+		"response": response,
+	}
+
+	var body bytes.Buffer
+	if tmpl != nil {
+		if err := tmpl.Execute(&body, data); err != nil {
+			return fmt.Errorf("failed to render compensation template: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return fmt.Errorf("failed to marshal compensation body: %w", err)
+	}
+
+	reqCtx, cancel := withClockTimeout(ctx, ws.clock, time.Duration(request.Timeout)*time.Second, context.DeadlineExceeded)
+	defer cancel()
+
+	req, err := ws.newOutboundRequest(reqCtx, "POST", request.Compensation.URL, body.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to create compensation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if request.Compensation.AuthHeader != "" {
+		req.Header.Set("Authorization", request.Compensation.AuthHeader)
+	}
+
+	if err := sanitizeOutboundRequest(req); err != nil {
+		return err
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("compensation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("compensation returned status %d", resp.StatusCode)
+	}
+	return nil
+}
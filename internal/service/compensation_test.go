@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestCompensationRespectsMaxConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, nil)
+	payloads := make([]json.RawMessage, 40)
+	results := make([]models.WebhookExecutionResult, len(payloads))
+	for i := range payloads {
+		payloads[i] = json.RawMessage(`{}`)
+		results[i] = models.WebhookExecutionResult{Index: i, Success: true}
+	}
+	request := &models.ParallelExecuteRequest{
+		WebhookURL:     "https://example.com/hook",
+		Payloads:       models.NewPayloads(payloads...),
+		Timeout:        30,
+		MaxConcurrency: 3,
+		Compensation:   &models.Compensation{URL: target.URL},
+	}
+
+	outcomes := ws.compensate(context.Background(), newExecution("exec-1", request, ws.clock, testLogger), request, results)
+	if len(outcomes) != len(results) {
+		t.Fatalf("compensated %d items, want %d", len(outcomes), len(results))
+	}
+	for index, err := range outcomes {
+		if err != nil {
+			t.Fatalf("compensation of item %d failed: %v", index, err)
+		}
+	}
+	if p := peak.Load(); p > 3 {
+		t.Fatalf("%d compensation calls in flight, want at most 3", p)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// defaultConcurrencyKeyLimit is the number of tasks per concurrency key running at once if the
+// request doesn't set concurrency_key_limit
+const defaultConcurrencyKeyLimit = 1
+
+// concurrencyKeyLimit returns the number of tasks per concurrency key allowed to run at once
+func concurrencyKeyLimit(request *models.ParallelExecuteRequest) int {
+	if request.ConcurrencyKeyLimit > 0 {
+		return request.ConcurrencyKeyLimit
+	}
+	return defaultConcurrencyKeyLimit
+}
+
+// keySemaphore limits the tasks of an execution running at once per concurrency key, e.g. per
+// customer, so downstream locks held per entity aren't contended within a batch
+type keySemaphore struct {
+	limit int
+
+	mu      sync.Mutex
+	running map[string]int
+	freed   chan struct{} // closed and replaced whenever a task released its key
+}
+
+func newKeySemaphore(limit int) *keySemaphore {
+	return &keySemaphore{
+		limit:   limit,
+		running: make(map[string]int),
+		freed:   make(chan struct{}),
+	}
+}
+
+// acquireNext waits until a slot is free for the key of one of the tasks and returns the index of
+// the first such task, so tasks of saturated keys don't hold up the tasks of other keys. Tasks
+// without a key aren't limited.
+func (s *keySemaphore) acquireNext(ctx context.Context, tasks []models.WebhookExecutionTask) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	for {
+		s.mu.Lock()
+		for i, task := range tasks {
+			if task.ConcurrencyKey == "" {
+				s.mu.Unlock()
+				return i, nil
+			}
+			if s.running[task.ConcurrencyKey] < s.limit {
+				s.running[task.ConcurrencyKey]++
+				s.mu.Unlock()
+				return i, nil
+			}
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return 0, context.Cause(ctx)
+		}
+	}
+}
+
+// release frees the slot of a task taken by acquire
+func (s *keySemaphore) release(key string) {
+	if s == nil || key == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[key]--; s.running[key] <= 0 {
+		delete(s.running, key)
+	}
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+// assignConcurrencyKeys evaluates the concurrency key of every task and interleaves the tasks
+// of different keys, so a run of tasks sharing a key doesn't hold up dispatching the others.
+// Payloads without the key field get no key.
+func assignConcurrencyKeys(request *models.ParallelExecuteRequest, tasks []models.WebhookExecutionTask) []models.WebhookExecutionTask {
+	path := strings.TrimPrefix(request.ConcurrencyKey, "item.")
+
+	var order []string
+	byKey := make(map[string][]models.WebhookExecutionTask)
+	for _, task := range tasks {
+		if payload, err := request.Payloads.Get(task.Index); err == nil {
+			task.ConcurrencyKey = concurrencyKeyOf(payload, path)
+		}
+		if _, ok := byKey[task.ConcurrencyKey]; !ok {
+			order = append(order, task.ConcurrencyKey)
+		}
+		byKey[task.ConcurrencyKey] = append(byKey[task.ConcurrencyKey], task)
+	}
+
+	// Round-robin over the keys in order of their first task
+	interleaved := make([]models.WebhookExecutionTask, 0, len(tasks))
+	for len(interleaved) < len(tasks) {
+		for _, key := range order {
+			if queued := byKey[key]; len(queued) > 0 {
+				interleaved = append(interleaved, queued[0])
+				byKey[key] = queued[1:]
+			}
+		}
+	}
+	return interleaved
+}
+
+// concurrencyKeyOf resolves a dotted path like "customer.id" in a payload. Strings are used as
+// they are, other values by their JSON encoding; missing values and null give no key.
+func concurrencyKeyOf(payload []byte, path string) string {
+	var current interface{}
+	if err := json.Unmarshal(payload, &current); err != nil {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = object[key]
+	}
+
+	switch value := current.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
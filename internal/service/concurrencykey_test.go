@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestSaturatedConcurrencyKeyDoesNotHoldUpOtherKeys(t *testing.T) {
+	unblock := make(chan struct{})
+	var others atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"a"`) {
+			<-unblock
+		} else {
+			others.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+	defer func() {
+		select {
+		case <-unblock:
+		default:
+			close(unblock)
+		}
+	}()
+
+	ws := newTestService(t, nil)
+	request := &models.ParallelExecuteRequest{
+		WebhookURL: target.URL,
+		Payloads: models.NewPayloads(
+			json.RawMessage(`{"k":"a"}`), json.RawMessage(`{"k":"a"}`),
+			json.RawMessage(`{"k":"b"}`), json.RawMessage(`{"k":"b"}`),
+		),
+		Timeout:             30,
+		ConcurrencyKey:      "item.k",
+		ConcurrencyKeyLimit: 1,
+	}
+
+	done := make(chan *models.ParallelExecuteResponse)
+	go func() {
+		response, err := ws.ExecuteParallel(context.Background(), request)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+
+	// Both tasks of key b run while the first task of key a blocks the second one
+	deadline := time.After(5 * time.Second)
+	for others.Load() < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("%d tasks of key b sent while key a was saturated, want 2", others.Load())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	close(unblock)
+
+	if response := <-done; response.Summary.SuccessfulRequests != 4 {
+		t.Fatalf("summary %+v, want 4 successful requests", response.Summary)
+	}
+}
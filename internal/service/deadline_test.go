@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestDeadlineHeadersRoundRemainingTimeUp(t *testing.T) {
+	now := newFakeClock().Now()
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{900 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{2500 * time.Millisecond, "3"},
+		{0, "0"},
+		{-time.Second, "0"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		setDeadlineHeaders(header, now.Add(tt.remaining), now, true)
+		if got := header.Get("Request-Timeout"); got != tt.want {
+			t.Errorf("Request-Timeout with %v left = %s, want %s", tt.remaining, got, tt.want)
+		}
+	}
+}
+
+func TestTimeoutsFollowTheServiceClock(t *testing.T) {
+	tests := []struct {
+		name        string
+		budget      int
+		advance     time.Duration
+		wantTimeout string
+		check       func(response *models.ParallelExecuteResponse) bool
+		wantState   string
+	}{
+		{"task timeout", 0, 31 * time.Second, "30", func(response *models.ParallelExecuteResponse) bool {
+			return response.Summary.TimeoutRequests == 1 && response.Results[0].ErrorCode == models.ErrorCodeTimeout
+		}, "timed out"},
+		{"execution budget", 10, 11 * time.Second, "10", func(response *models.ParallelExecuteResponse) bool {
+			return response.Summary.BudgetExceeded
+		}, "budget exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inFlight := make(chan string, 1)
+			release := make(chan struct{})
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inFlight <- r.Header.Get("Request-Timeout")
+				<-release
+			}))
+			defer target.Close()
+			defer close(release)
+
+			ws := newTestService(t, func(cfg *config.ExecutionConfig) { cfg.MaxExecutionDuration = tt.budget })
+			clock := newFakeClock()
+			ws.SetClock(clock, SystemRandomness)
+
+			done := make(chan *models.ParallelExecuteResponse, 1)
+			go func() {
+				response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+					WebhookURL:      target.URL,
+					Payloads:        models.NewPayloads(json.RawMessage(`{}`)),
+					Timeout:         30,
+					DeadlineHeaders: true,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+				done <- response
+			}()
+
+			if timeout := <-inFlight; timeout != tt.wantTimeout {
+				t.Fatalf("Request-Timeout = %s, want %s", timeout, tt.wantTimeout)
+			}
+			clock.Advance(tt.advance)
+			select {
+			case response := <-done:
+				if response == nil || !tt.check(response) {
+					t.Fatalf("response %+v, want the request %s", response, tt.wantState)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("request not stopped after advancing the clock by %v", tt.advance)
+			}
+		})
+	}
+}
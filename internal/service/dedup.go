@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// dedupWindow remembers the items recently sent to a target, so an identical item of an
+// overlapping execution is skipped instead of being processed twice downstream.
+// Items are identical if their target URL and payload bytes are equal. An identical item of an
+// item still being sent waits for its outcome, it is sent itself if the original failed. The
+// window is kept per replica.
+type dedupWindow struct {
+	window time.Duration
+	clock  Clock
+
+	mu        sync.Mutex
+	sent      map[[sha256.Size]byte]dedupEntry
+	lastSweep time.Time
+}
+
+type dedupEntry struct {
+	ref  models.DuplicateRef
+	sent time.Time
+	done chan struct{} // closed once the item succeeded or failed
+}
+
+// newDedupWindow returns nil if the window is disabled
+func newDedupWindow(seconds int, clock Clock) *dedupWindow {
+	if seconds <= 0 {
+		return nil
+	}
+	return &dedupWindow{
+		window:    time.Duration(seconds) * time.Second,
+		clock:     clock,
+		sent:      make(map[[sha256.Size]byte]dedupEntry),
+		lastSweep: clock.Now(),
+	}
+}
+
+// dedupKeyOf identifies an item by its target and payload
+func dedupKeyOf(target string, payload []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(target))
+	h.Write([]byte{0})
+	h.Write(payload)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// claim records ref as the latest item sent with key, finish must be called with its outcome.
+// If an identical item was sent successfully within the window, its reference is returned and
+// the item must be skipped. While an identical item is still being sent, claim waits for it.
+// Items whose context ends while waiting are sent without a claim.
+func (d *dedupWindow) claim(ctx context.Context, key [sha256.Size]byte, ref models.DuplicateRef) (*models.DuplicateRef, bool) {
+	if d == nil {
+		return nil, true
+	}
+	for {
+		d.mu.Lock()
+		now := d.clock.Now()
+		if now.Sub(d.lastSweep) > d.window {
+			for k, entry := range d.sent {
+				if now.Sub(entry.sent) > d.window && isClosed(entry.done) {
+					delete(d.sent, k)
+				}
+			}
+			d.lastSweep = now
+		}
+
+		entry, ok := d.sent[key]
+		if !ok || entry.ref.ExecutionID == ref.ExecutionID || (now.Sub(entry.sent) > d.window && isClosed(entry.done)) {
+			d.sent[key] = dedupEntry{ref: ref, sent: now, done: make(chan struct{})}
+			d.mu.Unlock()
+			return nil, true
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, true
+		}
+		// Succeeded items stay claimed, failed ones are gone and the next round claims the key
+		d.mu.Lock()
+		current, ok := d.sent[key]
+		d.mu.Unlock()
+		if ok && current.ref == entry.ref {
+			original := entry.ref
+			return &original, false
+		}
+	}
+}
+
+// finish records the outcome of a claimed item. Failed items are forgotten, so identical items
+// waiting for them and later attempts to send them aren't skipped. Claims taken over by another
+// item in the meantime are kept.
+func (d *dedupWindow) finish(key [sha256.Size]byte, ref models.DuplicateRef, succeeded bool) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.sent[key]
+	if !ok || entry.ref != ref {
+		return
+	}
+	if succeeded {
+		// The window starts once the item arrived
+		entry.sent = d.clock.Now()
+		d.sent[key] = entry
+	} else {
+		delete(d.sent, key)
+	}
+	close(entry.done)
+}
+
+// isClosed reports whether a channel was closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestDedupWindowSkipsSucceededItems(t *testing.T) {
+	clock := newFakeClock()
+	d := newDedupWindow(600, clock)
+	key := dedupKeyOf("https://n8n.example.com/webhook/x", []byte(`{"a":1}`))
+	first := models.DuplicateRef{ExecutionID: "first", Index: 0}
+	second := models.DuplicateRef{ExecutionID: "second", Index: 3}
+
+	if _, ok := d.claim(context.Background(), key, first); !ok {
+		t.Fatal("first claim was refused")
+	}
+	d.finish(key, first, true)
+
+	original, ok := d.claim(context.Background(), key, second)
+	if ok || original == nil || *original != first {
+		t.Fatalf("claim() = %v, %v, want a duplicate of %v", original, ok, first)
+	}
+
+	// Once the window passed the item is sent again
+	clock.Advance(601 * time.Second)
+	if _, ok := d.claim(context.Background(), key, second); !ok {
+		t.Fatal("claim after the window was refused")
+	}
+}
+
+func TestDedupWindowWaitsForItemsInFlight(t *testing.T) {
+	tests := []struct {
+		name      string
+		succeeded bool
+		wantSkip  bool
+	}{
+		{"original succeeds", true, true},
+		{"original fails", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDedupWindow(600, newFakeClock())
+			key := dedupKeyOf("https://n8n.example.com/webhook/x", []byte(`{"a":1}`))
+			first := models.DuplicateRef{ExecutionID: "first", Index: 0}
+			if _, ok := d.claim(context.Background(), key, first); !ok {
+				t.Fatal("first claim was refused")
+			}
+
+			claimed := make(chan bool, 1)
+			go func() {
+				_, ok := d.claim(context.Background(), key, models.DuplicateRef{ExecutionID: "second"})
+				claimed <- ok
+			}()
+			select {
+			case <-claimed:
+				t.Fatal("claim didn't wait for the item in flight")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			d.finish(key, first, tt.succeeded)
+			select {
+			case ok := <-claimed:
+				if ok == tt.wantSkip {
+					t.Fatalf("claim() ok = %v, want %v", ok, !tt.wantSkip)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("claim still waiting after the original finished")
+			}
+		})
+	}
+}
+
+func TestDuplicatesAreReportedAsSkipped(t *testing.T) {
+	var calls int
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) { cfg.DedupWindow = 600 })
+	ws.SetClock(newFakeClock(), SystemRandomness)
+	execute := func() *models.ParallelExecuteResponse {
+		response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+			WebhookURL: target.URL,
+			Payloads:   models.NewPayloads(json.RawMessage(`{"a":1}`)),
+			Timeout:    30,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if summary := execute().Summary; summary.SuccessfulRequests != 1 {
+		t.Fatalf("first execution: %+v", summary)
+	}
+	response := execute()
+	summary := response.Summary
+	if summary.DuplicateRequests != 1 || summary.SuccessfulRequests != 0 || summary.FailedRequests != 0 {
+		t.Fatalf("duplicate counted as %+v, want only duplicate_requests", summary)
+	}
+	if result := response.Results[0]; !result.Skipped || result.Success || result.DuplicateOf == nil {
+		t.Fatalf("duplicate result = %+v, want skipped", result)
+	}
+	if calls != 1 {
+		t.Fatalf("target called %d times, want 1", calls)
+	}
+	if body := filterCallback(models.CallbackOnErrorsOnly, callbackResponse(response.ExecutionID, response, nil)); body != nil {
+		t.Fatalf("errors_only callback sent for a skipped duplicate: %+v", body.Results)
+	}
+}
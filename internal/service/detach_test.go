@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestDetachOnDisconnect(t *testing.T) {
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+
+	// Synchronous executions are recorded right away if all executions are recorded, detaching
+	// replaces that record. The memory store keeps records readers copy from.
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.ExecutionStore = "sqlite"
+		cfg.FastPathMaxItems = 0
+	})
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	done := make(chan *models.ParallelExecuteResponse)
+	go func() {
+		response, err := ws.ExecuteParallel(ctx, &models.ParallelExecuteRequest{
+			WebhookURL:         target.URL,
+			Payloads:           models.NewPayloads(json.RawMessage(`{}`), json.RawMessage(`{}`)),
+			Timeout:            30,
+			DetachOnDisconnect: true,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+
+	// Readers of the store run next to the detaching, the race detector checks they don't share the record
+	var id string
+	for id == "" {
+		for _, e := range ws.executions.list() {
+			id = e.id
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				ws.GetExecution(context.Background(), id)
+			}
+		}
+	}()
+
+	disconnect()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, err := ws.GetExecution(context.Background(), id)
+		if err == nil && record.Mode == "async" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution wasn't detached: %+v, %v", record, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	<-done
+	close(stop)
+	<-polled
+
+	record, err := ws.GetExecution(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != StateCompleted || record.Mode != "async" || record.CompletedRequests != 2 {
+		t.Fatalf("detached execution finished as %s (%s) with %d results", record.Status, record.Mode, record.CompletedRequests)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+// Address families outbound connections are restricted to
+const (
+	DialPreferDual = "dual"
+	DialPreferIPv4 = "ipv4"
+	DialPreferIPv6 = "ipv6"
+)
+
+// dialContextFunc dials outbound connections
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialContext creates the dial function of outbound connections from the dialer configuration.
+// With dual-stack, IPv6 and IPv4 are raced after the fallback delay (Happy Eyeballs), so
+// hosts with broken IPv6 connectivity don't stall every task until the dial timeout.
+// With a guard, connections to addresses it rejects fail before they are made.
+func newDialContext(cfg config.ExecutionConfig, res *resolver, guard *targetGuard) dialContextFunc {
+	dialer := &net.Dialer{
+		Timeout:       time.Duration(cfg.DialTimeout) * time.Second,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: time.Duration(cfg.DialFallbackDelay) * time.Millisecond,
+		Resolver:      res.resolver,
+	}
+	if guard != nil {
+		dialer.Control = guard.control
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			addr = net.JoinHostPort(res.qualify(ctx, host), port)
+		}
+		return dialer.DialContext(ctx, dialNetwork(cfg.DialPrefer, network), addr)
+	}
+}
+
+// dialNetwork restricts a tcp network to the preferred address family
+func dialNetwork(prefer, network string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch prefer {
+	case DialPreferIPv4:
+		return "tcp4"
+	case DialPreferIPv6:
+		return "tcp6"
+	default:
+		return network
+	}
+}
+
+// newTransport creates the transport of outbound requests
+func newTransport(dial dialContextFunc) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dial
+	return transport
+}
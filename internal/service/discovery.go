@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Target discovery mechanisms, used as scheme prefix of the webhook URL, e.g. "srv+https://_n8n._tcp.example.com/webhook/x"
+const (
+	DiscoverySRV        = "srv"
+	DiscoveryConsul     = "consul"
+	DiscoveryKubernetes = "k8s"
+)
+
+// discoveryTimeout bounds the lookup of the targets of an execution
+const discoveryTimeout = 10 * time.Second
+
+// targetSet is the set of instances discovered for an execution, tasks are spread across them round-robin
+type targetSet struct {
+	base      url.URL
+	endpoints []string // host:port
+	next      atomic.Uint64
+}
+
+// url returns the webhook URL of the next instance
+func (ts *targetSet) url() string {
+	n := ts.next.Add(1) - 1
+	target := ts.base
+	target.Host = ts.endpoints[n%uint64(len(ts.endpoints))]
+	return target.String()
+}
+
+// discoverTargets resolves a webhook URL using a discovery scheme to the instances of the service,
+// it returns nil for plain webhook URLs
+func (ws *WebhookService) discoverTargets(ctx context.Context, webhookURL string) (*targetSet, error) {
+	target, err := url.Parse(webhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid webhook_url: %v", ErrInvalidRequest, err)
+	}
+
+	mechanism, scheme, _ := strings.Cut(target.Scheme, "+")
+	switch mechanism {
+	case DiscoverySRV, DiscoveryConsul, DiscoveryKubernetes:
+	default:
+		return nil, nil
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("%w: invalid webhook_url scheme: %s", ErrInvalidRequest, target.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	var endpoints []string
+	switch mechanism {
+	case DiscoverySRV:
+		endpoints, err = ws.lookupSRV(ctx, target.Hostname())
+	case DiscoveryConsul:
+		endpoints, err = ws.lookupConsul(ctx, target.Hostname())
+	case DiscoveryKubernetes:
+		endpoints, err = ws.lookupKubernetes(ctx, target.Hostname(), target.Port(), scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover targets of %s: %w", webhookURL, err)
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("failed to discover targets of %s: no instances found", webhookURL)
+	}
+	if err := ws.hosts.checkEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+
+	ts := &targetSet{base: *target, endpoints: endpoints}
+	ts.base.Scheme = scheme
+	return ts, nil
+}
+
+// lookupSRV resolves the SRV records of name, only the targets with the highest priority are used
+func (ws *WebhookService) lookupSRV(ctx context.Context, name string) ([]string, error) {
+	_, records, err := ws.resolver.resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records are sorted by priority, lower values are preferred
+	var endpoints []string
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return endpoints, nil
+}
+
+// consulServiceEntry is an entry of the Consul health API
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// lookupConsul queries the Consul catalog for the instances of service passing their health checks
+func (ws *WebhookService) lookupConsul(ctx context.Context, service string) ([]string, error) {
+	endpoint := strings.TrimRight(ws.config.ConsulAddr, "/") + "/v1/health/service/" + url.PathEscape(service) + "?passing=true"
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if ws.config.ConsulToken != "" {
+		req.Header.Set("X-Consul-Token", ws.config.ConsulToken)
+	}
+
+	resp, err := ws.internal.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consul response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	endpoints := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		// Instances without their own address are reachable at the address of their node
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	return endpoints, nil
+}
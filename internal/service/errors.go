@@ -0,0 +1,48 @@
+package service
+
+import "errors"
+
+var (
+	// ErrInvalidRequest is returned when a request is rejected by the service before execution
+	ErrInvalidRequest = errors.New("invalid request")
+
+	// ErrConcurrencyGroupBusy is returned when an execution could not enter its concurrency group in time
+	ErrConcurrencyGroupBusy = errors.New("concurrency group is busy")
+
+	// ErrConcurrencyGroupLeaseLost is the cause of executions stopped because the Redis lease of
+	// their concurrency group slot expired, other replicas may have taken the slot
+	ErrConcurrencyGroupLeaseLost = errors.New("concurrency group lease lost")
+
+	// ErrServerBusy is returned when an execution could not be admitted because the server-wide
+	// concurrency limit stayed exhausted
+	ErrServerBusy = errors.New("server is busy")
+
+	// ErrTargetBlocked is returned when a webhook target resolves to an internal address while
+	// private targets are blocked
+	ErrTargetBlocked = errors.New("target address not allowed")
+
+	// ErrBudgetExceeded is the cause of tasks stopped because their execution ran longer than
+	// MAX_EXECUTION_DURATION
+	ErrBudgetExceeded = errors.New("execution duration budget exceeded")
+
+	// ErrJobNotFound is returned when no running execution has the given id
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrExecutionNotFound is returned when no asynchronous execution has the given id
+	ErrExecutionNotFound = errors.New("execution not found")
+
+	// ErrExecutionArchived is returned when an execution was moved to the archive and has to be
+	// restored before it can be read
+	ErrExecutionArchived = errors.New("execution archived")
+
+	// ErrQueueLeaseLost is the cause of queued executions stopped because their lease expired or
+	// was taken over by another worker
+	ErrQueueLeaseLost = errors.New("queue lease lost")
+
+	// ErrPayloadDatabaseUnavailable is returned when the database of payload queries can't be
+	// opened or connected to
+	ErrPayloadDatabaseUnavailable = errors.New("payload database unavailable")
+
+	// ErrJobStateConflict is returned when an operation isn't allowed in the current state of a job
+	ErrJobStateConflict = errors.New("job state conflict")
+)
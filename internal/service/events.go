@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Types of job events
+const (
+	EventCreated              = "created"
+	EventQueued               = "queued"
+	EventStarted              = "started"
+	EventPaused               = "paused"
+	EventResumed              = "resumed"
+	EventCancelRequested      = "cancel_requested"
+	EventAwaitingConfirmation = "awaiting_confirmation"
+	EventContinued            = "continued"
+	EventDetached             = "detached"
+	EventTaskRetried          = "task_retried"
+	EventTaskSucceeded        = "task_succeeded"
+	EventTaskFailed           = "task_failed"
+	EventCompleted            = "completed"
+	EventFailed               = "failed"
+	EventCanceled             = "canceled"
+	EventBudgetExceeded       = "budget_exceeded"
+)
+
+// eventSampledTasks is the number of tasks of an execution whose events are logged, large
+// batches log every n-th task so the log stays small
+const eventSampledTasks = 100
+
+// eventLog is the append-only lifecycle of an execution
+type eventLog struct {
+	sampleEvery int // task events are logged for payload indices divisible by it
+	clock       Clock
+
+	mu     sync.Mutex
+	events []models.JobEvent
+}
+
+// newEventLog creates the log of an execution with the given number of payloads, stamping
+// events with the time of clock
+func newEventLog(payloads int, clock Clock) *eventLog {
+	return &eventLog{sampleEvery: max(1, (payloads+eventSampledTasks-1)/eventSampledTasks), clock: clock}
+}
+
+// add appends an event, stamping it with its sequence number and the current time
+func (l *eventLog) add(event models.JobEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Seq = len(l.events) + 1
+	event.Time = l.clock.Now().UTC().Format(time.RFC3339Nano)
+	l.events = append(l.events, event)
+}
+
+// addTask appends an event of the task with the given payload index if it is sampled
+func (l *eventLog) addTask(eventType string, index int, result models.WebhookExecutionResult) {
+	if index%l.sampleEvery != 0 {
+		return
+	}
+	event := models.JobEvent{Type: eventType, Index: &index, Attempt: result.Attempts, StatusCode: result.StatusCode}
+	if !result.Success && result.Error != nil {
+		event.Message = result.Error.Error()
+	}
+	l.add(event)
+}
+
+// restore puts the events logged before the execution was taken over, e.g. by the worker of a
+// queue, in front of the ones logged since. The previous events already tell when it was created.
+func (l *eventLog) restore(previous []models.JobEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := append([]models.JobEvent{}, previous...)
+	for _, event := range l.events {
+		if len(previous) == 0 || event.Type != EventCreated {
+			events = append(events, event)
+		}
+	}
+	for i := range events {
+		events[i].Seq = i + 1
+	}
+	l.events = events
+}
+
+// snapshot returns a copy of the events logged so far
+func (l *eventLog) snapshot() []models.JobEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.JobEvent{}, l.events...)
+}
+
+// logOutcome logs how a run of an execution ended
+func (e *execution) logOutcome(response *models.ParallelExecuteResponse, err error) {
+	switch {
+	case err != nil:
+		e.events.add(models.JobEvent{Type: EventFailed, Message: err.Error()})
+	case response.Summary.Canceled:
+		e.events.add(models.JobEvent{Type: EventCanceled})
+	case response.Summary.BudgetExceeded:
+		e.events.add(models.JobEvent{Type: EventBudgetExceeded, Message: fmt.Sprintf("%d of %d requests succeeded",
+			response.Summary.SuccessfulRequests, response.Summary.TotalRequests)})
+	default:
+		e.events.add(models.JobEvent{Type: EventCompleted, Message: fmt.Sprintf("%d of %d requests succeeded",
+			response.Summary.SuccessfulRequests, response.Summary.TotalRequests)})
+	}
+}
+
+// JobLog returns the event log of a running or recorded execution
+func (ws *WebhookService) JobLog(ctx context.Context, id string) (*models.JobLog, error) {
+	if exec, ok := ws.executions.get(id); ok {
+		return &models.JobLog{ExecutionID: id, Events: exec.events.snapshot()}, nil
+	}
+
+	record, err := ws.store.Get(ctx, id)
+	if errors.Is(err, ErrExecutionNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := record.Events
+	if events == nil {
+		events = []models.JobEvent{}
+	}
+	return &models.JobLog{ExecutionID: id, Events: events}, nil
+}
@@ -0,0 +1,515 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Execution states
+const (
+	StateRunning              = "running"
+	StatePaused               = "paused"
+	StateAwaitingConfirmation = "awaiting_confirmation"
+	StateCompleted            = "completed"
+	StateFailed               = "failed"
+	StateCanceled             = "canceled"
+	StateBudgetExceeded       = "budget_exceeded"
+	StateQueued               = "queued"
+)
+
+// execution tracks a running execution, allowing operators to inspect and control it
+type execution struct {
+	id               string
+	request          *models.ParallelExecuteRequest
+	credentials      credentials
+	taskCredentials  []credentials              // by payload index if the request has tasks, nil entries have no auth
+	client           *http.Client               // pinned to the resolved addresses of the target if requested
+	targets          *targetSet                 // discovered instances of the target, nil for plain webhook URLs
+	stream           *resultStream              // results in completion order, async executions only
+	emit             func(models.WebhookResult) // receives results as they complete, streaming executions only
+	record           *models.ExecutionRecord    // history of a synchronous execution, nil if not recorded
+	events           *eventLog                  // lifecycle of the execution, served by the job log
+	logger           *slog.Logger               // carries the attributes identifying the execution
+	requestID        string                     // of the API request which started the execution, if any
+	webhookURL       string
+	concurrencyGroup string
+	totalRequests    int
+	startedAt        time.Time
+
+	dispatched atomic.Int64
+	completed  atomic.Int64
+	collected  atomic.Int64 // results collected over all runs, numbering them in completion order
+
+	mu      sync.Mutex
+	paused  bool
+	pauses  int           // number of times the execution was paused, identifies the current pause
+	resumed chan struct{} // closed when a paused execution is resumed
+	pending []int         // payload indices awaiting confirmation of a canary execution
+	claimed bool          // a continuation took the pending indices and waits to be admitted
+	expired bool          // the confirmation period ended while the pending indices were claimed
+
+	cancel   context.CancelFunc              // cancels the tasks of the current run, nil if not running
+	canceled bool                            // the current run was canceled
+	finished chan struct{}                   // closed when the current run returned
+	response *models.ParallelExecuteResponse // of the last finished run
+}
+
+// newExecution creates the tracking state of an execution started at the time of clock, logging
+// through a child of logger so every line of the execution can be correlated
+func newExecution(id string, request *models.ParallelExecuteRequest, clock Clock, logger *slog.Logger) *execution {
+	e := &execution{
+		id:               id,
+		request:          request,
+		webhookURL:       request.WebhookURL,
+		concurrencyGroup: request.ConcurrencyGroup,
+		totalRequests:    request.Payloads.Len(),
+		startedAt:        clock.Now(),
+		events:           newEventLog(request.Payloads.Len(), clock),
+	}
+	e.events.add(models.JobEvent{Type: EventCreated, Message: fmt.Sprintf("%d payloads", e.totalRequests)})
+
+	attrs := []any{"execution_id", e.id}
+	if target, err := url.Parse(request.WebhookURL); err == nil && target.Host != "" {
+		attrs = append(attrs, "webhook_host", target.Host)
+	}
+	if request.ConcurrencyGroup != "" {
+		attrs = append(attrs, "concurrency_group", request.ConcurrencyGroup)
+	}
+	e.logger = logger.With(attrs...)
+	return e
+}
+
+// targetURL returns the webhook URL of the next task
+func (e *execution) targetURL() string {
+	if e.targets != nil {
+		return e.targets.url()
+	}
+	return e.webhookURL
+}
+
+// taskURL returns the URL the payload with the given index is sent to
+func (e *execution) taskURL(index int) string {
+	if len(e.request.Tasks) > 0 {
+		return e.request.Tasks[index].WebhookURL
+	}
+	return e.targetURL()
+}
+
+// credentialsOf returns the credentials of the payload with the given index, nil without auth.
+// Tasks only use their own.
+func (e *execution) credentialsOf(index int) credentials {
+	if len(e.request.Tasks) > 0 {
+		if index < len(e.taskCredentials) {
+			return e.taskCredentials[index]
+		}
+		return nil
+	}
+	return e.credentials
+}
+
+// itemHeaders returns the custom headers of the payload with the given index, nil without
+func (e *execution) itemHeaders(index int) map[string]string {
+	if len(e.request.Tasks) > 0 {
+		return e.request.Tasks[index].Headers
+	}
+	if index < len(e.request.PayloadHeaders) {
+		return e.request.PayloadHeaders[index]
+	}
+	return nil
+}
+
+// pause stops dispatching new tasks and returns the number of the pause, it returns false if
+// the execution isn't running
+func (e *execution) pause() (int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.paused || e.pending != nil {
+		return 0, false
+	}
+	e.paused = true
+	e.pauses++
+	e.resumed = make(chan struct{})
+	return e.pauses, true
+}
+
+// stillPaused reports whether the execution hasn't been resumed since the given pause
+func (e *execution) stillPaused(pause int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.paused && e.pauses == pause
+}
+
+// resume continues dispatching tasks, it returns false if the execution isn't paused
+func (e *execution) resume() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.paused {
+		return false
+	}
+	e.paused = false
+	close(e.resumed)
+	return true
+}
+
+// park keeps the remaining payload indices of a canary execution until it is confirmed
+func (e *execution) park(pending []int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = pending
+}
+
+// claim takes the remaining payload indices for a continuation, it returns false if the
+// execution isn't awaiting confirmation or another continuation claimed them. The execution
+// awaits confirmation until the run of the continuation is admitted, see acceptClaim.
+func (e *execution) claim() ([]int, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pending == nil || e.claimed {
+		return nil, false
+	}
+	e.claimed = true
+	return e.pending, true
+}
+
+// acceptClaim starts the continuation of a canary execution once its run was admitted, the
+// remaining payload indices are no longer pending. Runs which aren't continuations are unaffected.
+func (e *execution) acceptClaim() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.claimed {
+		return
+	}
+	e.totalRequests = len(e.pending)
+	e.pending = nil
+	e.claimed = false
+	e.dispatched.Store(0)
+	e.completed.Store(0)
+	e.events.add(models.JobEvent{Type: EventContinued})
+}
+
+// rejectClaim hands back the indices of a continuation whose run wasn't admitted, so it can be
+// continued again. It reports whether the run was rejected, and whether the confirmation period
+// ended meanwhile, the remaining payload indices are dropped then.
+func (e *execution) rejectClaim() (rejected, expired bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.claimed {
+		return false, false
+	}
+	e.claimed = false
+	if e.expired {
+		e.pending = nil
+		return true, true
+	}
+	return true, false
+}
+
+// expire drops the remaining payload indices, it returns false if the execution was confirmed
+// in the meantime. Indices claimed by a continuation are dropped if its run is rejected.
+func (e *execution) expire() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pending == nil {
+		return false
+	}
+	if e.claimed {
+		e.expired = true
+		return false
+	}
+	e.pending = nil
+	return true
+}
+
+// startRun makes the tasks of a run cancelable
+func (e *execution) startRun(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancel = cancel
+	e.canceled = false
+	e.finished = make(chan struct{})
+	e.response = nil
+	return ctx
+}
+
+// finishRun keeps the response of a run (nil if it failed) for cancellation requests waiting on it
+func (e *execution) finishRun(response *models.ParallelExecuteResponse) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cancel()
+	e.cancel = nil
+	if response != nil {
+		// Streaming executions drop the results from the returned response later
+		copied := *response
+		e.response = &copied
+	}
+	close(e.finished)
+}
+
+// abort cancels the current run, the returned channel is closed once it returned. It returns
+// false if the execution isn't running.
+func (e *execution) abort() (<-chan struct{}, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.cancel == nil {
+		return nil, false
+	}
+	e.canceled = true
+	e.cancel()
+	return e.finished, true
+}
+
+// isCanceled reports whether the current run was canceled
+func (e *execution) isCanceled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.canceled
+}
+
+// lastResponse returns the response of the last finished run, nil if it failed
+func (e *execution) lastResponse() *models.ParallelExecuteResponse {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.response
+}
+
+// waitIfPaused blocks while the execution is paused, calling pausing first if it is
+func (e *execution) waitIfPaused(ctx context.Context, pausing func()) error {
+	e.mu.Lock()
+	paused, resumed := e.paused, e.resumed
+	e.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+	if pausing != nil {
+		pausing()
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// status returns a snapshot of the execution state
+func (e *execution) status() models.JobStatus {
+	e.mu.Lock()
+	state, pending, total := StateRunning, len(e.pending), e.totalRequests
+	if e.pending != nil {
+		state = StateAwaitingConfirmation
+	} else if e.paused {
+		state = StatePaused
+	}
+	e.mu.Unlock()
+
+	return models.JobStatus{
+		ID:                 e.id,
+		State:              state,
+		WebhookURL:         e.webhookURL,
+		ConcurrencyGroup:   e.concurrencyGroup,
+		TotalRequests:      total,
+		DispatchedRequests: int(e.dispatched.Load()),
+		CompletedRequests:  int(e.completed.Load()),
+		PendingRequests:    pending,
+		StartedAt:          e.startedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// executionRegistry keeps track of all running executions
+type executionRegistry struct {
+	mu         sync.RWMutex
+	executions map[string]*execution
+}
+
+// newExecutionRegistry creates an empty registry
+func newExecutionRegistry() *executionRegistry {
+	return &executionRegistry{executions: make(map[string]*execution)}
+}
+
+func (r *executionRegistry) add(e *execution) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executions[e.id] = e
+}
+
+func (r *executionRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.executions, id)
+}
+
+func (r *executionRegistry) get(id string) (*execution, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.executions[id]
+	return e, ok
+}
+
+func (r *executionRegistry) list() []*execution {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	executions := make([]*execution, 0, len(r.executions))
+	for _, e := range r.executions {
+		executions = append(executions, e)
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].startedAt.Before(executions[j].startedAt)
+	})
+	return executions
+}
+
+// release unregisters a finished execution and removes its spooled payloads
+func (ws *WebhookService) release(e *execution) {
+	ws.executions.remove(e.id)
+	if err := e.request.Payloads.Close(); err != nil {
+		e.logger.Warn("Failed to remove payload spool", "error", err)
+	}
+}
+
+// releaseUnstarted releases an execution which won't run, together with its follow-ups
+func (ws *WebhookService) releaseUnstarted(e *execution) {
+	ws.release(e)
+	e.request.OnSuccess.ClosePayloads()
+	e.request.OnFailure.ClosePayloads()
+}
+
+// ListJobs returns the status of all running executions, oldest first
+func (ws *WebhookService) ListJobs() []models.JobStatus {
+	executions := ws.executions.list()
+	jobs := make([]models.JobStatus, len(executions))
+	for i, e := range executions {
+		jobs[i] = e.status()
+	}
+	return jobs
+}
+
+// GetJob returns the status of a running execution
+func (ws *WebhookService) GetJob(id string) (*models.JobStatus, error) {
+	e, ok := ws.executions.get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	status := e.status()
+	return &status, nil
+}
+
+// PauseJob stops dispatching new tasks of a running execution, in-flight tasks finish normally.
+// The execution is canceled unless it is resumed within PAUSE_TTL.
+func (ws *WebhookService) PauseJob(id string) (*models.JobStatus, error) {
+	e, ok := ws.executions.get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	pause, ok := e.pause()
+	if !ok {
+		return nil, fmt.Errorf("%w: job is not running", ErrJobStateConflict)
+	}
+
+	// Forgotten pauses would hold the slots and payloads of the execution forever
+	ttl := time.Duration(ws.config.PauseTTL) * time.Second
+	ws.clock.AfterFunc(ttl, func() {
+		if !e.stillPaused(pause) {
+			return
+		}
+		if _, ok := e.abort(); ok {
+			e.logger.Warn("Canceling execution paused for too long", "pause_ttl_seconds", ws.config.PauseTTL)
+			e.events.add(models.JobEvent{Type: EventCancelRequested, Message: "paused for longer than PAUSE_TTL"})
+		}
+	})
+
+	e.logger.Info("Paused execution", "pause_ttl_seconds", ws.config.PauseTTL)
+	e.events.add(models.JobEvent{Type: EventPaused})
+	status := e.status()
+	return &status, nil
+}
+
+// ResumeJob continues dispatching the remaining tasks of a paused execution
+func (ws *WebhookService) ResumeJob(id string) (*models.JobStatus, error) {
+	e, ok := ws.executions.get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if !e.resume() {
+		return nil, fmt.Errorf("%w: job is not paused", ErrJobStateConflict)
+	}
+
+	e.logger.Info("Resumed execution")
+	e.events.add(models.JobEvent{Type: EventResumed})
+	status := e.status()
+	return &status, nil
+}
+
+// CancelExecution cancels the remaining tasks of a running execution, including the in-flight
+// ones, and returns its partial results once the execution returned
+func (ws *WebhookService) CancelExecution(ctx context.Context, id string) (*models.ParallelExecuteResponse, error) {
+	e, ok := ws.executions.get(id)
+	if !ok {
+		if _, err := ws.store.Get(ctx, id); err == nil {
+			return nil, fmt.Errorf("%w: execution is not running", ErrJobStateConflict)
+		}
+		return nil, ErrExecutionNotFound
+	}
+
+	finished, ok := e.abort()
+	if !ok {
+		return nil, fmt.Errorf("%w: execution is not running", ErrJobStateConflict)
+	}
+	e.logger.Info("Canceling execution")
+	e.events.add(models.JobEvent{Type: EventCancelRequested})
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Executions canceled before dispatching, e.g. while waiting for their concurrency group, have no results
+	response := e.lastResponse()
+	if response == nil {
+		return &models.ParallelExecuteResponse{
+			ExecutionID: e.id,
+			Status:      StateCanceled,
+			Results:     []models.WebhookResult{},
+			Summary:     models.ExecutionSummary{Canceled: true},
+			Options:     ws.effectiveOptions(e.request),
+		}, nil
+	}
+	canceled := *response
+	canceled.Status = StateCanceled
+	return &canceled, nil
+}
+
+// newID generates a random UUID (version 4)
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate random id: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
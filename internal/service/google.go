@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// googleMetadataIdentityURL mints ID tokens for the workload identity of the instance
+const googleMetadataIdentityURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// googleServiceAccount is the relevant part of a service account key file
+type googleServiceAccount struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleIDTokenAudience returns the audience tokens for webhookURL are minted for. Tokens are
+// sent to the target, so callers can only choose the origin of the target (Cloud Run accepts
+// the service URL) or one of GOOGLE_ID_TOKEN_AUDIENCES, e.g. the OAuth client ID of IAP.
+// Otherwise any caller could have a token of the server minted for a service of their choice
+// and sent to a URL they control.
+func (ws *WebhookService) googleIDTokenAudience(webhookURL, audience string) (string, error) {
+	target, err := url.Parse(webhookURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		if audience != "" && slices.Contains(ws.config.GoogleIDTokenAudiences, audience) {
+			return audience, nil
+		}
+		return "", fmt.Errorf("%w: google_id_token auth needs an http or https webhook_url or an audience of GOOGLE_ID_TOKEN_AUDIENCES", ErrInvalidRequest)
+	}
+	origin := strings.ToLower(target.Scheme + "://" + target.Host)
+	if audience == "" {
+		return origin, nil
+	}
+
+	if chosen, err := url.Parse(audience); err == nil && strings.ToLower(chosen.Scheme+"://"+chosen.Host) == origin {
+		return audience, nil
+	}
+	if slices.Contains(ws.config.GoogleIDTokenAudiences, audience) {
+		return audience, nil
+	}
+	return "", fmt.Errorf("%w: auth.audience must be a URL of the webhook origin %s or one of GOOGLE_ID_TOKEN_AUDIENCES", ErrInvalidRequest, origin)
+}
+
+// googleIDTokenFetcher mints Google-signed ID tokens for audience. A service account key
+// configured with GOOGLE_APPLICATION_CREDENTIALS is used if present, otherwise the
+// workload identity provided by the metadata server.
+func (ws *WebhookService) googleIDTokenFetcher(audience string) tokenFetcher {
+	return func(ctx context.Context) (string, time.Time, error) {
+		var token string
+		var err error
+		if ws.config.GoogleCredentialsFile != "" {
+			token, err = ws.googleServiceAccountIDToken(ctx, audience)
+		} else {
+			token, err = ws.googleMetadataIDToken(ctx, audience)
+		}
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to mint google id token: %w", err)
+		}
+		return token, jwtExpiry(token, ws.clock.Now()), nil
+	}
+}
+
+// googleServiceAccountIDToken exchanges a self-signed JWT of the service account for an ID token
+func (ws *WebhookService) googleServiceAccountIDToken(ctx context.Context, audience string) (string, error) {
+	data, err := os.ReadFile(ws.config.GoogleCredentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account key: %w", err)
+	}
+
+	var account googleServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return "", fmt.Errorf("invalid service account key: %w", err)
+	}
+	if account.Type != "service_account" {
+		return "", fmt.Errorf("unsupported credentials type %q, expected service_account", account.Type)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	key, err := parseRSAPrivateKey(account.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	now := ws.clock.Now()
+	assertion, err := signJWT(key, map[string]interface{}{
+		"iss":             account.ClientEmail,
+		"sub":             account.ClientEmail,
+		"aud":             account.TokenURI,
+		"iat":             now.Unix(),
+		"exp":             now.Add(time.Hour).Unix(),
+		"target_audience": audience,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	token, err := requestOAuth2Token(ctx, ws.client, account.TokenURI, form)
+	if err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// googleMetadataIDToken requests an ID token from the metadata server
+func (ws *WebhookService) googleMetadataIDToken(ctx context.Context, audience string) (string, error) {
+	query := url.Values{}
+	query.Set("audience", audience)
+	query.Set("format", "full")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", googleMetadataIdentityURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	if err := sanitizeOutboundRequest(req); err != nil {
+		return "", err
+	}
+
+	resp, err := ws.internal.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata server request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read metadata server response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned status %d: %s", resp.StatusCode, body)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded PKCS#8 or PKCS#1 RSA private key
+func parseRSAPrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key: no PEM data")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid private key: not an RSA key")
+	}
+	return key, nil
+}
+
+// signJWT creates an RS256 signed JWT with the given claims
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JWT claims: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it, tokens without a
+// readable expiry are assumed to be valid for an hour from now
+func jwtExpiry(token string, now time.Time) time.Time {
+	fallback := now.Add(time.Hour)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fallback
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return fallback
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+func TestGoogleIDTokenAudience(t *testing.T) {
+	ws := &WebhookService{config: config.ExecutionConfig{
+		GoogleIDTokenAudiences: []string{"1234-abc.apps.googleusercontent.com"},
+	}}
+
+	tests := []struct {
+		name       string
+		webhookURL string
+		audience   string
+		want       string
+		wantErr    bool
+	}{
+		{"default is the origin", "https://svc-abc.a.run.app/hook?x=1", "", "https://svc-abc.a.run.app", false},
+		{"origin case is normalized", "https://SVC.a.run.app/hook", "", "https://svc.a.run.app", false},
+		{"url on the origin", "https://svc.a.run.app/hook", "https://svc.a.run.app/hook", "https://svc.a.run.app/hook", false},
+		{"allowlisted audience", "https://iap.example.com/hook", "1234-abc.apps.googleusercontent.com", "1234-abc.apps.googleusercontent.com", false},
+		{"other service", "https://attacker.example.com/hook", "https://victim.a.run.app", "", true},
+		{"other scheme", "http://svc.a.run.app/hook", "https://svc.a.run.app", "", true},
+		{"arbitrary string", "https://svc.a.run.app/hook", "victim-client-id", "", true},
+		{"discovery target needs an allowlisted audience", "consul://orders", "", "", true},
+		{"discovery target with allowlisted audience", "consul://orders", "1234-abc.apps.googleusercontent.com", "1234-abc.apps.googleusercontent.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ws.googleIDTokenAudience(tt.webhookURL, tt.audience)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Fatalf("googleIDTokenAudience() error = %v, want ErrInvalidRequest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("googleIDTokenAudience() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("googleIDTokenAudience() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// GroupSemaphore limits how many executions of the same concurrency group run at once
+type GroupSemaphore interface {
+	// Acquire blocks until a slot of the group is available or the context is done.
+	// The returned function must be called to release the slot. The lease context is canceled
+	// with ErrConcurrencyGroupLeaseLost if the slot couldn't be kept, the holder must stop then.
+	Acquire(ctx context.Context, group string) (lease context.Context, release func(), err error)
+}
+
+// localGroupSemaphore is a GroupSemaphore which only holds within the current process
+type localGroupSemaphore struct {
+	mu           sync.Mutex
+	defaultLimit int
+	limits       map[string]int
+	groups       map[string]*groupSlots
+}
+
+// groupSlots holds the semaphore of a single concurrency group
+type groupSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+// NewLocalGroupSemaphore creates an in-process group semaphore
+func NewLocalGroupSemaphore(defaultLimit int, limits map[string]int) GroupSemaphore {
+	return &localGroupSemaphore{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		groups:       make(map[string]*groupSlots),
+	}
+}
+
+// Acquire implements GroupSemaphore
+func (gl *localGroupSemaphore) Acquire(ctx context.Context, group string) (context.Context, func(), error) {
+	gs := gl.ref(group)
+
+	// Slots of the process can't be lost
+	select {
+	case gs.slots <- struct{}{}:
+		return context.Background(), func() {
+			<-gs.slots
+			gl.unref(group)
+		}, nil
+	case <-ctx.Done():
+		gl.unref(group)
+		return nil, nil, ErrConcurrencyGroupBusy
+	}
+}
+
+// ref returns the slots of a group, creating them on first use
+func (gl *localGroupSemaphore) ref(group string) *groupSlots {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	gs, ok := gl.groups[group]
+	if !ok {
+		limit := gl.defaultLimit
+		if l, ok := gl.limits[group]; ok {
+			limit = l
+		}
+		gs = &groupSlots{slots: make(chan struct{}, limit)}
+		gl.groups[group] = gs
+	}
+	gs.refs++
+
+	return gs
+}
+
+// unref drops a reference to a group and forgets it once unused
+func (gl *localGroupSemaphore) unref(group string) {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+
+	if gs, ok := gl.groups[group]; ok {
+		gs.refs--
+		if gs.refs == 0 {
+			delete(gl.groups, group)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireGroupScript drops expired leases and takes a slot if the group is below its limit.
+// Redis server time is used so that clock skew between replicas does not matter.
+var acquireGroupScript = redis.NewScript(`
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local lease_ms = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now_ms - lease_ms)
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 1
+end
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], now_ms, ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], lease_ms * 2)
+	return 1
+end
+return 0
+`)
+
+// refreshGroupScript extends the lease of a held slot. It returns 0 if the lease expired and
+// was dropped in the meantime.
+var refreshGroupScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+redis.call('ZADD', KEYS[1], now_ms, ARGV[1])
+redis.call('PEXPIRE', KEYS[1], tonumber(ARGV[2]) * 2)
+return 1
+`)
+
+// redisGroupSemaphore is a GroupSemaphore shared by all replicas connected to the same Redis.
+// Every holder owns a lease in a sorted set which is refreshed while the execution runs,
+// so slots of crashed replicas are reclaimed once their lease expires.
+type redisGroupSemaphore struct {
+	client       *redis.Client
+	keyPrefix    string
+	defaultLimit int
+	limits       map[string]int
+	leaseTTL     time.Duration
+	pollInterval time.Duration
+	logger       *slog.Logger
+}
+
+// NewRedisGroupSemaphore creates a group semaphore backed by Redis
+func NewRedisGroupSemaphore(client *redis.Client, keyPrefix string, defaultLimit int, limits map[string]int, leaseTTL time.Duration, logger *slog.Logger) GroupSemaphore {
+	return &redisGroupSemaphore{
+		client:       client,
+		keyPrefix:    keyPrefix,
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		leaseTTL:     leaseTTL,
+		pollInterval: 250 * time.Millisecond,
+		logger:       logger,
+	}
+}
+
+// Acquire implements GroupSemaphore
+func (rs *redisGroupSemaphore) Acquire(ctx context.Context, group string) (context.Context, func(), error) {
+	key := rs.keyPrefix + ":concurrency_group:" + group
+	holder := newID()
+
+	limit := rs.defaultLimit
+	if l, ok := rs.limits[group]; ok {
+		limit = l
+	}
+
+	ticker := time.NewTicker(rs.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := acquireGroupScript.Run(ctx, rs.client, []string{key}, holder, limit, rs.leaseTTL.Milliseconds()).Int()
+		if err != nil && ctx.Err() == nil {
+			return nil, nil, err
+		}
+		if acquired == 1 {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, nil, ErrConcurrencyGroupBusy
+		}
+	}
+
+	// Keep the lease alive until released
+	lease, lost := context.WithCancelCause(context.Background())
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	go rs.keepAlive(refreshCtx, key, holder, lost)
+
+	return lease, func() {
+		stopRefresh()
+		lost(context.Canceled)
+
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := rs.client.ZRem(releaseCtx, key, holder).Err(); err != nil {
+			rs.logger.Error("Failed to release concurrency group slot", "key", key, "error", err)
+		}
+	}, nil
+}
+
+// keepAlive refreshes the lease of a held slot until the context is cancelled. Once the lease
+// was dropped, or it couldn't be refreshed before it expired, lost is called and the refreshing
+// stops, as other replicas may take the slot.
+func (rs *redisGroupSemaphore) keepAlive(ctx context.Context, key, holder string, lost context.CancelCauseFunc) {
+	ticker := time.NewTicker(rs.leaseTTL / 3)
+	defer ticker.Stop()
+
+	refreshed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			held, err := refreshGroupScript.Run(ctx, rs.client, []string{key}, holder, rs.leaseTTL.Milliseconds()).Int()
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case err == nil && held == 0:
+				rs.logger.Error("Concurrency group lease expired, stopping the holder", "key", key)
+				lost(ErrConcurrencyGroupLeaseLost)
+				return
+			case err != nil && time.Since(refreshed) >= rs.leaseTTL:
+				rs.logger.Error("Concurrency group lease expired, stopping the holder", "key", key, "error", err)
+				lost(ErrConcurrencyGroupLeaseLost)
+				return
+			case err != nil:
+				rs.logger.Warn("Failed to refresh concurrency group lease", "key", key, "error", err)
+			default:
+				refreshed = time.Now()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func newTestGroupSemaphore(t *testing.T, leaseTTL time.Duration) (*redisGroupSemaphore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	rs := NewRedisGroupSemaphore(client, "test", 1, nil, leaseTTL, testLogger).(*redisGroupSemaphore)
+	rs.pollInterval = 10 * time.Millisecond
+	return rs, mr
+}
+
+func TestRedisGroupSemaphoreStopsHolderOnExpiredLease(t *testing.T) {
+	rs, mr := newTestGroupSemaphore(t, 300*time.Millisecond)
+	mr.SetTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	lease, release, err := rs.Acquire(context.Background(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Another replica reclaims the slot once the lease expired on the Redis clock
+	mr.SetTime(time.Date(2026, 1, 2, 3, 4, 6, 0, time.UTC))
+	_, otherRelease, err := rs.Acquire(context.Background(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherRelease()
+
+	waitDone(t, lease)
+	if cause := context.Cause(lease); !errors.Is(cause, ErrConcurrencyGroupLeaseLost) {
+		t.Fatalf("lease canceled with %v, want ErrConcurrencyGroupLeaseLost", cause)
+	}
+}
+
+func TestRedisGroupSemaphoreStopsHolderWhenRedisIsGone(t *testing.T) {
+	rs, mr := newTestGroupSemaphore(t, 150*time.Millisecond)
+	lease, release, err := rs.Acquire(context.Background(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	mr.Close()
+	waitDone(t, lease)
+	if cause := context.Cause(lease); !errors.Is(cause, ErrConcurrencyGroupLeaseLost) {
+		t.Fatalf("lease canceled with %v, want ErrConcurrencyGroupLeaseLost", cause)
+	}
+}
+
+func TestRedisGroupSemaphoreKeepsRefreshedLease(t *testing.T) {
+	rs, _ := newTestGroupSemaphore(t, 150*time.Millisecond)
+	lease, release, err := rs.Acquire(context.Background(), "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refreshed every 50ms, the slot outlives its TTL several times
+	time.Sleep(500 * time.Millisecond)
+	if lease.Err() != nil {
+		t.Fatalf("lease canceled while refreshed: %v", context.Cause(lease))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := rs.Acquire(ctx, "orders"); !errors.Is(err, ErrConcurrencyGroupBusy) {
+		t.Fatalf("second Acquire() error = %v, want ErrConcurrencyGroupBusy", err)
+	}
+
+	release()
+	if context.Cause(lease) != context.Canceled {
+		t.Fatalf("lease after release canceled with %v, want context.Canceled", context.Cause(lease))
+	}
+}
+
+// lostGroupSemaphore hands out slots whose lease the test cancels
+type lostGroupSemaphore struct {
+	lease context.Context
+}
+
+func (g lostGroupSemaphore) Acquire(ctx context.Context, group string) (context.Context, func(), error) {
+	return g.lease, func() {}, nil
+}
+
+func TestRunStopsOnLostGroupLease(t *testing.T) {
+	unblock := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer target.Close()
+	defer close(unblock)
+
+	lease, lost := context.WithCancelCause(context.Background())
+	ws := newTestService(t, nil)
+	ws.groups = lostGroupSemaphore{lease: lease}
+
+	time.AfterFunc(100*time.Millisecond, func() { lost(ErrConcurrencyGroupLeaseLost) })
+	start := time.Now()
+	response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+		WebhookURL:       target.URL,
+		Payloads:         models.NewPayloads(json.RawMessage(`{}`)),
+		Timeout:          30,
+		ConcurrencyGroup: "orders",
+	})
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("execution kept running after its group lease was lost")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Summary.FailedRequests != 1 || !strings.Contains(response.Results[0].Error, ErrConcurrencyGroupLeaseLost.Error()) {
+		t.Fatalf("result = %+v, want a failure by the lost lease", response.Results[0])
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// reservedHeaders are set by the server and can't be overridden by custom headers
+var reservedHeaders = []string{
+	"Host",
+	"Content-Length",
+	headerExecutionID,
+	headerItemIndex,
+}
+
+// validateHeaders checks the custom headers of a request. Their values are checked with the
+// other header values in checkRequestLimits.
+func validateHeaders(request *models.ParallelExecuteRequest) error {
+	if len(request.PayloadHeaders) > 0 {
+		if len(request.Tasks) > 0 {
+			return fmt.Errorf("%w: payload_headers can't be used with tasks, set tasks[].headers instead", ErrInvalidRequest)
+		}
+		if len(request.PayloadHeaders) > request.Payloads.Len() {
+			return fmt.Errorf("%w: payload_headers has more entries (%d) than there are payloads (%d)", ErrInvalidRequest, len(request.PayloadHeaders), request.Payloads.Len())
+		}
+	}
+
+	if err := checkHeaderNames("headers", request.Headers); err != nil {
+		return err
+	}
+	for i, headers := range request.PayloadHeaders {
+		if err := checkHeaderNames(fmt.Sprintf("payload_headers[%d]", i), headers); err != nil {
+			return err
+		}
+	}
+	for i, task := range request.Tasks {
+		if err := checkHeaderNames(fmt.Sprintf("tasks[%d].headers", i), task.Headers); err != nil {
+			return err
+		}
+	}
+	for _, name := range request.ResponseHeaders {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: response_headers has an invalid header name %q", ErrInvalidRequest, name)
+		}
+	}
+	return nil
+}
+
+// checkHeaderNames rejects invalid and reserved header names
+func checkHeaderNames(field string, headers map[string]string) error {
+	for name := range headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: %s has an invalid header name %q", ErrInvalidRequest, field, name)
+		}
+		for _, reserved := range reservedHeaders {
+			if http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(reserved) {
+				return fmt.Errorf("%w: %s can't set %s, it is set by the server", ErrInvalidRequest, field, reserved)
+			}
+		}
+	}
+	return nil
+}
+
+// setCustomHeaders sets the headers of the request and those of the item with the given index,
+// the latter win. Auth is applied afterwards, so auth_header and auth override an Authorization
+// header set here.
+func setCustomHeaders(header http.Header, exec *execution, index int) {
+	for name, value := range exec.request.Headers {
+		header.Set(name, value)
+	}
+	for name, value := range exec.itemHeaders(index) {
+		header.Set(name, value)
+	}
+}
+
+// selectHeaders returns the response headers with the given names, keyed by their canonical
+// name. Repeated headers are joined with ", ", missing ones are left out.
+func selectHeaders(header http.Header, names []string) map[string]string {
+	var selected map[string]string
+	for _, name := range names {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if selected == nil {
+			selected = make(map[string]string, len(names))
+		}
+		selected[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+	}
+	return selected
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+// testLogger discards everything
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestService creates a service with the default configuration, changed by configure.
+// Private targets are allowed, the test servers listen on loopback.
+func newTestService(t *testing.T, configure func(cfg *config.ExecutionConfig)) *WebhookService {
+	t.Helper()
+	cfg := config.Load().Execution
+	cfg.BlockPrivateTargets = false
+	if configure != nil {
+		configure(&cfg)
+	}
+	store := NewMemoryExecutionStore(time.Duration(cfg.AsyncResultTTL) * time.Second)
+	return NewWebhookService(cfg, NewLocalGroupSemaphore(cfg.ConcurrencyGroupLimit, cfg.ConcurrencyGroupLimits), store, nil, testLogger)
+}
+
+// fakeClock only moves when advanced, timers fire once their time was passed
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	c     chan time.Time
+	f     func()
+}
+
+// newFakeClock creates a clock standing at a fixed time
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, f)
+}
+
+func (c *fakeClock) add(d time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and fires the timers due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	now := c.now
+	c.mu.Unlock()
+
+	for _, t := range due {
+		if t.f != nil {
+			go t.f()
+		} else {
+			t.c <- now
+		}
+	}
+}
+
+// AdvanceToNextSleep moves the clock to the earliest pending timer with a channel, i.e. code
+// sleeping on the clock, and fires it. AfterFunc timers such as task timeouts are skipped, they
+// only fire if the sleep lasts past them. It reports false if nobody sleeps.
+func (c *fakeClock) AdvanceToNextSleep() bool {
+	c.mu.Lock()
+	var next time.Time
+	for _, t := range c.timers {
+		if t.f == nil && (next.IsZero() || t.at.Before(next)) {
+			next = t.at
+		}
+	}
+	if next.IsZero() {
+		c.mu.Unlock()
+		return false
+	}
+	d := next.Sub(c.now)
+	c.mu.Unlock()
+	c.Advance(d)
+	return true
+}
+
+// runTimers advances the clock to every sleep until done is closed, so code sleeping on the
+// clock goes on right away while requests in flight aren't timed out
+func (c *fakeClock) runTimers(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if !c.AdvanceToNextSleep() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// Pending returns the number of timers which didn't fire yet
+func (c *fakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
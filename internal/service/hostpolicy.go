@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// maxRedirects is the number of redirects followed, like the default of net/http
+const maxRedirects = 10
+
+// hostPolicy restricts the hosts outbound requests of callers may go to, e.g. to the own n8n
+// domains. Denied patterns win over allowed ones, without allowed patterns all hosts are allowed.
+type hostPolicy struct {
+	allowed []*regexp.Regexp
+	denied  []*regexp.Regexp
+}
+
+// newHostPolicy creates the policy of the configuration, nil if it restricts nothing
+func newHostPolicy(cfg config.ExecutionConfig) *hostPolicy {
+	allowed, denied, _ := cfg.TargetHostPatterns() // validated with the configuration
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+	return &hostPolicy{allowed: allowed, denied: denied}
+}
+
+// check returns an error if host isn't allowed
+func (p *hostPolicy) check(host string) error {
+	if p == nil {
+		return nil
+	}
+	for _, re := range p.denied {
+		if re.MatchString(host) {
+			return fmt.Errorf("host %s is denied by the server", host)
+		}
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	for _, re := range p.allowed {
+		if re.MatchString(host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s is not in the allowed target hosts", host)
+}
+
+// checkURL validates the host of a URL field of a request
+func (p *hostPolicy) checkURL(field, rawURL string) error {
+	if p == nil || rawURL == "" {
+		return nil
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: invalid %s: %v", ErrInvalidRequest, field, err)
+	}
+	if err := p.check(target.Hostname()); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidRequest, field, err)
+	}
+	return nil
+}
+
+// checkRedirect is the redirect policy of outbound clients, redirects to other hosts must be
+// allowed as well
+func (p *hostPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if err := p.check(req.URL.Hostname()); err != nil {
+		return fmt.Errorf("redirect rejected: %w", err)
+	}
+	return nil
+}
+
+// policyTransport refuses requests to hosts the policy doesn't allow. It covers the URLs which
+// aren't fields of the request as well, e.g. the token endpoints of Google and Azure AD and the
+// instances of discovered targets. The host of a request is passed on to the TLS handshake,
+// which presents the client certificate only to the hosts it is meant for.
+type policyTransport struct {
+	policy *hostPolicy // nil allows all hosts
+	next   http.RoundTripper
+}
+
+func (t policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.check(req.URL.Hostname()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("request rejected: %w", err)
+	}
+	return t.next.RoundTrip(req.WithContext(withTargetHost(req.Context(), req.URL.Hostname())))
+}
+
+// client returns a client sending requests with transport to the allowed hosts only
+func (p *hostPolicy) client(transport http.RoundTripper) *http.Client {
+	return &http.Client{Transport: policyTransport{policy: p, next: transport}, CheckRedirect: p.checkRedirect}
+}
+
+// checkEndpoints validates the hosts of the instances discovered for a webhook URL
+func (p *hostPolicy) checkEndpoints(endpoints []string) error {
+	for _, endpoint := range endpoints {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			host = endpoint
+		}
+		if err := p.check(host); err != nil {
+			return fmt.Errorf("%w: discovered webhook target: %v", ErrInvalidRequest, err)
+		}
+	}
+	return nil
+}
+
+// checkRequestHosts validates the hosts of the URLs a request sends requests to
+func (ws *WebhookService) checkRequestHosts(request *models.ParallelExecuteRequest) error {
+	urls := map[string]string{
+		"webhook_url":  request.WebhookURL,
+		"callback_url": request.CallbackURL,
+	}
+	if request.Compensation != nil {
+		urls["compensation.url"] = request.Compensation.URL
+	}
+	if auth := request.Auth; auth != nil && auth.Refresh != nil {
+		urls["auth.refresh.token_url"] = auth.Refresh.TokenURL
+	}
+	for i, task := range request.Tasks {
+		urls[fmt.Sprintf("tasks[%d].webhook_url", i)] = task.WebhookURL
+		if auth := task.Auth; auth != nil && auth.Refresh != nil {
+			urls[fmt.Sprintf("tasks[%d].auth.refresh.token_url", i)] = auth.Refresh.TokenURL
+		}
+	}
+	for field, value := range urls {
+		if err := ws.hosts.checkURL(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestHostPolicyRestrictsTokenEndpoints(t *testing.T) {
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.AllowedTargetHosts = []string{"*.n8n.example.com"}
+	})
+
+	fetch := ws.azureADTokenFetcher(&models.WebhookAuth{TenantID: "tenant", ClientID: "client", ClientSecret: "secret", Scope: "scope"})
+	if _, _, err := fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "login.microsoftonline.com is not in the allowed target hosts") {
+		t.Fatalf("azure ad token request: %v", err)
+	}
+}
+
+func TestHostPolicyRestrictsDiscoveredTargets(t *testing.T) {
+	address := "10.9.9.9"
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Node":{"Address":"` + address + `"},"Service":{"Port":5678}}]`))
+	}))
+	defer consul.Close()
+
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.AllowedTargetHosts = []string{"n8n", "10.0.0.*"}
+		cfg.ConsulAddr = consul.URL
+	})
+
+	if _, err := ws.discoverTargets(context.Background(), "consul+http://n8n/webhook/x"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("instance outside the allowed hosts: %v", err)
+	}
+
+	address = "10.0.0.7"
+	targets, err := ws.discoverTargets(context.Background(), "consul+http://n8n/webhook/x")
+	if err != nil {
+		t.Fatalf("allowed instance: %v", err)
+	}
+	if got := targets.url(); got != "http://10.0.0.7:5678/webhook/x" {
+		t.Fatalf("target %s", got)
+	}
+}
+
+func TestHostPolicyRestrictsPooledClients(t *testing.T) {
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.AllowedTargetHosts = []string{"n8n.example.com"}
+	})
+	pooled, err := ws.transports.get(&models.TransportOptions{MaxConnsPerHost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pooled.client.Get("http://other.example.com/"); err == nil || !strings.Contains(err.Error(), "not in the allowed target hosts") {
+		t.Fatalf("request to another host: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Files of the service account mounted into pods
+const (
+	serviceAccountDir       = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountToken     = serviceAccountDir + "/token"
+	serviceAccountCA        = serviceAccountDir + "/ca.crt"
+	serviceAccountNamespace = serviceAccountDir + "/namespace"
+)
+
+// endpointSliceList is the subset of a discovery.k8s.io/v1 EndpointSliceList used for discovery
+type endpointSliceList struct {
+	Items []struct {
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []struct {
+			Name *string `json:"name"`
+			Port *int    `json:"port"`
+		} `json:"ports"`
+	} `json:"items"`
+}
+
+// lookupKubernetes lists the ready pod addresses of a service from its EndpointSlices, using the
+// service account of the pod. host is "service" or "service.namespace", port selects the endpoint
+// port by number; without it the service must expose a single port or one named like the scheme.
+func (ws *WebhookService) lookupKubernetes(ctx context.Context, host, port, scheme string) ([]string, error) {
+	service, namespace, _ := strings.Cut(host, ".")
+	if namespace == "" {
+		ns, err := os.ReadFile(serviceAccountNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read namespace of the pod: %w", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	client, apiURL, err := ws.kubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	token, err := os.ReadFile(serviceAccountToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s",
+		apiURL, url.PathEscape(namespace), url.QueryEscape("kubernetes.io/service-name="+service))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubernetes response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubernetes returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var slices endpointSliceList
+	if err := json.Unmarshal(body, &slices); err != nil {
+		return nil, fmt.Errorf("invalid kubernetes response: %w", err)
+	}
+
+	var endpoints []string
+	for _, slice := range slices.Items {
+		// Ports are the same for all endpoints of a slice
+		targetPort := 0
+		for _, p := range slice.Ports {
+			if p.Port == nil {
+				continue
+			}
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if (port != "" && strconv.Itoa(*p.Port) == port) || (port == "" && (len(slice.Ports) == 1 || name == scheme)) {
+				targetPort = *p.Port
+				break
+			}
+		}
+		if targetPort == 0 {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				endpoints = append(endpoints, net.JoinHostPort(addr, strconv.Itoa(targetPort)))
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// kubernetesClient returns a client trusting the cluster CA and the URL of the API server
+func (ws *WebhookService) kubernetesClient() (*http.Client, string, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, "", errors.New("not running in a kubernetes cluster")
+	}
+
+	ca, err := os.ReadFile(serviceAccountCA)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, "", errors.New("cluster CA contains no valid PEM certificate")
+	}
+
+	// A lookup is made once per execution, connections aren't kept
+	transport := ws.internal.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	transport.DisableKeepAlives = true
+	return &http.Client{Transport: transport}, "https://" + net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets, in milliseconds
+var latencyBuckets = []int64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// latencyStats summarizes the durations of dispatched requests, nil if there are none. Every
+// bucket is linked to the trace of its slowest traced request.
+func latencyStats(dispatched []models.WebhookExecutionResult) *models.LatencyStats {
+	if len(dispatched) == 0 {
+		return nil
+	}
+
+	sorted := make([]int64, len(dispatched))
+	for i, result := range dispatched {
+		sorted[i] = result.Duration
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	stats := &models.LatencyStats{
+		Min: sorted[0],
+		Max: sorted[len(sorted)-1],
+		P50: percentile(sorted, 50),
+		P90: percentile(sorted, 90),
+		P95: percentile(sorted, 95),
+		P99: percentile(sorted, 99),
+	}
+
+	// Counts per bucket, the last bucket has no upper bound
+	counts := make([]int, len(latencyBuckets)+1)
+	exemplars := make([]*models.LatencyExemplar, len(counts))
+	for _, result := range dispatched {
+		i := sort.Search(len(latencyBuckets), func(i int) bool { return result.Duration <= latencyBuckets[i] })
+		counts[i]++
+		if result.TraceID != "" && (exemplars[i] == nil || result.Duration > exemplars[i].Duration) {
+			exemplars[i] = &models.LatencyExemplar{
+				Index:    result.Index,
+				Duration: result.Duration,
+				TraceID:  result.TraceID,
+				SpanID:   result.SpanID,
+			}
+		}
+	}
+	for i, count := range counts {
+		bucket := models.LatencyBucket{Count: count, Exemplar: exemplars[i]}
+		if i < len(latencyBuckets) {
+			le := latencyBuckets[i]
+			bucket.LE = &le
+		}
+		stats.Buckets = append(stats.Buckets, bucket)
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations
+func percentile(sorted []int64, p float64) int64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
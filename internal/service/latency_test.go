@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestLatencyBucketsLinkTheirSlowestTracedRequest(t *testing.T) {
+	stats := latencyStats([]models.WebhookExecutionResult{
+		{Index: 0, Duration: 5, TraceID: "trace-a", SpanID: "span-0"},
+		{Index: 1, Duration: 8, TraceID: "trace-a", SpanID: "span-1"},
+		{Index: 2, Duration: 9}, // not traced
+		{Index: 3, Duration: 200, TraceID: "trace-a", SpanID: "span-3"},
+	})
+
+	first := stats.Buckets[0]
+	if first.Count != 3 || first.Exemplar == nil || first.Exemplar.Index != 1 || first.Exemplar.SpanID != "span-1" {
+		t.Fatalf("first bucket %+v, want 3 requests linked to the span of index 1", first)
+	}
+	for _, bucket := range stats.Buckets {
+		if bucket.LE != nil && *bucket.LE == 250 {
+			if bucket.Exemplar == nil || bucket.Exemplar.Index != 3 || bucket.Exemplar.Duration != 200 {
+				t.Fatalf("250ms bucket %+v, want it linked to index 3", bucket)
+			}
+		} else if bucket.Count == 0 && bucket.Exemplar != nil {
+			t.Fatalf("empty bucket %+v has an exemplar", bucket)
+		}
+	}
+}
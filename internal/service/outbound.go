@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Limits of outbound request headers
+const (
+	maxOutboundHeaders     = 100
+	maxOutboundHeaderBytes = 64 << 10
+)
+
+// hopByHopHeaders only apply to a single connection and must not be forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// sanitizeOutboundRequest normalizes the headers of an outbound request before it is sent.
+// Hop-by-hop headers are removed, names and values are checked for characters which could
+// be used to smuggle requests, and the number and total size of headers is limited.
+// Every outbound request builder calls it, so user supplied header names and values
+// (api keys, token endpoint headers, ...) never reach the transport unchecked.
+func sanitizeOutboundRequest(req *http.Request) error {
+	header := req.Header
+
+	// Headers nominated by Connection are hop-by-hop as well
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+
+	count, size := 0, 0
+	for name, values := range header {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: invalid header name %q", ErrInvalidRequest, name)
+		}
+		for _, value := range values {
+			if !validHeaderValue(value) {
+				return fmt.Errorf("%w: invalid value of header %s", ErrInvalidRequest, name)
+			}
+			count++
+			size += len(name) + len(value)
+		}
+	}
+
+	if count > maxOutboundHeaders {
+		return fmt.Errorf("%w: too many headers (%d), at most %d are allowed", ErrInvalidRequest, count, maxOutboundHeaders)
+	}
+	if size > maxOutboundHeaderBytes {
+		return fmt.Errorf("%w: headers too large (%d bytes), at most %d bytes are allowed", ErrInvalidRequest, size, maxOutboundHeaderBytes)
+	}
+	return nil
+}
+
+// checkRequestLimits rejects target URLs and header values exceeding the configured caps
+// before anything is dispatched, instead of failing every item at the transport level
+func (ws *WebhookService) checkRequestLimits(request *models.ParallelExecuteRequest) error {
+	urls := map[string]string{"webhook_url": request.WebhookURL}
+	headers := map[string]string{"auth_header": request.AuthHeader, "content_type": request.ContentType}
+
+	addAuthFields("auth.", request.Auth, urls, headers)
+	addHeaderFields("headers.", request.Headers, headers)
+	for i, itemHeaders := range request.PayloadHeaders {
+		addHeaderFields(fmt.Sprintf("payload_headers[%d].", i), itemHeaders, headers)
+	}
+	for i, task := range request.Tasks {
+		prefix := fmt.Sprintf("tasks[%d].", i)
+		urls[prefix+"webhook_url"] = task.WebhookURL
+		headers[prefix+"auth_header"] = task.AuthHeader
+		addAuthFields(prefix+"auth.", task.Auth, urls, headers)
+		addHeaderFields(prefix+"headers.", task.Headers, headers)
+	}
+	if request.CallbackURL != "" {
+		urls["callback_url"] = request.CallbackURL
+		headers["callback_auth_header"] = request.CallbackAuthHeader
+	}
+	if transport := request.Transport; transport != nil {
+		urls["transport.proxy_url"] = transport.ProxyURL
+	}
+	if compensation := request.Compensation; compensation != nil {
+		urls["compensation.url"] = compensation.URL
+		headers["compensation.auth_header"] = compensation.AuthHeader
+	}
+
+	for field, value := range urls {
+		if len(value) > ws.config.MaxURLLength {
+			return fmt.Errorf("%w: %s is too long (%d bytes), at most %d bytes are allowed", ErrInvalidRequest, field, len(value), ws.config.MaxURLLength)
+		}
+	}
+	for field, value := range headers {
+		if len(value) > ws.config.MaxHeaderValueLength {
+			return fmt.Errorf("%w: %s is too long (%d bytes), at most %d bytes are allowed", ErrInvalidRequest, field, len(value), ws.config.MaxHeaderValueLength)
+		}
+		if !validHeaderValue(value) {
+			return fmt.Errorf("%w: %s contains invalid characters", ErrInvalidRequest, field)
+		}
+	}
+	return nil
+}
+
+// addAuthFields adds the URLs and header values of auth to the fields checked against the limits
+func addAuthFields(prefix string, auth *models.WebhookAuth, urls, headers map[string]string) {
+	if auth == nil {
+		return
+	}
+	headers[prefix+"token"] = auth.Token
+	headers[prefix+"value"] = auth.Value
+	if refresh := auth.Refresh; refresh != nil {
+		urls[prefix+"refresh.token_url"] = refresh.TokenURL
+		for name, value := range refresh.Headers {
+			headers[prefix+"refresh.headers."+name] = value
+		}
+	}
+}
+
+// addHeaderFields adds custom header values to the fields checked against the limits
+func addHeaderFields(prefix string, custom, headers map[string]string) {
+	for name, value := range custom {
+		headers[prefix+name] = value
+	}
+}
+
+// validHeaderName reports whether name is a valid header field name (an RFC 7230 token)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue reports whether value contains no control characters except tab
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
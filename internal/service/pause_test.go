@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// startPausedExecution starts an execution of three payloads, one at a time, and pauses it once
+// the first task is in flight. It returns the execution and its outcome.
+func startPausedExecution(t *testing.T, ws *WebhookService) (*execution, <-chan *models.ParallelExecuteResponse) {
+	t.Helper()
+	inFlight := make(chan struct{}, 3)
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight <- struct{}{}
+		<-release
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(target.Close)
+
+	done := make(chan *models.ParallelExecuteResponse, 1)
+	go func() {
+		response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+			WebhookURL:     target.URL,
+			Payloads:       models.NewPayloads(json.RawMessage(`{}`), json.RawMessage(`{}`), json.RawMessage(`{}`)),
+			Timeout:        30,
+			MaxConcurrency: 1,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+
+	<-inFlight
+	var exec *execution
+	for _, e := range ws.executions.list() {
+		exec = e
+	}
+	if _, err := ws.PauseJob(exec.id); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for exec.completed.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	return exec, done
+}
+
+func TestPausedExecutionCanceledAfterPauseTTL(t *testing.T) {
+	ws := newTestService(t, nil)
+	clock := newFakeClock()
+	ws.SetClock(clock, SystemRandomness)
+	_, done := startPausedExecution(t, ws)
+
+	clock.Advance(time.Duration(ws.config.PauseTTL) * time.Second)
+	response := <-done
+	if !response.Summary.Canceled || response.Summary.SuccessfulRequests != 1 {
+		t.Fatalf("summary %+v, want the execution canceled after its first request", response.Summary)
+	}
+	for _, result := range response.Results[1:] {
+		if result.ErrorCode != models.ErrorCodeCanceled {
+			t.Fatalf("undispatched result %+v, want it canceled", result)
+		}
+	}
+}
+
+func TestResumedExecutionNotCanceledByEarlierPause(t *testing.T) {
+	ws := newTestService(t, nil)
+	clock := newFakeClock()
+	ws.SetClock(clock, SystemRandomness)
+	exec, done := startPausedExecution(t, ws)
+
+	// The TTL of the first pause passes during the second one
+	ttl := time.Duration(ws.config.PauseTTL) * time.Second
+	clock.Advance(ttl / 2)
+	if _, err := ws.ResumeJob(exec.id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.PauseJob(exec.id); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(ttl / 2)
+	// The fired timer runs in the background, give it a moment to cancel wrongly
+	for deadline := time.Now().Add(50 * time.Millisecond); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if exec.isCanceled() {
+			t.Fatal("execution canceled by the TTL of an earlier pause")
+		}
+	}
+	if _, err := ws.ResumeJob(exec.id); err != nil {
+		t.Fatal(err)
+	}
+	if response := <-done; response.Summary.Canceled || response.Summary.SuccessfulRequests != 3 {
+		t.Fatalf("summary %+v, want all 3 requests sent", response.Summary)
+	}
+}
+
+func TestPausedExecutionGivesAdmissionSlotBack(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.MaxTotalConcurrency = 1
+		cfg.TotalConcurrencyWaitTimeout = 5
+	})
+	request := func() *models.ParallelExecuteRequest {
+		return &models.ParallelExecuteRequest{
+			WebhookURL: target.URL,
+			Payloads:   models.NewPayloads(json.RawMessage(`{}`), json.RawMessage(`{}`)),
+			Timeout:    10,
+		}
+	}
+
+	// The first execution is paused before its first task was dispatched
+	paused := request()
+	exec, err := ws.prepare(context.Background(), "exec-paused", paused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.pause()
+	done := make(chan *models.ParallelExecuteResponse, 1)
+	go func() {
+		response, err := ws.run(context.Background(), exec, paused, allIndices(2))
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+	started := func() bool {
+		for _, event := range exec.events.snapshot() {
+			if event.Type == EventStarted {
+				return true
+			}
+		}
+		return false
+	}
+	for !started() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Its admission slot is free for others while it is paused
+	response, err := ws.ExecuteParallel(context.Background(), request())
+	if err != nil {
+		t.Fatalf("execution next to a paused one wasn't admitted: %v", err)
+	}
+	if response.Summary.SuccessfulRequests != 2 {
+		t.Fatalf("summary %+v", response.Summary)
+	}
+
+	// and taken again on resume
+	exec.resume()
+	if response := <-done; response.Summary.SuccessfulRequests != 2 {
+		t.Fatalf("summary of the resumed execution %+v", response.Summary)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// Drivers of the payload queries, both pure Go
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// sqlDrivers maps the payload query drivers of the configuration to database/sql drivers
+var sqlDrivers = map[string]string{
+	"postgres": "pgx",
+	"mysql":    "mysql",
+}
+
+// payloadSource runs the payload queries configured on the server, so backfills can fan out
+// over the rows of a table without exporting them through n8n first
+type payloadSource struct {
+	db             *sql.DB
+	queries        map[string]string
+	maxRows        int
+	timeout        time.Duration
+	spoolThreshold int64
+	spoolDir       string
+	err            error // why the database couldn't be opened, returned by every query
+}
+
+// newPayloadSource returns nil if payload queries aren't configured. The database is connected
+// on first use. A source whose database couldn't be opened fails every query with the error.
+func newPayloadSource(cfg config.ExecutionConfig) *payloadSource {
+	if cfg.PayloadQueryDSN == "" {
+		return nil
+	}
+	db, err := sql.Open(sqlDrivers[cfg.PayloadQueryDriver], cfg.PayloadQueryDSN)
+	if err != nil {
+		return &payloadSource{err: fmt.Errorf("%w: failed to open the payload database: %v", ErrPayloadDatabaseUnavailable, err)}
+	}
+	db.SetMaxOpenConns(4)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	return &payloadSource{
+		db:             db,
+		queries:        cfg.PayloadQueries,
+		maxRows:        cfg.PayloadQueryMaxRows,
+		timeout:        time.Duration(cfg.PayloadQueryTimeout) * time.Second,
+		spoolThreshold: cfg.PayloadSpoolThreshold,
+		spoolDir:       cfg.PayloadSpoolDir,
+	}
+}
+
+// LoadPayloadQuery runs the payload query of a request and returns its rows as payloads. Unknown
+// queries, bad arguments and queries returning too many rows are rejected with ErrInvalidRequest,
+// a database which can't be reached with ErrPayloadDatabaseUnavailable.
+func (ws *WebhookService) LoadPayloadQuery(ctx context.Context, query *models.PayloadQuery) (models.Payloads, error) {
+	if ws.queries == nil {
+		return models.Payloads{}, fmt.Errorf("%w: payload queries aren't configured, see PAYLOAD_QUERY_DSN", ErrInvalidRequest)
+	}
+	return ws.queries.load(ctx, query)
+}
+
+// load runs a query in a read-only transaction, which is rolled back once the rows were read
+func (s *payloadSource) load(ctx context.Context, query *models.PayloadQuery) (models.Payloads, error) {
+	if s.err != nil {
+		return models.Payloads{}, s.err
+	}
+	statement, ok := s.queries[query.Name]
+	if !ok {
+		return models.Payloads{}, fmt.Errorf("%w: unknown payload query %q", ErrInvalidRequest, query.Name)
+	}
+	args, err := queryArgs(query.Args)
+	if err != nil {
+		return models.Payloads{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return models.Payloads{}, fmt.Errorf("%w: failed to connect to the payload database: %v", ErrPayloadDatabaseUnavailable, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return models.Payloads{}, fmt.Errorf("payload query %s failed: %w", query.Name, err)
+	}
+	defer rows.Close()
+
+	return s.readRows(rows, query.Name)
+}
+
+// readRows encodes every row as a JSON object of its columns
+func (s *payloadSource) readRows(rows *sql.Rows, name string) (models.Payloads, error) {
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return models.Payloads{}, err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	w := models.NewPayloadWriter(s.spoolThreshold, s.spoolDir)
+	row := make(map[string]interface{}, len(columns))
+	for rows.Next() {
+		if w.Len() == s.maxRows {
+			w.Abort()
+			return models.Payloads{}, fmt.Errorf("%w: payload query %s returned more than %d rows, see PAYLOAD_QUERY_MAX_ROWS", ErrInvalidRequest, name, s.maxRows)
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			w.Abort()
+			return models.Payloads{}, fmt.Errorf("payload query %s failed: %w", name, err)
+		}
+		for i, column := range columns {
+			row[column.Name()] = columnValue(values[i], column.DatabaseTypeName())
+		}
+		item, err := json.Marshal(row)
+		if err != nil {
+			w.Abort()
+			return models.Payloads{}, fmt.Errorf("failed to encode row %d of payload query %s: %w", w.Len(), name, err)
+		}
+		if err := w.Add(item); err != nil {
+			w.Abort()
+			return models.Payloads{}, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		w.Abort()
+		return models.Payloads{}, fmt.Errorf("payload query %s failed: %w", name, err)
+	}
+	return w.Finish()
+}
+
+// columnValue converts a scanned column to its JSON representation. Text columns, which some
+// drivers return as bytes, become strings, JSON columns are embedded as they are.
+func columnValue(value interface{}, databaseType string) interface{} {
+	var raw []byte
+	switch v := value.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return value
+	}
+
+	switch strings.ToUpper(databaseType) {
+	case "JSON", "JSONB":
+		if json.Valid(raw) {
+			return json.RawMessage(raw)
+		}
+	}
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	return raw // binary columns are encoded as base64
+}
+
+// queryArgs converts the arguments of a request to query arguments. JSON numbers without a
+// fraction are passed as integers, so they can be compared with integer columns.
+func queryArgs(values []interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil, string, bool:
+			args[i] = v
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				args[i] = int64(v)
+			} else {
+				args[i] = v
+			}
+		default:
+			return nil, fmt.Errorf("%w: payload_query.args[%d] must be a string, number, boolean or null", ErrInvalidRequest, i)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestPayloadQueryErrors(t *testing.T) {
+	// The execution store's driver stands in for a database answering queries
+	sqlDrivers["sqlite"] = "sqlite"
+	t.Cleanup(func() { delete(sqlDrivers, "sqlite") })
+
+	tests := []struct {
+		name        string
+		driver      string
+		dsn         string
+		query       string
+		unavailable bool
+	}{
+		{"database can't be opened", "unknown", "anything", "SELECT 1", true},
+		{"database can't be reached", "postgres", "postgres://reader@127.0.0.1:1/shop?connect_timeout=5", "SELECT 1", true},
+		{"query fails", "sqlite", filepath.Join(t.TempDir(), "payloads.db"), "SELECT * FROM missing", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+				cfg.PayloadQueryDriver = tt.driver
+				cfg.PayloadQueryDSN = tt.dsn
+				cfg.PayloadQueries = map[string]string{"rows": tt.query}
+			})
+			_, err := ws.LoadPayloadQuery(context.Background(), &models.PayloadQuery{Name: "rows"})
+			if err == nil || errors.Is(err, ErrInvalidRequest) {
+				t.Fatalf("LoadPayloadQuery() = %v, want a failure which isn't the caller's fault", err)
+			}
+			if errors.Is(err, ErrPayloadDatabaseUnavailable) != tt.unavailable {
+				t.Fatalf("LoadPayloadQuery() = %v, unavailable %v", err, tt.unavailable)
+			}
+		})
+	}
+}
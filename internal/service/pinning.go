@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+)
+
+// newPinnedClient resolves the host of targetURL once and returns a client with a copy of base
+// dialing only the resolved addresses for that host, so a DNS change mid-batch doesn't split an
+// execution across backends. Other hosts, e.g. redirect targets, are dialed normally.
+func (ws *WebhookService) newPinnedClient(ctx context.Context, targetURL string, client *http.Client, base *http.Transport) (*http.Client, []netip.Addr, error) {
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid webhook_url: %v", ErrInvalidRequest, err)
+	}
+
+	host := target.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return client, nil, nil // nothing to pin
+	}
+
+	network := "ip"
+	switch ws.config.DialPrefer {
+	case DialPreferIPv4:
+		network = "ip4"
+	case DialPreferIPv6:
+		network = "ip6"
+	}
+
+	addrs, err := ws.resolver.lookupNetIP(ctx, network, host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, nil, fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+
+	transport := base.Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialHost, port, err := net.SplitHostPort(addr)
+		if err != nil || dialHost != host {
+			return ws.dial(ctx, network, addr)
+		}
+
+		// Try the pinned addresses in resolution order
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := ws.dial(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+
+	return ws.hosts.client(transport), addrs, nil
+}
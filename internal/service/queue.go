@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// ExecutionQueue keeps submitted asynchronous executions until a worker runs them, so they
+// survive restarts of the server
+type ExecutionQueue interface {
+	// Enqueue adds the encoded request of an execution
+	Enqueue(ctx context.Context, id string, request []byte) error
+	// Dequeue blocks until an execution is available or the context is done. The execution is
+	// leased to the caller until the returned function is called; executions of workers which
+	// died are handed out again once their lease expired. The lease context is canceled with
+	// ErrQueueLeaseLost if the lease couldn't be kept, the execution must stop then.
+	Dequeue(ctx context.Context) (id string, request []byte, lease context.Context, done func(), err error)
+	// Queued reports whether an execution is waiting or running
+	Queued(ctx context.Context, id string) (bool, error)
+}
+
+// enqueue validates an asynchronous execution and submits it to the queue
+func (ws *WebhookService) enqueue(ctx context.Context, request *models.ParallelExecuteRequest) (string, error) {
+	defer request.ClosePayloads()
+
+	// Invalid requests are rejected right away, not once a worker picked them up
+	if err := ws.validateRequest(request); err != nil {
+		return "", err
+	}
+	if _, err := ws.newCredentials(request); err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode execution: %w", err)
+	}
+	// The request carries the credentials of its webhooks and callback
+	if ws.secrets != nil {
+		encoded = ws.secrets.seal(encoded)
+	}
+
+	id := newID()
+	record := &models.ExecutionRecord{
+		ExecutionID:      id,
+		Status:           StateQueued,
+		Mode:             "async",
+		WebhookURL:       request.WebhookURL,
+		ConcurrencyGroup: request.ConcurrencyGroup,
+		CallbackURL:      request.CallbackURL,
+		TotalRequests:    request.Payloads.Len(),
+		CreatedAt:        ws.clock.Now().UTC().Format(time.RFC3339),
+	}
+	events := newEventLog(record.TotalRequests, ws.clock)
+	events.add(models.JobEvent{Type: EventCreated, Message: fmt.Sprintf("%d payloads", record.TotalRequests)})
+	events.add(models.JobEvent{Type: EventQueued})
+	record.Events = events.snapshot()
+	if err := ws.store.Save(ctx, record); err != nil {
+		return "", fmt.Errorf("failed to store execution: %w", err)
+	}
+	if err := ws.queue.Enqueue(ctx, id, encoded); err != nil {
+		return "", fmt.Errorf("failed to enqueue execution: %w", err)
+	}
+
+	ws.logger.Info("Queued execution", "execution_id", id, "total_requests", record.TotalRequests)
+	return id, nil
+}
+
+// RunWorkers runs queued executions with the given number of workers, one execution per worker
+// at a time. It returns once the context is done and the running executions finished.
+func (ws *WebhookService) RunWorkers(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs queued executions until the context is done
+func (ws *WebhookService) work(ctx context.Context) {
+	for {
+		id, encoded, lease, done, err := ws.queue.Dequeue(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			ws.logger.Error("Failed to dequeue execution", "error", err)
+			if ws.sleep(ctx, time.Second) != nil {
+				return
+			}
+			continue
+		}
+
+		ws.runQueued(lease, id, encoded)
+		done()
+	}
+}
+
+// runQueued runs a dequeued execution, executions which can't be started are stored as failed.
+// The execution is stopped once the lease is lost, another worker runs it again.
+func (ws *WebhookService) runQueued(lease context.Context, id string, encoded []byte) {
+	ctx := context.Background()
+
+	// The queued record is gone if the server restarted in the meantime
+	createdAt := ws.clock.Now()
+	var queuedEvents []models.JobEvent
+	if queued, err := ws.store.Get(ctx, id); err == nil {
+		if t, err := time.Parse(time.RFC3339, queued.CreatedAt); err == nil {
+			createdAt = t
+		}
+		queuedEvents = queued.Events
+	}
+
+	var request models.ParallelExecuteRequest
+	fail := func(err error) {
+		ws.logger.Error("Failed to start queued execution", "execution_id", id, "error", err)
+		record := &models.ExecutionRecord{
+			ExecutionID:      id,
+			Status:           StateFailed,
+			Mode:             "async",
+			WebhookURL:       request.WebhookURL,
+			ConcurrencyGroup: request.ConcurrencyGroup,
+			CallbackURL:      request.CallbackURL,
+			CreatedAt:        createdAt.UTC().Format(time.RFC3339),
+			FinishedAt:       ws.clock.Now().UTC().Format(time.RFC3339),
+			Error:            err.Error(),
+		}
+		events := newEventLog(0, ws.clock)
+		events.restore(queuedEvents)
+		events.add(models.JobEvent{Type: EventFailed, Message: err.Error()})
+		record.Events = events.snapshot()
+		if err := ws.store.Save(ctx, record); err != nil {
+			ws.logger.Error("Failed to store execution results", "execution_id", id, "error", err)
+		}
+		ws.notifyCallback(ctx, newExecution(id, &request, ws.clock, ws.logger), nil, err)
+	}
+
+	if ws.secrets != nil {
+		var err error
+		if encoded, err = ws.secrets.open(encoded); err != nil {
+			fail(fmt.Errorf("invalid queued execution: %w", err))
+			return
+		}
+	}
+	if err := json.Unmarshal(encoded, &request); err != nil {
+		fail(fmt.Errorf("invalid queued execution: %w", err))
+		return
+	}
+
+	exec, err := ws.prepare(ctx, id, &request)
+	if err != nil {
+		fail(err)
+		return
+	}
+	exec.events.restore(queuedEvents)
+	record, err := ws.startAsync(ctx, exec, createdAt)
+	if err != nil {
+		ws.releaseUnstarted(exec)
+		fail(err)
+		return
+	}
+
+	exec.logger.Info("Dequeued execution", "queued_ms", ws.clock.Now().Sub(createdAt).Milliseconds())
+	// Stopping the worker doesn't cut the execution short, it starts a trace of its own
+	ws.runAsync(lease, exec, record)
+}
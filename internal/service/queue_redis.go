@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// dequeueScript hands out the oldest waiting execution and leases it to the caller, whose token
+// is recorded as the owner of the lease. Executions whose lease expired, because the worker
+// running them died, are put back in front of the queue first. Redis server time is used so
+// that clock skew between replicas does not matter.
+var dequeueScript = redis.NewScript(`
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now_ms - tonumber(ARGV[1]))
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('HDEL', KEYS[3], id)
+	redis.call('RPUSH', KEYS[1], id)
+end
+local id = redis.call('RPOP', KEYS[1])
+if id then
+	redis.call('ZADD', KEYS[2], now_ms, id)
+	redis.call('HSET', KEYS[3], id, ARGV[2])
+end
+return id
+`)
+
+// extendScript refreshes the lease of a running execution and the expiry of its request. It
+// returns 0 if the caller doesn't own the lease anymore.
+var extendScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+local now = redis.call('TIME')
+local now_ms = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+redis.call('ZADD', KEYS[1], now_ms, ARGV[1])
+redis.call('PEXPIRE', KEYS[3], ARGV[3])
+return 1
+`)
+
+// removeScript drops a finished execution if the caller still owns its lease
+var removeScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('DEL', KEYS[3])
+return 1
+`)
+
+// redisExecutionQueue is an ExecutionQueue shared by all replicas connected to the same Redis.
+// Waiting execution ids are kept in a list, running ones in a sorted set by the time their lease
+// was last refreshed together with a hash of their owners, and the encoded requests in a key per
+// execution expiring after ttl.
+type redisExecutionQueue struct {
+	client       *redis.Client
+	keyPrefix    string
+	leaseTTL     time.Duration
+	ttl          time.Duration
+	pollInterval time.Duration
+	logger       *slog.Logger
+}
+
+// NewRedisExecutionQueue creates an execution queue backed by Redis. Executions not started
+// within ttl are dropped.
+func NewRedisExecutionQueue(client *redis.Client, keyPrefix string, leaseTTL, ttl time.Duration, logger *slog.Logger) ExecutionQueue {
+	return &redisExecutionQueue{
+		client:       client,
+		keyPrefix:    keyPrefix,
+		leaseTTL:     leaseTTL,
+		ttl:          ttl,
+		pollInterval: 500 * time.Millisecond,
+		logger:       logger,
+	}
+}
+
+func (rq *redisExecutionQueue) pendingKey() string { return rq.keyPrefix + ":queue:pending" }
+func (rq *redisExecutionQueue) runningKey() string { return rq.keyPrefix + ":queue:running" }
+func (rq *redisExecutionQueue) ownersKey() string  { return rq.keyPrefix + ":queue:owners" }
+func (rq *redisExecutionQueue) requestKey(id string) string {
+	return rq.keyPrefix + ":queue:execution:" + id
+}
+
+// Enqueue implements ExecutionQueue
+func (rq *redisExecutionQueue) Enqueue(ctx context.Context, id string, request []byte) error {
+	_, err := rq.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, rq.requestKey(id), request, rq.ttl)
+		pipe.LPush(ctx, rq.pendingKey(), id)
+		return nil
+	})
+	return err
+}
+
+// Dequeue implements ExecutionQueue
+func (rq *redisExecutionQueue) Dequeue(ctx context.Context) (string, []byte, context.Context, func(), error) {
+	ticker := time.NewTicker(rq.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		token := newID()
+		id, err := dequeueScript.Run(ctx, rq.client, []string{rq.pendingKey(), rq.runningKey(), rq.ownersKey()},
+			rq.leaseTTL.Milliseconds(), token).Text()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return "", nil, nil, nil, err
+		}
+
+		if id != "" {
+			request, err := rq.client.Get(ctx, rq.requestKey(id)).Bytes()
+			if err == nil {
+				lease, lost := context.WithCancelCause(context.Background())
+				refreshCtx, stopRefresh := context.WithCancel(context.Background())
+				go rq.keepAlive(refreshCtx, id, token, lost)
+				return id, request, lease, func() {
+					stopRefresh()
+					lost(context.Canceled)
+					rq.remove(id, token)
+				}, nil
+			}
+			if !errors.Is(err, redis.Nil) {
+				return "", nil, nil, nil, err
+			}
+			// The request of an execution is removed once it finished or expired unrun
+			rq.logger.Warn("Dropped queued execution without request", "execution_id", id)
+			rq.remove(id, token)
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return "", nil, nil, nil, ctx.Err()
+		}
+	}
+}
+
+// Queued implements ExecutionQueue
+func (rq *redisExecutionQueue) Queued(ctx context.Context, id string) (bool, error) {
+	n, err := rq.client.Exists(ctx, rq.requestKey(id)).Result()
+	return n > 0, err
+}
+
+// remove drops a finished execution from the queue, unless another worker took it over
+func (rq *redisExecutionQueue) remove(id, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := []string{rq.runningKey(), rq.ownersKey(), rq.requestKey(id)}
+	if err := removeScript.Run(ctx, rq.client, keys, id, token).Err(); err != nil {
+		rq.logger.Error("Failed to remove finished execution from the queue", "execution_id", id, "error", err)
+	}
+}
+
+// keepAlive refreshes the lease of a running execution until the context is cancelled. Once
+// another worker took the lease over, or it couldn't be refreshed before it expired, lost is
+// called and the refreshing stops.
+func (rq *redisExecutionQueue) keepAlive(ctx context.Context, id, token string, lost context.CancelCauseFunc) {
+	ticker := time.NewTicker(rq.leaseTTL / 3)
+	defer ticker.Stop()
+
+	keys := []string{rq.runningKey(), rq.ownersKey(), rq.requestKey(id)}
+	refreshed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			held, err := extendScript.Run(ctx, rq.client, keys, id, token, rq.ttl.Milliseconds()).Int()
+			if ctx.Err() != nil {
+				return
+			}
+			switch {
+			case err == nil && held == 0:
+				rq.logger.Error("Queued execution lease was taken over, stopping the execution", "execution_id", id)
+				lost(ErrQueueLeaseLost)
+				return
+			case err != nil && time.Since(refreshed) >= rq.leaseTTL:
+				rq.logger.Error("Queued execution lease expired, stopping the execution", "execution_id", id, "error", err)
+				lost(ErrQueueLeaseLost)
+				return
+			case err != nil:
+				rq.logger.Warn("Failed to refresh queued execution lease", "execution_id", id, "error", err)
+			default:
+				refreshed = time.Now()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
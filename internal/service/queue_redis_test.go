@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// newTestQueue creates a Redis queue on an in-process Redis
+func newTestQueue(t *testing.T, leaseTTL, ttl time.Duration) (*redisExecutionQueue, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	rq := NewRedisExecutionQueue(client, "test", leaseTTL, ttl, testLogger).(*redisExecutionQueue)
+	rq.pollInterval = 10 * time.Millisecond
+	return rq, mr
+}
+
+// waitDone waits for a context to be canceled
+func waitDone(t *testing.T, ctx context.Context) {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context wasn't canceled")
+	}
+}
+
+func TestRedisQueueExpiresRequests(t *testing.T) {
+	rq, mr := newTestQueue(t, time.Second, time.Hour)
+	if err := rq.Enqueue(context.Background(), "exec-1", []byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(rq.requestKey("exec-1")); ttl != time.Hour {
+		t.Fatalf("TTL of the queued request = %v, want 1h", ttl)
+	}
+
+	// Requests which expired unrun are dropped
+	mr.FastForward(2 * time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, _, _, err := rq.Dequeue(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dequeue() error = %v, want the context deadline", err)
+	}
+}
+
+func TestRedisQueueStopsExecutionOnLostLease(t *testing.T) {
+	rq, mr := newTestQueue(t, 300*time.Millisecond, time.Hour)
+	mr.SetTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err := rq.Enqueue(context.Background(), "exec-1", []byte("request")); err != nil {
+		t.Fatal(err)
+	}
+
+	id, request, lease, done, err := rq.Dequeue(context.Background())
+	if err != nil || id != "exec-1" || string(request) != "request" {
+		t.Fatalf("Dequeue() = %q, %q, %v", id, request, err)
+	}
+
+	// The lease expires on the Redis clock while the worker is stuck, another worker takes over
+	mr.SetTime(time.Date(2026, 1, 2, 3, 4, 6, 0, time.UTC))
+	id, _, other, otherDone, err := rq.Dequeue(context.Background())
+	if err != nil || id != "exec-1" {
+		t.Fatalf("Dequeue() of the expired lease = %q, %v", id, err)
+	}
+	defer otherDone()
+
+	waitDone(t, lease)
+	if cause := context.Cause(lease); !errors.Is(cause, ErrQueueLeaseLost) {
+		t.Fatalf("lease canceled with %v, want ErrQueueLeaseLost", cause)
+	}
+
+	// The first worker finishing doesn't remove the execution of the new owner
+	done()
+	if !mr.Exists(rq.requestKey("exec-1")) {
+		t.Fatal("request was removed by the worker which lost the lease")
+	}
+	if other.Err() != nil {
+		t.Fatalf("lease of the new owner canceled: %v", context.Cause(other))
+	}
+}
+
+func TestRedisQueueStopsExecutionWhenRedisIsGone(t *testing.T) {
+	rq, mr := newTestQueue(t, 150*time.Millisecond, time.Hour)
+	if err := rq.Enqueue(context.Background(), "exec-1", []byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, lease, done, err := rq.Dequeue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+
+	mr.Close()
+	waitDone(t, lease)
+	if cause := context.Cause(lease); !errors.Is(cause, ErrQueueLeaseLost) {
+		t.Fatalf("lease canceled with %v, want ErrQueueLeaseLost", cause)
+	}
+}
+
+func TestEnqueueEncryptsRequests(t *testing.T) {
+	rq, mr := newTestQueue(t, time.Second, time.Hour)
+	ws := newTestService(t, nil)
+	ws.queue = rq
+	ws.secrets = newSecretBox("0123456789abcdef0123456789abcdef")
+
+	request := &models.ParallelExecuteRequest{
+		WebhookURL:     "https://n8n.example.com/webhook/x",
+		Payloads:       models.NewPayloads(json.RawMessage(`{"a":1}`)),
+		Auth:           &models.WebhookAuth{Type: AuthTypeBearer, Token: "webhook-token-value"},
+		CallbackURL:    "https://n8n.example.com/webhook/done",
+		CallbackSecret: "callback-secret-value-0123456789",
+		Timeout:        30,
+	}
+	id, err := ws.enqueue(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := mr.Get(rq.requestKey(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"webhook-token-value", "callback-secret-value-0123456789"} {
+		if bytes.Contains([]byte(stored), []byte(secret)) {
+			t.Errorf("queued request contains %q in plaintext", secret)
+		}
+	}
+
+	opened, err := ws.secrets.open([]byte(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded models.ParallelExecuteRequest
+	if err := json.Unmarshal(opened, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Auth == nil || decoded.Auth.Token != "webhook-token-value" {
+		t.Fatalf("decrypted request lost its auth: %+v", decoded.Auth)
+	}
+
+	if _, err := newSecretBox("another key of at least 32 bytes!").open([]byte(stored)); err == nil {
+		t.Fatal("request opened with another key")
+	}
+}
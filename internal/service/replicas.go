@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+)
+
+// ExecutionOwners records which replica keeps the record of an execution. The execution stores
+// are local to a replica, reads of executions recorded by another replica are forwarded to it,
+// so a client polling any replica right after creating an execution finds it.
+type ExecutionOwners interface {
+	// Claim records this replica as the owner of an execution
+	Claim(ctx context.Context, id string) error
+	// Owner returns the URL of the replica owning an execution, empty if it is unknown
+	Owner(ctx context.Context, id string) (string, error)
+}
+
+// SetExecutionOwners makes the service claim the executions it records, see ExecutionOwner. It
+// must be called before the service executes anything.
+func (ws *WebhookService) SetExecutionOwners(owners ExecutionOwners) {
+	ws.owners = owners
+}
+
+// ExecutionOwner returns the URL of the replica keeping the record of an execution if that is
+// another one, empty if it is this replica or unknown
+func (ws *WebhookService) ExecutionOwner(ctx context.Context, id string) (string, error) {
+	if ws.owners == nil {
+		return "", nil
+	}
+	owner, err := ws.owners.Owner(ctx, id)
+	if err != nil || owner == ws.config.ReplicaURL {
+		return "", err
+	}
+	return owner, nil
+}
+
+// claim records this replica as the owner of an execution, again with every save of its record
+// so the claim lasts as long as the record
+func (ws *WebhookService) claim(exec *execution) {
+	if ws.owners == nil {
+		return
+	}
+	if err := ws.owners.Claim(context.Background(), exec.id); err != nil {
+		exec.logger.Warn("Failed to claim execution, other replicas can't forward reads of it", "error", err)
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisExecutionOwners is an ExecutionOwners shared by all replicas connected to the same Redis,
+// the URL of the owner is kept in a key per execution expiring after ttl
+type redisExecutionOwners struct {
+	client     *redis.Client
+	keyPrefix  string
+	replicaURL string
+	ttl        time.Duration
+}
+
+// NewRedisExecutionOwners creates the owner registry of the replica reachable at replicaURL.
+// Claims expire after ttl, which should outlast the records of the execution store.
+func NewRedisExecutionOwners(client *redis.Client, keyPrefix, replicaURL string, ttl time.Duration) ExecutionOwners {
+	return &redisExecutionOwners{client: client, keyPrefix: keyPrefix, replicaURL: replicaURL, ttl: ttl}
+}
+
+func (ro *redisExecutionOwners) key(id string) string {
+	return ro.keyPrefix + ":owner:" + id
+}
+
+// Claim implements ExecutionOwners
+func (ro *redisExecutionOwners) Claim(ctx context.Context, id string) error {
+	return ro.client.Set(ctx, ro.key(id), ro.replicaURL, ro.ttl).Err()
+}
+
+// Owner implements ExecutionOwners
+func (ro *redisExecutionOwners) Owner(ctx context.Context, id string) (string, error) {
+	owner, err := ro.client.Get(ctx, ro.key(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return owner, err
+}
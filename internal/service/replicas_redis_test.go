@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestExecutionOwnersAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	replica := func(replicaURL string) *WebhookService {
+		ws := newTestService(t, func(cfg *config.ExecutionConfig) { cfg.ReplicaURL = replicaURL })
+		ws.SetExecutionOwners(NewRedisExecutionOwners(client, "test", replicaURL, time.Hour))
+		return ws
+	}
+	a, b := replica("http://replica-a:8080"), replica("http://replica-b:8080")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	payloads, err := models.DecodePayloads(json.NewDecoder(strings.NewReader(`[{"a":1}]`)), 1000, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.ExecuteAsync(ctx, &models.ParallelExecuteRequest{WebhookURL: server.URL, Payloads: payloads, Timeout: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The claim is made with the first save, before the id is returned
+	if owner, err := b.ExecutionOwner(ctx, id); err != nil || owner != "http://replica-a:8080" {
+		t.Fatalf("ExecutionOwner() on another replica = %q, %v", owner, err)
+	}
+	if owner, err := a.ExecutionOwner(ctx, id); err != nil || owner != "" {
+		t.Fatalf("ExecutionOwner() on the owner = %q, %v, want it served locally", owner, err)
+	}
+	if owner, err := b.ExecutionOwner(ctx, "unknown"); err != nil || owner != "" {
+		t.Fatalf("ExecutionOwner() of an unknown execution = %q, %v", owner, err)
+	}
+	if ttl := mr.TTL("test:owner:" + id); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("claim expires after %s", ttl)
+	}
+}
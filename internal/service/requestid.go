@@ -0,0 +1,20 @@
+package service
+
+import "context"
+
+// HeaderRequestID carries the id of the API request an execution was started by
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the id of an API request. Executions started with it
+// log the id with every line and forward it to the webhook calls if requested.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id of the API request carried by ctx, empty if none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+// resolver resolves the host names of outbound connections, optionally through dedicated DNS
+// servers instead of the host resolver, e.g. for split-horizon DNS
+type resolver struct {
+	resolver      *net.Resolver
+	searchDomains []string
+}
+
+// newResolver creates the resolver of outbound connections from the DNS configuration
+func newResolver(cfg config.ExecutionConfig) *resolver {
+	r := &resolver{resolver: net.DefaultResolver, searchDomains: cfg.DNSSearchDomains}
+	if len(cfg.DNSServers) == 0 {
+		return r
+	}
+
+	servers := make([]string, len(cfg.DNSServers))
+	for i, server := range cfg.DNSServers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		servers[i] = server
+	}
+
+	// Queries go to the configured servers in order, the next one is tried if a server is unreachable
+	dialer := &net.Dialer{}
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var lastErr error
+			for _, server := range servers {
+				conn, err := dialer.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		},
+	}
+	return r
+}
+
+// qualify returns the first name of host expanded with the search domains which resolves.
+// Only single-label names are expanded, other names and IP addresses are returned as is.
+func (r *resolver) qualify(ctx context.Context, host string) string {
+	if len(r.searchDomains) == 0 || strings.Contains(host, ".") || strings.Contains(host, ":") {
+		return host
+	}
+	for _, domain := range r.searchDomains {
+		name := host + "." + strings.Trim(domain, ".")
+		if addrs, err := r.resolver.LookupNetIP(ctx, "ip", name); err == nil && len(addrs) > 0 {
+			return name
+		}
+	}
+	return host
+}
+
+// lookupNetIP resolves host, expanded with the search domains, to its addresses
+func (r *resolver) lookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return r.resolver.LookupNetIP(ctx, network, r.qualify(ctx, host))
+}
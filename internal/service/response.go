@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// acceptEncoding lists the content encodings decodeResponseBody understands
+const acceptEncoding = "gzip, deflate, br"
+
+// decodeResponseBody reads the response body, undoing any Content-Encoding and
+// converting the body to UTF-8 according to the charset of the Content-Type.
+// Bodies longer than limit bytes, before or after decompression, are cut off at limit and
+// reported as truncated; the rest isn't read. A limit of 0 reads the whole body.
+func decodeResponseBody(resp *http.Response, limit int64) ([]byte, bool, error) {
+	reader := io.Reader(resp.Body)
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	truncated := limit > 0 && int64(len(body)) > limit
+
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && len(body) > 0 {
+		if body, err = decompress(body, encoding, limit, truncated); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if limit > 0 && int64(len(body)) > limit {
+		body, truncated = body[:limit], true
+	}
+	return toUTF8(body, resp.Header.Get("Content-Type")), truncated, nil
+}
+
+// decompress undoes the encodings listed in a Content-Encoding header, last applied first.
+// Decoding stops after limit+1 bytes, so small bodies can't expand without bound; a limit of 0
+// decodes everything. A cut off body is decoded up to where it was cut.
+func decompress(body []byte, contentEncoding string, limit int64, cut bool) ([]byte, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var reader io.Reader
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			gr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("invalid gzip response body: %w", err)
+			}
+			reader = gr
+		case "deflate":
+			// deflate should be zlib wrapped, but some servers send raw deflate streams
+			if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+				reader = zr
+			} else {
+				reader = flate.NewReader(bytes.NewReader(body))
+			}
+		case "br":
+			reader = brotli.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+		}
+
+		if limit > 0 {
+			reader = io.LimitReader(reader, limit+1)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil && !cut {
+			return nil, fmt.Errorf("failed to decompress %s response body: %w", strings.TrimSpace(encodings[i]), err)
+		}
+		body = decoded
+	}
+
+	return body, nil
+}
+
+// toUTF8 converts a body in the charset declared by contentType to UTF-8.
+// Bytes which still aren't valid UTF-8 afterwards are replaced.
+func toUTF8(body []byte, contentType string) []byte {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset := strings.ToLower(params["charset"])
+		if charset != "" && charset != "utf-8" && charset != "utf8" && charset != "us-ascii" {
+			if enc, err := htmlindex.Get(charset); err == nil {
+				if decoded, err := enc.NewDecoder().Bytes(body); err == nil {
+					body = decoded
+				}
+			}
+		}
+	}
+
+	if !utf8.Valid(body) {
+		body = bytes.ToValidUTF8(body, []byte("\uFFFD"))
+	}
+
+	return body
+}
+
+// jsonSafe returns the body as is when it is valid JSON, otherwise as a JSON string,
+// so that non-JSON responses can be embedded into the execution response
+func jsonSafe(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+
+	quoted, _ := json.Marshal(string(body))
+	return json.RawMessage(quoted)
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// maxResultFilterLength limits the filter expressions of the results endpoint
+const maxResultFilterLength = 1024
+
+// resultFilter reports whether a result is selected by a filter expression
+type resultFilter func(result *models.WebhookResult) bool
+
+// resultFilterFields are the result fields filter expressions can compare, by JSON name
+var resultFilterFields = map[string]func(result *models.WebhookResult) interface{}{
+	"index":              func(r *models.WebhookResult) interface{} { return float64(r.Index) },
+	"status_code":        func(r *models.WebhookResult) interface{} { return float64(r.StatusCode) },
+	"duration_ms":        func(r *models.WebhookResult) interface{} { return float64(r.Duration) },
+	"attempts":           func(r *models.WebhookResult) interface{} { return float64(r.Attempts) },
+	"payload_bytes":      func(r *models.WebhookResult) interface{} { return float64(r.PayloadBytes) },
+	"success":            func(r *models.WebhookResult) interface{} { return r.Success },
+	"truncated":          func(r *models.WebhookResult) interface{} { return r.Truncated },
+	"compensated":        func(r *models.WebhookResult) interface{} { return r.Compensated },
+	"skipped":            func(r *models.WebhookResult) interface{} { return r.Skipped },
+	"error":              func(r *models.WebhookResult) interface{} { return r.Error },
+	"error_code":         func(r *models.WebhookResult) interface{} { return r.ErrorCode },
+	"sha256":             func(r *models.WebhookResult) interface{} { return r.Checksum },
+	"compensation_error": func(r *models.WebhookResult) interface{} { return r.CompensationError },
+}
+
+// compileResultFilter parses a filter expression such as
+// `status_code >= 500 && duration_ms > 1000`. Comparisons of a result field with a number,
+// a quoted string or true/false are combined with &&, || and !, grouped by parentheses; a
+// boolean field stands for itself, e.g. `!success`. Numbers support ==, !=, <, <=, > and >=,
+// strings and booleans == and !=.
+func compileResultFilter(expression string) (resultFilter, error) {
+	if len(expression) > maxResultFilterLength {
+		return nil, fmt.Errorf("%w: filter is longer than %d characters", ErrInvalidRequest, maxResultFilterLength)
+	}
+	tokens, err := lexResultFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	filter, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEnd {
+		return nil, p.unexpected()
+	}
+	return filter, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type filterToken struct {
+	kind  tokenKind
+	text  string
+	value interface{} // of numbers and strings
+	pos   int
+}
+
+// filterOperators are matched longest first
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func lexResultFilter(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expression[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unterminated string at position %d of the filter", ErrInvalidRequest, i+1)
+			}
+			text := expression[i : i+end+2]
+			tokens = append(tokens, filterToken{kind: tokenString, text: text, value: text[1 : len(text)-1], pos: i})
+			i += len(text)
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i++; i < len(expression) && (expression[i] == '.' || (expression[i] >= '0' && expression[i] <= '9')); i++ {
+			}
+			value, err := strconv.ParseFloat(expression[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid number %q at position %d of the filter", ErrInvalidRequest, expression[start:i], start+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: expression[start:i], value: value, pos: start})
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i++; i < len(expression) && (expression[i] == '_' || (expression[i] >= 'a' && expression[i] <= 'z') || (expression[i] >= 'A' && expression[i] <= 'Z') || (expression[i] >= '0' && expression[i] <= '9')); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, text: expression[start:i], pos: start})
+		default:
+			operator := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expression[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("%w: unexpected %q at position %d of the filter", ErrInvalidRequest, string(c), i+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: operator, pos: i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEnd, pos: len(expression)}), nil
+}
+
+// filterParser is a recursive descent parser of filter expressions, turning them into closures
+type filterParser struct {
+	tokens []filterToken
+	next   int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) take() filterToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEnd {
+		p.next++
+	}
+	return token
+}
+
+func (p *filterParser) accept(operator string) bool {
+	if token := p.peek(); token.kind == tokenOperator && token.text == operator {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) unexpected() error {
+	token := p.peek()
+	if token.kind == tokenEnd {
+		return fmt.Errorf("%w: unexpected end of the filter", ErrInvalidRequest)
+	}
+	return fmt.Errorf("%w: unexpected %q at position %d of the filter", ErrInvalidRequest, token.text, token.pos+1)
+}
+
+// or := and ("||" and)*
+func (p *filterParser) or() (resultFilter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r *models.WebhookResult) bool { return l(r) || right(r) }
+	}
+	return left, nil
+}
+
+// and := unary ("&&" unary)*
+func (p *filterParser) and() (resultFilter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r *models.WebhookResult) bool { return l(r) && right(r) }
+	}
+	return left, nil
+}
+
+// unary := "!" unary | "(" or ")" | comparison
+func (p *filterParser) unary() (resultFilter, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r *models.WebhookResult) bool { return !operand(r) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.unexpected()
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison := field (operator value)?, a field without comparison must be boolean
+func (p *filterParser) comparison() (resultFilter, error) {
+	token := p.peek()
+	if token.kind != tokenIdent {
+		return nil, p.unexpected()
+	}
+	p.take()
+	field, ok := resultFilterFields[token.text]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown result field %q in the filter", ErrInvalidRequest, token.text)
+	}
+	name := token.text
+
+	operator := p.peek()
+	switch operator.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if operator.kind != tokenOperator {
+			break
+		}
+		p.take()
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return compareResultField(name, field, operator.text, value)
+	}
+
+	if _, isBool := field(&models.WebhookResult{}).(bool); !isBool {
+		return nil, fmt.Errorf("%w: %s must be compared with a value in the filter", ErrInvalidRequest, name)
+	}
+	return func(r *models.WebhookResult) bool { return field(r).(bool) }, nil
+}
+
+// value := number | string | "true" | "false"
+func (p *filterParser) value() (interface{}, error) {
+	token := p.peek()
+	switch {
+	case token.kind == tokenNumber || token.kind == tokenString:
+		p.take()
+		return token.value, nil
+	case token.kind == tokenIdent && (token.text == "true" || token.text == "false"):
+		p.take()
+		return token.text == "true", nil
+	}
+	return nil, p.unexpected()
+}
+
+// compareResultField checks that the value has the type of the field and that the operator
+// applies to it
+func compareResultField(name string, field func(*models.WebhookResult) interface{}, operator string, value interface{}) (resultFilter, error) {
+	switch zero := field(&models.WebhookResult{}); zero.(type) {
+	case float64:
+		want, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be compared with a number in the filter", ErrInvalidRequest, name)
+		}
+		return func(r *models.WebhookResult) bool {
+			got := field(r).(float64)
+			switch operator {
+			case "==":
+				return got == want
+			case "!=":
+				return got != want
+			case "<":
+				return got < want
+			case "<=":
+				return got <= want
+			case ">":
+				return got > want
+			default:
+				return got >= want
+			}
+		}, nil
+	default:
+		if fmt.Sprintf("%T", zero) != fmt.Sprintf("%T", value) {
+			return nil, fmt.Errorf("%w: %s must be compared with a %T in the filter", ErrInvalidRequest, name, zero)
+		}
+		if operator != "==" && operator != "!=" {
+			return nil, fmt.Errorf("%w: %s can only be compared with == or != in the filter", ErrInvalidRequest, name)
+		}
+		return func(r *models.WebhookResult) bool {
+			return (field(r) == value) == (operator == "==")
+		}, nil
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestCompileResultFilter(t *testing.T) {
+	results := []models.WebhookResult{
+		{Index: 0, Success: true, StatusCode: 200, Duration: 120},
+		{Index: 1, StatusCode: 500, Duration: 1500, Error: "webhook returned status 500", ErrorCode: "http_error"},
+		{Index: 2, StatusCode: 503, Duration: 300, ErrorCode: "http_error", Attempts: 3},
+		{Index: 3, Duration: 10000, ErrorCode: "timeout"},
+		{Index: 4, Skipped: true},
+	}
+	tests := []struct {
+		filter string
+		want   []int
+	}{
+		{"status_code >= 500 && duration_ms > 1000", []int{1}},
+		{"status_code >= 500 || error_code == 'timeout'", []int{1, 2, 3}},
+		{"!success && !skipped", []int{1, 2, 3}},
+		{"success == false && (status_code == 503 || duration_ms >= 10000)", []int{2, 3}},
+		{`error_code != "http_error" && index < 4`, []int{0, 3}},
+		{"attempts > 1", []int{2}},
+		{"skipped", []int{4}},
+		{"!(index <= 2)", []int{3, 4}},
+	}
+	for _, test := range tests {
+		filter, err := compileResultFilter(test.filter)
+		if err != nil {
+			t.Fatalf("compileResultFilter(%q) = %v", test.filter, err)
+		}
+		got := []int{}
+		for i := range results {
+			if filter(&results[i]) {
+				got = append(got, results[i].Index)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q selected %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestCompileResultFilterRejectsInvalidExpressions(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"status_code >=",
+		"status_code >= 500 &&",
+		"(success",
+		"success)",
+		"latency > 5",
+		"status_code",
+		"status_code == '500'",
+		"error_code > 'a'",
+		"success == 1",
+		"error == 'unterminated",
+		"status_code = 500",
+		"1.2.3 == index",
+	} {
+		if _, err := compileResultFilter(filter); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("compileResultFilter(%q) = %v, want ErrInvalidRequest", filter, err)
+		}
+	}
+}
+
+func TestExecutionResultsFilter(t *testing.T) {
+	ctx := context.Background()
+	ws := newTestService(t, nil)
+	record := &models.ExecutionRecord{
+		ExecutionID: "exec-1",
+		Status:      StateCompleted,
+		FinishedAt:  time.Now().UTC().Format(time.RFC3339),
+		Results: []models.WebhookResult{
+			{Index: 0, Success: true, StatusCode: 200, Duration: 1200},
+			{Index: 1, StatusCode: 500, Duration: 1500},
+			{Index: 2, StatusCode: 502, Duration: 200},
+		},
+	}
+	if err := ws.store.Save(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ws.ExecutionResults(ctx, "exec-1", "failed", "duration_ms > 1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 1 || got.Results[0].Index != 1 {
+		t.Fatalf("results %+v, want index 1", got.Results)
+	}
+	if _, err := ws.ExecutionResults(ctx, "exec-1", "", "duration_ms >"); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("ExecutionResults() with an invalid filter = %v, want ErrInvalidRequest", err)
+	}
+}
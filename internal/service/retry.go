@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// Defaults and bounds of the retry backoff
+const (
+	defaultBackoffInitialMs  = 500
+	defaultBackoffMultiplier = 2
+	maxBackoff               = time.Minute
+)
+
+// retryPolicy describes how often and how fast failed tasks are retried
+type retryPolicy struct {
+	maxRetries int
+	initial    time.Duration
+	multiplier float64
+	random     Randomness
+}
+
+// retryPolicy returns the retry policy of a request after defaults were applied
+func (ws *WebhookService) retryPolicy(request *models.ParallelExecuteRequest) retryPolicy {
+	policy := retryPolicy{
+		maxRetries: request.MaxRetries,
+		initial:    time.Duration(request.BackoffInitialMs) * time.Millisecond,
+		multiplier: request.BackoffMultiplier,
+		random:     ws.random,
+	}
+	if request.BackoffInitialMs == 0 {
+		policy.initial = defaultBackoffInitialMs * time.Millisecond
+	}
+	if policy.multiplier == 0 {
+		policy.multiplier = defaultBackoffMultiplier
+	}
+	return policy
+}
+
+// backoff returns the delay before the given retry, starting at 1. Half of the delay is
+// randomized, so tasks failing together don't retry in lockstep.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	delay := float64(p.initial) * math.Pow(p.multiplier, float64(retry-1))
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	half := time.Duration(delay / 2)
+	if half <= 0 {
+		return 0
+	}
+	return half + time.Duration(p.random.Int64N(int64(half)))
+}
+
+// retryableStatus reports whether a response status indicates a transient failure
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d on the clock of the service, it returns early with the error of the
+// context if it is done
+func (ws *WebhookService) sleep(ctx context.Context, d time.Duration) error {
+	timer := ws.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given in seconds or as HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   string
+		maxRetries   int
+		timeout      int
+		wantAttempts int
+		wantSuccess  bool
+		wantWaited   time.Duration // on the fake clock
+		wantTimeout  bool          // the Retry-After exceeding the timeout is named in the error
+	}{
+		{"counts against max_retries", "10", 0, 30, 1, false, 0, false},
+		{"waits as requested", "10", 2, 30, 3, true, 20 * time.Second, false},
+		{"exceeding the timeout", "120", 3, 30, 1, false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= 2 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(`{}`))
+			}))
+			defer target.Close()
+
+			clock := newFakeClock()
+			ws := newTestService(t, nil)
+			ws.SetClock(clock, SystemRandomness)
+			start := clock.Now()
+
+			done := make(chan struct{})
+			go clock.runTimers(done)
+			response, err := ws.ExecuteParallel(context.Background(), &models.ParallelExecuteRequest{
+				WebhookURL: target.URL,
+				Payloads:   models.NewPayloads(json.RawMessage(`{}`)),
+				Timeout:    tt.timeout,
+				MaxRetries: tt.maxRetries,
+			})
+			close(done)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := response.Results[0]
+			if result.Attempts != tt.wantAttempts || result.Success != tt.wantSuccess {
+				t.Fatalf("result = %d attempts, success %v (%s), want %d attempts, success %v",
+					result.Attempts, result.Success, result.Error, tt.wantAttempts, tt.wantSuccess)
+			}
+			if waited := clock.Now().Sub(start); waited != tt.wantWaited {
+				t.Errorf("waited %v, want %v", waited, tt.wantWaited)
+			}
+			if tt.wantTimeout && !strings.Contains(result.Error, "retry after 2m0s exceeds the timeout") {
+				t.Errorf("error = %q, want the timeout to be named", result.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// secretBox encrypts data kept outside of the process with AES-256-GCM, so Redis and database
+// backups don't expose the credentials of executions
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox returns nil without a key. The key of the cipher is the SHA-256 of key.
+func newSecretBox(key string) *secretBox {
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:]) // only fails for invalid key sizes
+	aead, _ := cipher.NewGCM(block)
+	return &secretBox{aead: aead}
+}
+
+// seal encrypts data, the random nonce is prepended to the result
+func (b *secretBox) seal(data []byte) []byte {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(data)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("failed to generate nonce: " + err.Error())
+	}
+	return b.aead.Seal(nonce, nonce, data, nil)
+}
+
+// open decrypts data sealed with the same key
+func (b *secretBox) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < b.aead.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, data := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	data, err := b.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt sealed data, check STORAGE_ENCRYPTION_KEY")
+	}
+	return data, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// rateShaper paces task dispatching, allowing different rates depending on the time of day
+type rateShaper struct {
+	location   *time.Location
+	defaultRPS float64
+	windows    []rateWindow
+	next       time.Time
+	clock      Clock
+}
+
+// rateWindow is a daily time window with its own rate, start and end are minutes since midnight
+type rateWindow struct {
+	start int
+	end   int
+	rps   float64
+}
+
+// newRateShaper creates a rate shaper from the rate schedule of a request
+func newRateShaper(schedule *models.RateSchedule, clock Clock) (*rateShaper, error) {
+	location := time.UTC
+	if schedule.Timezone != "" {
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid rate_schedule timezone %q", ErrInvalidRequest, schedule.Timezone)
+		}
+		location = loc
+	}
+
+	shaper := &rateShaper{
+		location:   location,
+		defaultRPS: schedule.DefaultRPS,
+		clock:      clock,
+	}
+
+	for i, w := range schedule.Windows {
+		start, err := parseTimeOfDay(w.Start)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid rate_schedule.windows[%d].start: %v", ErrInvalidRequest, i, err)
+		}
+		end, err := parseTimeOfDay(w.End)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid rate_schedule.windows[%d].end: %v", ErrInvalidRequest, i, err)
+		}
+		shaper.windows = append(shaper.windows, rateWindow{start: start, end: end, rps: w.RPS})
+	}
+
+	return shaper, nil
+}
+
+// Wait blocks until the next task may be dispatched according to the current rate.
+// It is meant to be called from a single dispatching goroutine.
+func (rs *rateShaper) Wait(ctx context.Context) error {
+	now := rs.clock.Now()
+	rps := rs.currentRPS(now)
+	if rps <= 0 {
+		return nil // unlimited
+	}
+
+	if now.Before(rs.next) {
+		timer := rs.clock.NewTimer(rs.next.Sub(now))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+		now = rs.next
+	}
+
+	rs.next = now.Add(time.Duration(float64(time.Second) / rps))
+	return nil
+}
+
+// currentRPS returns the rate of the first window containing t, or the default rate
+func (rs *rateShaper) currentRPS(t time.Time) float64 {
+	local := t.In(rs.location)
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, w := range rs.windows {
+		if w.contains(minute) {
+			return w.rps
+		}
+	}
+
+	return rs.defaultRPS
+}
+
+// contains reports whether the minute of day falls into the window, windows may wrap around midnight
+func (w rateWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// parseTimeOfDay parses "HH:MM" into minutes since midnight
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in HH:MM format", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
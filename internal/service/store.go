@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// ExecutionStore keeps the state and results of asynchronous executions
+type ExecutionStore interface {
+	// Save creates or replaces the record of an execution
+	Save(ctx context.Context, record *models.ExecutionRecord) error
+	// Get returns the record of an execution, ErrExecutionNotFound if there is none
+	Get(ctx context.Context, id string) (*models.ExecutionRecord, error)
+	// Search returns the executions with error messages containing all terms of query, newest first
+	Search(ctx context.Context, query string, limit int) ([]models.ExecutionMatch, error)
+	// List returns the executions matching filter without their results, newest first
+	List(ctx context.Context, filter models.ExecutionFilter) ([]models.ExecutionListItem, error)
+	// Stats describes the stored executions and the ones purged by the retention policy
+	Stats(ctx context.Context) (*models.ExecutionStoreStats, error)
+}
+
+// PayloadRecorder is implemented by execution stores writing the payloads of an execution item
+// by item, so spooled payloads are recorded without being read into memory at once
+type PayloadRecorder interface {
+	// SavePayloads stores the payloads of an execution in index order
+	SavePayloads(ctx context.Context, id string, payloads *models.Payloads) error
+}
+
+// maxMatchErrors is the number of distinct error messages reported per matching execution
+const maxMatchErrors = 5
+
+// memoryExecutionStore is an ExecutionStore which only holds within the current process.
+// Records of finished executions are dropped after the retention period.
+type memoryExecutionStore struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	clock     Clock
+	records   map[string]*storedExecution
+	purged    models.ExecutionStoreStats // executions dropped after the retention period
+}
+
+// storedExecution is a record with the index of its error messages
+type storedExecution struct {
+	record *models.ExecutionRecord
+	errors []indexedError
+}
+
+// indexedError is a distinct error message of an execution
+type indexedError struct {
+	message string
+	lower   string
+	count   int // failed results with the message, 0 for the error of the execution itself
+}
+
+// newStoredExecution indexes the error messages of a record
+func newStoredExecution(record *models.ExecutionRecord) *storedExecution {
+	stored := &storedExecution{record: record}
+	positions := make(map[string]int)
+	add := func(message string, count int) {
+		if message == "" {
+			return
+		}
+		if i, ok := positions[message]; ok {
+			stored.errors[i].count += count
+			return
+		}
+		positions[message] = len(stored.errors)
+		stored.errors = append(stored.errors, indexedError{message: message, lower: strings.ToLower(message), count: count})
+	}
+
+	add(record.Error, 0)
+	for _, result := range record.Results {
+		add(result.Error, 1)
+		add(result.CompensationError, 1)
+	}
+	return stored
+}
+
+// NewMemoryExecutionStore creates an in-process execution store
+func NewMemoryExecutionStore(retention time.Duration) ExecutionStore {
+	return &memoryExecutionStore{
+		retention: retention,
+		clock:     SystemClock,
+		records:   make(map[string]*storedExecution),
+	}
+}
+
+// Save implements ExecutionStore. The record is copied, callers may go on changing theirs.
+func (s *memoryExecutionStore) Save(_ context.Context, record *models.ExecutionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *record
+	record = &copied
+	stored := newStoredExecution(record)
+	s.records[record.ExecutionID] = stored
+	if record.Status != StateRunning {
+		s.clock.AfterFunc(s.retention, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.records[record.ExecutionID] == stored {
+				delete(s.records, record.ExecutionID)
+				s.purged.PurgedExecutions++
+				s.purged.PurgedResults += int64(len(record.Results))
+				s.purged.PurgedPayloads += int64(len(record.Payloads))
+				s.purged.LastCleanupAt = s.clock.Now().UTC().Format(time.RFC3339)
+			}
+		})
+	}
+	return nil
+}
+
+// Get implements ExecutionStore
+func (s *memoryExecutionStore) Get(_ context.Context, id string) (*models.ExecutionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.records[id]
+	if !ok {
+		return nil, ErrExecutionNotFound
+	}
+	copied := *stored.record
+	return &copied, nil
+}
+
+// Search implements ExecutionStore
+func (s *memoryExecutionStore) Search(_ context.Context, query string, limit int) ([]models.ExecutionMatch, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return []models.ExecutionMatch{}, nil
+	}
+
+	s.mu.RLock()
+	matches := []models.ExecutionMatch{}
+	for _, stored := range s.records {
+		var match *models.ExecutionMatch
+		for _, e := range stored.errors {
+			if !containsAll(e.lower, terms) {
+				continue
+			}
+			if match == nil {
+				match = &models.ExecutionMatch{
+					ExecutionID: stored.record.ExecutionID,
+					Status:      stored.record.Status,
+					WebhookURL:  stored.record.WebhookURL,
+					CreatedAt:   stored.record.CreatedAt,
+					FinishedAt:  stored.record.FinishedAt,
+				}
+			}
+			match.MatchingResults += e.count
+			if len(match.Errors) < maxMatchErrors {
+				match.Errors = append(match.Errors, e.message)
+			}
+		}
+		if match != nil {
+			matches = append(matches, *match)
+		}
+	}
+	s.mu.RUnlock()
+
+	// RFC 3339 timestamps in UTC sort chronologically
+	sort.Slice(matches, func(i, j int) bool { return matches[i].CreatedAt > matches[j].CreatedAt })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// List implements ExecutionStore
+func (s *memoryExecutionStore) List(_ context.Context, filter models.ExecutionFilter) ([]models.ExecutionListItem, error) {
+	s.mu.RLock()
+	items := []models.ExecutionListItem{}
+	for _, stored := range s.records {
+		if record := stored.record; matchesFilter(record, filter) {
+			items = append(items, listItem(record))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool { return listedBefore(items[i], items[j]) })
+	if len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	return items, nil
+}
+
+// Stats implements ExecutionStore
+func (s *memoryExecutionStore) Stats(_ context.Context) (*models.ExecutionStoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.purged
+	stats.Backend = "memory"
+	stats.Executions = len(s.records)
+	stats.RetentionSeconds = int64(s.retention / time.Second)
+	return &stats, nil
+}
+
+// matchesFilter reports whether a record is selected by filter
+func matchesFilter(record *models.ExecutionRecord, filter models.ExecutionFilter) bool {
+	switch {
+	case filter.Status != "" && record.Status != filter.Status,
+		filter.Mode != "" && record.Mode != filter.Mode,
+		filter.ConcurrencyGroup != "" && record.ConcurrencyGroup != filter.ConcurrencyGroup,
+		filter.WebhookURL != "" && record.WebhookURL != filter.WebhookURL,
+		filter.From != "" && record.CreatedAt < filter.From,
+		filter.To != "" && record.CreatedAt >= filter.To:
+		return false
+	}
+	// Only executions listed after the last one of the previous page
+	if filter.BeforeID != "" {
+		return record.CreatedAt < filter.BeforeCreatedAt ||
+			(record.CreatedAt == filter.BeforeCreatedAt && record.ExecutionID < filter.BeforeID)
+	}
+	return true
+}
+
+// listedBefore orders the history newest first, executions created in the same second by id
+func listedBefore(a, b models.ExecutionListItem) bool {
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt > b.CreatedAt
+	}
+	return a.ExecutionID > b.ExecutionID
+}
+
+// listItem is the history entry of a record
+func listItem(record *models.ExecutionRecord) models.ExecutionListItem {
+	return models.ExecutionListItem{
+		ExecutionID:       record.ExecutionID,
+		Status:            record.Status,
+		Mode:              record.Mode,
+		WebhookURL:        record.WebhookURL,
+		ConcurrencyGroup:  record.ConcurrencyGroup,
+		TotalRequests:     record.TotalRequests,
+		CompletedRequests: record.CompletedRequests,
+		CreatedAt:         record.CreatedAt,
+		FinishedAt:        record.FinishedAt,
+		Error:             record.Error,
+		Summary:           record.Summary,
+	}
+}
+
+// containsAll reports whether text contains every term
+func containsAll(text string, terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// ExecutionArchive is implemented by execution stores moving old executions to cold storage
+type ExecutionArchive interface {
+	// Restore moves an archived execution back into the store and returns its record,
+	// ErrExecutionNotFound if it isn't archived
+	Restore(ctx context.Context, id string) (*models.ExecutionRecord, error)
+}
+
+// archiveFileSuffix is the extension of archived executions, gzip compressed JSON
+const archiveFileSuffix = ".json.gz"
+
+// archivedExecution is the content of an archive file. The event log isn't part of the JSON
+// encoding of records, it is kept next to them.
+type archivedExecution struct {
+	Record *models.ExecutionRecord `json:"record"`
+	Events []models.JobEvent       `json:"events,omitempty"`
+}
+
+// archive moves the finished executions older than the archive period to the archive directory.
+// Their rows are kept as soft-deleted stubs, so they are still listed, while their results,
+// payloads and events are deleted from the database. Executions which fail to archive are
+// skipped until the next pass, the error of the first one is returned.
+func (s *sqliteExecutionStore) archive(ctx context.Context) (int64, error) {
+	if s.archiveDir == "" {
+		return 0, nil
+	}
+
+	// Restored executions are only archived again after another archive period
+	cutoff := s.clock.Now().Add(-s.archiveAfter).UTC().Format(time.RFC3339)
+	var archived, failed int64
+	var firstErr error
+	var after archiveCursor
+	for {
+		batch, err := s.archivable(ctx, cutoff, after)
+		if err != nil {
+			return archived, errors.Join(firstErr, err)
+		}
+		for _, next := range batch {
+			after = next
+			if err := s.archiveExecution(ctx, next.id); err != nil {
+				s.logger.Warn("Failed to archive execution", "execution_id", next.id, "error", err)
+				if failed++; firstErr == nil {
+					firstErr = fmt.Errorf("archive execution %s: %w", next.id, err)
+				}
+				continue
+			}
+			archived++
+		}
+		if len(batch) < sqliteCleanupBatch {
+			if failed > 1 {
+				firstErr = fmt.Errorf("%w (and %d more failed executions)", firstErr, failed-1)
+			}
+			return archived, firstErr
+		}
+	}
+}
+
+// archiveCursor is the position of the last execution a pass of archive went through
+type archiveCursor struct {
+	finishedAt string
+	id         string
+}
+
+// archivable returns the next batch of executions to archive after the cursor, oldest first
+func (s *sqliteExecutionStore) archivable(ctx context.Context, cutoff string, after archiveCursor) ([]archiveCursor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT finished_at, id FROM executions
+		WHERE archived_at = '' AND finished_at != '' AND finished_at < ? AND restored_at < ?
+			AND (finished_at, id) > (?, ?)
+		ORDER BY finished_at, id LIMIT ?`, cutoff, cutoff, after.finishedAt, after.id, sqliteCleanupBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []archiveCursor
+	for rows.Next() {
+		var next archiveCursor
+		if err := rows.Scan(&next.finishedAt, &next.id); err != nil {
+			return nil, err
+		}
+		batch = append(batch, next)
+	}
+	return batch, rows.Err()
+}
+
+// queryIDs returns the ids selected by query
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// archiveExecution writes the record of an execution to its archive file, then soft-deletes it.
+// The file is complete before the database changes, a failed pass is repeated by the next one.
+func (s *sqliteExecutionStore) archiveExecution(ctx context.Context, id string) error {
+	record, err := s.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveFile(s.archivePath(id), record); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM execution_results WHERE execution_id = ?`,
+		`DELETE FROM execution_payloads WHERE execution_id = ?`,
+		`DELETE FROM execution_events WHERE execution_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE executions SET archived_at = ? WHERE id = ?`,
+		s.clock.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore implements ExecutionArchive. The archive file is kept, it is replaced when the
+// execution is archived again. Executions purged by the retention period are gone for good,
+// their archive file is deleted with them.
+func (s *sqliteExecutionStore) Restore(ctx context.Context, id string) (*models.ExecutionRecord, error) {
+	if s.archiveDir == "" {
+		return nil, fmt.Errorf("%w: executions aren't archived, see EXECUTION_ARCHIVE_DIR", ErrInvalidRequest)
+	}
+	// Ids are generated by the server, anything else can't name an archive file
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrExecutionNotFound
+	}
+
+	var archivedAt string
+	err := s.db.QueryRowContext(ctx, `SELECT archived_at FROM executions WHERE id = ?`, id).Scan(&archivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if archivedAt == "" {
+		return nil, fmt.Errorf("%w: execution %s isn't archived", ErrJobStateConflict, id)
+	}
+
+	record, err := readArchiveFile(s.archivePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived execution: %w", err)
+	}
+
+	// Saving replaces the stub, which clears archived_at
+	if err := s.Save(ctx, record); err != nil {
+		return nil, err
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE executions SET restored_at = ? WHERE id = ?`,
+		s.clock.Now().UTC().Format(time.RFC3339), id); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// archivePath returns the archive file of an execution
+func (s *sqliteExecutionStore) archivePath(id string) string {
+	return filepath.Join(s.archiveDir, id+archiveFileSuffix)
+}
+
+// writeArchiveFile writes a record compressed to path. It is written to a temporary file first,
+// so a crash never leaves a truncated archive behind.
+func writeArchiveFile(path string, record *models.ExecutionRecord) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // fails once renamed
+
+	zw := gzip.NewWriter(file)
+	if err := json.NewEncoder(zw).Encode(archivedExecution{Record: record, Events: record.Events}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// readArchiveFile reads a record written by writeArchiveFile
+func readArchiveFile(path string) (*models.ExecutionRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var archived archivedExecution
+	if err := json.NewDecoder(zr).Decode(&archived); err != nil {
+		return nil, err
+	}
+	if archived.Record == nil {
+		return nil, errors.New("archive file has no record")
+	}
+	archived.Record.Events = archived.Events
+	return archived.Record, nil
+}
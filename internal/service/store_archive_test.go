@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// newTestArchiveStore opens a SQLite store archiving after a day and purging after three, timed
+// by clock. The janitor doesn't run, tests call cleanup.
+func newTestArchiveStore(t *testing.T, clock Clock) *sqliteExecutionStore {
+	t.Helper()
+	store, err := NewSQLiteExecutionStore(filepath.Join(t.TempDir(), "executions.db"), 0, 0, time.Hour, "", 0, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.(*sqliteExecutionStore)
+	t.Cleanup(func() { s.db.Close() })
+	s.archiveDir = t.TempDir()
+	s.archiveAfter = 24 * time.Hour
+	s.retention = 72 * time.Hour
+	s.clock = clock
+	return s
+}
+
+func TestArchiveSkipsFailingExecutionsAndPurgesArchives(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	s := newTestArchiveStore(t, clock)
+
+	finishedAt := clock.Now().UTC().Format(time.RFC3339)
+	for _, id := range []string{"broken", "restored", "purged"} {
+		if err := s.Save(ctx, &models.ExecutionRecord{
+			ExecutionID: id,
+			Status:      StateCompleted,
+			WebhookURL:  "https://example.com/hook",
+			CreatedAt:   finishedAt,
+			FinishedAt:  finishedAt,
+			Results:     []models.WebhookResult{{Index: 0, Success: true}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A directory in place of its archive file can't be replaced, archiving the execution fails
+	if err := os.MkdirAll(filepath.Join(s.archivePath("broken"), "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(48 * time.Hour)
+	s.cleanup(ctx)
+	if s.stats.ArchivedExecutions != 2 || s.stats.LastCleanupError == "" {
+		t.Fatalf("stats %+v, want 2 archived executions and the failure reported", s.stats)
+	}
+	if _, err := s.Get(ctx, "broken"); err != nil {
+		t.Fatalf("execution failing to archive: %v, want it kept in the database", err)
+	}
+	if _, err := s.Get(ctx, "purged"); !errors.Is(err, ErrExecutionArchived) {
+		t.Fatalf("archived execution: %v, want ErrExecutionArchived", err)
+	}
+	record, err := s.Restore(ctx, "restored")
+	if err != nil || len(record.Results) != 1 {
+		t.Fatalf("Restore() = %+v, %v, want the record with its result", record, err)
+	}
+
+	// The retention period passes for all but the restored execution, the failing one doesn't hold it up
+	clock.Advance(48 * time.Hour)
+	s.cleanup(ctx)
+	if s.stats.PurgedExecutions != 2 {
+		t.Fatalf("stats %+v, want 2 purged executions", s.stats)
+	}
+	if _, err := os.Stat(s.archivePath("purged")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("archive file of purged execution: %v, want it deleted", err)
+	}
+	if _, err := s.Restore(ctx, "purged"); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("Restore() of purged execution = %v, want ErrExecutionNotFound", err)
+	}
+	// The restored execution was archived again, but is kept for another retention period
+	if _, err := s.Restore(ctx, "restored"); err != nil {
+		t.Fatalf("Restore() of restored execution = %v, want it kept", err)
+	}
+}
+
+func TestSizeLimitKeepsArchivedExecutions(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	s := newTestArchiveStore(t, clock)
+	save := func(id string) {
+		t.Helper()
+		finishedAt := clock.Now().UTC().Format(time.RFC3339)
+		if err := s.Save(ctx, &models.ExecutionRecord{
+			ExecutionID: id,
+			Status:      StateCompleted,
+			WebhookURL:  "https://example.com/hook",
+			CreatedAt:   finishedAt,
+			FinishedAt:  finishedAt,
+			Results:     []models.WebhookResult{{Index: 0, Success: true}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("archived")
+	clock.Advance(48 * time.Hour)
+	s.cleanup(ctx)
+	save("hot")
+
+	// Both exceed the limit, only the execution which isn't archived is purged
+	s.maxSize = 1
+	purged, err := s.purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged.executions != 1 {
+		t.Fatalf("purged %d executions, want 1", purged.executions)
+	}
+	if _, err := s.Get(ctx, "hot"); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("execution which isn't archived: %v, want it purged", err)
+	}
+	if _, err := os.Stat(s.archivePath("archived")); err != nil {
+		t.Fatalf("archive file: %v, want it kept", err)
+	}
+	if _, err := s.Restore(ctx, "archived"); err != nil {
+		t.Fatalf("Restore() = %v", err)
+	}
+}
+
+func TestRetentionTimesRecordsWithTheServiceClock(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+
+	ctx := context.Background()
+	store, err := NewSQLiteExecutionStore(filepath.Join(t.TempDir(), "executions.db"), 0, 0, time.Hour, "", 0, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.(*sqliteExecutionStore)
+	t.Cleanup(func() { s.db.Close() })
+	s.retention = 72 * time.Hour
+
+	cfg := config.Load().Execution
+	cfg.BlockPrivateTargets = false
+	cfg.ExecutionStore = "sqlite"
+	cfg.FastPathMaxItems = 0 // recorded before the response, not in the background
+	ws := NewWebhookService(cfg, NewLocalGroupSemaphore(cfg.ConcurrencyGroupLimit, cfg.ConcurrencyGroupLimits), store, nil, testLogger)
+	clock := newFakeClock()
+	ws.SetClock(clock, SystemRandomness)
+
+	response, err := ws.ExecuteParallel(ctx, &models.ParallelExecuteRequest{
+		WebhookURL: target.URL,
+		Payloads:   models.NewPayloads(json.RawMessage(`{}`)),
+		Timeout:    30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := s.Get(ctx, response.ExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := clock.Now().UTC().Format(time.RFC3339)
+	if record.CreatedAt != now || record.FinishedAt != now {
+		t.Fatalf("record created at %s and finished at %s, want %s of the service clock", record.CreatedAt, record.FinishedAt, now)
+	}
+
+	clock.Advance(73 * time.Hour)
+	s.cleanup(ctx)
+	if _, err := s.Get(ctx, response.ExecutionID); !errors.Is(err, ErrExecutionNotFound) {
+		t.Fatalf("execution past the retention period: %v, want it purged", err)
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SaveCallback implements CallbackOutbox
+func (s *sqliteExecutionStore) SaveCallback(ctx context.Context, delivery *CallbackDelivery) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR REPLACE INTO callback_deliveries
+		(id, execution_id, url, auth_header, secret, body, result_signature, attempts, last_error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.ID, delivery.ExecutionID, delivery.URL, delivery.AuthHeader, delivery.Secret, delivery.Body,
+		delivery.ResultSignature, delivery.Attempts, delivery.LastError, delivery.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// DeleteCallback implements CallbackOutbox
+func (s *sqliteExecutionStore) DeleteCallback(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM callback_deliveries WHERE id = ?`, id)
+	return err
+}
+
+// PendingCallbacks implements CallbackOutbox
+func (s *sqliteExecutionStore) PendingCallbacks(ctx context.Context) ([]CallbackDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, execution_id, url, auth_header, secret, body, result_signature,
+		attempts, last_error, created_at FROM callback_deliveries ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []CallbackDelivery
+	for rows.Next() {
+		var delivery CallbackDelivery
+		var createdAt string
+		if err := rows.Scan(&delivery.ID, &delivery.ExecutionID, &delivery.URL, &delivery.AuthHeader, &delivery.Secret,
+			&delivery.Body, &delivery.ResultSignature, &delivery.Attempts, &delivery.LastError, &createdAt); err != nil {
+			return nil, err
+		}
+		if delivery.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, fmt.Errorf("invalid stored callback time: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
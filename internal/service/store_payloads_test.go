@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestSpooledPayloadsAreWrittenToTheStoreItemByItem(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Load().Execution
+	cfg.ExecutionStore = "sqlite"
+	cfg.ExecutionStorePayloads = true
+	store, err := NewSQLiteExecutionStore(filepath.Join(t.TempDir(), "executions.db"), 0, 0, time.Hour, "", 0, testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.(*sqliteExecutionStore).db.Close() })
+	ws := NewWebhookService(cfg, NewLocalGroupSemaphore(cfg.ConcurrencyGroupLimit, cfg.ConcurrencyGroupLimits), store, nil, testLogger)
+
+	payloads, err := models.DecodePayloads(json.NewDecoder(strings.NewReader(`[{"a":1},{"a":2},{"a":3}]`)), 1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer payloads.Close()
+	if !payloads.Spooled() {
+		t.Fatal("payloads weren't spooled")
+	}
+	exec := newExecution("exec-1", &models.ParallelExecuteRequest{WebhookURL: "https://example.com/hook", Payloads: payloads}, SystemClock, testLogger)
+
+	record := ws.newRecord(exec, "async", time.Now())
+	if record.Payloads != nil {
+		t.Fatalf("payloads copied into the record: %s", record.Payloads)
+	}
+	if err := store.Save(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	ws.storePayloads(ctx, exec, "async")
+
+	stored, err := store.Get(ctx, "exec-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Payloads) != 3 || string(stored.Payloads[2]) != `{"a":3}` {
+		t.Fatalf("stored payloads %s", stored.Payloads)
+	}
+}
@@ -0,0 +1,728 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// Pure Go driver, the server is built without cgo
+	_ "modernc.org/sqlite"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// sqliteSchema creates the tables of the sqlite execution store. Results and payloads are kept
+// as JSON, their error messages are columns of their own so that they can be searched.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS executions (
+	id                 TEXT PRIMARY KEY,
+	status             TEXT NOT NULL,
+	mode               TEXT NOT NULL DEFAULT '',
+	webhook_url        TEXT NOT NULL,
+	concurrency_group  TEXT NOT NULL DEFAULT '',
+	callback_url       TEXT NOT NULL DEFAULT '',
+	follow_up_id       TEXT NOT NULL DEFAULT '',
+	total_requests     INTEGER NOT NULL,
+	completed_requests INTEGER NOT NULL,
+	created_at         TEXT NOT NULL,
+	finished_at        TEXT NOT NULL DEFAULT '',
+	error              TEXT NOT NULL DEFAULT '',
+	summary            TEXT,
+	options            TEXT
+);
+CREATE INDEX IF NOT EXISTS executions_created_at ON executions (created_at);
+CREATE INDEX IF NOT EXISTS executions_finished_at ON executions (finished_at);
+CREATE INDEX IF NOT EXISTS executions_status ON executions (status, created_at);
+
+CREATE TABLE IF NOT EXISTS execution_results (
+	execution_id       TEXT NOT NULL,
+	idx                INTEGER NOT NULL,
+	success            INTEGER NOT NULL,
+	error_code         TEXT NOT NULL DEFAULT '',
+	error              TEXT NOT NULL DEFAULT '',
+	compensation_error TEXT NOT NULL DEFAULT '',
+	result             TEXT NOT NULL,
+	PRIMARY KEY (execution_id, idx)
+);
+
+CREATE TABLE IF NOT EXISTS execution_payloads (
+	execution_id TEXT NOT NULL,
+	idx          INTEGER NOT NULL,
+	payload      TEXT NOT NULL,
+	PRIMARY KEY (execution_id, idx)
+);
+
+CREATE TABLE IF NOT EXISTS execution_events (
+	execution_id TEXT NOT NULL,
+	seq          INTEGER NOT NULL,
+	event        TEXT NOT NULL,
+	PRIMARY KEY (execution_id, seq)
+);
+
+CREATE TABLE IF NOT EXISTS callback_deliveries (
+	id               TEXT PRIMARY KEY,
+	execution_id     TEXT NOT NULL,
+	url              TEXT NOT NULL,
+	auth_header      TEXT NOT NULL DEFAULT '',
+	secret           TEXT NOT NULL DEFAULT '',
+	body             BLOB NOT NULL,
+	result_signature TEXT NOT NULL DEFAULT '',
+	attempts         INTEGER NOT NULL,
+	last_error       TEXT NOT NULL DEFAULT '',
+	created_at       TEXT NOT NULL
+);
+`
+
+// sqliteMigrations add the columns introduced after the schema was first released to existing
+// databases, by table
+var sqliteMigrations = []struct{ table, column, definition string }{
+	{"executions", "follow_up_id", "TEXT NOT NULL DEFAULT ''"},
+	{"executions", "archived_at", "TEXT NOT NULL DEFAULT ''"},
+	{"executions", "restored_at", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// sqliteCleanupBatch is the number of executions deleted at once while the database exceeds its
+// size limit
+const sqliteCleanupBatch = 100
+
+// sqliteExecutionStore is an ExecutionStore keeping executions in an embedded SQLite database,
+// so the history survives restarts and can be audited later
+type sqliteExecutionStore struct {
+	db              *sql.DB
+	retention       time.Duration
+	maxSize         int64
+	cleanupInterval time.Duration
+	archiveDir      string        // cold storage of old executions, empty if they aren't archived
+	archiveAfter    time.Duration // age of finished executions before they are archived
+	clock           Clock
+	logger          *slog.Logger
+
+	mu    sync.Mutex
+	stats models.ExecutionStoreStats // outcome of the janitor so far
+}
+
+// NewSQLiteExecutionStore opens or creates the database at path. Every cleanupInterval, finished
+// executions older than archiveAfter are moved to archiveDir if it is set, then those older than
+// retention are deleted, then the oldest ones until the database is at most maxSize bytes.
+// A retention or maxSize of 0 doesn't limit.
+func NewSQLiteExecutionStore(path string, retention time.Duration, maxSize int64, cleanupInterval time.Duration, archiveDir string, archiveAfter time.Duration, logger *slog.Logger) (ExecutionStore, error) {
+	if archiveDir != "" {
+		if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create execution archive directory: %w", err)
+		}
+	}
+
+	// Incremental auto vacuum only applies to new databases, it lets the janitor shrink the file
+	db, err := sql.Open("sqlite", path+"?_pragma=auto_vacuum(incremental)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open execution store: %w", err)
+	}
+	// SQLite has a single writer, one connection avoids busy errors between them
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create execution store schema: %w", err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate execution store schema: %w", err)
+	}
+
+	// Executions running when the server stopped won't finish anymore
+	interrupted, err := db.Exec(`UPDATE executions SET status = ?, finished_at = ?, error = ? WHERE status = ?`,
+		StateFailed, time.Now().UTC().Format(time.RFC3339), "server stopped while the execution was running", StateRunning)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to update interrupted executions: %w", err)
+	}
+	if n, err := interrupted.RowsAffected(); err == nil && n > 0 {
+		logger.Warn("Marked executions interrupted by a restart as failed", "executions", n)
+	}
+
+	s := &sqliteExecutionStore{
+		db:              db,
+		retention:       retention,
+		maxSize:         maxSize,
+		cleanupInterval: cleanupInterval,
+		archiveDir:      archiveDir,
+		archiveAfter:    archiveAfter,
+		clock:           SystemClock,
+		logger:          logger,
+	}
+	if retention > 0 || maxSize > 0 || archiveDir != "" {
+		go s.janitor()
+	}
+	return s, nil
+}
+
+// migrateSQLite adds the missing columns of databases created by an earlier version
+func migrateSQLite(db *sql.DB) error {
+	for _, m := range sqliteMigrations {
+		var exists int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, m.table, m.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, m.table, m.column, m.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save implements ExecutionStore
+func (s *sqliteExecutionStore) Save(ctx context.Context, record *models.ExecutionRecord) error {
+	summary, err := marshalNullable(record.Summary)
+	if err != nil {
+		return err
+	}
+	options, err := marshalNullable(record.Options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO executions
+		(id, status, mode, webhook_url, concurrency_group, callback_url, follow_up_id, total_requests, completed_requests,
+		 created_at, finished_at, error, summary, options)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.ExecutionID, record.Status, record.Mode, record.WebhookURL, record.ConcurrencyGroup,
+		record.CallbackURL, record.FollowUpExecutionID, record.TotalRequests, record.CompletedRequests, record.CreatedAt,
+		record.FinishedAt, record.Error, summary, options)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM execution_results WHERE execution_id = ?`, record.ExecutionID); err != nil {
+		return err
+	}
+	for _, result := range record.Results {
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO execution_results
+			(execution_id, idx, success, error_code, error, compensation_error, result)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			record.ExecutionID, result.Index, result.Success, result.ErrorCode, result.Error,
+			result.CompensationError, string(encoded))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Payloads don't change while an execution runs, they are only written by the first save
+	for i, payload := range record.Payloads {
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO execution_payloads (execution_id, idx, payload)
+			VALUES (?, ?, ?)`, record.ExecutionID, i, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+
+	// The event log is append-only, events written by earlier saves are kept
+	for _, event := range record.Events {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO execution_events (execution_id, seq, event)
+			VALUES (?, ?, ?)`, record.ExecutionID, event.Seq, string(encoded))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SavePayloads implements PayloadRecorder
+func (s *sqliteExecutionStore) SavePayloads(ctx context.Context, id string, payloads *models.Payloads) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO execution_payloads (execution_id, idx, payload) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < payloads.Len(); i++ {
+		payload, err := payloads.Get(i)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, id, i, string(payload)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Get implements ExecutionStore
+func (s *sqliteExecutionStore) Get(ctx context.Context, id string) (*models.ExecutionRecord, error) {
+	var archivedAt string
+	err := s.db.QueryRowContext(ctx, `SELECT archived_at FROM executions WHERE id = ?`, id).Scan(&archivedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if archivedAt != "" {
+		return nil, fmt.Errorf("%w: archived at %s, restore it to read it", ErrExecutionArchived, archivedAt)
+	}
+	return s.load(ctx, id)
+}
+
+// load reads the record of an execution with its results, payloads and events
+func (s *sqliteExecutionStore) load(ctx context.Context, id string) (*models.ExecutionRecord, error) {
+	record := &models.ExecutionRecord{}
+	var summary, options sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT id, status, mode, webhook_url, concurrency_group, callback_url, follow_up_id,
+		total_requests, completed_requests, created_at, finished_at, error, summary, options
+		FROM executions WHERE id = ?`, id).Scan(
+		&record.ExecutionID, &record.Status, &record.Mode, &record.WebhookURL, &record.ConcurrencyGroup,
+		&record.CallbackURL, &record.FollowUpExecutionID, &record.TotalRequests, &record.CompletedRequests,
+		&record.CreatedAt, &record.FinishedAt, &record.Error, &summary, &options)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExecutionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if summary.Valid {
+		record.Summary = &models.ExecutionSummary{}
+		if err := json.Unmarshal([]byte(summary.String), record.Summary); err != nil {
+			return nil, fmt.Errorf("invalid stored summary: %w", err)
+		}
+	}
+	if options.Valid {
+		record.Options = &models.EffectiveOptions{}
+		if err := json.Unmarshal([]byte(options.String), record.Options); err != nil {
+			return nil, fmt.Errorf("invalid stored options: %w", err)
+		}
+	}
+
+	// Rows are read one query at a time, the store has a single connection
+	if record.Results, err = s.results(ctx, id); err != nil {
+		return nil, err
+	}
+	if record.Payloads, err = s.payloads(ctx, id); err != nil {
+		return nil, err
+	}
+	if record.Events, err = s.events(ctx, id); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// results reads the results of an execution in index order
+func (s *sqliteExecutionStore) results(ctx context.Context, id string) ([]models.WebhookResult, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT result FROM execution_results WHERE execution_id = ? ORDER BY idx`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.WebhookResult
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		var result models.WebhookResult
+		if err := json.Unmarshal([]byte(encoded), &result); err != nil {
+			return nil, fmt.Errorf("invalid stored result: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// payloads reads the stored payloads of an execution in index order
+func (s *sqliteExecutionStore) payloads(ctx context.Context, id string) ([]json.RawMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT payload FROM execution_payloads WHERE execution_id = ? ORDER BY idx`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payloads []json.RawMessage
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, json.RawMessage(payload))
+	}
+	return payloads, rows.Err()
+}
+
+// events reads the event log of an execution in order
+func (s *sqliteExecutionStore) events(ctx context.Context, id string) ([]models.JobEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT event FROM execution_events WHERE execution_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.JobEvent
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		var event models.JobEvent
+		if err := json.Unmarshal([]byte(encoded), &event); err != nil {
+			return nil, fmt.Errorf("invalid stored event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Search implements ExecutionStore
+func (s *sqliteExecutionStore) Search(ctx context.Context, query string, limit int) ([]models.ExecutionMatch, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return []models.ExecutionMatch{}, nil
+	}
+
+	conditions := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		conditions[i] = "instr(lower(m.message), ?) > 0"
+		args[i] = term
+	}
+
+	// Distinct error messages with the number of failed results carrying them, 0 for the error
+	// of the execution itself
+	rows, err := s.db.QueryContext(ctx, `SELECT e.id, e.status, e.webhook_url, e.created_at, e.finished_at,
+		m.message, SUM(m.n)
+		FROM (
+			SELECT id AS execution_id, error AS message, 0 AS n FROM executions WHERE error != ''
+			UNION ALL
+			SELECT execution_id, error, 1 FROM execution_results WHERE error != ''
+			UNION ALL
+			SELECT execution_id, compensation_error, 1 FROM execution_results WHERE compensation_error != ''
+		) m
+		JOIN executions e ON e.id = m.execution_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY e.id, m.message
+		ORDER BY e.created_at DESC, e.id, m.message`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []models.ExecutionMatch{}
+	for rows.Next() {
+		var match models.ExecutionMatch
+		var message string
+		var count int
+		if err := rows.Scan(&match.ExecutionID, &match.Status, &match.WebhookURL, &match.CreatedAt,
+			&match.FinishedAt, &message, &count); err != nil {
+			return nil, err
+		}
+
+		if n := len(matches); n == 0 || matches[n-1].ExecutionID != match.ExecutionID {
+			if n == limit {
+				break
+			}
+			matches = append(matches, match)
+		}
+		last := &matches[len(matches)-1]
+		last.MatchingResults += count
+		if len(last.Errors) < maxMatchErrors {
+			last.Errors = append(last.Errors, message)
+		}
+	}
+	return matches, rows.Err()
+}
+
+// List implements ExecutionStore
+func (s *sqliteExecutionStore) List(ctx context.Context, filter models.ExecutionFilter) ([]models.ExecutionListItem, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+	where := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if filter.Status != "" {
+		where("status = ?", filter.Status)
+	}
+	if filter.Mode != "" {
+		where("mode = ?", filter.Mode)
+	}
+	if filter.ConcurrencyGroup != "" {
+		where("concurrency_group = ?", filter.ConcurrencyGroup)
+	}
+	if filter.WebhookURL != "" {
+		where("webhook_url = ?", filter.WebhookURL)
+	}
+	if filter.From != "" {
+		where("created_at >= ?", filter.From)
+	}
+	if filter.To != "" {
+		where("created_at < ?", filter.To)
+	}
+	if filter.BeforeID != "" {
+		where("(created_at < ? OR (created_at = ? AND id < ?))", filter.BeforeCreatedAt, filter.BeforeCreatedAt, filter.BeforeID)
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, status, mode, webhook_url, concurrency_group,
+		total_requests, completed_requests, created_at, finished_at, error, summary, archived_at
+		FROM executions WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.ExecutionListItem{}
+	for rows.Next() {
+		var item models.ExecutionListItem
+		var summary sql.NullString
+		if err := rows.Scan(&item.ExecutionID, &item.Status, &item.Mode, &item.WebhookURL, &item.ConcurrencyGroup,
+			&item.TotalRequests, &item.CompletedRequests, &item.CreatedAt, &item.FinishedAt, &item.Error,
+			&summary, &item.ArchivedAt); err != nil {
+			return nil, err
+		}
+		if summary.Valid {
+			item.Summary = &models.ExecutionSummary{}
+			if err := json.Unmarshal([]byte(summary.String), item.Summary); err != nil {
+				return nil, fmt.Errorf("invalid stored summary: %w", err)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Stats implements ExecutionStore
+func (s *sqliteExecutionStore) Stats(ctx context.Context) (*models.ExecutionStoreStats, error) {
+	var executions int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM executions`).Scan(&executions); err != nil {
+		return nil, err
+	}
+	size, err := s.size(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Backend = "sqlite"
+	stats.Executions = executions
+	stats.SizeBytes = size
+	stats.MaxSizeBytes = s.maxSize
+	stats.RetentionSeconds = int64(s.retention / time.Second)
+	if s.archiveDir != "" {
+		stats.ArchiveAfterSeconds = int64(s.archiveAfter / time.Second)
+	}
+	return &stats, nil
+}
+
+// janitor periodically deletes the finished executions exceeding the retention period or the
+// size limit
+func (s *sqliteExecutionStore) janitor() {
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup(context.Background())
+		<-ticker.C
+	}
+}
+
+// cleanup runs one pass of the janitor and records its outcome
+func (s *sqliteExecutionStore) cleanup(ctx context.Context) {
+	// Executions which failed to archive don't hold up the retention period and size limit
+	archived, archiveErr := s.archive(ctx)
+	purged, err := s.purge(ctx)
+	err = errors.Join(archiveErr, err)
+
+	s.mu.Lock()
+	s.stats.ArchivedExecutions += archived
+	s.stats.PurgedExecutions += purged.executions
+	s.stats.PurgedResults += purged.results
+	s.stats.PurgedPayloads += purged.payloads
+	s.stats.LastCleanupAt = s.clock.Now().UTC().Format(time.RFC3339)
+	s.stats.LastCleanupError = ""
+	if err != nil {
+		s.stats.LastCleanupError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error("Failed to clean up execution history", "error", err)
+	}
+	if archived > 0 {
+		s.logger.Info("Archived execution history", "archived_executions", archived, "archive_dir", s.archiveDir)
+	}
+	if purged.executions > 0 {
+		s.logger.Info("Purged execution history",
+			"purged_executions", purged.executions,
+			"purged_results", purged.results,
+			"purged_payloads", purged.payloads)
+	}
+}
+
+// purgedRows counts the rows deleted by the janitor
+type purgedRows struct {
+	executions int64
+	results    int64
+	payloads   int64
+	events     int64
+}
+
+// purge deletes the finished executions older than the retention period, then the oldest ones
+// which aren't archived until the database fits into the size limit
+func (s *sqliteExecutionStore) purge(ctx context.Context) (purgedRows, error) {
+	var total purgedRows
+	add := func(purged purgedRows) {
+		total.executions += purged.executions
+		total.results += purged.results
+		total.payloads += purged.payloads
+	}
+
+	if s.retention > 0 {
+		// RFC 3339 timestamps in UTC sort chronologically
+		// Restored executions are kept for another retention period
+		cutoff := s.clock.Now().Add(-s.retention).UTC().Format(time.RFC3339)
+		purged, err := s.delete(ctx, `finished_at != '' AND finished_at < ? AND restored_at < ?`, cutoff, cutoff)
+		add(purged)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	for s.maxSize > 0 {
+		size, err := s.size(ctx)
+		if err != nil {
+			return total, err
+		}
+		if size <= s.maxSize {
+			break
+		}
+		// Archived executions hardly take any space, their archive files are kept until retention
+		purged, err := s.delete(ctx, `id IN (SELECT id FROM executions WHERE finished_at != '' AND archived_at = ''
+			ORDER BY finished_at, id LIMIT ?)`, sqliteCleanupBatch)
+		add(purged)
+		if err != nil {
+			return total, err
+		}
+		if purged.executions == 0 {
+			s.logger.Warn("Execution history exceeds its size limit, but has no finished executions left to purge, archived ones are kept",
+				"size_bytes", size, "max_size_bytes", s.maxSize)
+			break
+		}
+	}
+
+	// Hands the freed pages back to the file system, a no-op for databases created without
+	// incremental auto vacuum
+	if total.executions > 0 {
+		if _, err := s.db.ExecContext(ctx, `PRAGMA incremental_vacuum`); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// delete removes the executions matching condition together with their results, payloads, events
+// and archive files, so purged executions can't be restored
+func (s *sqliteExecutionStore) delete(ctx context.Context, condition string, args ...interface{}) (purgedRows, error) {
+	var purged purgedRows
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return purged, err
+	}
+	defer tx.Rollback()
+
+	selected := `SELECT id FROM executions WHERE ` + condition
+	var archived []string
+	if s.archiveDir != "" {
+		if archived, err = queryIDs(ctx, tx, `SELECT id FROM executions WHERE archived_at != '' AND (`+condition+`)`, args...); err != nil {
+			return purgedRows{}, err
+		}
+	}
+	for _, step := range []struct {
+		query string
+		count *int64
+	}{
+		{`DELETE FROM execution_results WHERE execution_id IN (` + selected + `)`, &purged.results},
+		{`DELETE FROM execution_payloads WHERE execution_id IN (` + selected + `)`, &purged.payloads},
+		{`DELETE FROM execution_events WHERE execution_id IN (` + selected + `)`, &purged.events},
+		{`DELETE FROM executions WHERE ` + condition, &purged.executions},
+	} {
+		result, err := tx.ExecContext(ctx, step.query, args...)
+		if err != nil {
+			return purgedRows{}, err
+		}
+		if *step.count, err = result.RowsAffected(); err != nil {
+			return purgedRows{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return purgedRows{}, err
+	}
+
+	// Without their row the files can't be restored anyway, leftovers are only logged
+	for _, id := range archived {
+		if err := os.Remove(s.archivePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn("Failed to delete archive file of purged execution", "execution_id", id, "error", err)
+		}
+	}
+	return purged, nil
+}
+
+// size returns the bytes of the database in use, pages on the free list don't count
+func (s *sqliteExecutionStore) size(ctx context.Context) (int64, error) {
+	var pages, free, pageSize int64
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&free); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return (pages - free) * pageSize, nil
+}
+
+// marshalNullable encodes a value as JSON, nil pointers are stored as NULL
+func marshalNullable[T any](value *T) (sql.NullString, error) {
+	if value == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// resultStream collects the results of an execution in completion order, so that they can be
+// followed while the execution is running
+type resultStream struct {
+	mu      sync.Mutex
+	results []models.WebhookResult
+	changed chan struct{} // closed and replaced whenever a result is added or the stream closed
+	closed  bool
+}
+
+// newResultStream creates an open stream
+func newResultStream() *resultStream {
+	return &resultStream{changed: make(chan struct{})}
+}
+
+// publish adds the result of a completed task
+func (s *resultStream) publish(result models.WebhookResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// close marks the stream as complete
+func (s *resultStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.changed)
+	}
+}
+
+// since returns the results after the first cursor ones, the channel closed on the next change
+// and whether the stream is complete
+func (s *resultStream) since(cursor int) ([]models.WebhookResult, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results[cursor:], s.changed, s.closed
+}
+
+// follow calls emit for every result of the stream until it is complete or the context is done
+func (s *resultStream) follow(ctx context.Context, emit func(models.WebhookResult) error) error {
+	cursor := 0
+	for {
+		results, changed, closed := s.since(cursor)
+		for _, result := range results {
+			if err := emit(result); err != nil {
+				return err
+			}
+		}
+		cursor += len(results)
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
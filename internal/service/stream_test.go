@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// streamAll collects what StreamExecution emits
+func streamAll(t *testing.T, ws *WebhookService, ctx context.Context, id string) ([]int, *models.ExecutionRecord) {
+	t.Helper()
+	var indices []int
+	var final *models.ExecutionRecord
+	err := ws.StreamExecution(ctx, id, func(result models.WebhookResult) error {
+		indices = append(indices, result.Index)
+		return nil
+	}, func(record *models.ExecutionRecord) error {
+		final = record
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	return indices, final
+}
+
+func TestStreamExecutionEmitsStoredAndLiveResultsOnce(t *testing.T) {
+	ws := newTestService(t, nil)
+	ctx := context.Background()
+
+	record := &models.ExecutionRecord{ExecutionID: "exec-1", Status: StateRunning, Results: []models.WebhookResult{{Index: 0}, {Index: 1}}}
+	if err := ws.store.Save(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+	exec := &execution{id: "exec-1", stream: newResultStream()}
+	ws.executions.add(exec)
+	exec.stream.publish(models.WebhookResult{Index: 1})
+	exec.stream.publish(models.WebhookResult{Index: 2})
+	exec.stream.close()
+
+	indices, final := streamAll(t, ws, ctx, "exec-1")
+	if len(indices) != 3 || indices[0] != 0 || indices[1] != 1 || indices[2] != 2 {
+		t.Fatalf("emitted %v, want [0 1 2]", indices)
+	}
+	if final == nil || final.Results != nil {
+		t.Fatalf("final record %+v", final)
+	}
+}
+
+func TestStreamExecutionEmitsResultsOfExecutionFinishedMeanwhile(t *testing.T) {
+	ws := newTestService(t, nil)
+	ctx := context.Background()
+
+	// The execution already left the registry, its record still reads as running
+	record := &models.ExecutionRecord{ExecutionID: "exec-2", Status: StateRunning, Results: []models.WebhookResult{{Index: 0}, {Index: 1}}}
+	if err := ws.store.Save(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, _ := streamAll(t, ws, ctx, "exec-2")
+	if len(indices) != 2 {
+		t.Fatalf("emitted %v, want [0 1]", indices)
+	}
+}
+
+func TestExecuteStreamingNumbersResultsInCompletionOrder(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, nil)
+	var streamed []models.StreamedResult
+	response, err := ws.ExecuteStreaming(context.Background(), &models.ParallelExecuteRequest{
+		WebhookURL: target.URL,
+		Payloads:   models.NewPayloads(json.RawMessage(`{"a":1}`), json.RawMessage(`{"a":2}`), json.RawMessage(`{"a":3}`)),
+		Timeout:    30,
+	}, func(result models.StreamedResult) {
+		streamed = append(streamed, result)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(streamed) != 3 {
+		t.Fatalf("streamed %d results, want 3", len(streamed))
+	}
+	for i, result := range streamed {
+		if result.ExecutionID != response.ExecutionID || result.Seq != i+1 {
+			t.Fatalf("result %d = execution %q seq %d, want execution %q seq %d", i, result.ExecutionID, result.Seq, response.ExecutionID, i+1)
+		}
+	}
+}
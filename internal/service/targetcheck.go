@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// n8nSettings is the subset of the n8n /rest/settings response carrying the version
+type n8nSettings struct {
+	Data struct {
+		VersionCli string `json:"versionCli"`
+	} `json:"data"`
+}
+
+// CheckTarget probes a webhook target: whether it responds, how long it takes, its TLS
+// certificate and, if it is served by n8n, the health and version of the instance. The target
+// is requested with HEAD, which doesn't trigger POST webhooks.
+func (ws *WebhookService) CheckTarget(ctx context.Context, targetURL string, timeout time.Duration) (*models.TargetCheck, error) {
+	if len(targetURL) > ws.config.MaxURLLength {
+		return nil, fmt.Errorf("%w: url is too long (%d bytes), at most %d bytes are allowed", ErrInvalidRequest, len(targetURL), ws.config.MaxURLLength)
+	}
+
+	if err := ws.hosts.checkURL("url", targetURL); err != nil {
+		return nil, err
+	}
+
+	// Instances of discovered services are probed one at a time, the first one is checked
+	targets, err := ws.discoverTargets(ctx, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if targets != nil {
+		targetURL = targets.url()
+	}
+
+	target, err := url.Parse(targetURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidRequest)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// A fresh connection, so the timings include connecting and the TLS handshake. The check
+	// is guarded regardless of BLOCK_PRIVATE_TARGETS, so it can't map the internal network.
+	transport := ws.probes.Clone()
+	transport.DisableKeepAlives = true
+	client := &http.Client{
+		Transport: policyTransport{policy: ws.hosts, next: transport},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	check := &models.TargetCheck{URL: targetURL}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", targetURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid url: %v", ErrInvalidRequest, err)
+	}
+	trace := newTimingTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	check.ResponseTime = time.Since(start).Milliseconds()
+	check.Timings = trace.timings()
+	if err != nil {
+		check.Error = err.Error()
+		return check, nil
+	}
+	resp.Body.Close()
+
+	check.Reachable = true
+	check.StatusCode = resp.StatusCode
+	if resp.TLS != nil {
+		check.TLS = targetTLS(resp.TLS)
+	}
+	check.N8N = checkN8N(ctx, client, target)
+	return check, nil
+}
+
+// targetTLS describes an established TLS connection
+func targetTLS(state *tls.ConnectionState) *models.TargetTLS {
+	info := &models.TargetTLS{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.Subject = cert.Subject.String()
+		info.Issuer = cert.Issuer.String()
+		info.DNSNames = cert.DNSNames
+		info.NotAfter = cert.NotAfter.UTC().Format(time.RFC3339)
+		info.ExpiresInDays = int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+	}
+	return info
+}
+
+// checkN8N asks the origin of a target for the health and version of n8n, nil if it doesn't
+// look like n8n
+func checkN8N(ctx context.Context, client *http.Client, target *url.URL) *models.TargetN8N {
+	origin := target.Scheme + "://" + target.Host
+
+	health, err := probeGet(ctx, client, origin+"/healthz")
+	if err != nil {
+		return nil
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	healthy := health.statusCode == http.StatusOK && json.Unmarshal(health.body, &status) == nil && status.Status == "ok"
+
+	// The settings of the editor are public on most versions, they include the version
+	var version string
+	if settings, err := probeGet(ctx, client, origin+"/rest/settings"); err == nil && settings.statusCode == http.StatusOK {
+		var parsed n8nSettings
+		if json.Unmarshal(settings.body, &parsed) == nil {
+			version = parsed.Data.VersionCli
+		}
+	}
+
+	if !healthy && version == "" {
+		return nil
+	}
+	return &models.TargetN8N{Healthy: healthy, Version: version}
+}
+
+// probeResponse is a response read by probeGet
+type probeResponse struct {
+	statusCode int
+	body       []byte
+}
+
+// probeGet requests a URL, reading at most 1 MiB of the response
+func probeGet(ctx context.Context, client *http.Client, url string) (*probeResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return &probeResponse{statusCode: resp.StatusCode, body: body}, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+func TestCheckTargetIsGuardedEvenIfWebhookCallsAreNot(t *testing.T) {
+	var requests int
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, nil) // BLOCK_PRIVATE_TARGETS disabled
+	check, err := ws.CheckTarget(context.Background(), target.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CheckTarget() error = %v", err)
+	}
+	if check.Reachable || !strings.Contains(check.Error, ErrTargetBlocked.Error()) {
+		t.Fatalf("CheckTarget() = reachable %v, error %q, want blocked", check.Reachable, check.Error)
+	}
+	if requests != 0 {
+		t.Fatalf("target received %d requests", requests)
+	}
+}
+
+func TestCheckTargetAllowsAllowlistedNetworks(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.AllowedTargetNetworks = []string{"127.0.0.0/8"}
+	})
+	check, err := ws.CheckTarget(context.Background(), target.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("CheckTarget() error = %v", err)
+	}
+	if !check.Reachable || check.StatusCode != http.StatusNoContent {
+		t.Fatalf("CheckTarget() = reachable %v, status %d, error %q", check.Reachable, check.StatusCode, check.Error)
+	}
+}
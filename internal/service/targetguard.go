@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+)
+
+// blockedTargetPrefixes are ranges not covered by the netip predicates which don't lead to
+// public hosts either
+var blockedTargetPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network", 0.0.0.0 reaches the local host
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT, also used by overlay networks
+}
+
+// targetGuard keeps outbound connections away from loopback, private and link-local addresses,
+// so callers can't use webhook_url to reach the internal network. The address is checked right
+// before connecting, after resolution, so DNS names pointing inside and redirects are caught too.
+// Requests sent through a proxy are checked by their target host before they are handed to it.
+type targetGuard struct {
+	allowed []netip.Prefix
+	res     *resolver
+}
+
+// newTargetGuard creates the guard of the configuration, nil if private targets aren't blocked
+func newTargetGuard(cfg config.ExecutionConfig, res *resolver) *targetGuard {
+	if !cfg.BlockPrivateTargets {
+		return nil
+	}
+	return newStrictTargetGuard(cfg, res)
+}
+
+// newStrictTargetGuard creates a guard regardless of BLOCK_PRIVATE_TARGETS, for outbound requests
+// which are never supposed to reach the internal network
+func newStrictTargetGuard(cfg config.ExecutionConfig, res *resolver) *targetGuard {
+	allowed, _ := cfg.AllowedTargetPrefixes() // validated with the configuration
+	return &targetGuard{allowed: allowed, res: res}
+}
+
+// check returns ErrTargetBlocked for internal addresses which aren't allowlisted
+func (g *targetGuard) check(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, prefix := range g.allowed {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+
+	internal := addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+	for _, prefix := range blockedTargetPrefixes {
+		internal = internal || prefix.Contains(addr)
+	}
+	if internal {
+		return fmt.Errorf("%w: %s", ErrTargetBlocked, addr)
+	}
+	return nil
+}
+
+// control is the net.Dialer hook checking the address a connection is about to be made to
+func (g *targetGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	return g.check(addr)
+}
+
+// checkHost resolves host and checks all of its addresses
+func (g *targetGuard) checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.check(addr)
+	}
+	addrs, err := g.res.lookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := g.check(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxy wraps the Proxy function of a transport, so the target host of every request is checked
+// before the request is handed to the proxy: the dialer only sees the address of the proxy.
+// A proxy resolving names itself could still resolve them differently, socks5h included.
+func (g *targetGuard) proxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := next(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if err := g.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	}
+}
+
+// guardTransport makes transport check its targets with g. Without OUTBOUND_PROXY_URL the dialer
+// checks every address connected to. The outbound proxy is chosen by the operator, it is
+// dialed unchecked while the targets sent through it are checked by their host instead;
+// proxies of the environment (HTTP_PROXY) are both dialed through the guard and checked.
+func (g *targetGuard) guardTransport(transport *http.Transport, cfg config.ExecutionConfig, proxyURL *url.URL) {
+	if proxyURL == nil {
+		transport.DialContext = newDialContext(cfg, g.res, g)
+		if transport.Proxy != nil {
+			transport.Proxy = g.proxy(transport.Proxy)
+		}
+		return
+	}
+	transport.DialContext = newDialContext(cfg, g.res, nil)
+	transport.Proxy = g.proxy(http.ProxyURL(proxyURL))
+}
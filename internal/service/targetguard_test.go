@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestTargetGuardCheck(t *testing.T) {
+	guard := &targetGuard{allowed: []netip.Prefix{netip.MustParsePrefix("10.0.5.0/24")}}
+
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+		{"fe80::1", true},
+		{"10.0.5.7", false}, // allowlisted
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	}
+	for _, tt := range tests {
+		err := guard.check(netip.MustParseAddr(tt.addr))
+		if blocked := errors.Is(err, ErrTargetBlocked); blocked != tt.blocked {
+			t.Errorf("check(%s) = %v, want blocked %v", tt.addr, err, tt.blocked)
+		}
+	}
+}
+
+func TestBlockPrivateTargetsIsTheDefault(t *testing.T) {
+	if !config.Load().Execution.BlockPrivateTargets {
+		t.Fatal("BLOCK_PRIVATE_TARGETS must default to true")
+	}
+}
+
+func TestGuardedDialRejectsLoopback(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) { cfg.BlockPrivateTargets = true })
+	resp, err := ws.client.Get(target.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrTargetBlocked) {
+		t.Fatalf("Get(%s) error = %v, want ErrTargetBlocked", target.URL, err)
+	}
+}
+
+func TestGuardChecksTargetsSentThroughTheOutboundProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+	}))
+	defer proxy.Close()
+
+	// The proxy itself is on loopback, it is chosen by the operator and may be internal
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) {
+		cfg.BlockPrivateTargets = true
+		cfg.OutboundProxyURL = proxy.URL
+	})
+
+	resp, err := ws.client.Get("http://169.254.169.254/latest/meta-data/")
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrTargetBlocked) {
+		t.Fatalf("internal target through the proxy: error = %v, want ErrTargetBlocked", err)
+	}
+	if proxied.Load() != 0 {
+		t.Fatal("internal target was handed to the proxy")
+	}
+
+	resp, err = ws.client.Get("http://93.184.216.34/")
+	if err != nil {
+		t.Fatalf("public target through the proxy: %v", err)
+	}
+	resp.Body.Close()
+	if proxied.Load() != 1 {
+		t.Fatalf("proxy received %d requests, want 1", proxied.Load())
+	}
+}
+
+func TestTransportPoolRejectsProxyWhileGuarded(t *testing.T) {
+	ws := newTestService(t, func(cfg *config.ExecutionConfig) { cfg.BlockPrivateTargets = true })
+	_, err := ws.transports.get(&models.TransportOptions{ProxyURL: "http://proxy.example.com:3128"})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("get() error = %v, want ErrInvalidRequest", err)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// validateTasks checks the tasks of a request, whose payloads were moved to the payloads of the
+// request when it was accepted
+func validateTasks(request *models.ParallelExecuteRequest) error {
+	if len(request.Tasks) == 0 {
+		return nil
+	}
+	if request.WebhookURL != "" {
+		return fmt.Errorf("%w: tasks can't be used together with webhook_url", ErrInvalidRequest)
+	}
+	if len(request.Tasks) != request.Payloads.Len() {
+		return fmt.Errorf("%w: tasks can't be used together with payloads", ErrInvalidRequest)
+	}
+	if request.PinResolution {
+		return fmt.Errorf("%w: pin_resolution can't be used with tasks", ErrInvalidRequest)
+	}
+	// Tasks name their own hosts, credentials of the request must not be sent to any of them
+	if request.AuthHeader != "" || request.Auth != nil {
+		return fmt.Errorf("%w: auth_header and auth can't be used with tasks, set them on the tasks instead", ErrInvalidRequest)
+	}
+	for i, task := range request.Tasks {
+		// Discovery schemes resolve a single target per execution, tasks need plain URLs
+		target, err := url.Parse(task.WebhookURL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("%w: tasks[%d].webhook_url must be an http or https URL", ErrInvalidRequest, i)
+		}
+	}
+	return nil
+}
+
+// newTaskCredentials creates the credentials of the tasks with auth of their own, indexed like
+// the payloads. It returns nil if no task has auth of its own, tasks without are sent without auth.
+func (ws *WebhookService) newTaskCredentials(request *models.ParallelExecuteRequest) ([]credentials, error) {
+	var taskCreds []credentials
+	for i, task := range request.Tasks {
+		if task.AuthHeader == "" && task.Auth == nil {
+			continue
+		}
+		own, err := ws.newCredentials(&models.ParallelExecuteRequest{
+			WebhookURL: task.WebhookURL,
+			AuthHeader: task.AuthHeader,
+			Auth:       task.Auth,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tasks[%d]: %w", i, err)
+		}
+		if taskCreds == nil {
+			taskCreds = make([]credentials, len(request.Tasks))
+		}
+		taskCreds[i] = own
+	}
+	return taskCreds, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+func TestValidateTasksRejectsRequestAuth(t *testing.T) {
+	tasks := []models.TaskSpec{{WebhookURL: "https://a.example.com/hook"}, {WebhookURL: "https://b.example.com/hook"}}
+	payloads := models.NewPayloads(json.RawMessage(`{}`), json.RawMessage(`{}`))
+
+	tests := []struct {
+		name    string
+		request models.ParallelExecuteRequest
+		wantErr bool
+	}{
+		{"no auth", models.ParallelExecuteRequest{Tasks: tasks, Payloads: payloads}, false},
+		{"auth_header", models.ParallelExecuteRequest{Tasks: tasks, Payloads: payloads, AuthHeader: "Bearer secret"}, true},
+		{"auth", models.ParallelExecuteRequest{Tasks: tasks, Payloads: payloads, Auth: &models.WebhookAuth{Type: AuthTypeBearer, Token: "secret"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTasks(&tt.request)
+			if tt.wantErr != errors.Is(err, ErrInvalidRequest) {
+				t.Fatalf("validateTasks() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTasksWithoutAuthGetNoCredentials(t *testing.T) {
+	ws := newTestService(t, nil)
+	request := &models.ParallelExecuteRequest{Tasks: []models.TaskSpec{
+		{WebhookURL: "https://a.example.com/hook", AuthHeader: "Bearer a"},
+		{WebhookURL: "https://b.example.com/hook"},
+	}}
+	taskCreds, err := ws.newTaskCredentials(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := newExecution("exec", request, SystemClock, testLogger)
+	exec.credentials = headerCredentials{name: "Authorization", value: "Bearer request"}
+	exec.taskCredentials = taskCreds
+
+	if got, ok := exec.credentialsOf(0).(headerCredentials); !ok || got.value != "Bearer a" {
+		t.Errorf("credentialsOf(0) = %v, want the task's own", exec.credentialsOf(0))
+	}
+	if got := exec.credentialsOf(1); got != nil {
+		t.Errorf("credentialsOf(1) = %v, want nil", got)
+	}
+}
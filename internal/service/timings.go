@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// timingTrace records the phases of a single webhook request
+type timingTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	getConn      time.Time
+	gotConn      time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+// newTimingTrace starts recording the timings of a request
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+// clientTrace returns the hooks recording the request phases. Dual-stack dials may attempt
+// several connections, the first start and the last completion are recorded.
+func (t *timingTrace) clientTrace() *httptrace.ClientTrace {
+	record := func(field *time.Time, onlyFirst bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !onlyFirst || field.IsZero() {
+			*field = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		GetConn: func(string) { record(&t.getConn, true) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+			t.gotConn = time.Now()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { record(&t.dnsStart, true) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { record(&t.dnsDone, false) },
+		ConnectStart:         func(string, string) { record(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { record(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { record(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { record(&t.tlsDone, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { record(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { record(&t.firstByte, true) },
+	}
+}
+
+// timings returns the recorded phases, phases which didn't happen are reported as 0
+func (t *timingTrace) timings() *models.RequestTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := &models.RequestTimings{
+		DNS:              phaseMillis(t.dnsStart, t.dnsDone),
+		Connect:          phaseMillis(t.connectStart, t.connectDone),
+		TLS:              phaseMillis(t.tlsStart, t.tlsDone),
+		Wait:             phaseMillis(t.wroteRequest, t.firstByte),
+		TTFB:             phaseMillis(t.start, t.firstByte),
+		ConnectionReused: t.reused,
+	}
+	// Getting a connection includes dialing a new one, the rest is waiting for a free one
+	dial := timings.DNS + timings.Connect + timings.TLS
+	timings.ConnWait = math.Max(0, phaseMillis(t.getConn, t.gotConn)-dial)
+	return timings
+}
+
+// phaseMillis returns the duration of a phase in milliseconds
+func phaseMillis(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return float64(end.Sub(start).Microseconds()) / 1000
+}
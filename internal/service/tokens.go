@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenResponse is the response of an OAuth2 style token endpoint
+type tokenResponse struct {
+	AccessToken string
+	IDToken     string
+	ExpiresIn   int // seconds
+}
+
+// requestToken sends a request to a token endpoint and decodes the JSON response
+func requestToken(client *http.Client, req *http.Request) (map[string]interface{}, error) {
+	if err := sanitizeOutboundRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	return document, nil
+}
+
+// requestOAuth2Token sends a form encoded request to an OAuth2 token endpoint
+func requestOAuth2Token(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	document, err := requestToken(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var token tokenResponse
+	if accessToken, ok := document["access_token"].(string); ok {
+		token.AccessToken = accessToken
+	}
+	if idToken, ok := document["id_token"].(string); ok {
+		token.IDToken = idToken
+	}
+	if expiresIn, ok := document["expires_in"].(float64); ok {
+		token.ExpiresIn = int(expiresIn)
+	}
+
+	return &token, nil
+}
+
+// lookupField resolves a dotted path like "data.token" in a JSON document
+func lookupField(document map[string]interface{}, path string) (string, bool) {
+	var current interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current = object[key]
+	}
+
+	value, ok := current.(string)
+	return value, ok && value != ""
+}
+
+// tokenExpiryMargin is how long before their expiry cached tokens are renewed
+const tokenExpiryMargin = time.Minute
+
+// tokenFetcher obtains a new token and its expiry
+type tokenFetcher func(ctx context.Context) (string, time.Time, error)
+
+// tokenCache keeps fetched tokens until shortly before they expire, shared by all executions
+type tokenCache struct {
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*cachedToken
+}
+
+type cachedToken struct {
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// newTokenCache creates an empty token cache expiring tokens by the time of clock
+func newTokenCache(clock Clock) *tokenCache {
+	return &tokenCache{clock: clock, entries: make(map[string]*cachedToken)}
+}
+
+// get returns the token cached under key, concurrent callers wait for a single fetch
+func (c *tokenCache) get(ctx context.Context, key string, fetch tokenFetcher) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedToken{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.token != "" && entry.expiresAt.Sub(c.clock.Now()) > tokenExpiryMargin {
+		return entry.token, nil
+	}
+
+	token, expiresAt, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	entry.token, entry.expiresAt = token, expiresAt
+	return token, nil
+}
+
+// cachedTokenCredentials send a bearer token obtained from a token cache
+type cachedTokenCredentials struct {
+	cache *tokenCache
+	key   string
+	fetch tokenFetcher
+}
+
+func (c cachedTokenCredentials) apply(ctx context.Context, req *http.Request) error {
+	token, err := c.cache.get(ctx, c.key, c.fetch)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
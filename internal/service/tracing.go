@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+var tracer = otel.Tracer("github.com/mylxsw/n8n-parallels/internal/service")
+
+// startExecutionSpan starts the parent span of a run of an execution. Waiting for the
+// concurrency group and admission are part of it, so queueing shows up in the trace.
+func startExecutionSpan(ctx context.Context, exec *execution, requests int) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("execution.id", exec.id),
+		attribute.Int("execution.total_requests", requests),
+	}
+	if target, err := url.Parse(exec.webhookURL); err == nil {
+		attrs = append(attrs, attribute.String("webhook.host", target.Host))
+	}
+	if exec.concurrencyGroup != "" {
+		attrs = append(attrs, attribute.String("execution.concurrency_group", exec.concurrencyGroup))
+	}
+	return tracer.Start(ctx, "execution", trace.WithAttributes(attrs...))
+}
+
+// endExecutionSpan records the summary of a run and ends its span
+func endExecutionSpan(span trace.Span, response *models.ParallelExecuteResponse, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	if response == nil {
+		return
+	}
+	summary := response.Summary
+	span.SetAttributes(
+		attribute.Int("execution.successful_requests", summary.SuccessfulRequests),
+		attribute.Int("execution.failed_requests", summary.FailedRequests),
+		attribute.Int("execution.timeout_requests", summary.TimeoutRequests),
+		attribute.Bool("execution.aborted", summary.Aborted),
+		attribute.Bool("execution.canceled", summary.Canceled),
+	)
+	if summary.Aborted {
+		span.SetStatus(codes.Error, "execution aborted")
+	}
+}
+
+// startTaskSpan starts the child span of a webhook call, retries are part of it.
+// The trace context is passed on to the target with the traceparent header.
+func startTaskSpan(ctx context.Context, exec *execution, task models.WebhookExecutionTask) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "webhook task",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("execution.id", exec.id),
+			attribute.Int("task.index", task.Index),
+		))
+}
+
+// endTaskSpan records the outcome of a webhook call and ends its span. Sampled spans are noted
+// in the result, so the latency histogram can link to them.
+func endTaskSpan(span trace.Span, request *models.ParallelExecuteRequest, result *models.WebhookExecutionResult) {
+	defer span.End()
+	if sc := span.SpanContext(); sc.IsSampled() {
+		result.TraceID, result.SpanID = sc.TraceID().String(), sc.SpanID().String()
+	}
+	span.SetAttributes(
+		attribute.Int("task.attempts", result.Attempts),
+		attribute.Int("task.payload_bytes", result.PayloadBytes),
+		attribute.Int64("task.duration_ms", result.Duration),
+	)
+	if result.StatusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	if !result.Success {
+		if code := toWebhookResult(request, *result).ErrorCode; code != "" {
+			span.SetAttributes(attribute.String("task.error_code", code))
+		}
+		if result.Error != nil {
+			span.RecordError(result.Error)
+			span.SetStatus(codes.Error, result.Error.Error())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mylxsw/n8n-parallels/internal/config"
+	"github.com/mylxsw/n8n-parallels/internal/models"
+)
+
+// maxPooledTransports is the number of distinct transport configurations kept for reuse
+const maxPooledTransports = 32
+
+// pooledTransport is a client with its transport, shared by all executions using the same options
+type pooledTransport struct {
+	client    *http.Client
+	transport *http.Transport
+}
+
+// transportPool keeps the transports of executions overriding the transport options, keyed by
+// their configuration, so executions with the same options share connections while
+// differing ones stay isolated from each other and from the default client.
+type transportPool struct {
+	base           *http.Transport
+	allowInsecure  bool
+	allowedProxies []string // proxy URLs executions may choose, see ALLOWED_PROXY_URLS
+	guarded        bool     // private targets are blocked, per-execution proxies would bypass the guard
+	hosts          *hostPolicy
+
+	mu      sync.Mutex
+	entries map[string]*pooledTransport
+	order   []string // keys in insertion order, the oldest is evicted first
+}
+
+// newTransportPool creates a pool deriving transports from base, their clients only send
+// requests to the hosts allowed by hosts
+func newTransportPool(base *http.Transport, cfg config.ExecutionConfig, guarded bool, hosts *hostPolicy) *transportPool {
+	return &transportPool{
+		base:           base,
+		allowInsecure:  cfg.AllowInsecureTLS,
+		allowedProxies: cfg.AllowedProxyURLs,
+		guarded:        guarded,
+		hosts:          hosts,
+		entries:        make(map[string]*pooledTransport),
+	}
+}
+
+// get returns the transport for options, creating it if necessary
+func (p *transportPool) get(options *models.TransportOptions) (*pooledTransport, error) {
+	// The options hold the private key of a client certificate, the pool only keeps their digest
+	keyBytes, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(keyBytes)
+	key := hex.EncodeToString(digest[:])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.entries[key]; ok {
+		return entry, nil
+	}
+
+	transport, err := p.newTransport(options)
+	if err != nil {
+		return nil, err
+	}
+	entry := &pooledTransport{client: p.hosts.client(transport), transport: transport}
+
+	// Executions still using an evicted transport keep working, its idle connections are closed
+	if len(p.order) >= maxPooledTransports {
+		oldest := p.order[0]
+		p.order = p.order[1:]
+		p.entries[oldest].transport.CloseIdleConnections()
+		delete(p.entries, oldest)
+	}
+	p.entries[key] = entry
+	p.order = append(p.order, key)
+	return entry, nil
+}
+
+// newTransport derives a transport with the given options from the base transport
+func (p *transportPool) newTransport(options *models.TransportOptions) (*http.Transport, error) {
+	transport := p.base.Clone()
+
+	if options.InsecureSkipVerify || options.CACert != "" || options.ServerName != "" || options.ClientCert != "" || options.ClientKey != "" {
+		if options.InsecureSkipVerify && !p.allowInsecure {
+			return nil, fmt.Errorf("%w: transport.insecure_skip_verify is not allowed by the server", ErrInvalidRequest)
+		}
+
+		// Settings of the server, e.g. its client certificate, apply unless overridden
+		tlsConfig := transport.TLSClientConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.InsecureSkipVerify = options.InsecureSkipVerify
+		tlsConfig.ServerName = options.ServerName
+		if options.CACert != "" {
+			// The CAs of the server stay trusted
+			var roots *x509.CertPool
+			if tlsConfig.RootCAs != nil {
+				roots = tlsConfig.RootCAs.Clone()
+			} else if system, err := x509.SystemCertPool(); err == nil {
+				roots = system
+			} else {
+				roots = x509.NewCertPool()
+			}
+			if !roots.AppendCertsFromPEM([]byte(options.CACert)) {
+				return nil, fmt.Errorf("%w: transport.ca_cert contains no valid PEM certificate", ErrInvalidRequest)
+			}
+			tlsConfig.RootCAs = roots
+		}
+		if options.ClientCert != "" || options.ClientKey != "" {
+			cert, err := tls.X509KeyPair([]byte(options.ClientCert), []byte(options.ClientKey))
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid transport.client_cert or transport.client_key: %v", ErrInvalidRequest, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+			tlsConfig.GetClientCertificate = nil
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if options.ProxyURL != "" {
+		if p.guarded {
+			return nil, fmt.Errorf("%w: transport.proxy_url is not allowed while private targets are blocked", ErrInvalidRequest)
+		}
+		proxyURL, err := parseProxyURL(options.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid transport.proxy_url: %v", ErrInvalidRequest, err)
+		}
+		if !p.proxyAllowed(proxyURL) {
+			return nil, fmt.Errorf("%w: transport.proxy_url %s://%s is not in ALLOWED_PROXY_URLS", ErrInvalidRequest, proxyURL.Scheme, proxyURL.Host)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if options.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = options.MaxConnsPerHost
+	}
+	if options.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	}
+	transport.DisableKeepAlives = options.DisableKeepAlives
+
+	return transport, nil
+}
+
+// proxyAllowed reports whether a proxy is one of the allowed ones. Proxies are compared by
+// scheme and host, credentials may differ.
+func (p *transportPool) proxyAllowed(proxyURL *url.URL) bool {
+	for _, raw := range p.allowedProxies {
+		allowed, err := url.Parse(raw)
+		if err == nil && strings.EqualFold(allowed.Scheme, proxyURL.Scheme) && strings.EqualFold(allowed.Host, proxyURL.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxyURL parses the URL of a forward proxy, http and https proxies are sent CONNECT
+// requests for https targets, socks5 proxies resolve the target host themselves
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks5 or socks5h", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("missing proxy host")
+	}
+	return proxyURL, nil
+}
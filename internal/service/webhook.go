@@ -1,126 +1,1277 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/mylxsw/n8n-parallels/internal/auth"
+	"github.com/mylxsw/n8n-parallels/internal/config"
 	"github.com/mylxsw/n8n-parallels/internal/models"
 )
 
 // WebhookService handles parallel webhook execution
 type WebhookService struct {
-	client *http.Client
-	logger *slog.Logger
+	client     *http.Client
+	transport  *http.Transport
+	probes     *http.Transport // of target checks, always guarded
+	dial       dialContextFunc
+	internal   *http.Client // reaches the infrastructure the server is configured with, unguarded
+	hosts      *hostPolicy
+	resolver   *resolver
+	bandwidth  *bandwidthLimiter
+	transports *transportPool
+	config     config.ExecutionConfig
+	groups     GroupSemaphore
+	store      ExecutionStore
+	queue      ExecutionQueue
+	owners     ExecutionOwners // replicas keeping the records of executions, nil with a single replica
+	breakers   *circuitBreakers
+	dedup      *dedupWindow
+	slots      *taskSlots
+	executions *executionRegistry
+	tokens     *tokenCache
+	signer     *auth.ResultSigner // signs execution results, nil without a signing key
+	queries    *payloadSource     // runs payload queries, nil if they aren't configured
+	secrets    *secretBox         // seals queued requests and callback credentials, nil without STORAGE_ENCRYPTION_KEY
+	clock      Clock
+	random     Randomness
+	logger     *slog.Logger
 }
 
 // NewWebhookService creates a new webhook service instance
-func NewWebhookService(logger *slog.Logger) *WebhookService {
+// A nil queue runs asynchronous executions in the background of the process submitting them.
+func NewWebhookService(cfg config.ExecutionConfig, groups GroupSemaphore, store ExecutionStore, queue ExecutionQueue, logger *slog.Logger) *WebhookService {
+	res := newResolver(cfg)
+	guard := newTargetGuard(cfg, res)
+	dial := newDialContext(cfg, res, guard)
+	transport := newTransport(newDialContext(cfg, res, nil))
+	roots, _ := cfg.RootCAs()                    // validated with the configuration
+	signer, _ := cfg.ResultSigner()              // validated with the configuration
+	certHosts, _ := cfg.ClientCertHostPatterns() // validated with the configuration
+	cert := newClientCertificate(cfg.ClientCertFile, cfg.ClientKeyFile, certHosts)
+	if roots != nil || cert != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+		if cert != nil {
+			transport.TLSClientConfig.GetClientCertificate = cert.get
+		}
+	}
+	// The metadata server, Consul and the Kubernetes API are internal by nature, they aren't
+	// chosen by callers and bypass the guard
+	internal := transport
+	if guard != nil || cfg.OutboundProxyURL != "" {
+		internal = transport.Clone()
+		internal.DialContext = newDialContext(cfg, res, nil)
+	}
+	// Webhook calls go through the outbound proxy, executions may choose another one
+	var proxyURL *url.URL
+	if cfg.OutboundProxyURL != "" {
+		proxyURL, _ = parseProxyURL(cfg.OutboundProxyURL) // validated with the configuration
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	// Target checks are guarded even if webhook calls aren't, probing the internal network is
+	// all they would be good for there
+	probes := transport.Clone()
+	newStrictTargetGuard(cfg, res).guardTransport(probes, cfg, proxyURL)
+	if guard != nil {
+		guard.guardTransport(transport, cfg, proxyURL)
+	} else {
+		transport.DialContext = dial
+	}
+	hosts := newHostPolicy(cfg)
+	breakers := newCircuitBreakers(cfg.CircuitBreakerThreshold,
+		time.Duration(cfg.CircuitBreakerResetInterval)*time.Second, cfg.CircuitBreakerHalfOpenProbes, SystemClock, logger)
+	queries := newPayloadSource(cfg)
+	if queries != nil && queries.err != nil {
+		logger.Error("Payload queries will fail", "error", queries.err)
+	}
+
 	return &WebhookService{
-		client: &http.Client{
-			Timeout: 0, // We'll handle timeout per request
-		},
-		logger: logger,
+		client:     hosts.client(transport), // without a timeout, every request has its own
+		transport:  transport,
+		probes:     probes,
+		dial:       dial,
+		internal:   &http.Client{Transport: internal},
+		hosts:      hosts,
+		resolver:   res,
+		bandwidth:  newBandwidthLimiter(cfg.OutboundBandwidthLimit),
+		transports: newTransportPool(transport, cfg, guard != nil, hosts),
+		config:     cfg,
+		groups:     groups,
+		store:      store,
+		queue:      queue,
+		breakers:   breakers,
+		dedup:      newDedupWindow(cfg.DedupWindow, SystemClock),
+		slots:      newTaskSlots(cfg.MaxTotalConcurrency, cfg.ConcurrencyGroupWeights),
+		executions: newExecutionRegistry(),
+		tokens:     newTokenCache(SystemClock),
+		signer:     signer,
+		queries:    queries,
+		secrets:    newSecretBox(cfg.StorageEncryptionKey),
+		clock:      SystemClock,
+		random:     SystemRandomness,
+		logger:     logger,
 	}
 }
 
+// ResultSigner returns the signer of execution results, nil if results aren't signed
+func (ws *WebhookService) ResultSigner() *auth.ResultSigner {
+	return ws.signer
+}
+
 // ExecuteParallel executes webhook requests in parallel and returns results in order
-func (ws *WebhookService) ExecuteParallel(ctx context.Context, request *models.ParallelExecuteRequest) *models.ParallelExecuteResponse {
+// The service takes ownership of the request payloads and releases them once the execution is done.
+func (ws *WebhookService) ExecuteParallel(ctx context.Context, request *models.ParallelExecuteRequest) (*models.ParallelExecuteResponse, error) {
+	return ws.execute(ctx, request, nil)
+}
+
+// ExecuteStreaming executes webhook requests in parallel and passes every result to emit the moment
+// it completes, with the execution ID and its position in the completion order. The returned
+// response has the summary but no results, response bodies aren't kept after they were emitted
+// unless compensation needs them.
+func (ws *WebhookService) ExecuteStreaming(ctx context.Context, request *models.ParallelExecuteRequest, emit func(models.StreamedResult)) (*models.ParallelExecuteResponse, error) {
+	response, err := ws.execute(ctx, request, emit)
+	if response != nil {
+		response.Results = nil
+	}
+	return response, err
+}
+
+// execute runs a synchronous execution, emitting results as they complete if emit is set
+func (ws *WebhookService) execute(ctx context.Context, request *models.ParallelExecuteRequest, emit func(models.StreamedResult)) (*models.ParallelExecuteResponse, error) {
+	if request.CallbackURL != "" {
+		request.ClosePayloads()
+		return nil, fmt.Errorf("%w: callback_url requires mode=async", ErrInvalidRequest)
+	}
+
+	exec, err := ws.prepare(ctx, newID(), request)
+	if err != nil {
+		return nil, err
+	}
+	if emit != nil {
+		exec.emit = func(result models.WebhookResult) {
+			emit(models.StreamedResult{ExecutionID: exec.id, WebhookResult: result})
+		}
+	}
+	if ws.recordsAll() {
+		mode := "sync"
+		if emit != nil {
+			mode = "stream"
+		}
+		exec.record = ws.newRecord(exec, mode, exec.startedAt)
+		// Small batches are only recorded once finished, off the path of the response
+		if !ws.fastPath(request) {
+			ws.saveRecord(exec, exec.record)
+			ws.storePayloads(ctx, exec, mode)
+		}
+	}
+
+	// A canary execution only runs a sample first, the rest waits for confirmation
+	indices, pending := allIndices(request.Payloads.Len()), []int(nil)
+	if request.Canary != nil && request.Canary.Count < request.Payloads.Len() {
+		indices, pending = sampleIndices(request.Payloads.Len(), request.Canary.Count, request.Canary.Random, ws.random)
+	}
+
+	// With detach_on_disconnect the execution outlives a caller that went away, it continues as
+	// an asynchronous job whose results are kept in the store
+	runCtx := ctx
+	var finished, detached chan struct{}
+	if request.DetachOnDisconnect {
+		runCtx = context.WithoutCancel(ctx)
+		finished, detached = make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(detached)
+			select {
+			case <-ctx.Done():
+				ws.detach(exec)
+			case <-finished:
+			}
+		}()
+	}
+
+	response, err := ws.run(runCtx, exec, request, indices)
+	if detached != nil {
+		close(finished)
+		<-detached
+	}
+	exec.emit = nil // the remaining payloads of a canary execution are continued without streaming
+	if err != nil || len(pending) == 0 || response.Summary.Canceled || response.Summary.BudgetExceeded {
+		ws.release(exec)
+		followUp := ws.startFollowUp(context.WithoutCancel(ctx), exec, response, err)
+		if response != nil {
+			response.FollowUpExecutionID = followUp
+		}
+		if exec.record != nil {
+			finished := ws.finishedRecord(exec.record, response, err)
+			finished.FollowUpExecutionID = followUp
+			if ws.fastPath(request) {
+				go ws.saveRecord(exec, &finished)
+			} else {
+				ws.saveRecord(exec, &finished)
+			}
+		}
+		return response, err
+	}
+
+	ttl := time.Duration(ws.config.CanaryTTL) * time.Second
+	exec.park(pending)
+	exec.events.add(models.JobEvent{Type: EventAwaitingConfirmation, Message: fmt.Sprintf("%d pending requests", len(pending))})
+	ws.clock.AfterFunc(ttl, func() {
+		if exec.expire() {
+			ws.discardCanary(exec, len(pending))
+		}
+	})
+
+	exec.logger.Info("Canary execution awaiting confirmation",
+		"pending_requests", len(pending),
+		"expires_in_seconds", ws.config.CanaryTTL)
+
+	response.Status = StateAwaitingConfirmation
+	response.PendingRequests = len(pending)
+	if exec.record != nil {
+		sampled := ws.finishedRecord(exec.record, response, nil)
+		sampled.Status = StateAwaitingConfirmation
+		sampled.FinishedAt = ""
+		exec.record = &sampled
+		ws.saveRecord(exec, exec.record)
+	}
+	return response, nil
+}
+
+// detach turns a synchronous execution whose caller disconnected into an asynchronous job, its
+// record is stored right away so the execution can be polled by its id. The stored record is
+// replaced, not changed, as readers of the store may hold it.
+func (ws *WebhookService) detach(exec *execution) {
+	created := exec.record == nil
+	if created {
+		exec.record = ws.newRecord(exec, "async", exec.startedAt)
+	} else {
+		detached := *exec.record
+		detached.Mode = "async"
+		exec.record = &detached
+	}
+	exec.events.add(models.JobEvent{Type: EventDetached, Message: "client disconnected"})
+	exec.logger.Warn("Client disconnected, execution continues as an asynchronous job",
+		"status_url", "/v1/parallels/executions/"+exec.id)
+	ws.saveRecord(exec, exec.record)
+	if created {
+		ws.storePayloads(context.Background(), exec, "async")
+	}
+}
+
+// ExecuteAsync starts an execution in the background and returns its id right away.
+// The state and results of the execution are kept in the execution store. With a queue,
+// the execution is only submitted and started by a worker, see RunWorkers.
+func (ws *WebhookService) ExecuteAsync(ctx context.Context, request *models.ParallelExecuteRequest) (string, error) {
+	if request.Canary != nil {
+		request.ClosePayloads()
+		return "", fmt.Errorf("%w: canary executions can't run asynchronously", ErrInvalidRequest)
+	}
+	if ws.queue != nil && !ws.fastPath(request) {
+		return ws.enqueue(ctx, request)
+	}
+
+	exec, err := ws.prepare(ctx, newID(), request)
+	if err != nil {
+		return "", err
+	}
+
+	record, err := ws.startAsync(ctx, exec, exec.startedAt)
+	if err != nil {
+		ws.releaseUnstarted(exec)
+		return "", err
+	}
+
+	// The execution outlives the request which started it, but stays part of its trace
+	go ws.runAsync(context.WithoutCancel(ctx), exec, record)
+
+	return exec.id, nil
+}
+
+// startAsync stores the running record of an asynchronous execution
+func (ws *WebhookService) startAsync(ctx context.Context, exec *execution, createdAt time.Time) (*models.ExecutionRecord, error) {
+	exec.stream = newResultStream()
+
+	record := ws.newRecord(exec, "async", createdAt)
+	record.Events = exec.events.snapshot()
+	if err := ws.store.Save(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to store execution: %w", err)
+	}
+	ws.claim(exec)
+	ws.storePayloads(ctx, exec, "async")
+	return record, nil
+}
+
+// runAsync runs an asynchronous execution, stores its results and sends the callback if requested
+func (ws *WebhookService) runAsync(ctx context.Context, exec *execution, record *models.ExecutionRecord) {
+	defer ws.release(exec)
+
+	request := exec.request
+	response, err := ws.run(ctx, exec, request, allIndices(request.Payloads.Len()))
+	// Another worker took over the queued execution, its run records the outcome
+	if errors.Is(context.Cause(ctx), ErrQueueLeaseLost) {
+		exec.logger.Warn("Stopped execution after losing its queue lease")
+		exec.stream.close()
+		return
+	}
+	finished := ws.finishedRecord(record, response, err)
+	finished.FollowUpExecutionID = ws.startFollowUp(ctx, exec, response, err)
+	if response != nil {
+		response.FollowUpExecutionID = finished.FollowUpExecutionID
+	}
+	ws.saveRecord(exec, &finished)
+	exec.stream.close()
+
+	ws.notifyCallback(context.Background(), exec, response, err)
+}
+
+// fastPath reports whether a request is small enough to skip the queue and to be recorded in the
+// background, so tiny fan-outs don't pay for either. Canary executions never take it.
+func (ws *WebhookService) fastPath(request *models.ParallelExecuteRequest) bool {
+	return ws.config.FastPathMaxItems > 0 && request.Payloads.Len() <= ws.config.FastPathMaxItems && request.Canary == nil
+}
+
+// recordsAll reports whether synchronous executions are recorded too. Only the persistent store
+// does, the memory store keeps asynchronous executions until their results were fetched.
+func (ws *WebhookService) recordsAll() bool {
+	return ws.config.ExecutionStore == "sqlite"
+}
+
+// newRecord creates the running record of an execution
+func (ws *WebhookService) newRecord(exec *execution, mode string, createdAt time.Time) *models.ExecutionRecord {
+	record := &models.ExecutionRecord{
+		ExecutionID:      exec.id,
+		Status:           StateRunning,
+		Mode:             mode,
+		WebhookURL:       exec.request.WebhookURL,
+		ConcurrencyGroup: exec.request.ConcurrencyGroup,
+		CallbackURL:      exec.request.CallbackURL,
+		TotalRequests:    exec.request.Payloads.Len(),
+		CreatedAt:        createdAt.UTC().Format(time.RFC3339),
+	}
+
+	if ws.config.ExecutionStorePayloads && !ws.recordsPayloads(exec, mode) {
+		record.Payloads = make([]json.RawMessage, 0, record.TotalRequests)
+		for i := 0; i < record.TotalRequests; i++ {
+			payload, err := exec.request.Payloads.Get(i)
+			if err != nil {
+				exec.logger.Warn("Failed to read payload for the execution record", "index", i, "error", err)
+				record.Payloads = nil
+				break
+			}
+			record.Payloads = append(record.Payloads, payload)
+		}
+	}
+	return record
+}
+
+// recordsPayloads reports whether the payloads of an execution are written to the store item by
+// item with its first record, see storePayloads, instead of being copied into the record. Small
+// synchronous batches are only recorded once finished, when a spool is gone, they are copied.
+func (ws *WebhookService) recordsPayloads(exec *execution, mode string) bool {
+	_, ok := ws.store.(PayloadRecorder)
+	return ok && (mode == "async" || !ws.fastPath(exec.request))
+}
+
+// storePayloads writes the payloads of an execution recorded with mode to a PayloadRecorder
+func (ws *WebhookService) storePayloads(ctx context.Context, exec *execution, mode string) {
+	if !ws.config.ExecutionStorePayloads || !ws.recordsPayloads(exec, mode) {
+		return
+	}
+	// Like the record, the payloads are stored even if the caller went away meanwhile
+	if err := ws.store.(PayloadRecorder).SavePayloads(context.WithoutCancel(ctx), exec.id, &exec.request.Payloads); err != nil {
+		exec.logger.Warn("Failed to store payloads of the execution record", "error", err)
+	}
+}
+
+// finishedRecord completes the running record of an execution with the outcome of its run
+func (ws *WebhookService) finishedRecord(record *models.ExecutionRecord, response *models.ParallelExecuteResponse, err error) models.ExecutionRecord {
+	finished := *record
+	finished.FinishedAt = ws.clock.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		finished.Status = StateFailed
+		finished.Error = err.Error()
+		return finished
+	}
+
+	finished.Status = StateCompleted
+	if response.Summary.Canceled {
+		finished.Status = StateCanceled
+	} else if response.Summary.BudgetExceeded {
+		finished.Status = StateBudgetExceeded
+	}
+	finished.CompletedRequests = response.Summary.TotalRequests
+	finished.Results = response.Results
+	finished.Summary = &response.Summary
+	finished.Options = &response.Options
+	return finished
+}
+
+// saveRecord stores the record of an execution, failures are only logged as the execution itself
+// went through
+func (ws *WebhookService) saveRecord(exec *execution, record *models.ExecutionRecord) {
+	record.Events = exec.events.snapshot()
+	if err := ws.store.Save(context.Background(), record); err != nil {
+		exec.logger.Error("Failed to store execution results", "error", err)
+		return
+	}
+	ws.claim(exec)
+}
+
+// GetExecution returns the state of a recorded execution, with its results once finished
+func (ws *WebhookService) GetExecution(ctx context.Context, id string) (*models.ExecutionRecord, error) {
+	record, err := ws.store.Get(ctx, id)
+	if errors.Is(err, ErrExecutionNotFound) && ws.queue != nil {
+		// Records of queued executions are lost on restart, the queue still knows them
+		if queued, qErr := ws.queue.Queued(ctx, id); qErr == nil && queued {
+			return &models.ExecutionRecord{ExecutionID: id, Status: StateQueued}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Status == StateRunning {
+		if exec, ok := ws.executions.get(id); ok {
+			record.CompletedRequests = int(exec.completed.Load())
+		}
+	}
+	return record, nil
+}
+
+// ExecutionResults returns the record of a finished execution with its results, only the failed or
+// the succeeded ones if only is "failed" or "succeeded" and only those matching the filter
+// expression if there is one, see compileResultFilter
+func (ws *WebhookService) ExecutionResults(ctx context.Context, id, only, filter string) (*models.ExecutionRecord, error) {
+	if only != "" && only != "failed" && only != "succeeded" {
+		return nil, fmt.Errorf("%w: only must be 'failed' or 'succeeded'", ErrInvalidRequest)
+	}
+	var selected resultFilter
+	if filter != "" {
+		var err error
+		if selected, err = compileResultFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := ws.GetExecution(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.FinishedAt == "" {
+		return nil, fmt.Errorf("%w: execution is %s, results are available once it finished", ErrJobStateConflict, record.Status)
+	}
+
+	if only != "" || selected != nil {
+		results := make([]models.WebhookResult, 0, len(record.Results))
+		for _, result := range record.Results {
+			if only != "" && (result.Skipped || result.Success != (only == "succeeded")) {
+				continue
+			}
+			if selected != nil && !selected(&result) {
+				continue
+			}
+			results = append(results, result)
+		}
+		record.Results = results
+	}
+	return record, nil
+}
+
+// StreamExecution emits the results of an asynchronous execution as they complete, followed by
+// the final record without results once the execution finished. Results of finished executions
+// are emitted in index order.
+func (ws *WebhookService) StreamExecution(ctx context.Context, id string, emitResult func(models.WebhookResult) error, emitFinal func(*models.ExecutionRecord) error) error {
+	// Subscribe before reading the record, so that no result completing in between is missed.
+	// The stored and the streamed results overlap, every index is emitted once.
+	exec, live := ws.executions.get(id)
+	live = live && exec.stream != nil
+
+	record, err := ws.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]bool)
+	emit := func(results []models.WebhookResult) error {
+		for _, result := range results {
+			if seen[result.Index] {
+				continue
+			}
+			seen[result.Index] = true
+			if err := emitResult(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := emit(record.Results); err != nil {
+		return err
+	}
+	if record.Status == StateRunning {
+		if live {
+			if err := exec.stream.follow(ctx, func(result models.WebhookResult) error {
+				return emit([]models.WebhookResult{result})
+			}); err != nil {
+				return err
+			}
+		}
+		// The execution may have finished since the record was read
+		if record, err = ws.store.Get(ctx, id); err != nil {
+			return err
+		}
+		if err := emit(record.Results); err != nil {
+			return err
+		}
+	}
+
+	record.Results = nil
+	return emitFinal(record)
+}
+
+// SearchExecutions returns the stored executions with errors matching query, newest first
+func (ws *WebhookService) SearchExecutions(ctx context.Context, query string, limit int) ([]models.ExecutionMatch, error) {
+	return ws.store.Search(ctx, query, limit)
+}
+
+// ExecutionStoreStats describes the execution store and what its retention policy purged
+func (ws *WebhookService) ExecutionStoreStats(ctx context.Context) (*models.ExecutionStoreStats, error) {
+	return ws.store.Stats(ctx)
+}
+
+// RestoreExecution moves an archived execution back into the execution store
+func (ws *WebhookService) RestoreExecution(ctx context.Context, id string) (*models.ExecutionRecord, error) {
+	archive, ok := ws.store.(ExecutionArchive)
+	if !ok {
+		return nil, fmt.Errorf("%w: executions aren't archived, see EXECUTION_ARCHIVE_DIR", ErrInvalidRequest)
+	}
+	return archive.Restore(ctx, id)
+}
+
+// historyStates are the states executions can be listed by
+var historyStates = map[string]bool{
+	StateQueued: true, StateRunning: true, StateAwaitingConfirmation: true,
+	StateCompleted: true, StateFailed: true, StateCanceled: true, StateBudgetExceeded: true,
+}
+
+// ListExecutions returns a page of the stored executions matching filter, newest first. The
+// cursor is the next_cursor of the previous page, empty for the first one.
+func (ws *WebhookService) ListExecutions(ctx context.Context, filter models.ExecutionFilter, cursor string) (*models.ExecutionPage, error) {
+	if filter.Status != "" && !historyStates[filter.Status] {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidRequest, filter.Status)
+	}
+	if filter.Mode != "" && filter.Mode != "sync" && filter.Mode != "stream" && filter.Mode != "async" {
+		return nil, fmt.Errorf("%w: mode must be 'sync', 'stream' or 'async'", ErrInvalidRequest)
+	}
+	if cursor != "" {
+		createdAt, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidRequest)
+		}
+		filter.BeforeCreatedAt, filter.BeforeID = createdAt, id
+	}
+
+	// One more execution than requested tells whether there is a next page
+	limit := filter.Limit
+	filter.Limit++
+	items, err := ws.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.ExecutionPage{Executions: items}
+	if len(items) > limit {
+		page.Executions = items[:limit]
+		last := page.Executions[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ExecutionID)
+	}
+	for i, item := range page.Executions {
+		if item.Status == StateRunning {
+			if exec, ok := ws.executions.get(item.ExecutionID); ok {
+				page.Executions[i].CompletedRequests = int(exec.completed.Load())
+			}
+		}
+	}
+	return page, nil
+}
+
+// encodeCursor encodes the position of an execution in the history
+func encodeCursor(createdAt, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt + "|" + id))
+}
+
+// decodeCursor decodes a position encoded by encodeCursor
+func decodeCursor(cursor string) (createdAt, id string, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", err
+	}
+	createdAt, id, ok := strings.Cut(string(decoded), "|")
+	if !ok || id == "" {
+		return "", "", errors.New("malformed cursor")
+	}
+	return createdAt, id, nil
+}
+
+// prepare validates a request and registers its execution, so that it can be inspected and
+// paused while running. The payloads are released if the request is rejected.
+func (ws *WebhookService) prepare(ctx context.Context, id string, request *models.ParallelExecuteRequest) (*execution, error) {
+	if err := ws.validateRequest(request); err != nil {
+		request.ClosePayloads()
+		return nil, err
+	}
+	creds, err := ws.newCredentials(request)
+	if err != nil {
+		request.ClosePayloads()
+		return nil, err
+	}
+	taskCreds, err := ws.newTaskCredentials(request)
+	if err != nil {
+		request.ClosePayloads()
+		return nil, err
+	}
+
+	// Executions overriding transport options get an isolated transport
+	client, transport := ws.client, ws.transport
+	if request.Transport != nil {
+		pooled, err := ws.transports.get(request.Transport)
+		if err != nil {
+			request.ClosePayloads()
+			return nil, err
+		}
+		client, transport = pooled.client, pooled.transport
+	}
+	targets, err := ws.discoverTargets(ctx, request.WebhookURL)
+	if err != nil {
+		request.ClosePayloads()
+		return nil, err
+	}
+	var pinned []netip.Addr
+	if request.PinResolution && targets == nil {
+		client, pinned, err = ws.newPinnedClient(ctx, request.WebhookURL, client, transport)
+		if err != nil {
+			request.ClosePayloads()
+			return nil, err
+		}
+	}
+
+	// Dispatching may be paced or paused, so the execution as a whole has no deadline,
+	// every task is bounded by its own timeout.
+	exec := newExecution(id, request, ws.clock, ws.logger)
+	if requestID := RequestID(ctx); requestID != "" {
+		exec.requestID = requestID
+		exec.logger = exec.logger.With("request_id", requestID)
+	}
+	if subject := auth.Subject(ctx); subject != "" {
+		exec.logger = exec.logger.With("subject", subject)
+	}
+	if targets != nil {
+		exec.logger.Debug("Discovered webhook targets", "endpoints", targets.endpoints)
+	}
+	if pinned != nil {
+		exec.logger.Debug("Pinned webhook host resolution", "addresses", pinned)
+	}
+	exec.credentials = creds
+	exec.taskCredentials = taskCreds
+	exec.client = client
+	exec.targets = targets
+	ws.executions.add(exec)
+	return exec, nil
+}
+
+// validateRequest checks the parts of a request the validator can't
+func (ws *WebhookService) validateRequest(request *models.ParallelExecuteRequest) error {
+	if err := ws.checkRequestLimits(request); err != nil {
+		return err
+	}
+	if err := ws.checkRequestHosts(request); err != nil {
+		return err
+	}
+	if request.CallbackOn != "" && request.CallbackURL == "" {
+		return fmt.Errorf("%w: callback_on requires callback_url", ErrInvalidRequest)
+	}
+	if request.CallbackSecret != "" && len(request.CallbackSecret) < minCallbackSecretLength {
+		return fmt.Errorf("%w: callback_secret must be at least %d bytes long", ErrInvalidRequest, minCallbackSecretLength)
+	}
+	if err := validateTasks(request); err != nil {
+		return err
+	}
+	if err := validateHeaders(request); err != nil {
+		return err
+	}
+	if err := validateBodyFormat(request); err != nil {
+		return err
+	}
+	if request.ConcurrencyKeyLimit > 0 && request.ConcurrencyKey == "" {
+		return fmt.Errorf("%w: concurrency_key_limit requires concurrency_key", ErrInvalidRequest)
+	}
+	if err := ws.validateFollowUps(request); err != nil {
+		return err
+	}
+	if request.RateSchedule != nil {
+		if _, err := newRateShaper(request.RateSchedule, ws.clock); err != nil {
+			return err
+		}
+	}
+	if request.Compensation != nil {
+		if _, err := parseCompensationTemplate(request.Compensation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContinueJob executes the remaining tasks of a canary execution awaiting confirmation
+func (ws *WebhookService) ContinueJob(ctx context.Context, id string) (*models.ParallelExecuteResponse, error) {
+	exec, ok := ws.executions.get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	pending, ok := exec.claim()
+	if !ok {
+		return nil, fmt.Errorf("%w: job is not awaiting confirmation", ErrJobStateConflict)
+	}
+
+	exec.logger.Info("Continuing canary execution",
+		"pending_requests", len(pending))
+
+	// A run which wasn't admitted, e.g. because the concurrency group is busy, leaves the
+	// execution awaiting confirmation
+	response, err := ws.run(ctx, exec, exec.request, pending)
+	if rejected, expired := exec.rejectClaim(); rejected {
+		if expired {
+			ws.discardCanary(exec, len(pending))
+		}
+		return nil, err
+	}
+	defer ws.release(exec)
+
+	if exec.record != nil {
+		// The record keeps the results of the sample next to those of the continuation, the
+		// summary is the one of the continuation
+		finished := ws.finishedRecord(exec.record, response, err)
+		if err == nil {
+			finished.Results = append(append([]models.WebhookResult{}, exec.record.Results...), response.Results...)
+			sort.Slice(finished.Results, func(i, j int) bool { return finished.Results[i].Index < finished.Results[j].Index })
+			finished.CompletedRequests = len(finished.Results)
+		}
+		ws.saveRecord(exec, &finished)
+	}
+	return response, err
+}
+
+// discardCanary ends a canary execution whose remaining payloads weren't confirmed in time
+func (ws *WebhookService) discardCanary(exec *execution, pending int) {
+	ws.release(exec)
+	exec.logger.Info("Discarded unconfirmed canary execution",
+		"pending_requests", pending)
+	if exec.record != nil {
+		discarded := *exec.record
+		discarded.Status = StateFailed
+		discarded.FinishedAt = ws.clock.Now().UTC().Format(time.RFC3339)
+		discarded.Error = "canary execution was not confirmed in time"
+		ws.saveRecord(exec, &discarded)
+	}
+}
+
+// run executes the tasks of the given payload indices and returns their results in order.
+// An error means the run wasn't admitted, no task was dispatched.
+func (ws *WebhookService) run(ctx context.Context, exec *execution, request *models.ParallelExecuteRequest, indices []int) (response *models.ParallelExecuteResponse, err error) {
+	ctx, span := startExecutionSpan(ctx, exec, len(indices))
+	defer func() { endExecutionSpan(span, response, err) }()
+
+	ctx = exec.startRun(ctx)
+	defer func() { exec.finishRun(response) }()
+	defer func() { exec.logOutcome(response, err) }()
+
+	// The server caps how long a run may take, whatever the timeouts of the request allow
+	if budget := time.Duration(ws.config.MaxExecutionDuration) * time.Second; budget > 0 {
+		var cancelBudget context.CancelFunc
+		ctx, cancelBudget = withClockTimeout(ctx, ws.clock, budget, ErrBudgetExceeded)
+		defer cancelBudget()
+	}
+
+	// Executions sharing a concurrency group are limited server-side, wait for a free slot first
+	if request.ConcurrencyGroup != "" {
+		waitCtx, cancelWait := context.WithTimeout(ctx, time.Duration(ws.config.ConcurrencyGroupWaitTimeout)*time.Second)
+		lease, release, err := ws.groups.Acquire(waitCtx, request.ConcurrencyGroup)
+		cancelWait()
+		if errors.Is(err, ErrConcurrencyGroupBusy) {
+			exec.logger.Warn("Timed out waiting for concurrency group",
+				"wait_timeout_seconds", ws.config.ConcurrencyGroupWaitTimeout)
+			return nil, fmt.Errorf("%w: %s", err, request.ConcurrencyGroup)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire concurrency group %s: %w", request.ConcurrencyGroup, err)
+		}
+		defer release()
+
+		// The run can't go on without its slot, other replicas may have taken it
+		var cancelRun context.CancelCauseFunc
+		ctx, cancelRun = context.WithCancelCause(ctx)
+		defer cancelRun(nil)
+		stop := context.AfterFunc(lease, func() {
+			if cause := context.Cause(lease); errors.Is(cause, ErrConcurrencyGroupLeaseLost) {
+				cancelRun(cause)
+			}
+		})
+		defer stop()
+	}
+
+	// Admission control: the first task needs a server-wide slot, later tasks queue for one
+	waitTimeout := time.Duration(ws.config.TotalConcurrencyWaitTimeout) * time.Second
+	if err := ws.slots.admit(ctx, flowOf(exec), waitTimeout); err != nil {
+		if errors.Is(err, ErrServerBusy) {
+			exec.logger.Warn("Rejected execution, server-wide concurrency limit reached",
+				"max_total_concurrency", ws.config.MaxTotalConcurrency,
+				"wait_timeout_seconds", ws.config.TotalConcurrencyWaitTimeout)
+			return nil, fmt.Errorf("%w: %d webhook calls already in flight", err, ws.config.MaxTotalConcurrency)
+		}
+		return nil, err
+	}
+	exec.acceptClaim()
+
+	var shaper *rateShaper
+	if request.RateSchedule != nil {
+		shaper, _ = newRateShaper(request.RateSchedule, ws.clock) // validated by ExecuteParallel
+	}
+
 	startTime := time.Now()
-	totalRequests := len(request.Payloads)
-	
-	ws.logger.Info("Starting parallel webhook execution",
+	totalRequests := len(indices)
+
+	exec.logger.Info("Starting parallel webhook execution",
 		"webhook_url", request.WebhookURL,
 		"total_requests", totalRequests,
 		"timeout_seconds", request.Timeout)
+	exec.events.add(models.JobEvent{Type: EventStarted, Message: fmt.Sprintf("%d requests", totalRequests)})
 
 	// Create tasks
 	tasks := make([]models.WebhookExecutionTask, totalRequests)
-	for i, payload := range request.Payloads {
+	for i, index := range indices {
 		tasks[i] = models.WebhookExecutionTask{
-			Index:      i,
-			WebhookURL: request.WebhookURL,
-			AuthHeader: request.AuthHeader,
-			Payload:    payload,
+			Index:      index,
+			WebhookURL: exec.taskURL(index),
 			TimeoutSec: request.Timeout,
+
+			DeadlineHeaders: request.DeadlineHeaders,
+			GRPCTimeout:     request.GRPCTimeout,
 		}
 	}
 
 	// Execute tasks in parallel
-	results := ws.executeTasksParallel(ctx, tasks)
+	results, aborted := ws.executeTasksParallel(ctx, exec, tasks, shaper)
 
 	// Sort results by index to maintain order
-	sortedResults := make([]models.WebhookExecutionResult, totalRequests)
-	for _, result := range results {
-		sortedResults[result.Index] = result
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Index < results[j].Index
+	})
+
+	// Roll back the successfully processed items of an aborted execution
+	var compensations map[int]error
+	if aborted && request.Compensation != nil {
+		compensations = ws.compensate(ctx, exec, request, results)
 	}
 
 	// Convert to response format and calculate summary
 	webhookResults := make([]models.WebhookResult, totalRequests)
 	summary := models.ExecutionSummary{
-		TotalRequests: totalRequests,
-		TotalDuration: time.Since(startTime).Milliseconds(),
+		TotalRequests:  totalRequests,
+		TotalDuration:  time.Since(startTime).Milliseconds(),
+		Aborted:        aborted,
+		Canceled:       exec.isCanceled(),
+		BudgetExceeded: errors.Is(context.Cause(ctx), ErrBudgetExceeded),
 	}
 
-	for i, result := range sortedResults {
-		webhookResult := models.WebhookResult{
-			Index:    i,
-			Success:  result.Success,
-			Duration: result.Duration,
-		}
+	// Checksum of all response bodies, so exported results can be verified later
+	resultsHash := sha256.New()
 
+	dispatched := make([]models.WebhookExecutionResult, 0, len(results))
+	largestAccepted := 0
+	for i, result := range results {
+		if result.Dispatched {
+			dispatched = append(dispatched, result)
+		}
 		if result.Success {
-			webhookResult.Response = result.Response
+			largestAccepted = max(largestAccepted, result.PayloadBytes)
+		}
+
+		webhookResult := toWebhookResult(request, result)
+		if result.DuplicateOf != nil {
+			summary.DuplicateRequests++
+		} else if result.Success {
+			if request.IncludeChecksums && exec.emit == nil {
+				resultsHash.Write(result.Response)
+			}
+			if compErr, ok := compensations[result.Index]; ok {
+				if compErr != nil {
+					webhookResult.CompensationError = compErr.Error()
+				} else {
+					webhookResult.Compensated = true
+					summary.CompensatedRequests++
+				}
+			}
 			summary.SuccessfulRequests++
 		} else {
-			if result.IsTimeout {
-				webhookResult.Error = "timeout"
+			switch webhookResult.ErrorCode {
+			case models.ErrorCodeTimeout:
 				summary.TimeoutRequests++
-			} else if result.Error != nil {
-				webhookResult.Error = result.Error.Error()
-			} else {
-				webhookResult.Error = "unknown error"
+			case models.ErrorCodeAborted:
+				summary.AbortedRequests++
+			case models.ErrorCodeInvalid:
+				summary.InvalidRequests++
+			case models.ErrorCodeCanceled:
+				summary.CanceledRequests++
+			case models.ErrorCodeBudgetExceeded:
+				summary.BudgetExceededRequests++
+			case models.ErrorCodePayloadTooLarge:
+				summary.PayloadTooLargeRequests++
 			}
 			summary.FailedRequests++
 		}
+		if result.Truncated {
+			summary.TruncatedResponses++
+		}
 
 		webhookResults[i] = webhookResult
 	}
 
-	ws.logger.Info("Completed parallel webhook execution",
+	// Streamed response bodies aren't kept, there is no checksum over all of them
+	if request.IncludeChecksums && exec.emit == nil {
+		summary.ResultsChecksum = hex.EncodeToString(resultsHash.Sum(nil))
+	}
+	summary.Latency = latencyStats(dispatched)
+	if summary.PayloadTooLargeRequests > 0 && largestAccepted > 0 {
+		summary.SuggestedMaxPayloadBytes = largestAccepted
+		exec.logger.Warn("Target rejected payloads as too large",
+			"payload_too_large_requests", summary.PayloadTooLargeRequests,
+			"largest_accepted_bytes", largestAccepted)
+	}
+
+	if request.Analyze {
+		transport, _ := exec.client.Transport.(*http.Transport)
+		summary.Analysis = analyzeExecution(request, results, transport, ws.maxConcurrency(request))
+	}
+
+	if summary.BudgetExceeded {
+		exec.logger.Warn("Stopped execution, duration budget exceeded",
+			"max_execution_duration_seconds", ws.config.MaxExecutionDuration,
+			"budget_exceeded_requests", summary.BudgetExceededRequests)
+	}
+
+	exec.logger.Info("Completed parallel webhook execution",
 		"total_requests", summary.TotalRequests,
 		"successful", summary.SuccessfulRequests,
 		"failed", summary.FailedRequests,
 		"timeout", summary.TimeoutRequests,
+		"aborted", summary.Aborted,
+		"compensated", summary.CompensatedRequests,
 		"duration_ms", summary.TotalDuration)
 
-	return &models.ParallelExecuteResponse{
-		Results: webhookResults,
-		Summary: summary,
+	response = &models.ParallelExecuteResponse{
+		ExecutionID: exec.id,
+		Results:     webhookResults,
+		Summary:     summary,
+		Options:     ws.effectiveOptions(request),
+	}
+	if summary.BudgetExceeded {
+		response.Status = StateBudgetExceeded
+	}
+	return response, nil
+}
+
+// maxConcurrency returns the number of tasks of an execution allowed to run at once
+func (ws *WebhookService) maxConcurrency(request *models.ParallelExecuteRequest) int {
+	limit := request.MaxConcurrency
+	if limit == 0 {
+		limit = ws.config.DefaultMaxConcurrency
+	}
+	if ws.config.MaxConcurrencyLimit > 0 && limit > ws.config.MaxConcurrencyLimit {
+		limit = ws.config.MaxConcurrencyLimit
+	}
+	return limit
+}
+
+// maxResponseBytes returns the number of bytes of a response body kept, 0 if unlimited.
+// Requests can lower the server limit but not raise it.
+func (ws *WebhookService) maxResponseBytes(request *models.ParallelExecuteRequest) int {
+	limit := ws.config.MaxResponseSize
+	if request.MaxResponseBytes > 0 && (limit == 0 || request.MaxResponseBytes < limit) {
+		limit = request.MaxResponseBytes
+	}
+	return limit
+}
+
+// effectiveOptions reports the options of a request after defaults and caps were applied
+func (ws *WebhookService) effectiveOptions(request *models.ParallelExecuteRequest) models.EffectiveOptions {
+	options := models.EffectiveOptions{
+		Timeout:          request.Timeout,
+		MaxConcurrency:   ws.maxConcurrency(request),
+		OnInvalidPayload: request.OnInvalidPayload,
+		PayloadsSpooled:  request.Payloads.Spooled(),
+	}
+	if options.OnInvalidPayload == "" {
+		options.OnInvalidPayload = "reject_all"
+	}
+	options.Output = request.Output
+	if options.Output == "" {
+		options.Output = models.OutputDefault
+	}
+	if request.ConcurrencyKey != "" {
+		options.ConcurrencyKeyLimit = concurrencyKeyLimit(request)
+	}
+	if request.ConcurrencyGroup != "" {
+		options.ConcurrencyGroupLimit = ws.config.ConcurrencyGroupLimit
+		if limit, ok := ws.config.ConcurrencyGroupLimits[request.ConcurrencyGroup]; ok {
+			options.ConcurrencyGroupLimit = limit
+		}
+	}
+	if request.Canary != nil {
+		options.CanaryCount = min(request.Canary.Count, request.Payloads.Len())
+	}
+	if request.MaxRetries > 0 {
+		policy := ws.retryPolicy(request)
+		options.MaxRetries = policy.maxRetries
+		options.BackoffInitialMs = int(policy.initial.Milliseconds())
+		options.BackoffMultiplier = policy.multiplier
+	}
+	options.MaxResponseBytes = ws.maxResponseBytes(request)
+	return options
+}
+
+// toWebhookResult converts the result of a task to its representation in the response
+func toWebhookResult(request *models.ParallelExecuteRequest, result models.WebhookExecutionResult) models.WebhookResult {
+	webhookResult := models.WebhookResult{
+		Index:    result.Index,
+		Success:  result.Success,
+		Duration: result.Duration,
+
+		StatusCode:      result.StatusCode,
+		ResponseHeaders: result.ResponseHeaders,
+		Truncated:       result.Truncated,
+
+		Attempts:         result.Attempts,
+		AttemptDurations: result.AttemptDurations,
+
+		Seq: result.Seq,
+	}
+
+	if result.DuplicateOf != nil {
+		webhookResult.Skipped = true
+		webhookResult.DuplicateOf = result.DuplicateOf
+		return webhookResult
 	}
+	// Timings are also recorded for the analysis, but only returned if requested
+	if request.IncludeTimings {
+		webhookResult.Timings = result.Timings
+	}
+	if result.Success {
+		webhookResult.Response = result.Response
+		if request.IncludeChecksums {
+			sum := sha256.Sum256(result.Response)
+			webhookResult.Checksum = hex.EncodeToString(sum[:])
+		}
+		return webhookResult
+	}
+
+	if result.IsTimeout {
+		webhookResult.Error = "timeout"
+		webhookResult.ErrorCode = models.ErrorCodeTimeout
+	} else if result.IsAborted {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeAborted
+	} else if result.IsInvalid {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeInvalid
+	} else if result.IsCircuitOpen {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeCircuitOpen
+	} else if result.IsMismatch {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeIndexMismatch
+	} else if result.StatusCode == http.StatusRequestEntityTooLarge {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodePayloadTooLarge
+		webhookResult.PayloadBytes = result.PayloadBytes
+	} else if errors.Is(result.Error, ErrBudgetExceeded) {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeBudgetExceeded
+	} else if errors.Is(result.Error, context.Canceled) {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeCanceled
+	} else if errors.Is(result.Error, ErrTargetBlocked) {
+		webhookResult.Error = result.Error.Error()
+		webhookResult.ErrorCode = models.ErrorCodeBlocked
+	} else if result.Error != nil {
+		webhookResult.Error = result.Error.Error()
+	} else {
+		webhookResult.Error = "unknown error"
+	}
+	return webhookResult
 }
 
-// executeTasksParallel executes webhook tasks in parallel using goroutines
-func (ws *WebhookService) executeTasksParallel(ctx context.Context, tasks []models.WebhookExecutionTask) []models.WebhookExecutionResult {
+// errFailureThreshold is the cause of the dispatch waits ended by abort_after_failures
+var errFailureThreshold = errors.New("failure threshold reached")
+
+// executeTasksParallel executes webhook tasks in parallel using goroutines, paced by the shaper if any.
+// Once the failure threshold of the execution is reached no further tasks are dispatched and the
+// execution is reported as aborted. The threshold is checked as results come in, tasks waiting to
+// be dispatched are aborted right away.
+// The server-wide slot taken on admission is handed to the first dispatched task, or given back
+// if the execution is paused before.
+func (ws *WebhookService) executeTasksParallel(ctx context.Context, exec *execution, tasks []models.WebhookExecutionTask, shaper *rateShaper) ([]models.WebhookExecutionResult, bool) {
 	var wg sync.WaitGroup
 	results := make([]models.WebhookExecutionResult, len(tasks))
-	
+
 	// Use buffered channel to prevent goroutine leaks
 	resultChan := make(chan models.WebhookExecutionResult, len(tasks))
 
-	// Start goroutines for each task
-	for i, task := range tasks {
+	abortAfter := int64(exec.request.AbortAfterFailures)
+	var failures atomic.Int64
+	aborted := false
+
+	// Waits before dispatching end once the failure threshold is reached, in-flight tasks go on
+	dispatchCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	notDispatched := func(index int, err error) models.WebhookExecutionResult {
+		if abortAfter <= 0 || failures.Load() < abortAfter {
+			return models.WebhookExecutionResult{Index: index, Error: fmt.Errorf("task not dispatched: %w", err)}
+		}
+		if !aborted {
+			aborted = true
+			exec.logger.Warn("Aborting execution, failure threshold reached",
+				"failed_requests", failures.Load(),
+				"abort_after_failures", abortAfter)
+		}
+		return models.WebhookExecutionResult{
+			Index:     index,
+			Error:     fmt.Errorf("aborted after %d failed requests", abortAfter),
+			IsAborted: true,
+		}
+	}
+
+	// At most maxConcurrency tasks run at once, a slot is taken before a task is dispatched
+	slots := make(chan struct{}, ws.maxConcurrency(exec.request))
+
+	// Tasks sharing a concurrency key are limited further
+	var keys *keySemaphore
+	if exec.request.ConcurrencyKey != "" {
+		tasks = assignConcurrencyKeys(exec.request, tasks)
+		keys = newKeySemaphore(concurrencyKeyLimit(exec.request))
+	}
+	admitted := true
+	defer func() {
+		if admitted {
+			ws.slots.release()
+		}
+	}()
+
+	// Invalid payloads which are to be skipped are never dispatched
+	pending := make([]models.WebhookExecutionTask, 0, len(tasks))
+	for _, task := range tasks {
+		if message, ok := exec.request.Payloads.InvalidAt(task.Index); ok {
+			resultChan <- models.WebhookExecutionResult{
+				Index:     task.Index,
+				Error:     fmt.Errorf("invalid payload: %s", message),
+				IsInvalid: true,
+			}
+			continue
+		}
+		pending = append(pending, task)
+	}
+
+	// Start goroutines for each task. The next task is the first one whose concurrency key has a
+	// free slot, tasks of saturated keys wait without holding up the others.
+	for len(pending) > 0 {
+		select {
+		case slots <- struct{}{}:
+		case <-dispatchCtx.Done():
+			resultChan <- notDispatched(pending[0].Index, context.Cause(dispatchCtx))
+			pending = pending[1:]
+			continue
+		}
+
+		next, err := keys.acquireNext(dispatchCtx, pending)
+		if err != nil {
+			<-slots
+			resultChan <- notDispatched(pending[0].Index, err)
+			pending = pending[1:]
+			continue
+		}
+		task := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+
+		// A paused execution gives the slot taken on admission back, it is taken again on resume
+		err = ws.waitForDispatch(dispatchCtx, exec, shaper, func() {
+			if admitted {
+				admitted = false
+				ws.slots.release()
+			}
+		})
+		if err != nil {
+			keys.release(task.ConcurrencyKey)
+			<-slots
+			resultChan <- notDispatched(task.Index, err)
+			continue
+		}
+
+		// Paused or paced tasks don't hold a server-wide slot, it is taken right before dispatching
+		if admitted {
+			admitted = false
+		} else if err := ws.slots.acquire(dispatchCtx, flowOf(exec)); err != nil {
+			keys.release(task.ConcurrencyKey)
+			<-slots
+			resultChan <- notDispatched(task.Index, err)
+			continue
+		}
+
+		// Failures may have come in while waiting
+		if abortAfter > 0 && failures.Load() >= abortAfter {
+			ws.slots.release()
+			keys.release(task.ConcurrencyKey)
+			<-slots
+			resultChan <- notDispatched(task.Index, nil)
+			continue
+		}
+
+		exec.dispatched.Add(1)
 		wg.Add(1)
-		go func(taskIndex int, t models.WebhookExecutionTask) {
+		go func(t models.WebhookExecutionTask) {
 			defer wg.Done()
-			result := ws.executeTask(ctx, t)
+			defer func() {
+				ws.slots.release()
+				keys.release(t.ConcurrencyKey)
+				<-slots
+			}()
+			taskCtx, span := startTaskSpan(ctx, exec, t)
+			result := ws.executeTask(taskCtx, exec, t)
+			endTaskSpan(span, exec.request, &result)
+			result.Dispatched = result.DuplicateOf == nil && (!result.IsCircuitOpen || result.Attempts > 1)
+			if !result.Success && result.DuplicateOf == nil && failures.Add(1) == abortAfter {
+				abort(errFailureThreshold)
+			}
+			exec.completed.Add(1)
 			resultChan <- result
-		}(i, task)
+		}(task)
 	}
 
 	// Close channel when all goroutines complete
@@ -132,35 +1283,197 @@ func (ws *WebhookService) executeTasksParallel(ctx context.Context, tasks []mode
 	// Collect results
 	i := 0
 	for result := range resultChan {
+		result.Seq = int(exec.collected.Add(1))
 		results[i] = result
 		i++
+		if exec.stream != nil {
+			exec.stream.publish(toWebhookResult(exec.request, result))
+		}
+		if exec.emit != nil {
+			exec.emit(toWebhookResult(exec.request, result))
+			if exec.request.Compensation == nil {
+				results[i-1].Response = nil
+			}
+		}
 	}
 
-	return results
+	return results, aborted
+}
+
+// waitForDispatch blocks until the next task of the execution may be started, calling pausing
+// before it waits for a paused execution to be resumed
+func (ws *WebhookService) waitForDispatch(ctx context.Context, exec *execution, shaper *rateShaper, pausing func()) error {
+	if err := exec.waitIfPaused(ctx, pausing); err != nil {
+		return err
+	}
+	if shaper != nil {
+		if err := shaper.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return context.Cause(ctx)
 }
 
 // executeTask executes a single webhook task
-func (ws *WebhookService) executeTask(ctx context.Context, task models.WebhookExecutionTask) models.WebhookExecutionResult {
+// Transient failures are retried with exponential backoff, the timeout applies to every attempt.
+// A Retry-After of a 429 or 503 response replaces the backoff, the task fails if it exceeds the
+// time left of the timeout of the task.
+func (ws *WebhookService) executeTask(ctx context.Context, exec *execution, task models.WebhookExecutionTask) models.WebhookExecutionResult {
 	startTime := time.Now()
-	
-	result := models.WebhookExecutionResult{
-		Index: task.Index,
+
+	// Load the payload, spooled payloads are only read from disk when dispatched
+	payloadBytes, err := exec.request.Payloads.Get(task.Index)
+	if err != nil {
+		return models.WebhookExecutionResult{
+			Index:    task.Index,
+			Error:    err,
+			Duration: time.Since(startTime).Milliseconds(),
+		}
+	}
+	// Payloads which can't be converted to the body format fail without being sent
+	payloadBytes, contentType, err := encodeBody(exec.request, payloadBytes)
+	if err != nil {
+		return models.WebhookExecutionResult{
+			Index:     task.Index,
+			Error:     fmt.Errorf("failed to encode payload as %s: %w", exec.request.BodyFormat, err),
+			IsInvalid: true,
+			Duration:  time.Since(startTime).Milliseconds(),
+		}
+	}
+
+	// Items an overlapping execution recently sent to the same target aren't sent again
+	var dedupKey [sha256.Size]byte
+	claim := models.DuplicateRef{ExecutionID: exec.id, Index: task.Index}
+	if !exec.request.AllowDuplicates && ws.dedup != nil {
+		target := exec.request.WebhookURL
+		if len(exec.request.Tasks) > 0 {
+			target = task.WebhookURL
+		}
+		dedupKey = dedupKeyOf(target, payloadBytes)
+		if original, ok := ws.dedup.claim(ctx, dedupKey, claim); !ok {
+			exec.logger.Debug("Skipping duplicate item",
+				"index", task.Index,
+				"duplicate_of", original.ExecutionID,
+				"duplicate_of_index", original.Index)
+			return models.WebhookExecutionResult{
+				Index:        task.Index,
+				DuplicateOf:  original,
+				PayloadBytes: len(payloadBytes),
+				Duration:     time.Since(startTime).Milliseconds(),
+			}
+		}
+	}
+
+	policy := ws.retryPolicy(exec.request)
+	deadline := ws.clock.Now().Add(time.Duration(task.TimeoutSec) * time.Second)
+	var result models.WebhookExecutionResult
+	var durations []int64
+	for attempt := 1; ; attempt++ {
+		result = ws.attemptTask(ctx, exec, task, payloadBytes, contentType)
+		result.Attempts = attempt
+		durations = append(durations, result.Duration)
+
+		if result.Success || !result.Retryable || attempt > policy.maxRetries {
+			break
+		}
+
+		// The delay requested by the target wins over the backoff, unless the backoff is longer.
+		// A retry the target allows only after the timeout, measured from the first attempt, isn't
+		// sent at all, sending it earlier would just be rejected again.
+		delay := policy.backoff(attempt)
+		if result.RetryAfter > 0 {
+			if result.RetryAfter > deadline.Sub(ws.clock.Now()) {
+				result.Error = fmt.Errorf("%w (retry after %s exceeds the timeout)", result.Error, result.RetryAfter.Round(time.Millisecond))
+				break
+			}
+			delay = max(delay, result.RetryAfter)
+		}
+
+		exec.logger.Debug("Retrying webhook request",
+			"index", task.Index,
+			"attempt", attempt,
+			"status_code", result.StatusCode,
+			"delay_ms", delay.Milliseconds(),
+			"error", result.Error)
+		exec.events.addTask(EventTaskRetried, task.Index, result)
+		if err := ws.sleep(ctx, delay); err != nil {
+			break
+		}
+	}
+
+	if len(durations) > 1 {
+		result.AttemptDurations = durations
+		result.Duration = time.Since(startTime).Milliseconds()
+	}
+	result.PayloadBytes = len(payloadBytes)
+	if result.Success {
+		exec.events.addTask(EventTaskSucceeded, task.Index, result)
+	} else {
+		exec.events.addTask(EventTaskFailed, task.Index, result)
+	}
+	if !exec.request.AllowDuplicates {
+		ws.dedup.finish(dedupKey, claim, result.Success)
+	}
+	return result
+}
+
+// attemptTask sends the webhook request of a task once, bounded by the task timeout
+func (ws *WebhookService) attemptTask(ctx context.Context, exec *execution, task models.WebhookExecutionTask, payloadBytes []byte, contentType string) models.WebhookExecutionResult {
+	startTime := time.Now()
+
+	// Calls to a host with an open circuit fail fast instead of waiting for their timeout
+	var host string
+	if target, err := url.Parse(task.WebhookURL); err == nil {
+		host = target.Host
+	}
+	allowed, probe := ws.breakers.allow(host)
+	if !allowed {
+		return models.WebhookExecutionResult{
+			Index:         task.Index,
+			Error:         fmt.Errorf("circuit open for %s", host),
+			IsCircuitOpen: true,
+		}
 	}
 
 	// Create request context with timeout
-	taskCtx, cancel := context.WithTimeout(ctx, time.Duration(task.TimeoutSec)*time.Second)
+	taskCtx, cancel := withClockTimeout(ctx, ws.clock, time.Duration(task.TimeoutSec)*time.Second, context.DeadlineExceeded)
 	defer cancel()
 
-	// Marshal payload to JSON
-	payloadBytes, err := json.Marshal(task.Payload)
-	if err != nil {
-		result.Error = fmt.Errorf("failed to marshal payload: %w", err)
-		result.Duration = time.Since(startTime).Milliseconds()
-		return result
+	result := ws.sendTask(taskCtx, exec, task, payloadBytes, contentType, startTime)
+	defer func() {
+		// Server errors and transient connection failures count against the host, client errors don't.
+		// Calls without a response which won't be retried, e.g. canceled by the caller, are neutral.
+		if result.StatusCode == 0 && !result.Retryable {
+			ws.breakers.release(host, probe)
+			return
+		}
+		ws.breakers.record(host, probe, result.StatusCode >= 500 || result.StatusCode == 0)
+	}()
+
+	// Expired credentials are refreshed once per execution, affected items are retried with the new ones
+	if result.StatusCode == http.StatusUnauthorized {
+		if refresher, ok := exec.credentialsOf(task.Index).(refreshableCredentials); ok {
+			if err := refresher.refresh(taskCtx, ws.client); err != nil {
+				result.Error = fmt.Errorf("%w (credential refresh failed: %v)", result.Error, err)
+				return result
+			}
+
+			exec.logger.Debug("Retrying webhook request with refreshed credentials", "index", task.Index)
+			result = ws.sendTask(taskCtx, exec, task, payloadBytes, contentType, startTime)
+		}
+	}
+
+	return result
+}
+
+// sendTask sends a single webhook request of a task
+func (ws *WebhookService) sendTask(taskCtx context.Context, exec *execution, task models.WebhookExecutionTask, payloadBytes []byte, contentType string, startTime time.Time) models.WebhookExecutionResult {
+	result := models.WebhookExecutionResult{
+		Index: task.Index,
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequestWithContext(taskCtx, "POST", task.WebhookURL, bytes.NewReader(payloadBytes))
+	req, err := ws.newOutboundRequest(taskCtx, "POST", task.WebhookURL, payloadBytes)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to create request: %w", err)
 		result.Duration = time.Since(startTime).Milliseconds()
@@ -168,55 +1481,141 @@ func (ws *WebhookService) executeTask(ctx context.Context, task models.WebhookEx
 	}
 
 	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	if task.AuthHeader != "" {
-		req.Header.Set("Authorization", task.AuthHeader)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept-Encoding", acceptEncoding) // decompressed by decodeResponseBody
+	setCustomHeaders(req.Header, exec, task.Index)
+	req.Header.Set(headerExecutionID, exec.id)
+	req.Header.Set(headerItemIndex, strconv.Itoa(task.Index))
+	if exec.request.ForwardRequestID && exec.requestID != "" {
+		req.Header.Set(HeaderRequestID, exec.requestID)
+	}
+	otel.GetTextMapPropagator().Inject(taskCtx, propagation.HeaderCarrier(req.Header))
+	if creds := exec.credentialsOf(task.Index); creds != nil {
+		if err := creds.apply(taskCtx, req); err != nil {
+			result.Error = fmt.Errorf("failed to authenticate request: %w", err)
+			result.Duration = time.Since(startTime).Milliseconds()
+			return result
+		}
+	}
+	if task.DeadlineHeaders {
+		if deadline, ok := clockDeadline(taskCtx); ok {
+			setDeadlineHeaders(req.Header, deadline, ws.clock.Now(), task.GRPCTimeout)
+		}
 	}
 
-	ws.logger.Debug("Executing webhook request",
+	if err := sanitizeOutboundRequest(req); err != nil {
+		result.Error = err
+		result.Duration = time.Since(startTime).Milliseconds()
+		return result
+	}
+
+	exec.logger.Debug("Executing webhook request",
 		"index", task.Index,
 		"url", task.WebhookURL,
 		"payload_size", len(payloadBytes))
 
 	// Execute request
-	resp, err := ws.client.Do(req)
+	// Record the phases of the request if requested
+	var trace *timingTrace
+	if exec.request.IncludeTimings || exec.request.Analyze {
+		trace = newTimingTrace()
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	}
+
+	resp, err := exec.client.Do(req)
+	if trace != nil {
+		result.Timings = trace.timings()
+	}
 	if err != nil {
 		result.Duration = time.Since(startTime).Milliseconds()
-		if taskCtx.Err() == context.DeadlineExceeded {
+		if cause := context.Cause(taskCtx); errors.Is(cause, ErrBudgetExceeded) {
+			result.Error = fmt.Errorf("request stopped: %w", cause)
+			return result
+		}
+		if timedOut(taskCtx) {
 			result.IsTimeout = true
 			result.Error = fmt.Errorf("request timeout after %d seconds", task.TimeoutSec)
 		} else {
 			result.Error = fmt.Errorf("request failed: %w", err)
 		}
+		// Connection errors and timeouts are transient, unless the execution itself was canceled
+		// or the target is blocked
+		result.Retryable = (taskCtx.Err() == nil || timedOut(taskCtx)) && !errors.Is(err, ErrTargetBlocked)
 		return result
 	}
 	defer resp.Body.Close()
 
 	result.Duration = time.Since(startTime).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	result.ResponseHeaders = selectHeaders(resp.Header, exec.request.ResponseHeaders)
 
 	// Read response body
-	var responseBytes bytes.Buffer
-	_, err = responseBytes.ReadFrom(resp.Body)
+	responseBytes, truncated, err := decodeResponseBody(resp, int64(ws.maxResponseBytes(exec.request)))
 	if err != nil {
 		result.Error = fmt.Errorf("failed to read response body: %w", err)
 		return result
 	}
+	if truncated {
+		result.Truncated = true
+		if exec.request.OversizedResponse == models.OversizedDrop {
+			responseBytes = nil
+		}
+	}
+
+	// A response for another item, e.g. mixed up by a proxy, must not be attributed to this one
+	if exec.request.VerifyItemIndex && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if echoed := resp.Header.Get(headerItemIndex); echoed != strconv.Itoa(task.Index) {
+			result.IsMismatch = true
+			result.Error = fmt.Errorf("response echoed %s %q, expected %d", headerItemIndex, echoed, task.Index)
+			return result
+		}
+	}
 
 	// Check if response is successful (2xx status codes)
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		result.Success = true
-		result.Response = json.RawMessage(responseBytes.Bytes())
-		ws.logger.Debug("Webhook request successful",
+		result.Response = jsonSafe(responseBytes)
+		exec.logger.Debug("Webhook request successful",
 			"index", task.Index,
 			"status_code", resp.StatusCode,
 			"duration_ms", result.Duration)
 	} else {
-		result.Error = fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, responseBytes.String())
-		ws.logger.Debug("Webhook request failed",
+		result.Error = fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, responseBytes)
+		result.Retryable = retryableStatus(resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), ws.clock.Now()); ok {
+				result.RetryAfter = max(delay, time.Millisecond)
+			}
+		}
+		exec.logger.Debug("Webhook request failed",
 			"index", task.Index,
 			"status_code", resp.StatusCode,
 			"duration_ms", result.Duration)
 	}
 
 	return result
-}
\ No newline at end of file
+}
+
+// Headers identifying the item of a webhook call, targets may echo X-Item-Index in their response
+const (
+	headerExecutionID = "X-Execution-ID"
+	headerItemIndex   = "X-Item-Index"
+)
+
+// setDeadlineHeaders tells the target when the request will be abandoned, so it can stop
+// work it cannot finish in time. Request-Timeout is rounded up, a fraction of a second left
+// isn't sent as 0, which targets read as no time or no limit.
+func setDeadlineHeaders(header http.Header, deadline, now time.Time, grpcTimeout bool) {
+	remaining := deadline.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	header.Set("X-Deadline", deadline.UTC().Format(time.RFC3339Nano))
+	header.Set("Request-Timeout", strconv.FormatInt(int64((remaining+time.Second-1)/time.Second), 10))
+
+	if grpcTimeout {
+		// grpc-timeout allows at most 8 digits, milliseconds cover the supported timeout range
+		header.Set("grpc-timeout", strconv.FormatInt(remaining.Milliseconds(), 10)+"m")
+	}
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultServiceName is the service name spans are reported with if none is configured
+const DefaultServiceName = "n8n-parallels"
+
+// Config represents the tracing configuration
+type Config struct {
+	Endpoint    string  `json:"endpoint"`     // OTLP/HTTP endpoint, e.g. "http://collector:4318", empty disables tracing
+	ServiceName string  `json:"service_name"` // service.name of the reported spans
+	SampleRatio float64 `json:"sample_ratio"` // share of traces started here which are recorded, 0 to 1
+}
+
+// Setup installs the global tracer provider exporting spans over OTLP/HTTP. The returned function
+// flushes pending spans and stops the export. Without an endpoint nothing is recorded, but the
+// trace context of incoming requests is still passed on to the webhook calls.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if config.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// Headers, e.g. for authentication, are taken from OTEL_EXPORTER_OTLP_HEADERS by the exporter
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(tracesURL(config.Endpoint)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+		// Traces continued from an incoming request follow the sampling decision of the caller
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// tracesURL appends the traces path to the base endpoint, like the OpenTelemetry SDKs do for
+// OTEL_EXPORTER_OTLP_ENDPOINT
+func tracesURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.JoinPath("v1/traces").String()
+}